@@ -13,7 +13,8 @@ type MetaClient interface {
 	CreateDatabase(name string) (*meta.DatabaseInfo, error)
 	CreateDatabaseWithRetentionPolicy(name string, rpi *meta.RetentionPolicyInfo) (*meta.DatabaseInfo, error)
 	CreateRetentionPolicy(database string, rpi *meta.RetentionPolicyInfo) (*meta.RetentionPolicyInfo, error)
-	CreateSubscription(database, rp, name, mode string, destinations []string) error
+	CreateRollup(database, rp string, ri *meta.RollupInfo) error
+	CreateSubscription(database, rp, name, mode string, destinations []string, condition string) error
 	CreateUser(name, password string, admin bool) (*meta.UserInfo, error)
 	Database(name string) (*meta.DatabaseInfo, error)
 	Databases() ([]meta.DatabaseInfo, error)
@@ -21,6 +22,7 @@ type MetaClient interface {
 	DropContinuousQuery(database, name string) error
 	DropDatabase(name string) error
 	DropRetentionPolicy(database, name string) error
+	DropRollup(database, rp, name string) error
 	DropSubscription(database, rp, name string) error
 	DropUser(name string) error
 	RetentionPolicy(database, name string) (rpi *meta.RetentionPolicyInfo, err error)
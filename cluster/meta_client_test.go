@@ -13,7 +13,8 @@ type MetaClient struct {
 	CreateDatabaseFn                    func(name string) (*meta.DatabaseInfo, error)
 	CreateDatabaseWithRetentionPolicyFn func(name string, rpi *meta.RetentionPolicyInfo) (*meta.DatabaseInfo, error)
 	CreateRetentionPolicyFn             func(database string, rpi *meta.RetentionPolicyInfo) (*meta.RetentionPolicyInfo, error)
-	CreateSubscriptionFn                func(database, rp, name, mode string, destinations []string) error
+	CreateRollupFn                      func(database, rp string, ri *meta.RollupInfo) error
+	CreateSubscriptionFn                func(database, rp, name, mode string, destinations []string, condition string) error
 	CreateUserFn                        func(name, password string, admin bool) (*meta.UserInfo, error)
 	DatabaseFn                          func(name string) (*meta.DatabaseInfo, error)
 	DatabasesFn                         func() ([]meta.DatabaseInfo, error)
@@ -24,6 +25,7 @@ type MetaClient struct {
 	DropContinuousQueryFn               func(database, name string) error
 	DropDatabaseFn                      func(name string) error
 	DropRetentionPolicyFn               func(database, name string) error
+	DropRollupFn                        func(database, rp, name string) error
 	DropSubscriptionFn                  func(database, rp, name string) error
 	DropShardFn                         func(id uint64) error
 	DropUserFn                          func(name string) error
@@ -55,12 +57,21 @@ func (c *MetaClient) CreateDatabaseWithRetentionPolicy(name string, rpi *meta.Re
 func (c *MetaClient) CreateRetentionPolicy(database string, rpi *meta.RetentionPolicyInfo) (*meta.RetentionPolicyInfo, error) {
 	return c.CreateRetentionPolicyFn(database, rpi)
 }
+
+func (c *MetaClient) CreateRollup(database, rp string, ri *meta.RollupInfo) error {
+	return c.CreateRollupFn(database, rp, ri)
+}
+
+func (c *MetaClient) DropRollup(database, rp, name string) error {
+	return c.DropRollupFn(database, rp, name)
+}
+
 func (c *MetaClient) DropShard(id uint64) error {
 	return c.DropShardFn(id)
 }
 
-func (c *MetaClient) CreateSubscription(database, rp, name, mode string, destinations []string) error {
-	return c.CreateSubscriptionFn(database, rp, name, mode, destinations)
+func (c *MetaClient) CreateSubscription(database, rp, name, mode string, destinations []string, condition string) error {
+	return c.CreateSubscriptionFn(database, rp, name, mode, destinations, condition)
 }
 
 func (c *MetaClient) CreateUser(name, password string, admin bool) (*meta.UserInfo, error) {
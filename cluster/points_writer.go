@@ -229,16 +229,29 @@ func (w *PointsWriter) WritePoints(database, retentionPolicy string, consistency
 		w.statMap.Add(statSubWriteDrop, 1)
 	}
 
+	// Points dropped by individual shards are combined into a single
+	// partial write so callers can report every rejected point.
+	var partial *tsdb.PartialWriteError
 	for range shardMappings.Points {
 		select {
 		case <-w.closing:
 			return ErrWriteFailed
 		case err := <-ch:
+			if perr, ok := err.(tsdb.PartialWriteError); ok {
+				if partial != nil {
+					perr = partial.Merge(perr)
+				}
+				partial = &perr
+				continue
+			}
 			if err != nil {
 				return err
 			}
 		}
 	}
+	if partial != nil {
+		return *partial
+	}
 	return nil
 }
 
@@ -250,6 +263,10 @@ func (w *PointsWriter) writeToShard(shard *meta.ShardInfo, database, retentionPo
 	if err == nil {
 		w.statMap.Add(statWriteOK, 1)
 		return nil
+	} else if _, ok := err.(tsdb.PartialWriteError); ok {
+		// The remaining points were written so there is nothing to retry.
+		w.statMap.Add(statWritePartial, 1)
+		return err
 	}
 
 	// If we've written to shard that should exist on the current node, but the store has
@@ -12,6 +12,7 @@ import (
 	"github.com/influxdata/influxdb/cluster"
 	"github.com/influxdata/influxdb/models"
 	"github.com/influxdata/influxdb/services/meta"
+	"github.com/influxdata/influxdb/tsdb"
 )
 
 // TODO(benbjohnson): Rewrite tests to use cluster_test.MetaClient.
@@ -258,6 +259,45 @@ func TestPointsWriter_WritePoints(t *testing.T) {
 	}
 }
 
+// Ensure points dropped by each shard are combined into a single partial write.
+func TestPointsWriter_WritePoints_PartialWrite(t *testing.T) {
+	pr := &cluster.WritePointsRequest{Database: "mydb", RetentionPolicy: "myrp"}
+	pr.AddPoint("cpu", 1.0, time.Unix(0, 0), nil)
+	pr.AddPoint("cpu", 2.0, time.Unix(0, 0).Add(time.Hour), nil)
+	pr.AddPoint("cpu", 3.0, time.Unix(0, 0).Add(time.Hour+time.Second), nil)
+
+	store := &fakeStore{
+		WriteFn: func(shardID uint64, points []models.Point) error {
+			return tsdb.PartialWriteError{
+				Reason:        "field type conflict",
+				Dropped:       1,
+				DroppedPoints: []tsdb.DroppedPoint{{Point: points[0], Reason: "field type conflict"}},
+			}
+		},
+	}
+
+	ms := NewPointsWriterMetaClient()
+	ms.NodeIDFn = func() uint64 { return 1 }
+
+	c := cluster.NewPointsWriter()
+	c.MetaClient = ms
+	c.TSDBStore = store
+	c.Subscriber = Subscriber{PointsFn: func() chan<- *cluster.WritePointsRequest { return nil }}
+	c.Node = &influxdb.Node{ID: 1}
+
+	c.Open()
+	defer c.Close()
+
+	err := c.WritePoints(pr.Database, pr.RetentionPolicy, models.ConsistencyLevelAny, pr.Points)
+	if perr, ok := err.(tsdb.PartialWriteError); !ok {
+		t.Fatalf("unexpected error: %v", err)
+	} else if perr.Dropped != 2 || len(perr.DroppedPoints) != 2 {
+		t.Fatalf("unexpected dropped count: %d", perr.Dropped)
+	} else if perr.Reason != "field type conflict" {
+		t.Fatalf("unexpected reason: %s", perr.Reason)
+	}
+}
+
 var shardID uint64
 
 type fakeShardWriter struct {
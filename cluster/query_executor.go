@@ -10,6 +10,7 @@ import (
 	"log"
 	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/influxdata/influxdb"
@@ -17,6 +18,7 @@ import (
 	"github.com/influxdata/influxdb/models"
 	"github.com/influxdata/influxdb/monitor"
 	"github.com/influxdata/influxdb/services/meta"
+	"github.com/influxdata/influxdb/tsdb"
 )
 
 // A QueryExecutor is responsible for processing a influxql.Query and
@@ -33,6 +35,13 @@ type QueryExecutor struct {
 	// Holds monitoring data for SHOW STATS and SHOW DIAGNOSTICS.
 	Monitor *monitor.Monitor
 
+	// Executes SHOW CONTINUOUS QUERY STATUS and BACKFILL CONTINUOUS QUERY.
+	// Nil if the continuous query service is disabled.
+	ContinuousQuerier interface {
+		ExecuteShowContinuousQueryStatusStatement(stmt *influxql.ShowContinuousQueryStatusStatement) (models.Rows, error)
+		ExecuteBackfillContinuousQueryStatement(stmt *influxql.BackfillContinuousQueryStatement, closing <-chan struct{}) (models.Rows, error)
+	}
+
 	// Used for rewriting points back into system for SELECT INTO statements.
 	PointsWriter *PointsWriter
 
@@ -53,6 +62,10 @@ const (
 	statQueryExecutionDuration = "queryDurationNs" // Total (wall) time spent executing queries
 )
 
+func init() {
+	influxdb.RegisterGauges("queryExecutor", statQueriesActive)
+}
+
 // NewQueryExecutor returns a new instance of QueryExecutor.
 func NewQueryExecutor() *QueryExecutor {
 	return &QueryExecutor{
@@ -123,12 +136,18 @@ func (e *QueryExecutor) executeQuery(query *influxql.Query, database string, chu
 		switch stmt := stmt.(type) {
 		case *influxql.AlterRetentionPolicyStatement:
 			err = e.executeAlterRetentionPolicyStatement(stmt)
+		case *influxql.BackfillContinuousQueryStatement:
+			rows, err = e.executeBackfillContinuousQueryStatement(stmt, closing)
+		case *influxql.CompactShardStatement:
+			rows, err = e.executeCompactShardStatement(stmt)
 		case *influxql.CreateContinuousQueryStatement:
 			err = e.executeCreateContinuousQueryStatement(stmt)
 		case *influxql.CreateDatabaseStatement:
 			err = e.executeCreateDatabaseStatement(stmt)
 		case *influxql.CreateRetentionPolicyStatement:
 			err = e.executeCreateRetentionPolicyStatement(stmt)
+		case *influxql.CreateRollupStatement:
+			err = e.executeCreateRollupStatement(stmt)
 		case *influxql.CreateSubscriptionStatement:
 			err = e.executeCreateSubscriptionStatement(stmt)
 		case *influxql.CreateUserStatement:
@@ -143,6 +162,8 @@ func (e *QueryExecutor) executeQuery(query *influxql.Query, database string, chu
 			err = e.executeDropSeriesStatement(stmt, database)
 		case *influxql.DropRetentionPolicyStatement:
 			err = e.executeDropRetentionPolicyStatement(stmt)
+		case *influxql.DropRollupStatement:
+			err = e.executeDropRollupStatement(stmt)
 		case *influxql.DropServerStatement:
 			err = influxql.ErrInvalidQuery
 		case *influxql.DropShardStatement:
@@ -161,6 +182,8 @@ func (e *QueryExecutor) executeQuery(query *influxql.Query, database string, chu
 			err = e.executeRevokeAdminStatement(stmt)
 		case *influxql.ShowContinuousQueriesStatement:
 			rows, err = e.executeShowContinuousQueriesStatement(stmt)
+		case *influxql.ShowContinuousQueryStatusStatement:
+			rows, err = e.executeShowContinuousQueryStatusStatement(stmt)
 		case *influxql.ShowDatabasesStatement:
 			rows, err = e.executeShowDatabasesStatement(stmt)
 		case *influxql.ShowDiagnosticsStatement:
@@ -169,6 +192,8 @@ func (e *QueryExecutor) executeQuery(query *influxql.Query, database string, chu
 			rows, err = e.executeShowGrantsForUserStatement(stmt)
 		case *influxql.ShowRetentionPoliciesStatement:
 			rows, err = e.executeShowRetentionPoliciesStatement(stmt)
+		case *influxql.ShowRollupsStatement:
+			rows, err = e.executeShowRollupsStatement(stmt)
 		case *influxql.ShowServersStatement:
 			// TODO: corylanou add this back for single node
 			err = influxql.ErrInvalidQuery
@@ -214,8 +239,10 @@ func (e *QueryExecutor) executeQuery(query *influxql.Query, database string, chu
 
 func (e *QueryExecutor) executeAlterRetentionPolicyStatement(stmt *influxql.AlterRetentionPolicyStatement) error {
 	rpu := &meta.RetentionPolicyUpdate{
-		Duration: stmt.Duration,
-		ReplicaN: stmt.Replication,
+		Duration:           stmt.Duration,
+		ShardGroupDuration: stmt.ShardGroupDuration,
+		ReplicaN:           stmt.Replication,
+		ColdAfter:          stmt.ColdAfter,
 	}
 
 	// Update the retention policy.
@@ -253,7 +280,9 @@ func (e *QueryExecutor) executeCreateDatabaseStatement(stmt *influxql.CreateData
 func (e *QueryExecutor) executeCreateRetentionPolicyStatement(stmt *influxql.CreateRetentionPolicyStatement) error {
 	rpi := meta.NewRetentionPolicyInfo(stmt.Name)
 	rpi.Duration = stmt.Duration
+	rpi.ShardGroupDuration = stmt.ShardGroupDuration
 	rpi.ReplicaN = stmt.Replication
+	rpi.ColdAfter = stmt.ColdAfter
 
 	// Create new retention policy.
 	if _, err := e.MetaClient.CreateRetentionPolicy(stmt.Database, rpi); err != nil {
@@ -269,8 +298,30 @@ func (e *QueryExecutor) executeCreateRetentionPolicyStatement(stmt *influxql.Cre
 	return nil
 }
 
+func (e *QueryExecutor) executeCreateRollupStatement(q *influxql.CreateRollupStatement) error {
+	ri := &meta.RollupInfo{
+		Name:     q.Name,
+		Target:   q.Target,
+		Interval: q.Interval,
+	}
+	if q.Measurements != nil {
+		ri.Measurements = q.Measurements.Val.String()
+	}
+	for _, a := range q.Aggregates {
+		ri.Aggregates = append(ri.Aggregates, meta.RollupAggregateInfo{
+			Type:      a.Type.String(),
+			Functions: a.Functions,
+		})
+	}
+	return e.MetaClient.CreateRollup(q.Database, q.RetentionPolicy, ri)
+}
+
 func (e *QueryExecutor) executeCreateSubscriptionStatement(q *influxql.CreateSubscriptionStatement) error {
-	return e.MetaClient.CreateSubscription(q.Database, q.RetentionPolicy, q.Name, q.Mode, q.Destinations)
+	var condition string
+	if q.Condition != nil {
+		condition = q.Condition.String()
+	}
+	return e.MetaClient.CreateSubscription(q.Database, q.RetentionPolicy, q.Name, q.Mode, q.Destinations, condition)
 }
 
 func (e *QueryExecutor) executeCreateUserStatement(q *influxql.CreateUserStatement) error {
@@ -341,6 +392,10 @@ func (e *QueryExecutor) executeDropRetentionPolicyStatement(stmt *influxql.DropR
 	return e.TSDBStore.DeleteRetentionPolicy(stmt.Database, stmt.Name)
 }
 
+func (e *QueryExecutor) executeDropRollupStatement(q *influxql.DropRollupStatement) error {
+	return e.MetaClient.DropRollup(q.Database, q.RetentionPolicy, q.Name)
+}
+
 func (e *QueryExecutor) executeDropSubscriptionStatement(q *influxql.DropSubscriptionStatement) error {
 	return e.MetaClient.DropSubscription(q.Database, q.RetentionPolicy, q.Name)
 }
@@ -521,6 +576,20 @@ func (e *QueryExecutor) iteratorCreator(stmt *influxql.SelectStatement, opt *inf
 	return influxql.IteratorCreators(ics), nil
 }
 
+func (e *QueryExecutor) executeShowContinuousQueryStatusStatement(stmt *influxql.ShowContinuousQueryStatusStatement) (models.Rows, error) {
+	if e.ContinuousQuerier == nil {
+		return nil, ErrContinuousQueriesDisabled
+	}
+	return e.ContinuousQuerier.ExecuteShowContinuousQueryStatusStatement(stmt)
+}
+
+func (e *QueryExecutor) executeBackfillContinuousQueryStatement(stmt *influxql.BackfillContinuousQueryStatement, closing <-chan struct{}) (models.Rows, error) {
+	if e.ContinuousQuerier == nil {
+		return nil, ErrContinuousQueriesDisabled
+	}
+	return e.ContinuousQuerier.ExecuteBackfillContinuousQueryStatement(stmt, closing)
+}
+
 func (e *QueryExecutor) executeShowContinuousQueriesStatement(stmt *influxql.ShowContinuousQueriesStatement) (models.Rows, error) {
 	dis, err := e.MetaClient.Databases()
 	if err != nil {
@@ -605,9 +674,9 @@ func (e *QueryExecutor) executeShowRetentionPoliciesStatement(q *influxql.ShowRe
 		return nil, influxdb.ErrDatabaseNotFound(q.Database)
 	}
 
-	row := &models.Row{Columns: []string{"name", "duration", "replicaN", "default"}}
+	row := &models.Row{Columns: []string{"name", "duration", "shardGroupDuration", "replicaN", "default"}}
 	for _, rpi := range di.RetentionPolicies {
-		row.Values = append(row.Values, []interface{}{rpi.Name, rpi.Duration.String(), rpi.ReplicaN, di.DefaultRetentionPolicy == rpi.Name})
+		row.Values = append(row.Values, []interface{}{rpi.Name, rpi.Duration.String(), rpi.ShardGroupDuration.String(), rpi.ReplicaN, di.DefaultRetentionPolicy == rpi.Name})
 	}
 	return []*models.Row{row}, nil
 }
@@ -620,7 +689,7 @@ func (e *QueryExecutor) executeShowShardsStatement(stmt *influxql.ShowShardsStat
 
 	rows := []*models.Row{}
 	for _, di := range dis {
-		row := &models.Row{Columns: []string{"id", "database", "retention_policy", "shard_group", "start_time", "end_time", "expiry_time", "owners"}, Name: di.Name}
+		row := &models.Row{Columns: []string{"id", "database", "retention_policy", "shard_group", "start_time", "end_time", "expiry_time", "owners", "tier"}, Name: di.Name}
 		for _, rpi := range di.RetentionPolicies {
 			for _, sgi := range rpi.ShardGroups {
 				// Shards associated with deleted shard groups are effectively deleted.
@@ -644,6 +713,7 @@ func (e *QueryExecutor) executeShowShardsStatement(stmt *influxql.ShowShardsStat
 						sgi.EndTime.UTC().Format(time.RFC3339),
 						sgi.EndTime.Add(rpi.Duration).UTC().Format(time.RFC3339),
 						joinUint64(ownerIDs),
+						e.TSDBStore.ShardTier(si.ID),
 					})
 				}
 			}
@@ -653,6 +723,48 @@ func (e *QueryExecutor) executeShowShardsStatement(stmt *influxql.ShowShardsStat
 	return rows, nil
 }
 
+func (e *QueryExecutor) executeCompactShardStatement(stmt *influxql.CompactShardStatement) (models.Rows, error) {
+	ids := []uint64{stmt.ID}
+	if stmt.Database != "" {
+		di, err := e.MetaClient.Database(stmt.Database)
+		if err != nil {
+			return nil, err
+		} else if di == nil {
+			return nil, influxdb.ErrDatabaseNotFound(stmt.Database)
+		} else if stmt.RetentionPolicy != "" && di.RetentionPolicy(stmt.RetentionPolicy) == nil {
+			return nil, influxdb.ErrRetentionPolicyNotFound(stmt.RetentionPolicy)
+		}
+
+		// Only compact the shards stored on this server.
+		ids = nil
+		for _, rpi := range di.RetentionPolicies {
+			if stmt.RetentionPolicy != "" && rpi.Name != stmt.RetentionPolicy {
+				continue
+			}
+			for _, sgi := range rpi.ShardGroups {
+				if sgi.Deleted() {
+					continue
+				}
+				for _, si := range sgi.Shards {
+					if e.TSDBStore.ShardTier(si.ID) != "" {
+						ids = append(ids, si.ID)
+					}
+				}
+			}
+		}
+	}
+
+	row := &models.Row{Columns: []string{"id", "files_before", "size_before", "files_after", "size_after", "duration"}}
+	for _, id := range ids {
+		c, err := e.TSDBStore.CompactShard(id, stmt.Full)
+		if err != nil {
+			return nil, fmt.Errorf("compacting shard %d: %s", id, err)
+		}
+		row.Values = append(row.Values, []interface{}{id, c.FilesBefore, c.SizeBefore, c.FilesAfter, c.SizeAfter, c.Duration.String()})
+	}
+	return []*models.Row{row}, nil
+}
+
 func (e *QueryExecutor) executeShowShardGroupsStatement(stmt *influxql.ShowShardGroupsStatement) (models.Rows, error) {
 	dis, err := e.MetaClient.Databases()
 	if err != nil {
@@ -708,6 +820,31 @@ func (e *QueryExecutor) executeShowStatsStatement(stmt *influxql.ShowStatsStatem
 	return rows, nil
 }
 
+func (e *QueryExecutor) executeShowRollupsStatement(stmt *influxql.ShowRollupsStatement) (models.Rows, error) {
+	dis, err := e.MetaClient.Databases()
+	if err != nil {
+		return nil, err
+	}
+
+	rows := []*models.Row{}
+	for _, di := range dis {
+		row := &models.Row{Columns: []string{"retention_policy", "name", "target", "interval", "measurements", "aggregates", "backfilled"}, Name: di.Name}
+		for _, rpi := range di.RetentionPolicies {
+			for _, ri := range rpi.Rollups {
+				aggregates := make([]string, len(ri.Aggregates))
+				for i, a := range ri.Aggregates {
+					aggregates[i] = fmt.Sprintf("%s(%s)", a.Type, strings.Join(a.Functions, ", "))
+				}
+				row.Values = append(row.Values, []interface{}{rpi.Name, ri.Name, ri.Target, ri.Interval.String(), ri.Measurements, strings.Join(aggregates, ", "), ri.Backfilled})
+			}
+		}
+		if len(row.Values) > 0 {
+			rows = append(rows, row)
+		}
+	}
+	return rows, nil
+}
+
 func (e *QueryExecutor) executeShowSubscriptionsStatement(stmt *influxql.ShowSubscriptionsStatement) (models.Rows, error) {
 	dis, err := e.MetaClient.Databases()
 	if err != nil {
@@ -716,10 +853,10 @@ func (e *QueryExecutor) executeShowSubscriptionsStatement(stmt *influxql.ShowSub
 
 	rows := []*models.Row{}
 	for _, di := range dis {
-		row := &models.Row{Columns: []string{"retention_policy", "name", "mode", "destinations"}, Name: di.Name}
+		row := &models.Row{Columns: []string{"retention_policy", "name", "mode", "destinations", "condition"}, Name: di.Name}
 		for _, rpi := range di.RetentionPolicies {
 			for _, si := range rpi.Subscriptions {
-				row.Values = append(row.Values, []interface{}{rpi.Name, si.Name, si.Mode, si.Destinations})
+				row.Values = append(row.Values, []interface{}{rpi.Name, si.Name, si.Mode, si.Destinations, si.Condition})
 			}
 		}
 		if len(row.Values) > 0 {
@@ -780,6 +917,10 @@ func (e *QueryExecutor) writeInto(stmt *influxql.SelectStatement, row *models.Ro
 
 var errNoDatabaseInTarget = errors.New("no database in target")
 
+// ErrContinuousQueriesDisabled is returned when a statement requires the
+// continuous query service and it is not enabled.
+var ErrContinuousQueriesDisabled = errors.New("continuous query service is disabled")
+
 // convertRowToPoints will convert a query result Row into Points that can be written back in.
 func convertRowToPoints(measurementName string, row *models.Row) ([]models.Point, error) {
 	// figure out which parts of the result are the time and which are the fields
@@ -894,6 +1035,8 @@ type TSDBStore interface {
 	ExecuteShowTagValuesStatement(stmt *influxql.ShowTagValuesStatement, database string) (models.Rows, error)
 	ExpandSources(sources influxql.Sources) (influxql.Sources, error)
 	ShardIteratorCreator(id uint64) influxql.IteratorCreator
+	ShardTier(id uint64) string
+	CompactShard(id uint64, full bool) (tsdb.ShardCompaction, error)
 }
 
 // joinUint64 returns a comma-delimited string of uint64 numbers.
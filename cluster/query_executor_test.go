@@ -14,6 +14,7 @@ import (
 	"github.com/influxdata/influxdb/influxql"
 	"github.com/influxdata/influxdb/models"
 	"github.com/influxdata/influxdb/services/meta"
+	"github.com/influxdata/influxdb/tsdb"
 )
 
 const (
@@ -76,6 +77,31 @@ func TestQueryExecutor_ExecuteQuery_SelectStatement(t *testing.T) {
 	}
 }
 
+// Ensure query executor can compact a shard and report its files.
+func TestQueryExecutor_ExecuteQuery_CompactShardStatement(t *testing.T) {
+	e := DefaultQueryExecutor()
+	e.TSDBStore.CompactShardFn = func(id uint64, full bool) (tsdb.ShardCompaction, error) {
+		if id != 100 || !full {
+			t.Fatalf("unexpected compaction: id=%d full=%v", id, full)
+		}
+		return tsdb.ShardCompaction{FilesBefore: 4, SizeBefore: 4000, FilesAfter: 1, SizeAfter: 3000, Duration: time.Second}, nil
+	}
+
+	if a := ReadAllResults(e.ExecuteQuery(`COMPACT SHARD 100 FULL`, "", 0)); !reflect.DeepEqual(a, []*influxql.Result{
+		{
+			StatementID: 0,
+			Series: []*models.Row{{
+				Columns: []string{"id", "files_before", "size_before", "files_after", "size_after", "duration"},
+				Values: [][]interface{}{
+					{uint64(100), 4, int64(4000), 1, int64(3000), "1s"},
+				},
+			}},
+		},
+	}) {
+		t.Fatalf("unexpected results: %s", spew.Sdump(a))
+	}
+}
+
 // QueryExecutor is a test wrapper for cluster.QueryExecutor.
 type QueryExecutor struct {
 	*cluster.QueryExecutor
@@ -130,6 +156,8 @@ type TSDBStore struct {
 	ExecuteShowTagValuesStatementFn func(stmt *influxql.ShowTagValuesStatement, database string) (models.Rows, error)
 	ExpandSourcesFn                 func(sources influxql.Sources) (influxql.Sources, error)
 	ShardIteratorCreatorFn          func(id uint64) influxql.IteratorCreator
+	ShardTierFn                     func(id uint64) string
+	CompactShardFn                  func(id uint64, full bool) (tsdb.ShardCompaction, error)
 }
 
 func (s *TSDBStore) CreateShard(database, policy string, shardID uint64) error {
@@ -179,6 +207,17 @@ func (s *TSDBStore) ShardIteratorCreator(id uint64) influxql.IteratorCreator {
 	return s.ShardIteratorCreatorFn(id)
 }
 
+func (s *TSDBStore) ShardTier(id uint64) string {
+	if s.ShardTierFn == nil {
+		return ""
+	}
+	return s.ShardTierFn(id)
+}
+
+func (s *TSDBStore) CompactShard(id uint64, full bool) (tsdb.ShardCompaction, error) {
+	return s.CompactShardFn(id, full)
+}
+
 // DefaultTSDBStoreExpandSourcesFn expands a single source using the default database & retention policy.
 func DefaultTSDBStoreExpandSourcesFn(sources influxql.Sources) (influxql.Sources, error) {
 	return influxql.Sources{&influxql.Measurement{
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/influxdata/influxdb/influxql"
+	"github.com/influxdata/influxdb/pkg/escape"
+	"github.com/influxdata/influxdb/services/meta"
+	"github.com/influxdata/influxdb/tsdb"
+	"github.com/influxdata/influxdb/tsdb/engine/tsm1"
+)
+
+type exportOpts struct {
+	dataDir         string
+	coldDir         string
+	walDir          string
+	metaDir         string
+	out             string
+	database        string
+	retentionPolicy string
+	startTime       int64
+	endTime         int64
+	compress        bool
+	keyring         *tsdb.Keyring
+}
+
+// exportShard is a shard found in the data, cold or WAL directory.
+type exportShard struct {
+	database        string
+	retentionPolicy string
+	id              string
+}
+
+func cmdExport(opts *exportOpts) {
+	start := time.Now()
+
+	shards, err := findExportShards(opts)
+	if err != nil {
+		fmt.Printf("Failed to read shards: %v\n", err)
+		os.Exit(1)
+	}
+
+	f, err := os.Create(opts.out)
+	if err != nil {
+		fmt.Printf("Failed to create output file: %v\n", err)
+		os.Exit(1)
+	}
+	defer f.Close()
+
+	var w io.Writer = f
+	if opts.compress {
+		gw := gzip.NewWriter(f)
+		defer gw.Close()
+		w = gw
+	}
+	bw := bufio.NewWriter(w)
+	defer bw.Flush()
+
+	if err := writeDDL(bw, opts, shards); err != nil {
+		fmt.Printf("Failed to write DDL: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Fprintln(bw, "# DML")
+	var n int
+	var database, retentionPolicy string
+	for _, sh := range shards {
+		if sh.database != database || sh.retentionPolicy != retentionPolicy {
+			database, retentionPolicy = sh.database, sh.retentionPolicy
+			fmt.Fprintf(bw, "# CONTEXT-DATABASE:%s\n", database)
+			fmt.Fprintf(bw, "# CONTEXT-RETENTION-POLICY:%s\n", retentionPolicy)
+		}
+
+		written, err := exportShardData(bw, opts, sh)
+		n += written
+		if err != nil {
+			fmt.Printf("Failed to export shard %s: %v\n", sh.id, err)
+			os.Exit(1)
+		}
+	}
+
+	if err := bw.Flush(); err != nil {
+		fmt.Printf("Failed to write output: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Exported %d points from %d shards to %s in %v\n", n, len(shards), opts.out, time.Since(start))
+}
+
+// findExportShards returns every shard in the data, cold and WAL directories
+// that matches the database and retention policy filters, sorted by database,
+// retention policy and shard ID.
+func findExportShards(opts *exportOpts) ([]exportShard, error) {
+	found := make(map[exportShard]struct{})
+	for _, dir := range []string{opts.dataDir, opts.coldDir, opts.walDir} {
+		if dir == "" {
+			continue
+		}
+
+		paths, err := filepath.Glob(filepath.Join(dir, "*", "*", "*"))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, path := range paths {
+			if fi, err := os.Stat(path); err != nil {
+				return nil, err
+			} else if !fi.IsDir() {
+				continue
+			}
+
+			rpDir, id := filepath.Split(path)
+			dbDir, rp := filepath.Split(filepath.Clean(rpDir))
+			db := filepath.Base(dbDir)
+			if (opts.database != "" && db != opts.database) || (opts.retentionPolicy != "" && rp != opts.retentionPolicy) {
+				continue
+			} else if _, err := strconv.ParseUint(id, 10, 64); err != nil {
+				continue
+			}
+			found[exportShard{database: db, retentionPolicy: rp, id: id}] = struct{}{}
+		}
+	}
+
+	shards := make([]exportShard, 0, len(found))
+	for sh := range found {
+		shards = append(shards, sh)
+	}
+	sort.Sort(exportShards(shards))
+	return shards, nil
+}
+
+// writeDDL writes the statements that create the exported databases and
+// retention policies. Retention policies are created with the settings in
+// the meta store if it is available and with an infinite duration otherwise.
+func writeDDL(w io.Writer, opts *exportOpts, shards []exportShard) error {
+	var data *meta.Data
+	if buf, err := ioutil.ReadFile(filepath.Join(opts.metaDir, "meta.db")); err == nil {
+		data = &meta.Data{}
+		if err := data.UnmarshalBinary(buf); err != nil {
+			return fmt.Errorf("read meta store: %s", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	fmt.Fprintln(w, "# DDL")
+	created := make(map[string]bool)
+	for _, sh := range shards {
+		if !created[sh.database] {
+			created[sh.database] = true
+			stmt := &influxql.CreateDatabaseStatement{Name: sh.database, IfNotExists: true}
+			fmt.Fprintln(w, stmt.String())
+		}
+
+		if id := sh.database + "." + sh.retentionPolicy; !created[id] {
+			created[id] = true
+			stmt := &influxql.CreateRetentionPolicyStatement{Name: sh.retentionPolicy, Database: sh.database, Replication: 1}
+			if data != nil {
+				if rpi, _ := data.RetentionPolicy(sh.database, sh.retentionPolicy); rpi != nil {
+					stmt.Duration = rpi.Duration
+					stmt.Replication = rpi.ReplicaN
+					stmt.ShardGroupDuration = rpi.ShardGroupDuration
+					stmt.ColdAfter = rpi.ColdAfter
+				}
+			}
+			fmt.Fprintln(w, stmt.String())
+		}
+	}
+	fmt.Fprintln(w)
+	return nil
+}
+
+// exportShardData writes the values in the TSM files of a shard, followed by
+// the values in its WAL segments, as line protocol. The TSM files are read
+// from the data directory and, for shards moved to cold storage, the cold
+// directory. Returns the number of values written.
+func exportShardData(w io.Writer, opts *exportOpts, sh exportShard) (int, error) {
+	var n int
+	var files []string
+	for _, dir := range []string{opts.dataDir, opts.coldDir} {
+		if dir == "" {
+			continue
+		}
+
+		paths, err := filepath.Glob(filepath.Join(dir, sh.database, sh.retentionPolicy, sh.id, "*."+tsm1.TSMFileExtension))
+		if err != nil {
+			return n, err
+		}
+		sort.Strings(paths)
+		files = append(files, paths...)
+	}
+
+	for _, path := range files {
+		written, err := exportTSMFile(w, opts, path)
+		n += written
+		if err != nil {
+			return n, fmt.Errorf("%s: %s", path, err)
+		}
+	}
+
+	segments, err := filepath.Glob(filepath.Join(opts.walDir, sh.database, sh.retentionPolicy, sh.id, tsm1.WALFilePrefix+"*."+tsm1.WALFileExtension))
+	if err != nil {
+		return n, err
+	}
+	sort.Strings(segments)
+
+	// Deletes in the WAL only apply to the values written before them, so
+	// replay the segments in order before writing anything.
+	values := make(map[string][]tsm1.Value)
+	for _, path := range segments {
+		if err := readWALSegment(path, opts.keyring, values); err != nil {
+			return n, fmt.Errorf("%s: %s", path, err)
+		}
+	}
+
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		written, err := writeValues(w, opts, k, values[k])
+		n += written
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// exportTSMFile writes every value in a TSM file as line protocol. Keys
+// deleted by the file's tombstones are skipped.
+func exportTSMFile(w io.Writer, opts *exportOpts, path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	r, err := tsm1.NewTSMReaderWithOptions(tsm1.TSMReaderOptions{MMAPFile: f, Keyring: opts.keyring})
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+
+	if min, max := r.TimeRange(); min > opts.endTime || max < opts.startTime {
+		return 0, nil
+	}
+
+	var n int
+	for i := 0; i < r.KeyCount(); i++ {
+		key := r.KeyAt(i)
+		values, err := r.ReadAll(key)
+		if err != nil {
+			return n, fmt.Errorf("read %s: %s", key, err)
+		}
+
+		written, err := writeValues(w, opts, key, values)
+		n += written
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// readWALSegment applies the writes and deletes in a WAL segment to values.
+// Encrypted entries are decrypted with the keys in keyring.
+func readWALSegment(path string, keyring *tsdb.Keyring, values map[string][]tsm1.Value) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	r := tsm1.NewWALSegmentReader(f)
+	r.Keyring = keyring
+	defer r.Close()
+
+	for r.Next() {
+		entry, err := r.Read()
+		if err != nil {
+			// Like the engine, ignore everything after a corrupt entry, which
+			// is usually a partial write from a crash.
+			fmt.Printf("Segment %s corrupt at position %d, skipping remainder: %v\n", path, r.Count(), err)
+			break
+		}
+
+		switch t := entry.(type) {
+		case *tsm1.WriteWALEntry:
+			for k, v := range t.Values {
+				values[k] = append(values[k], v...)
+			}
+		case *tsm1.DeleteWALEntry:
+			for _, k := range t.Keys {
+				delete(values, k)
+			}
+		}
+	}
+	return nil
+}
+
+// writeValues writes the values of a composite key within the exported time
+// range as line protocol. Returns the number of values written.
+func writeValues(w io.Writer, opts *exportOpts, key string, values []tsm1.Value) (int, error) {
+	seriesKey, field := tsm1.SeriesAndFieldFromCompositeKey(key)
+	prefix := seriesKey + " " + escape.String(field) + "="
+
+	var n int
+	for _, v := range values {
+		ts := v.UnixNano()
+		if ts < opts.startTime || ts > opts.endTime {
+			continue
+		}
+
+		var s string
+		switch value := v.Value().(type) {
+		case float64:
+			s = strconv.FormatFloat(value, 'g', -1, 64)
+		case int64:
+			s = strconv.FormatInt(value, 10) + "i"
+		case bool:
+			s = strconv.FormatBool(value)
+		case string:
+			s = `"` + stringFieldReplacer.Replace(value) + `"`
+		default:
+			return n, fmt.Errorf("%s: unsupported value type %T", key, value)
+		}
+
+		if _, err := fmt.Fprintf(w, "%s%s %d\n", prefix, s, ts); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// stringFieldReplacer escapes string field values for line protocol.
+var stringFieldReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+type exportShards []exportShard
+
+func (a exportShards) Len() int      { return len(a) }
+func (a exportShards) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a exportShards) Less(i, j int) bool {
+	if a[i].database != a[j].database {
+		return a[i].database < a[j].database
+	} else if a[i].retentionPolicy != a[j].retentionPolicy {
+		return a[i].retentionPolicy < a[j].retentionPolicy
+	}
+	x, _ := strconv.ParseUint(a[i].id, 10, 64)
+	y, _ := strconv.ParseUint(a[j].id, 10, 64)
+	return x < y
+}
+
+// parseExportTime parses an RFC3339 time flag, returning def if s is empty.
+func parseExportTime(s string, def int64) (int64, error) {
+	if s == "" {
+		return def, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return 0, err
+	}
+	return t.UnixNano(), nil
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/influxdata/influxdb/services/meta"
+	"github.com/influxdata/influxdb/tsdb/engine/tsm1"
+)
+
+// Ensure values are written as escaped line protocol within the time range.
+func TestWriteValues(t *testing.T) {
+	opts := &exportOpts{startTime: 1, endTime: 3}
+	values := []tsm1.Value{
+		tsm1.NewValue(0, `skipped`),
+		tsm1.NewValue(1, `a "quoted" \ value`),
+		tsm1.NewValue(2, `b`),
+		tsm1.NewValue(4, `skipped`),
+	}
+
+	var buf bytes.Buffer
+	n, err := writeValues(&buf, opts, tsm1.SeriesFieldKey(`cpu,host=a\ b`, "field name"), values)
+	if err != nil {
+		t.Fatal(err)
+	} else if n != 2 {
+		t.Fatalf("unexpected values written: %d", n)
+	}
+
+	exp := `cpu,host=a\ b field\ name="a \"quoted\" \\ value" 1` + "\n" +
+		`cpu,host=a\ b field\ name="b" 2` + "\n"
+	if got := buf.String(); got != exp {
+		t.Fatalf("unexpected output:\n\nexp=%s\ngot=%s", exp, got)
+	}
+}
+
+// Ensure each value type is written in its line protocol format.
+func TestWriteValues_Types(t *testing.T) {
+	opts := &exportOpts{startTime: math.MinInt64, endTime: math.MaxInt64}
+	for _, tt := range []struct {
+		value tsm1.Value
+		exp   string
+	}{
+		{value: tsm1.NewValue(1, 1.5), exp: "cpu value=1.5 1\n"},
+		{value: tsm1.NewValue(1, int64(-2)), exp: "cpu value=-2i 1\n"},
+		{value: tsm1.NewValue(1, true), exp: "cpu value=true 1\n"},
+	} {
+		var buf bytes.Buffer
+		if _, err := writeValues(&buf, opts, tsm1.SeriesFieldKey("cpu", "value"), []tsm1.Value{tt.value}); err != nil {
+			t.Fatal(err)
+		} else if got := buf.String(); got != tt.exp {
+			t.Fatalf("unexpected output: exp=%q got=%q", tt.exp, got)
+		}
+	}
+}
+
+// Ensure the DDL uses the retention policy settings from the meta store.
+func TestWriteDDL(t *testing.T) {
+	dir := MustTempDir()
+	defer os.RemoveAll(dir)
+
+	data := &meta.Data{}
+	if err := data.CreateDatabase("db0"); err != nil {
+		t.Fatal(err)
+	} else if err := data.CreateRetentionPolicy("db0", &meta.RetentionPolicyInfo{
+		Name:               "rp0",
+		ReplicaN:           2,
+		Duration:           7 * 24 * time.Hour,
+		ShardGroupDuration: 24 * time.Hour,
+		ColdAfter:          48 * time.Hour,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	buf, err := data.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	} else if err := ioutil.WriteFile(filepath.Join(dir, "meta.db"), buf, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	shards := []exportShard{
+		{database: "db0", retentionPolicy: "rp0", id: "1"},
+		{database: "db0", retentionPolicy: "rp0", id: "2"},
+		{database: "db0", retentionPolicy: "rp1", id: "3"},
+	}
+
+	var out bytes.Buffer
+	if err := writeDDL(&out, &exportOpts{metaDir: dir}, shards); err != nil {
+		t.Fatal(err)
+	}
+
+	exp := "# DDL\n" +
+		"CREATE DATABASE IF NOT EXISTS db0\n" +
+		"CREATE RETENTION POLICY rp0 ON db0 DURATION 1w REPLICATION 2 SHARD DURATION 1d COLD AFTER 2d\n" +
+		"CREATE RETENTION POLICY rp1 ON db0 DURATION 0s REPLICATION 1\n" +
+		"\n"
+	if got := out.String(); got != exp {
+		t.Fatalf("unexpected DDL:\n\nexp=%s\ngot=%s", exp, got)
+	}
+}
+
+// Ensure deletes in a WAL segment only remove the values written before them.
+func TestReadWALSegment_Delete(t *testing.T) {
+	dir := MustTempDir()
+	defer os.RemoveAll(dir)
+
+	path := MustWriteWALSegment(filepath.Join(dir, "_00001.wal"),
+		&tsm1.WriteWALEntry{Values: map[string][]tsm1.Value{
+			"cpu#!~#value": {tsm1.NewValue(1, 1.0)},
+			"mem#!~#value": {tsm1.NewValue(1, 2.0)},
+		}},
+		&tsm1.DeleteWALEntry{Keys: []string{"cpu#!~#value"}},
+		&tsm1.WriteWALEntry{Values: map[string][]tsm1.Value{
+			"cpu#!~#value": {tsm1.NewValue(2, 3.0)},
+		}},
+	)
+
+	values := make(map[string][]tsm1.Value)
+	if err := readWALSegment(path, nil, values); err != nil {
+		t.Fatal(err)
+	}
+
+	exp := map[string][]tsm1.Value{
+		"cpu#!~#value": {tsm1.NewValue(2, 3.0)},
+		"mem#!~#value": {tsm1.NewValue(1, 2.0)},
+	}
+	if !reflect.DeepEqual(values, exp) {
+		t.Fatalf("unexpected values: %v", values)
+	}
+}
+
+// Ensure shards are exported from the data, cold and WAL directories.
+func TestExportShardData(t *testing.T) {
+	dir := MustTempDir()
+	defer os.RemoveAll(dir)
+
+	opts := &exportOpts{
+		dataDir:   filepath.Join(dir, "data"),
+		coldDir:   filepath.Join(dir, "cold"),
+		walDir:    filepath.Join(dir, "wal"),
+		startTime: 2,
+		endTime:   math.MaxInt64,
+	}
+
+	// Shard 1 is in the data directory and shard 2 has been moved to cold
+	// storage. Both have a WAL segment.
+	MustWriteTSM(filepath.Join(opts.dataDir, "db0", "rp0", "1", "000000001-000000001.tsm"), map[string][]tsm1.Value{
+		"cpu,host=a#!~#value": {tsm1.NewValue(1, 1.0), tsm1.NewValue(2, 2.0)},
+	})
+	MustWriteWALSegment(filepath.Join(opts.walDir, "db0", "rp0", "1", "_00001.wal"),
+		&tsm1.WriteWALEntry{Values: map[string][]tsm1.Value{"cpu,host=b#!~#value": {tsm1.NewValue(3, 3.0)}}},
+	)
+	MustWriteTSM(filepath.Join(opts.coldDir, "db0", "rp0", "2", "000000001-000000001.tsm"), map[string][]tsm1.Value{
+		"mem,host=a#!~#free": {tsm1.NewValue(4, int64(4))},
+	})
+	MustWriteWALSegment(filepath.Join(opts.walDir, "db0", "rp0", "2", "_00001.wal"),
+		&tsm1.WriteWALEntry{Values: map[string][]tsm1.Value{"mem,host=b#!~#free": {tsm1.NewValue(5, int64(5))}}},
+	)
+
+	// Directories that are not shards are ignored.
+	if err := os.MkdirAll(filepath.Join(opts.dataDir, "db0", "rp0", "tmp"), 0777); err != nil {
+		t.Fatal(err)
+	}
+
+	shards, err := findExportShards(opts)
+	if err != nil {
+		t.Fatal(err)
+	} else if exp := []exportShard{
+		{database: "db0", retentionPolicy: "rp0", id: "1"},
+		{database: "db0", retentionPolicy: "rp0", id: "2"},
+	}; !reflect.DeepEqual(shards, exp) {
+		t.Fatalf("unexpected shards: %v", shards)
+	}
+
+	var buf bytes.Buffer
+	for _, sh := range shards {
+		if _, err := exportShardData(&buf, opts, sh); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	exp := "cpu,host=a value=2 2\n" +
+		"cpu,host=b value=3 3\n" +
+		"mem,host=a free=4i 4\n" +
+		"mem,host=b free=5i 5\n"
+	if got := buf.String(); got != exp {
+		t.Fatalf("unexpected output:\n\nexp=%s\ngot=%s", exp, got)
+	}
+}
+
+// MustTempDir returns a new temporary directory. Panic on error.
+func MustTempDir() string {
+	dir, err := ioutil.TempDir("", "influx-inspect-test")
+	if err != nil {
+		panic(err)
+	}
+	return dir
+}
+
+// MustWriteTSM writes a TSM file containing values to path. Panic on error.
+func MustWriteTSM(path string, values map[string][]tsm1.Value) {
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		panic(err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+
+	w, err := tsm1.NewTSMWriter(f)
+	if err != nil {
+		panic(err)
+	}
+	for k, v := range values {
+		if err := w.Write(k, v); err != nil {
+			panic(err)
+		}
+	}
+	if err := w.WriteIndex(); err != nil {
+		panic(err)
+	} else if err := w.Close(); err != nil {
+		panic(err)
+	}
+}
+
+// MustWriteWALSegment writes a WAL segment containing entries to path and
+// returns the path. Panic on error.
+func MustWriteWALSegment(path string, entries ...tsm1.WALEntry) string {
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		panic(err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+
+	w := tsm1.NewWALSegmentWriter(f)
+	for _, entry := range entries {
+		b, err := entry.MarshalBinary()
+		if err != nil {
+			panic(err)
+		}
+		if err := w.Write(entry.Type(), snappy.Encode(nil, b)); err != nil {
+			panic(err)
+		}
+	}
+	return path
+}
@@ -3,9 +3,12 @@ package main
 import (
 	"flag"
 	"fmt"
+	"math"
 	"os"
 
+	"github.com/influxdata/influxdb/tsdb"
 	_ "github.com/influxdata/influxdb/tsdb/engine"
+	_ "github.com/influxdata/influxdb/tsdb/index"
 )
 
 func usage() {
@@ -17,10 +20,29 @@ Displays detailed information about InfluxDB data files.
 	println(`Commands:
   info - displays series meta-data for all shards.  Default location [$HOME/.influxdb]
   dumptsm - dumps low-level details about tsm1 files.
-  dumptsmdev - dumps low-level details about tsm1dev files.`)
+  dumptsmdev - dumps low-level details about tsm1dev files.
+  report - displays series and disk usage per measurement for all shards.  Default location [$HOME/.influxdb]
+  export - exports raw data as line protocol for use with influx -import.
+  verify - verifies the integrity of all tsm1 files.  Default location [$HOME/.influxdb]
+  repair - rewrites corrupt tsm1 files without their corrupt blocks. The server must be stopped.`)
 	println()
 }
 
+// loadKeyring loads the encryption keys used to read encrypted files from
+// path. Returns nil if path is blank.
+func loadKeyring(path string) *tsdb.Keyring {
+	if path == "" {
+		return nil
+	}
+
+	keyring, err := tsdb.LoadKeyring(path)
+	if err != nil {
+		fmt.Printf("Failed to load key file: %v\n", err)
+		os.Exit(1)
+	}
+	return keyring
+}
+
 func main() {
 
 	flag.Usage = usage
@@ -113,6 +135,106 @@ func main() {
 		opts.dumpBlocks = opts.dumpBlocks || dumpAll || opts.filterKey != ""
 		opts.dumpIndex = opts.dumpIndex || dumpAll || opts.filterKey != ""
 		cmdDumpTsm1dev(opts)
+	case "report":
+		var keyFile string
+		opts := &reportOpts{}
+		fs := flag.NewFlagSet("report", flag.ExitOnError)
+		fs.StringVar(&opts.dir, "dir", os.Getenv("HOME")+"/.influxdb", "Root storage path. [$HOME/.influxdb]")
+		fs.StringVar(&opts.coldDir, "colddir", "", "Cold storage path, if shards are moved to cold storage")
+		fs.BoolVar(&opts.exact, "exact", false, "Count series and tag values exactly instead of estimating them. Uses more memory")
+		fs.StringVar(&keyFile, "keyfile", "", "Key file used to read encrypted files")
+
+		fs.Usage = func() {
+			println("Usage: influx_inspect report [options]\n\n   Displays series counts, tag value counts, disk usage and block encodings\n   per measurement for all shards.")
+			println()
+			println("Options:")
+			fs.PrintDefaults()
+		}
+
+		if err := fs.Parse(flag.Args()[1:]); err != nil {
+			fmt.Printf("%v", err)
+			os.Exit(1)
+		}
+		opts.keyring = loadKeyring(keyFile)
+		cmdReport(opts)
+	case "export":
+		var start, end, keyFile string
+		opts := &exportOpts{}
+		fs := flag.NewFlagSet("export", flag.ExitOnError)
+		fs.StringVar(&opts.dataDir, "datadir", os.Getenv("HOME")+"/.influxdb/data", "Data storage path. [$HOME/.influxdb/data]")
+		fs.StringVar(&opts.coldDir, "colddir", "", "Cold storage path, if shards are moved to cold storage")
+		fs.StringVar(&opts.walDir, "waldir", os.Getenv("HOME")+"/.influxdb/wal", "WAL storage path. [$HOME/.influxdb/wal]")
+		fs.StringVar(&opts.metaDir, "metadir", os.Getenv("HOME")+"/.influxdb/meta", "Meta storage path, used to export retention policy settings. [$HOME/.influxdb/meta]")
+		fs.StringVar(&opts.out, "out", os.Getenv("HOME")+"/.influxdb/export", "Destination file. [$HOME/.influxdb/export]")
+		fs.StringVar(&opts.database, "database", "", "Only export this database")
+		fs.StringVar(&opts.retentionPolicy, "retention", "", "Only export this retention policy")
+		fs.StringVar(&start, "start", "", "Only export data at or after this RFC3339 time")
+		fs.StringVar(&end, "end", "", "Only export data at or before this RFC3339 time")
+		fs.BoolVar(&opts.compress, "compress", false, "Compress the output with gzip")
+		fs.StringVar(&keyFile, "keyfile", "", "Key file used to read encrypted files")
+
+		fs.Usage = func() {
+			println("Usage: influx_inspect export [options]\n\n   Exports TSM files and WAL segments as line protocol for use with influx -import.")
+			println()
+			println("Options:")
+			fs.PrintDefaults()
+		}
+
+		if err := fs.Parse(flag.Args()[1:]); err != nil {
+			fmt.Printf("%v", err)
+			os.Exit(1)
+		}
+
+		var err error
+		if opts.startTime, err = parseExportTime(start, math.MinInt64); err != nil {
+			fmt.Printf("invalid start time: %v\n", err)
+			os.Exit(1)
+		} else if opts.endTime, err = parseExportTime(end, math.MaxInt64); err != nil {
+			fmt.Printf("invalid end time: %v\n", err)
+			os.Exit(1)
+		}
+		opts.keyring = loadKeyring(keyFile)
+		cmdExport(opts)
+	case "verify":
+		var path, keyFile string
+		fs := flag.NewFlagSet("verify", flag.ExitOnError)
+		fs.StringVar(&path, "dir", os.Getenv("HOME")+"/.influxdb", "Root storage path. [$HOME/.influxdb]")
+		fs.StringVar(&keyFile, "keyfile", "", "Key file used to read encrypted files")
+
+		fs.Usage = func() {
+			println("Usage: influx_inspect verify [options]\n\n   Verifies the checksums, index and tombstones of all tsm1 files.\n   Exits with a non-zero status if any file is corrupt.")
+			println()
+			println("Options:")
+			fs.PrintDefaults()
+		}
+
+		if err := fs.Parse(flag.Args()[1:]); err != nil {
+			fmt.Printf("%v", err)
+			os.Exit(1)
+		}
+		cmdVerify(path, loadKeyring(keyFile))
+	case "repair":
+		var keyFile string
+		fs := flag.NewFlagSet("repair", flag.ExitOnError)
+		fs.StringVar(&keyFile, "keyfile", "", "Key file used to read and write encrypted files")
+		fs.Usage = func() {
+			println("Usage: influx_inspect repair [options] <path>\n\n   Rewrites corrupt tsm1 files at path, a file or directory, without their corrupt blocks\n   and reports the series and time ranges lost. Originals are kept with a .quarantine\n   extension. The server must be stopped.")
+			println()
+			println("Options:")
+			fs.PrintDefaults()
+		}
+
+		if err := fs.Parse(flag.Args()[1:]); err != nil {
+			fmt.Printf("%v", err)
+			os.Exit(1)
+		}
+
+		if len(fs.Args()) == 0 || fs.Args()[0] == "" {
+			fmt.Printf("Path not specified\n\n")
+			fs.Usage()
+			os.Exit(1)
+		}
+		cmdRepair(fs.Args()[0], loadKeyring(keyFile))
 	default:
 		flag.Usage()
 		os.Exit(1)
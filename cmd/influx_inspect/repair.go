@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/influxdata/influxdb/tsdb"
+	"github.com/influxdata/influxdb/tsdb/engine/tsm1"
+)
+
+func cmdRepair(path string, keyring *tsdb.Keyring) {
+	tw := tabwriter.NewWriter(os.Stdout, 16, 8, 0, '\t', 0)
+	fmt.Fprintln(tw, strings.Join([]string{"File", "Key", "Time Range", "Problem"}, "\t"))
+
+	var files, repaired, failed int
+	err := filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		} else if info.IsDir() || !strings.HasSuffix(path, "."+tsm1.TSMFileExtension) {
+			return nil
+		}
+		files++
+
+		lost, err := tsm1.RepairTSMFile(path, keyring)
+		if err != nil {
+			fmt.Fprintf(tw, "%s\t-\t-\t%s\n", path, err)
+			failed++
+			return nil
+		} else if len(lost) == 0 {
+			return nil
+		}
+
+		repaired++
+		for _, e := range lost {
+			key, timeRange := e.Key, "-"
+			if key == "" {
+				key = "-"
+			}
+			if e.Size > 0 {
+				timeRange = fmt.Sprintf("%s - %s",
+					time.Unix(0, e.MinTime).UTC().Format(time.RFC3339Nano),
+					time.Unix(0, e.MaxTime).UTC().Format(time.RFC3339Nano))
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", path, key, timeRange, e.Err)
+		}
+		return nil
+	})
+	tw.Flush()
+	if err != nil {
+		fmt.Printf("Failed to walk dir: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("\nFiles: %d, Repaired: %d, Failed: %d\n", files, repaired, failed)
+	if repaired > 0 {
+		fmt.Printf("Originals of repaired files were kept with a .%s extension.\n", tsm1.QuarantineExtension)
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/influxdata/influxdb/models"
+	"github.com/influxdata/influxdb/pkg/hll"
+	"github.com/influxdata/influxdb/tsdb"
+	"github.com/influxdata/influxdb/tsdb/engine/tsm1"
+)
+
+type reportOpts struct {
+	dir     string
+	coldDir string
+	exact   bool
+	keyring *tsdb.Keyring
+}
+
+// counter counts distinct values, either exactly or as an estimate.
+type counter interface {
+	Add(v []byte)
+	Count() uint64
+}
+
+// exactCounter counts distinct values using a set.
+type exactCounter map[string]struct{}
+
+func (c exactCounter) Add(v []byte)  { c[string(v)] = struct{}{} }
+func (c exactCounter) Count() uint64 { return uint64(len(c)) }
+
+// sparseCounterMax is the number of distinct values an estimateCounter
+// stores exactly before switching to a sketch.
+const sparseCounterMax = 256
+
+// estimateCounter counts distinct values exactly until there are more than
+// sparseCounterMax of them and estimates the count with a sketch after that.
+// Most tag keys have few values, so this avoids allocating a full sketch for
+// every tag key of every measurement in every shard.
+type estimateCounter struct {
+	values exactCounter
+	sketch *hll.Sketch
+}
+
+func newEstimateCounter() *estimateCounter {
+	return &estimateCounter{values: make(exactCounter)}
+}
+
+func (c *estimateCounter) Add(v []byte) {
+	if c.sketch != nil {
+		c.sketch.Add(v)
+		return
+	}
+
+	c.values.Add(v)
+	if len(c.values) > sparseCounterMax {
+		c.sketch = hll.MustNewSketch(hll.DefaultPrecision)
+		for k := range c.values {
+			c.sketch.Add([]byte(k))
+		}
+		c.values = nil
+	}
+}
+
+func (c *estimateCounter) Count() uint64 {
+	if c.sketch != nil {
+		return c.sketch.Count()
+	}
+	return c.values.Count()
+}
+
+// measurementReport holds the statistics of a measurement in a single shard.
+type measurementReport struct {
+	series    counter
+	tagValues map[string]counter
+	size      int64
+	blocks    int64
+	encodings map[string]int
+}
+
+func cmdReport(opts *reportOpts) {
+	start := time.Now()
+
+	newCounter := func() counter {
+		if opts.exact {
+			return make(exactCounter)
+		}
+		return newEstimateCounter()
+	}
+
+	shardDirs, err := findReportShards(opts)
+	if err != nil {
+		fmt.Printf("Failed to read shards: %v\n", err)
+		os.Exit(1)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 8, 8, 1, '\t', 0)
+	fmt.Fprintln(tw, strings.Join([]string{"DB", "RP", "Shard", "Measurement", "Series", "Tag Values [Key:#]", "Size", "Blocks", "Encoding [T/V:#]"}, "\t"))
+
+	total := newCounter()
+	var totalSize int64
+	for _, dir := range shardDirs {
+		rpDir, id := filepath.Split(dir)
+		dbDir, rp := filepath.Split(filepath.Clean(rpDir))
+		db := filepath.Base(dbDir)
+
+		files, err := filepath.Glob(filepath.Join(dir, "*."+tsm1.TSMFileExtension))
+		if err != nil {
+			fmt.Printf("Failed to read shard %s: %v\n", id, err)
+			os.Exit(1)
+		}
+
+		measurements := make(map[string]*measurementReport)
+		for _, path := range files {
+			if err := reportTSMFile(path, db, opts.keyring, measurements, total, newCounter); err != nil {
+				fmt.Printf("Failed to read %s: %v\n", path, err)
+				os.Exit(1)
+			}
+		}
+
+		names := make([]string, 0, len(measurements))
+		for name := range measurements {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			m := measurements[name]
+			totalSize += m.size
+
+			fmt.Fprintln(tw, strings.Join([]string{
+				db, rp, id, name,
+				strconv.FormatUint(m.series.Count(), 10),
+				formatCounts(m.tagValues),
+				strconv.FormatInt(m.size, 10),
+				strconv.FormatInt(m.blocks, 10),
+				formatEncodings(m.encodings),
+			}, "\t"))
+		}
+	}
+	tw.Flush()
+
+	mode := "estimated"
+	if opts.exact {
+		mode = "exact"
+	}
+	fmt.Printf("\nSeries (%s): %d, Size: %d, Shards: %d, in %v\n", mode, total.Count(), totalSize, len(shardDirs), time.Since(start))
+}
+
+// findReportShards returns the directories of the shards in the data
+// directory and, if set, the cold directory.
+func findReportShards(opts *reportOpts) ([]string, error) {
+	var shardDirs []string
+	for _, dir := range []string{filepath.Join(opts.dir, "data"), opts.coldDir} {
+		if dir == "" {
+			continue
+		}
+
+		paths, err := filepath.Glob(filepath.Join(dir, "*", "*", "*"))
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range paths {
+			if _, err := strconv.ParseUint(filepath.Base(path), 10, 64); err != nil {
+				continue
+			}
+			shardDirs = append(shardDirs, path)
+		}
+	}
+	return shardDirs, nil
+}
+
+// reportTSMFile adds the series, tags, size and block encodings of every key
+// in a TSM file to the reports of their measurements. Series are also added to
+// total, qualified by database so they are counted once across its shards.
+func reportTSMFile(path, database string, keyring *tsdb.Keyring, measurements map[string]*measurementReport, total counter, newCounter func() counter) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r, err := tsm1.NewTSMReaderWithOptions(tsm1.TSMReaderOptions{MMAPFile: f, Keyring: keyring})
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	var prevSeriesKey string
+	iter := r.BlockIterator()
+	for iter.Next() {
+		key, _, _, buf, err := iter.Read()
+		if err != nil {
+			return err
+		}
+
+		seriesKey, _ := tsm1.SeriesAndFieldFromCompositeKey(key)
+		name := tsdb.MeasurementFromSeriesKey(seriesKey)
+		m := measurements[name]
+		if m == nil {
+			m = &measurementReport{
+				series:    newCounter(),
+				tagValues: make(map[string]counter),
+				encodings: make(map[string]int),
+			}
+			measurements[name] = m
+		}
+
+		// Blocks of the same series are adjacent so only parse its tags once.
+		if seriesKey != prevSeriesKey {
+			prevSeriesKey = seriesKey
+			m.series.Add([]byte(seriesKey))
+			total.Add([]byte(database + "\x00" + seriesKey))
+
+			_, tags, _ := models.ParseKey(seriesKey)
+			for k, v := range tags {
+				c := m.tagValues[k]
+				if c == nil {
+					c = newCounter()
+					m.tagValues[k] = c
+				}
+				c.Add([]byte(v))
+			}
+		}
+
+		// Include the checksum in the size of the block.
+		m.size += int64(len(buf)) + 4
+		m.blocks++
+		m.encodings[blockEncoding(buf)]++
+	}
+	return nil
+}
+
+// blockEncoding returns the timestamp and value encodings of a block, such as
+// "s8b/gor".
+func blockEncoding(buf []byte) string {
+	if len(buf) < 2 {
+		return "unknown"
+	}
+	blockType := int(buf[0])
+
+	// Length of the timestamp block
+	tsLen, j := binary.Uvarint(buf[1:])
+	if j <= 0 || 1+j+int(tsLen) >= len(buf) || tsLen == 0 || blockType >= len(blockTypes) {
+		return "unknown"
+	}
+	ts := buf[1+j:]
+	values := buf[1+j+int(tsLen):]
+
+	tsEnc, vEnc := int(ts[0]>>4), int(values[0]>>4)
+	if tsEnc >= len(timeEnc) || vEnc >= len(encDescs[blockType+1]) {
+		return "unknown"
+	}
+	return timeEnc[tsEnc] + "/" + encDescs[blockType+1][vEnc]
+}
+
+// formatCounts returns the distinct value counts of each tag key, sorted by
+// key.
+func formatCounts(counts map[string]counter) string {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	a := make([]string, len(keys))
+	for i, k := range keys {
+		a[i] = fmt.Sprintf("%s:%d", k, counts[k].Count())
+	}
+	return strings.Join(a, " ")
+}
+
+// formatEncodings returns the number of blocks of each encoding, sorted by
+// encoding.
+func formatEncodings(encodings map[string]int) string {
+	keys := make([]string, 0, len(encodings))
+	for k := range encodings {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	a := make([]string, len(keys))
+	for i, k := range keys {
+		a[i] = fmt.Sprintf("%s:%d", k, encodings[k])
+	}
+	return strings.Join(a, " ")
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// Ensure the estimate counter is exact for small sets and estimates large ones.
+func TestEstimateCounter(t *testing.T) {
+	c := newEstimateCounter()
+	for i := 0; i < sparseCounterMax; i++ {
+		c.Add([]byte(strconv.Itoa(i)))
+		c.Add([]byte(strconv.Itoa(i)))
+	}
+	if n := c.Count(); n != sparseCounterMax {
+		t.Fatalf("unexpected count: %d", n)
+	} else if c.sketch != nil {
+		t.Fatal("expected values to be counted exactly")
+	}
+
+	for i := sparseCounterMax; i < 10000; i++ {
+		c.Add([]byte(strconv.Itoa(i)))
+	}
+	if c.sketch == nil {
+		t.Fatal("expected values to be estimated")
+	} else if n := c.Count(); n < 9800 || n > 10200 {
+		t.Fatalf("unexpected count: %d", n)
+	}
+}
+
+// Ensure shards are found in the data and cold directories.
+func TestFindReportShards(t *testing.T) {
+	dir := MustTempDir()
+	defer os.RemoveAll(dir)
+
+	opts := &reportOpts{dir: dir, coldDir: filepath.Join(dir, "cold")}
+	for _, path := range []string{
+		filepath.Join(dir, "data", "db0", "rp0", "1"),
+		filepath.Join(dir, "data", "db0", "rp0", "tmp"),
+		filepath.Join(opts.coldDir, "db0", "rp0", "2"),
+	} {
+		if err := os.MkdirAll(path, 0777); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	shardDirs, err := findReportShards(opts)
+	if err != nil {
+		t.Fatal(err)
+	} else if exp := []string{
+		filepath.Join(dir, "data", "db0", "rp0", "1"),
+		filepath.Join(opts.coldDir, "db0", "rp0", "2"),
+	}; !reflect.DeepEqual(shardDirs, exp) {
+		t.Fatalf("unexpected shards: %v", shardDirs)
+	}
+}
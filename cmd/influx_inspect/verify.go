@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/influxdata/influxdb/tsdb"
+	"github.com/influxdata/influxdb/tsdb/engine/tsm1"
+)
+
+func cmdVerify(path string, keyring *tsdb.Keyring) {
+	start := time.Now()
+	tw := tabwriter.NewWriter(os.Stdout, 16, 8, 0, '\t', 0)
+
+	var files, corrupt, problems int
+	err := filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		} else if info.IsDir() || !strings.HasSuffix(path, "."+tsm1.TSMFileExtension) {
+			return nil
+		}
+		files++
+
+		errs, err := tsm1.VerifyTSMFile(path, keyring)
+		if err != nil {
+			fmt.Fprintf(tw, "%s\t%s\n", path, err)
+			corrupt++
+			return nil
+		} else if len(errs) == 0 {
+			return nil
+		}
+
+		corrupt++
+		problems += len(errs)
+		for _, e := range errs {
+			key := e.Key
+			if key == "" {
+				key = "-"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", path, key, e.Err)
+		}
+		return nil
+	})
+	tw.Flush()
+	if err != nil {
+		fmt.Printf("Failed to walk dir: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Files: %d, Corrupt: %d, Problems: %d, in %v\n", files, corrupt, problems, time.Since(start))
+	if corrupt > 0 {
+		os.Exit(1)
+	}
+}
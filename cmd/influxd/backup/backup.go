@@ -43,6 +43,8 @@ type Command struct {
 	host     string
 	path     string
 	database string
+
+	manifest *Manifest
 }
 
 // NewCommand returns a new instance of Command with default settings.
@@ -64,6 +66,11 @@ func (cmd *Command) Run(args ...string) error {
 		return err
 	}
 
+	// Load the manifest of previous backups to this directory.
+	if cmd.manifest, err = ReadManifest(filepath.Join(cmd.path, ManifestFile)); err != nil {
+		return fmt.Errorf("read manifest: %s", err)
+	}
+
 	// based on the arguments passed in we only backup the minimum
 	if shardID != "" {
 		// always backup the metastore
@@ -127,22 +134,16 @@ func (cmd *Command) parseFlags(args []string) (retentionPolicy, shardID string,
 	return
 }
 
-// backupShard will write a tar archive of the passed in shard with any TSM files that have been
-// created since the time passed in
+// backupShard will write a tar archive of the passed in shard. Without a since
+// time, only the data files not already recorded in the manifest are
+// downloaded and the manifest is updated. Otherwise the archive contains any
+// TSM files that have been created since the passed in time.
 func (cmd *Command) backupShard(retentionPolicy string, shardID string, since time.Time) error {
 	id, err := strconv.ParseUint(shardID, 10, 64)
 	if err != nil {
 		return err
 	}
 
-	shardArchivePath, err := cmd.nextPath(filepath.Join(cmd.path, fmt.Sprintf(BackupFilePattern, cmd.database, retentionPolicy, id)))
-	if err != nil {
-		return err
-	}
-
-	cmd.Logger.Printf("backing up db=%v rp=%v shard=%v to %s since %s",
-		cmd.database, retentionPolicy, shardID, shardArchivePath, since)
-
 	req := &snapshotter.Request{
 		Type:            snapshotter.RequestShardBackup,
 		Database:        cmd.database,
@@ -151,8 +152,75 @@ func (cmd *Command) backupShard(retentionPolicy string, shardID string, since ti
 		Since:           since,
 	}
 
-	// TODO: verify shard backup data
-	return cmd.downloadAndVerify(req, shardArchivePath, nil)
+	if !since.IsZero() {
+		shardArchivePath, err := cmd.nextPath(filepath.Join(cmd.path, fmt.Sprintf(BackupFilePattern, cmd.database, retentionPolicy, id)))
+		if err != nil {
+			return err
+		}
+
+		cmd.Logger.Printf("backing up db=%v rp=%v shard=%v to %s since %s",
+			cmd.database, retentionPolicy, shardID, shardArchivePath, since)
+
+		// Ensure the archive is complete by reading every file in it.
+		return cmd.downloadAndVerify(req, shardArchivePath, func(file string) error {
+			_, err := ChecksumArchive(file)
+			return err
+		})
+	}
+
+	// Determine which of the shard's files are not in the backup yet.
+	response, err := cmd.requestInfo(&snapshotter.Request{Type: snapshotter.RequestShardFiles, ShardID: id})
+	if err != nil {
+		return err
+	}
+
+	prev := cmd.manifest.Shard(id)
+	for _, f := range response.Files {
+		if fm := prev.File(f.Name); fm == nil || fm.Size != f.Size {
+			req.Files = append(req.Files, f.Name)
+		}
+	}
+
+	var downloaded map[string]*FileManifest
+	if len(req.Files) == 0 {
+		cmd.Logger.Printf("db=%v rp=%v shard=%v unchanged since last backup", cmd.database, retentionPolicy, shardID)
+	} else {
+		shardArchivePath, err := cmd.nextPath(filepath.Join(cmd.path, fmt.Sprintf(BackupFilePattern, cmd.database, retentionPolicy, id)))
+		if err != nil {
+			return err
+		}
+
+		cmd.Logger.Printf("backing up db=%v rp=%v shard=%v to %s (%d new files)",
+			cmd.database, retentionPolicy, shardID, shardArchivePath, len(req.Files))
+
+		if err := cmd.downloadAndVerify(req, shardArchivePath, func(file string) error {
+			downloaded, err = ChecksumArchive(file)
+			return err
+		}); err != nil {
+			return err
+		}
+		for _, fm := range downloaded {
+			fm.Archive = filepath.Base(shardArchivePath)
+		}
+	}
+
+	// Record the files the shard consists of now. Files that were removed
+	// from the shard while downloading are left out.
+	sm := &ShardManifest{Database: cmd.database, RetentionPolicy: retentionPolicy, ShardID: id}
+	for _, f := range response.Files {
+		if fm := downloaded[f.Name]; fm != nil {
+			sm.Files = append(sm.Files, fm)
+		} else if fm := prev.File(f.Name); fm != nil && fm.Size == f.Size {
+			sm.Files = append(sm.Files, fm)
+		}
+	}
+
+	if prev != nil {
+		*prev = *sm
+	} else {
+		cmd.manifest.Shards = append(cmd.manifest.Shards, sm)
+	}
+	return cmd.manifest.Write(filepath.Join(cmd.path, ManifestFile))
 }
 
 // backupDatabase will request the database information from the server and then backup the metastore and
@@ -350,7 +418,8 @@ Options:
         Optional. The shard id to backup. If specified, retention is required.
   -since <2015-12-24T08:12:23>
         Optional. Do an incremental backup since the passed in RFC3339
-        formatted time.
+        formatted time. By default, only shard files not yet recorded in
+        the manifest of the backup directory are downloaded.
 
 `)
 }
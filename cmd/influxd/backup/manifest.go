@@ -0,0 +1,127 @@
+package backup
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// ManifestFile is the name of the manifest kept in the backup directory.
+const ManifestFile = "manifest"
+
+// Manifest records the data files of every shard in a backup directory and
+// the archive each file is stored in, so that later backups only need to
+// download new files.
+type Manifest struct {
+	Shards []*ShardManifest `json:"shards"`
+}
+
+// ShardManifest records the data files of a shard as of its last backup.
+type ShardManifest struct {
+	Database        string          `json:"database"`
+	RetentionPolicy string          `json:"retentionPolicy"`
+	ShardID         uint64          `json:"shardID"`
+	Files           []*FileManifest `json:"files"`
+}
+
+// FileManifest records a single backed up data file.
+type FileManifest struct {
+	Name     string `json:"name"`
+	Size     int64  `json:"size"`
+	Checksum string `json:"checksum"` // hex encoded SHA-256 of the file
+	Archive  string `json:"archive"`  // name of the archive holding the file
+}
+
+// ReadManifest reads the manifest at path. Returns an empty manifest if the
+// file does not exist.
+func ReadManifest(path string) (*Manifest, error) {
+	buf, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &Manifest{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(buf, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// Write atomically writes the manifest to path.
+func (m *Manifest) Write(path string) error {
+	buf, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmppath := path + Suffix
+	if err := ioutil.WriteFile(tmppath, buf, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmppath, path)
+}
+
+// Shard returns the manifest of a shard or nil if the shard isn't in the
+// backup.
+func (m *Manifest) Shard(id uint64) *ShardManifest {
+	for _, sm := range m.Shards {
+		if sm.ShardID == id {
+			return sm
+		}
+	}
+	return nil
+}
+
+// File returns the named file or nil if the file isn't in the backup.
+func (sm *ShardManifest) File(name string) *FileManifest {
+	if sm == nil {
+		return nil
+	}
+	for _, f := range sm.Files {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// ChecksumArchive returns the manifest entries of every file in the tar
+// archive at path, keyed by file name. The Archive of the entries is not set.
+func ChecksumArchive(path string) (map[string]*FileManifest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	files := make(map[string]*FileManifest)
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		h := sha256.New()
+		n, err := io.Copy(h, tr)
+		if err != nil {
+			return nil, err
+		}
+
+		name := filepath.Base(hdr.Name)
+		files[name] = &FileManifest{
+			Name:     name,
+			Size:     n,
+			Checksum: hex.EncodeToString(h.Sum(nil)),
+		}
+	}
+}
@@ -3,7 +3,10 @@ package restore
 import (
 	"archive/tar"
 	"bytes"
+	"crypto/sha256"
 	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
@@ -13,12 +16,15 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
 
 	"github.com/influxdata/influxdb/cmd/influxd/backup"
 	"github.com/influxdata/influxdb/services/meta"
 	"github.com/influxdata/influxdb/services/snapshotter"
+	"github.com/influxdata/influxdb/tcp"
 )
 
 // Command represents the program execution for "influxd restore".
@@ -33,6 +39,10 @@ type Command struct {
 	retention       string
 	shard           string
 
+	// Online restore into a running server.
+	host  string
+	newdb string
+
 	// TODO: when the new meta stuff is done this should not be exported or be gone
 	MetaConfig *meta.Config
 }
@@ -52,6 +62,10 @@ func (cmd *Command) Run(args ...string) error {
 		return err
 	}
 
+	if cmd.host != "" {
+		return cmd.restoreOnline()
+	}
+
 	if cmd.metadir != "" {
 		if err := cmd.unpackMeta(); err != nil {
 			return err
@@ -76,6 +90,8 @@ func (cmd *Command) parseFlags(args []string) error {
 	fs.StringVar(&cmd.database, "database", "", "")
 	fs.StringVar(&cmd.retention, "retention", "", "")
 	fs.StringVar(&cmd.shard, "shard", "", "")
+	fs.StringVar(&cmd.host, "host", "", "")
+	fs.StringVar(&cmd.newdb, "newdb", "", "")
 	fs.SetOutput(cmd.Stdout)
 	fs.Usage = cmd.printUsage
 	if err := fs.Parse(args); err != nil {
@@ -92,11 +108,22 @@ func (cmd *Command) parseFlags(args []string) error {
 	}
 
 	// validate the arguments
+	if cmd.host != "" {
+		if cmd.database == "" {
+			return fmt.Errorf("-database is required to restore into a running server")
+		}
+		if cmd.metadir != "" || cmd.datadir != "" {
+			return fmt.Errorf("-metadir and -datadir can't be used with -host")
+		}
+	} else if cmd.newdb != "" {
+		return fmt.Errorf("-newdb requires -host")
+	}
+
 	if cmd.metadir == "" && cmd.database == "" {
 		return fmt.Errorf("-metadir or -database are required to restore")
 	}
 
-	if cmd.database != "" && cmd.datadir == "" {
+	if cmd.host == "" && cmd.database != "" && cmd.datadir == "" {
 		return fmt.Errorf("-datadir is required to restore")
 	}
 
@@ -114,17 +141,17 @@ func (cmd *Command) parseFlags(args []string) error {
 	return nil
 }
 
-// unpackMeta reads the metadata from the backup directory and initializes a raft
-// cluster and replaces the root metadata.
-func (cmd *Command) unpackMeta() error {
+// readMeta reads the latest metastore backup from the backup directory.
+// Returns the metadata and the contents of node.json.
+func (cmd *Command) readMeta() (*meta.Data, []byte, error) {
 	// find the meta file
 	metaFiles, err := filepath.Glob(filepath.Join(cmd.backupFilesPath, backup.Metafile+".*"))
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
 	if len(metaFiles) == 0 {
-		return fmt.Errorf("no metastore backups in %s", cmd.backupFilesPath)
+		return nil, nil, fmt.Errorf("no metastore backups in %s", cmd.backupFilesPath)
 	}
 
 	latest := metaFiles[len(metaFiles)-1]
@@ -133,12 +160,13 @@ func (cmd *Command) unpackMeta() error {
 	// Read the metastore backup
 	f, err := os.Open(latest)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
+	defer f.Close()
 
 	var buf bytes.Buffer
 	if _, err := io.Copy(&buf, f); err != nil {
-		return fmt.Errorf("copy: %s", err)
+		return nil, nil, fmt.Errorf("copy: %s", err)
 	}
 
 	b := buf.Bytes()
@@ -147,7 +175,7 @@ func (cmd *Command) unpackMeta() error {
 	// Make sure the file is actually a meta store backup file
 	magic := binary.BigEndian.Uint64(b[:8])
 	if magic != snapshotter.BackupMagicHeader {
-		return fmt.Errorf("invalid metadata file")
+		return nil, nil, fmt.Errorf("invalid metadata file")
 	}
 	i += 8
 
@@ -165,7 +193,17 @@ func (cmd *Command) unpackMeta() error {
 	// Unpack into metadata.
 	var data meta.Data
 	if err := data.UnmarshalBinary(metaBytes); err != nil {
-		return fmt.Errorf("unmarshal: %s", err)
+		return nil, nil, fmt.Errorf("unmarshal: %s", err)
+	}
+	return &data, nodeBytes, nil
+}
+
+// unpackMeta reads the metadata from the backup directory and initializes a raft
+// cluster and replaces the root metadata.
+func (cmd *Command) unpackMeta() error {
+	data, nodeBytes, err := cmd.readMeta()
+	if err != nil {
+		return err
 	}
 
 	// Copy meta config and remove peers so it starts in single mode.
@@ -190,7 +228,7 @@ func (cmd *Command) unpackMeta() error {
 	defer client.Close()
 
 	// Force set the full metadata.
-	if err := client.SetData(&data); err != nil {
+	if err := client.SetData(data); err != nil {
 		return fmt.Errorf("set data: %s", err)
 	}
 	return nil
@@ -311,13 +349,186 @@ func (cmd *Command) unpackFile(tr *tar.Reader, fileName string) error {
 	return nil
 }
 
+// restoreOnline imports the shards of a database in the backup into a
+// running server through its snapshotter service. The database, retention
+// policies and shard groups are created on the server if they don't exist.
+func (cmd *Command) restoreOnline() error {
+	data, _, err := cmd.readMeta()
+	if err != nil {
+		return err
+	}
+
+	dbi := data.Database(cmd.database)
+	if dbi == nil {
+		return fmt.Errorf("database %s not found in backup", cmd.database)
+	}
+
+	manifest, err := backup.ReadManifest(filepath.Join(cmd.backupFilesPath, backup.ManifestFile))
+	if err != nil {
+		return err
+	}
+
+	target := cmd.database
+	if cmd.newdb != "" {
+		target = cmd.newdb
+	}
+
+	for _, rpi := range dbi.RetentionPolicies {
+		if cmd.retention != "" && rpi.Name != cmd.retention {
+			continue
+		}
+
+		for _, sgi := range rpi.ShardGroups {
+			if sgi.Deleted() {
+				continue
+			}
+
+			for _, si := range sgi.Shards {
+				if cmd.shard != "" && strconv.FormatUint(si.ID, 10) != cmd.shard {
+					continue
+				}
+
+				req := &snapshotter.Request{
+					Type:               snapshotter.RequestShardRestore,
+					Database:           target,
+					RetentionPolicy:    rpi.Name,
+					ShardID:            si.ID,
+					Time:               sgi.StartTime,
+					Duration:           rpi.Duration,
+					ShardGroupDuration: rpi.ShardGroupDuration,
+					ReplicaN:           rpi.ReplicaN,
+				}
+				if err := cmd.restoreShardOnline(req, rpi.Name, manifest.Shard(si.ID)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// restoreShardOnline streams the backed up files of a shard to the server.
+// If the shard is in the manifest, only the files it lists are sent and
+// their checksums are verified first. Otherwise every archive of the shard
+// is sent.
+func (cmd *Command) restoreShardOnline(req *snapshotter.Request, retention string, sm *backup.ShardManifest) error {
+	var archives []string
+	if sm != nil {
+		seen := make(map[string]bool)
+		for _, f := range sm.Files {
+			if !seen[f.Archive] {
+				seen[f.Archive] = true
+				archives = append(archives, filepath.Join(cmd.backupFilesPath, f.Archive))
+			}
+		}
+		sort.Strings(archives)
+	} else {
+		pat := filepath.Join(cmd.backupFilesPath, fmt.Sprintf(backup.BackupFilePattern, cmd.database, retention, req.ShardID))
+		matches, err := filepath.Glob(pat + ".*")
+		if err != nil {
+			return err
+		}
+		for _, path := range matches {
+			if !strings.HasSuffix(path, backup.Suffix) {
+				archives = append(archives, path)
+			}
+		}
+	}
+
+	if len(archives) == 0 {
+		return nil
+	}
+
+	// Verify the backed up files before sending anything.
+	for _, path := range archives {
+		if err := copyArchive(nil, path, sm); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(cmd.Stdout, "Restoring shard %d into %s.%s\n", req.ShardID, req.Database, req.RetentionPolicy)
+
+	conn, err := tcp.Dial("tcp", cmd.host, snapshotter.MuxHeader)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return fmt.Errorf("encode restore request: %s", err)
+	}
+
+	tw := tar.NewWriter(conn)
+	for _, path := range archives {
+		if err := copyArchive(tw, path, sm); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	var res snapshotter.Response
+	if err := json.NewDecoder(conn).Decode(&res); err != nil {
+		return fmt.Errorf("read restore response: %s", err)
+	} else if res.Err != "" {
+		return fmt.Errorf("restore shard %d: %s", req.ShardID, res.Err)
+	}
+	return nil
+}
+
+// copyArchive copies the files of the tar archive at path to tw. If sm is
+// not nil, only the files it records as stored in the archive are copied
+// and their checksums are verified. If tw is nil the files are only verified.
+func copyArchive(tw *tar.Writer, path string, sm *backup.ShardManifest) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		name := filepath.Base(hdr.Name)
+		var fm *backup.FileManifest
+		if sm != nil {
+			if fm = sm.File(name); fm == nil || fm.Archive != filepath.Base(path) {
+				continue
+			}
+		}
+
+		w := ioutil.Discard
+		if tw != nil {
+			if err := tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+			w = tw
+		}
+
+		h := sha256.New()
+		if _, err := io.Copy(io.MultiWriter(w, h), tr); err != nil {
+			return err
+		}
+		if fm != nil && hex.EncodeToString(h.Sum(nil)) != fm.Checksum {
+			return fmt.Errorf("checksum mismatch for %s in %s", name, path)
+		}
+	}
+}
+
 // printUsage prints the usage message to STDERR.
 func (cmd *Command) printUsage() {
 	fmt.Fprintf(cmd.Stdout, `usage: influxd restore [flags] PATH
 
 Restore uses backups from the PATH to restore the metastore, databases,
 retention policies, or specific shards. The InfluxDB process must not be
-running during restore.
+running during restore, unless -host is given.
 
 Options:
   -metadir <path>
@@ -334,6 +545,13 @@ Options:
   -shard <id>
     Optional. If given, database and retention are required. Will restore the shard's
     TSM files.
+  -host <host:port>
+        Optional. If given, the database is imported into the running server
+        at this address instead of being restored to -metadir and -datadir.
+        The database, its retention policies and shard groups are created
+        if they don't exist. The metastore of the server is not replaced.
+  -newdb <name>
+        Optional. Requires -host. The name to import the database as.
 
 `)
 }
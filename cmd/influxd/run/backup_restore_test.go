@@ -98,6 +98,74 @@ func TestServer_BackupAndRestore(t *testing.T) {
 	}
 }
 
+func TestServer_BackupAndRestore_Online(t *testing.T) {
+	config := NewConfig()
+	config.Data.Engine = "tsm1"
+	config.Data.Dir, _ = ioutil.TempDir("", "data_backup")
+	config.Meta.Dir, _ = ioutil.TempDir("", "meta_backup")
+	config.BindAddress = freePort()
+
+	backupDir, _ := ioutil.TempDir("", "backup")
+	defer os.RemoveAll(backupDir)
+
+	// set the cache snapshot size low so that a single point will cause TSM file creation
+	config.Data.CacheSnapshotMemorySize = 1
+
+	s := OpenServer(config)
+	defer s.Close()
+
+	if err := s.CreateDatabaseAndRetentionPolicy("mydb", newRetentionPolicyInfo("forever", 1, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.MetaClient.SetDefaultRetentionPolicy("mydb", "forever"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Write("mydb", "forever", "myseries,host=A value=23 1000000", nil); err != nil {
+		t.Fatalf("failed to write: %s", err)
+	}
+
+	// wait for the snapshot to write
+	time.Sleep(time.Second)
+
+	// Backup twice. The second backup should not download the shard again.
+	hostAddress, _ := run.DefaultHost(run.DefaultHostname, config.BindAddress)
+	for i := 0; i < 2; i++ {
+		if err := backup.NewCommand().Run("-host", hostAddress, "-database", "mydb", backupDir); err != nil {
+			t.Fatalf("error backing up: %s, hostAddress: %s", err.Error(), hostAddress)
+		}
+	}
+
+	if archives, err := filepath.Glob(filepath.Join(backupDir, "mydb.forever.*")); err != nil {
+		t.Fatal(err)
+	} else if len(archives) != 1 {
+		t.Fatalf("unexpected shard archives: %v", archives)
+	}
+
+	manifest, err := backup.ReadManifest(filepath.Join(backupDir, backup.ManifestFile))
+	if err != nil {
+		t.Fatal(err)
+	} else if len(manifest.Shards) != 1 || len(manifest.Shards[0].Files) != 1 {
+		t.Fatalf("unexpected manifest: %+v", manifest)
+	}
+
+	// Import the database under a new name into the running server.
+	cmd := restore.NewCommand()
+	cmd.Stdout = ioutil.Discard
+	if err := cmd.Run("-host", hostAddress, "-database", "mydb", "-newdb", "mydb_restored", backupDir); err != nil {
+		t.Fatalf("error restoring: %s", err.Error())
+	}
+
+	expected := `{"results":[{"series":[{"name":"myseries","columns":["time","host","value"],"values":[["1970-01-01T00:00:00.001Z","A",23]]}]}]}`
+	res, err := s.Query(`select * from "mydb_restored"."forever"."myseries"`)
+	if err != nil {
+		t.Fatalf("error querying: %s", err.Error())
+	}
+	if res != expected {
+		t.Fatalf("query results wrong:\n\texp: %s\n\tgot: %s", expected, res)
+	}
+}
+
 func freePort() string {
 	l, _ := net.Listen("tcp", "")
 	defer l.Close()
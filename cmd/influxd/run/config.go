@@ -22,6 +22,7 @@ import (
 	"github.com/influxdata/influxdb/services/precreator"
 	"github.com/influxdata/influxdb/services/retention"
 	"github.com/influxdata/influxdb/services/subscriber"
+	"github.com/influxdata/influxdb/services/tiering"
 	"github.com/influxdata/influxdb/services/udp"
 	"github.com/influxdata/influxdb/tsdb"
 )
@@ -41,6 +42,7 @@ type Config struct {
 	Data       tsdb.Config       `toml:"data"`
 	Cluster    cluster.Config    `toml:"cluster"`
 	Retention  retention.Config  `toml:"retention"`
+	Tiering    tiering.Config    `toml:"tiering"`
 	Precreator precreator.Config `toml:"shard-precreation"`
 
 	Admin      admin.Config      `toml:"admin"`
@@ -84,6 +86,7 @@ func NewConfig() *Config {
 
 	c.ContinuousQuery = continuous_querier.NewConfig()
 	c.Retention = retention.NewConfig()
+	c.Tiering = tiering.NewConfig()
 	c.BindAddress = DefaultBindAddress
 
 	// All ARRAY attributes have to be init after toml decode
@@ -125,6 +128,7 @@ func NewDemoConfig() (*Config, error) {
 	c.Meta.Dir = filepath.Join(homeDir, ".influxdb/meta")
 	c.Data.Dir = filepath.Join(homeDir, ".influxdb/data")
 	c.Data.WALDir = filepath.Join(homeDir, ".influxdb/wal")
+	c.Subscriber.QueueDir = filepath.Join(homeDir, ".influxdb/subscriber")
 
 	c.Admin.Enabled = true
 
@@ -141,6 +145,10 @@ func (c *Config) Validate() error {
 		return err
 	}
 
+	if err := c.Subscriber.Validate(); err != nil {
+		return fmt.Errorf("invalid subscriber config: %v", err)
+	}
+
 	for _, g := range c.Graphites {
 		if err := g.Validate(); err != nil {
 			return fmt.Errorf("invalid graphite config: %v", err)
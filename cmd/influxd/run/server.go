@@ -26,12 +26,14 @@ import (
 	"github.com/influxdata/influxdb/services/retention"
 	"github.com/influxdata/influxdb/services/snapshotter"
 	"github.com/influxdata/influxdb/services/subscriber"
+	"github.com/influxdata/influxdb/services/tiering"
 	"github.com/influxdata/influxdb/services/udp"
 	"github.com/influxdata/influxdb/tcp"
 	"github.com/influxdata/influxdb/tsdb"
 	client "github.com/influxdata/usage-client/v1"
-	// Initialize the engine packages
+	// Initialize the engine and index packages
 	_ "github.com/influxdata/influxdb/tsdb/engine"
+	_ "github.com/influxdata/influxdb/tsdb/index"
 )
 
 var startTime time.Time
@@ -221,6 +223,16 @@ func (s *Server) appendRetentionPolicyService(c retention.Config) {
 	s.Services = append(s.Services, srv)
 }
 
+func (s *Server) appendTieringService(c tiering.Config) {
+	if !c.Enabled || s.config.Data.ColdDir == "" {
+		return
+	}
+	srv := tiering.NewService(c)
+	srv.MetaClient = s.MetaClient
+	srv.TSDBStore = s.TSDBStore
+	s.Services = append(s.Services, srv)
+}
+
 func (s *Server) appendAdminService(c admin.Config) {
 	if !c.Enabled {
 		return
@@ -240,6 +252,7 @@ func (s *Server) appendHTTPDService(c httpd.Config) {
 	srv.Handler.QueryExecutor = s.QueryExecutor
 	srv.Handler.PointsWriter = s.PointsWriter
 	srv.Handler.Version = s.buildInfo.Version
+	srv.Handler.Monitor = s.Monitor
 
 	// If a ContinuousQuerier service has been started, attach it.
 	for _, srvc := range s.Services {
@@ -322,7 +335,10 @@ func (s *Server) appendContinuousQueryService(c continuous_querier.Config) {
 	srv := continuous_querier.NewService(c)
 	srv.MetaClient = s.MetaClient
 	srv.QueryExecutor = s.QueryExecutor
+	srv.TSDBStore = s.TSDBStore
+	srv.PointsWriter = (*monitorPointsWriter)(s.PointsWriter)
 	s.Services = append(s.Services, srv)
+	s.QueryExecutor.ContinuousQuerier = srv
 }
 
 // Err returns an error channel that multiplexes all out of band errors received from all services.
@@ -360,6 +376,7 @@ func (s *Server) Open() error {
 		s.appendUDPService(g)
 	}
 	s.appendRetentionPolicyService(s.config.Retention)
+	s.appendTieringService(s.config.Tiering)
 	for _, g := range s.config.Graphites {
 		if err := s.appendGraphiteService(g); err != nil {
 			return err
@@ -379,6 +396,7 @@ func (s *Server) Open() error {
 	if err := s.TSDBStore.Open(); err != nil {
 		return fmt.Errorf("open tsdb store: %s", err)
 	}
+	s.Monitor.RegisterDiagnosticsClient("compaction", s.TSDBStore.EngineOptions.CompactionScheduler)
 
 	// Open the subcriber service
 	if err := s.Subscriber.Open(); err != nil {
@@ -46,6 +46,11 @@ func IsClientError(err error) bool {
 		return true
 	}
 
+	// Points dropped for exceeding cardinality limits are reported as a partial write.
+	if strings.HasPrefix(err.Error(), "partial write") {
+		return true
+	}
+
 	return false
 }
 
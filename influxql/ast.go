@@ -89,45 +89,51 @@ type Node interface {
 func (*Query) node()     {}
 func (Statements) node() {}
 
-func (*AlterRetentionPolicyStatement) node()  {}
-func (*CreateContinuousQueryStatement) node() {}
-func (*CreateDatabaseStatement) node()        {}
-func (*CreateRetentionPolicyStatement) node() {}
-func (*CreateSubscriptionStatement) node()    {}
-func (*CreateUserStatement) node()            {}
-func (*Distinct) node()                       {}
-func (*DeleteStatement) node()                {}
-func (*DropContinuousQueryStatement) node()   {}
-func (*DropDatabaseStatement) node()          {}
-func (*DropMeasurementStatement) node()       {}
-func (*DropRetentionPolicyStatement) node()   {}
-func (*DropSeriesStatement) node()            {}
-func (*DropServerStatement) node()            {}
-func (*DropShardStatement) node()             {}
-func (*DropSubscriptionStatement) node()      {}
-func (*DropUserStatement) node()              {}
-func (*GrantStatement) node()                 {}
-func (*GrantAdminStatement) node()            {}
-func (*RevokeStatement) node()                {}
-func (*RevokeAdminStatement) node()           {}
-func (*SelectStatement) node()                {}
-func (*SetPasswordUserStatement) node()       {}
-func (*ShowContinuousQueriesStatement) node() {}
-func (*ShowGrantsForUserStatement) node()     {}
-func (*ShowServersStatement) node()           {}
-func (*ShowDatabasesStatement) node()         {}
-func (*ShowFieldKeysStatement) node()         {}
-func (*ShowRetentionPoliciesStatement) node() {}
-func (*ShowMeasurementsStatement) node()      {}
-func (*ShowSeriesStatement) node()            {}
-func (*ShowShardGroupsStatement) node()       {}
-func (*ShowShardsStatement) node()            {}
-func (*ShowStatsStatement) node()             {}
-func (*ShowSubscriptionsStatement) node()     {}
-func (*ShowDiagnosticsStatement) node()       {}
-func (*ShowTagKeysStatement) node()           {}
-func (*ShowTagValuesStatement) node()         {}
-func (*ShowUsersStatement) node()             {}
+func (*AlterRetentionPolicyStatement) node()      {}
+func (*CompactShardStatement) node()              {}
+func (*CreateContinuousQueryStatement) node()     {}
+func (*CreateDatabaseStatement) node()            {}
+func (*CreateRetentionPolicyStatement) node()     {}
+func (*CreateRollupStatement) node()              {}
+func (*CreateSubscriptionStatement) node()        {}
+func (*CreateUserStatement) node()                {}
+func (*Distinct) node()                           {}
+func (*DeleteStatement) node()                    {}
+func (*DropContinuousQueryStatement) node()       {}
+func (*DropDatabaseStatement) node()              {}
+func (*DropMeasurementStatement) node()           {}
+func (*DropRetentionPolicyStatement) node()       {}
+func (*DropRollupStatement) node()                {}
+func (*DropSeriesStatement) node()                {}
+func (*DropServerStatement) node()                {}
+func (*DropShardStatement) node()                 {}
+func (*DropSubscriptionStatement) node()          {}
+func (*DropUserStatement) node()                  {}
+func (*GrantStatement) node()                     {}
+func (*GrantAdminStatement) node()                {}
+func (*RevokeStatement) node()                    {}
+func (*RevokeAdminStatement) node()               {}
+func (*SelectStatement) node()                    {}
+func (*SetPasswordUserStatement) node()           {}
+func (*ShowContinuousQueriesStatement) node()     {}
+func (*ShowContinuousQueryStatusStatement) node() {}
+func (*BackfillContinuousQueryStatement) node()   {}
+func (*ShowGrantsForUserStatement) node()         {}
+func (*ShowServersStatement) node()               {}
+func (*ShowDatabasesStatement) node()             {}
+func (*ShowFieldKeysStatement) node()             {}
+func (*ShowRetentionPoliciesStatement) node()     {}
+func (*ShowRollupsStatement) node()               {}
+func (*ShowMeasurementsStatement) node()          {}
+func (*ShowSeriesStatement) node()                {}
+func (*ShowShardGroupsStatement) node()           {}
+func (*ShowShardsStatement) node()                {}
+func (*ShowStatsStatement) node()                 {}
+func (*ShowSubscriptionsStatement) node()         {}
+func (*ShowDiagnosticsStatement) node()           {}
+func (*ShowTagKeysStatement) node()               {}
+func (*ShowTagValuesStatement) node()             {}
+func (*ShowUsersStatement) node()                 {}
 
 func (*BinaryExpr) node()      {}
 func (*BooleanLiteral) node()  {}
@@ -202,44 +208,50 @@ type ExecutionPrivilege struct {
 // ExecutionPrivileges is a list of privileges required to execute a statement.
 type ExecutionPrivileges []ExecutionPrivilege
 
-func (*AlterRetentionPolicyStatement) stmt()  {}
-func (*CreateContinuousQueryStatement) stmt() {}
-func (*CreateDatabaseStatement) stmt()        {}
-func (*CreateRetentionPolicyStatement) stmt() {}
-func (*CreateSubscriptionStatement) stmt()    {}
-func (*CreateUserStatement) stmt()            {}
-func (*DeleteStatement) stmt()                {}
-func (*DropContinuousQueryStatement) stmt()   {}
-func (*DropDatabaseStatement) stmt()          {}
-func (*DropMeasurementStatement) stmt()       {}
-func (*DropRetentionPolicyStatement) stmt()   {}
-func (*DropSeriesStatement) stmt()            {}
-func (*DropServerStatement) stmt()            {}
-func (*DropSubscriptionStatement) stmt()      {}
-func (*DropUserStatement) stmt()              {}
-func (*GrantStatement) stmt()                 {}
-func (*GrantAdminStatement) stmt()            {}
-func (*ShowContinuousQueriesStatement) stmt() {}
-func (*ShowGrantsForUserStatement) stmt()     {}
-func (*ShowServersStatement) stmt()           {}
-func (*ShowDatabasesStatement) stmt()         {}
-func (*ShowFieldKeysStatement) stmt()         {}
-func (*ShowMeasurementsStatement) stmt()      {}
-func (*ShowRetentionPoliciesStatement) stmt() {}
-func (*ShowSeriesStatement) stmt()            {}
-func (*ShowShardGroupsStatement) stmt()       {}
-func (*ShowShardsStatement) stmt()            {}
-func (*ShowStatsStatement) stmt()             {}
-func (*DropShardStatement) stmt()             {}
-func (*ShowSubscriptionsStatement) stmt()     {}
-func (*ShowDiagnosticsStatement) stmt()       {}
-func (*ShowTagKeysStatement) stmt()           {}
-func (*ShowTagValuesStatement) stmt()         {}
-func (*ShowUsersStatement) stmt()             {}
-func (*RevokeStatement) stmt()                {}
-func (*RevokeAdminStatement) stmt()           {}
-func (*SelectStatement) stmt()                {}
-func (*SetPasswordUserStatement) stmt()       {}
+func (*AlterRetentionPolicyStatement) stmt()      {}
+func (*CompactShardStatement) stmt()              {}
+func (*CreateContinuousQueryStatement) stmt()     {}
+func (*CreateDatabaseStatement) stmt()            {}
+func (*CreateRetentionPolicyStatement) stmt()     {}
+func (*CreateRollupStatement) stmt()              {}
+func (*CreateSubscriptionStatement) stmt()        {}
+func (*CreateUserStatement) stmt()                {}
+func (*DeleteStatement) stmt()                    {}
+func (*DropContinuousQueryStatement) stmt()       {}
+func (*DropDatabaseStatement) stmt()              {}
+func (*DropMeasurementStatement) stmt()           {}
+func (*DropRetentionPolicyStatement) stmt()       {}
+func (*DropRollupStatement) stmt()                {}
+func (*DropSeriesStatement) stmt()                {}
+func (*DropServerStatement) stmt()                {}
+func (*DropSubscriptionStatement) stmt()          {}
+func (*DropUserStatement) stmt()                  {}
+func (*GrantStatement) stmt()                     {}
+func (*GrantAdminStatement) stmt()                {}
+func (*ShowContinuousQueriesStatement) stmt()     {}
+func (*ShowContinuousQueryStatusStatement) stmt() {}
+func (*BackfillContinuousQueryStatement) stmt()   {}
+func (*ShowGrantsForUserStatement) stmt()         {}
+func (*ShowServersStatement) stmt()               {}
+func (*ShowDatabasesStatement) stmt()             {}
+func (*ShowFieldKeysStatement) stmt()             {}
+func (*ShowMeasurementsStatement) stmt()          {}
+func (*ShowRetentionPoliciesStatement) stmt()     {}
+func (*ShowRollupsStatement) stmt()               {}
+func (*ShowSeriesStatement) stmt()                {}
+func (*ShowShardGroupsStatement) stmt()           {}
+func (*ShowShardsStatement) stmt()                {}
+func (*ShowStatsStatement) stmt()                 {}
+func (*DropShardStatement) stmt()                 {}
+func (*ShowSubscriptionsStatement) stmt()         {}
+func (*ShowDiagnosticsStatement) stmt()           {}
+func (*ShowTagKeysStatement) stmt()               {}
+func (*ShowTagValuesStatement) stmt()             {}
+func (*ShowUsersStatement) stmt()                 {}
+func (*RevokeStatement) stmt()                    {}
+func (*RevokeAdminStatement) stmt()               {}
+func (*SelectStatement) stmt()                    {}
+func (*SetPasswordUserStatement) stmt()           {}
 
 // Expr represents an expression that can be evaluated to a value.
 type Expr interface {
@@ -729,6 +741,13 @@ type CreateRetentionPolicyStatement struct {
 	// Replication factor for data written to this policy.
 	Replication int
 
+	// Duration of the shard groups in this policy.  Derived from the policy
+	// duration if zero.
+	ShardGroupDuration time.Duration
+
+	// Age after which shards are moved to cold storage. Never if zero.
+	ColdAfter time.Duration
+
 	// Should this policy be set as default for the database?
 	Default bool
 }
@@ -744,6 +763,14 @@ func (s *CreateRetentionPolicyStatement) String() string {
 	_, _ = buf.WriteString(FormatDuration(s.Duration))
 	_, _ = buf.WriteString(" REPLICATION ")
 	_, _ = buf.WriteString(strconv.Itoa(s.Replication))
+	if s.ShardGroupDuration > 0 {
+		_, _ = buf.WriteString(" SHARD DURATION ")
+		_, _ = buf.WriteString(FormatDuration(s.ShardGroupDuration))
+	}
+	if s.ColdAfter > 0 {
+		_, _ = buf.WriteString(" COLD AFTER ")
+		_, _ = buf.WriteString(FormatDuration(s.ColdAfter))
+	}
 	if s.Default {
 		_, _ = buf.WriteString(" DEFAULT")
 	}
@@ -769,6 +796,12 @@ type AlterRetentionPolicyStatement struct {
 	// Replication factor for data written to this policy.
 	Replication *int
 
+	// Duration of the shard groups in this policy.
+	ShardGroupDuration *time.Duration
+
+	// Age after which shards are moved to cold storage.
+	ColdAfter *time.Duration
+
 	// Should this policy be set as defalut for the database?
 	Default bool
 }
@@ -791,6 +824,16 @@ func (s *AlterRetentionPolicyStatement) String() string {
 		_, _ = buf.WriteString(strconv.Itoa(*s.Replication))
 	}
 
+	if s.ShardGroupDuration != nil {
+		_, _ = buf.WriteString(" SHARD DURATION ")
+		_, _ = buf.WriteString(FormatDuration(*s.ShardGroupDuration))
+	}
+
+	if s.ColdAfter != nil {
+		_, _ = buf.WriteString(" COLD AFTER ")
+		_, _ = buf.WriteString(FormatDuration(*s.ColdAfter))
+	}
+
 	if s.Default {
 		_, _ = buf.WriteString(" DEFAULT")
 	}
@@ -2171,6 +2214,47 @@ func (s *DropShardStatement) RequiredPrivileges() ExecutionPrivileges {
 	return ExecutionPrivileges{{Admin: true, Name: "", Privilege: AllPrivileges}}
 }
 
+// CompactShardStatement represents a command for compacting a shard, or the
+// shards of a database or retention policy, immediately.
+type CompactShardStatement struct {
+	// ID of the shard to compact. Unused if Database is set.
+	ID uint64
+
+	// Database, and optionally the retention policy, whose shards to compact.
+	Database        string
+	RetentionPolicy string
+
+	// Full compacts all files of the shards into as few files as possible
+	// instead of running the compaction planned for cold shards.
+	Full bool
+}
+
+// String returns a string representation of the compact shard statement.
+func (s *CompactShardStatement) String() string {
+	var buf bytes.Buffer
+	if s.Database == "" {
+		_, _ = buf.WriteString("COMPACT SHARD ")
+		_, _ = buf.WriteString(strconv.FormatUint(s.ID, 10))
+	} else {
+		_, _ = buf.WriteString("COMPACT SHARDS ON ")
+		_, _ = buf.WriteString(QuoteIdent(s.Database))
+		if s.RetentionPolicy != "" {
+			_, _ = buf.WriteString(".")
+			_, _ = buf.WriteString(QuoteIdent(s.RetentionPolicy))
+		}
+	}
+	if s.Full {
+		_, _ = buf.WriteString(" FULL")
+	}
+	return buf.String()
+}
+
+// RequiredPrivileges returns the privilege required to execute a
+// CompactShardStatement.
+func (s *CompactShardStatement) RequiredPrivileges() ExecutionPrivileges {
+	return ExecutionPrivileges{{Admin: true, Name: "", Privilege: AllPrivileges}}
+}
+
 // ShowContinuousQueriesStatement represents a command for listing continuous queries.
 type ShowContinuousQueriesStatement struct{}
 
@@ -2182,6 +2266,56 @@ func (s *ShowContinuousQueriesStatement) RequiredPrivileges() ExecutionPrivilege
 	return ExecutionPrivileges{{Admin: false, Name: "", Privilege: ReadPrivilege}}
 }
 
+// BackfillContinuousQueryStatement represents a command for running a
+// continuous query over a historical time range.
+type BackfillContinuousQueryStatement struct {
+	// Name of the continuous query to run.
+	Name string
+
+	// Name of the database the continuous query belongs to.
+	Database string
+
+	// Time range to process. The end time is exclusive.
+	StartTime time.Time
+	EndTime   time.Time
+}
+
+// String returns a string representation of the statement.
+func (s *BackfillContinuousQueryStatement) String() string {
+	var buf bytes.Buffer
+	_, _ = buf.WriteString("BACKFILL CONTINUOUS QUERY ")
+	_, _ = buf.WriteString(QuoteIdent(s.Name))
+	_, _ = buf.WriteString(" ON ")
+	_, _ = buf.WriteString(QuoteIdent(s.Database))
+	_, _ = buf.WriteString(" FROM ")
+	_, _ = buf.WriteString((&TimeLiteral{Val: s.StartTime}).String())
+	_, _ = buf.WriteString(" TO ")
+	_, _ = buf.WriteString((&TimeLiteral{Val: s.EndTime}).String())
+	return buf.String()
+}
+
+// DefaultDatabase returns the default database from the statement.
+func (s *BackfillContinuousQueryStatement) DefaultDatabase() string {
+	return s.Database
+}
+
+// RequiredPrivileges returns the privilege required to execute a BackfillContinuousQueryStatement.
+func (s *BackfillContinuousQueryStatement) RequiredPrivileges() ExecutionPrivileges {
+	return ExecutionPrivileges{{Admin: true, Name: "", Privilege: AllPrivileges}}
+}
+
+// ShowContinuousQueryStatusStatement represents a command for listing the
+// execution status of continuous queries.
+type ShowContinuousQueryStatusStatement struct{}
+
+// String returns a string representation of the statement.
+func (s *ShowContinuousQueryStatusStatement) String() string { return "SHOW CONTINUOUS QUERY STATUS" }
+
+// RequiredPrivileges returns the privilege required to execute a ShowContinuousQueryStatusStatement.
+func (s *ShowContinuousQueryStatusStatement) RequiredPrivileges() ExecutionPrivileges {
+	return ExecutionPrivileges{{Admin: false, Name: "", Privilege: ReadPrivilege}}
+}
+
 // ShowGrantsForUserStatement represents a command for listing user privileges.
 type ShowGrantsForUserStatement struct {
 	// Name of the user to display privileges.
@@ -2480,6 +2614,10 @@ func (s *ShowDiagnosticsStatement) RequiredPrivileges() ExecutionPrivileges {
 	return ExecutionPrivileges{{Admin: true, Name: "", Privilege: AllPrivileges}}
 }
 
+// SubscriptionMeasurementKey is the name used in a subscription condition to
+// refer to the measurement of a point.
+const SubscriptionMeasurementKey = "_name"
+
 // CreateSubscriptionStatement represents a command to add a subscription to the incoming data stream
 type CreateSubscriptionStatement struct {
 	Name            string
@@ -2487,6 +2625,9 @@ type CreateSubscriptionStatement struct {
 	RetentionPolicy string
 	Destinations    []string
 	Mode            string
+
+	// Only points matching the condition are forwarded, if set.
+	Condition Expr
 }
 
 // String returns a string representation of the CreateSubscriptionStatement.
@@ -2507,6 +2648,10 @@ func (s *CreateSubscriptionStatement) String() string {
 		}
 		_, _ = buf.WriteString(QuoteString(dest))
 	}
+	if s.Condition != nil {
+		_, _ = buf.WriteString(" WHERE ")
+		_, _ = buf.WriteString(s.Condition.String())
+	}
 
 	return buf.String()
 }
@@ -2516,6 +2661,44 @@ func (s *CreateSubscriptionStatement) RequiredPrivileges() ExecutionPrivileges {
 	return ExecutionPrivileges{{Admin: true, Name: "", Privilege: AllPrivileges}}
 }
 
+// ValidateSubscriptionCondition returns an error if expr cannot be used as a
+// subscription condition.  Conditions may only compare the measurement or tags
+// of a point to strings or regular expressions, combined with AND and OR.
+func ValidateSubscriptionCondition(expr Expr) error {
+	switch expr := expr.(type) {
+	case *ParenExpr:
+		return ValidateSubscriptionCondition(expr.Expr)
+	case *BinaryExpr:
+		switch expr.Op {
+		case AND, OR:
+			if err := ValidateSubscriptionCondition(expr.LHS); err != nil {
+				return err
+			}
+			return ValidateSubscriptionCondition(expr.RHS)
+		case EQ, NEQ, EQREGEX, NEQREGEX:
+			ref, ok := expr.LHS.(*VarRef)
+			if !ok {
+				return fmt.Errorf("invalid subscription condition: %s: expected tag key or %s", expr, SubscriptionMeasurementKey)
+			} else if strings.ToLower(ref.Val) == "time" {
+				return fmt.Errorf("invalid subscription condition: %s: time cannot be used", expr)
+			}
+
+			switch expr.RHS.(type) {
+			case *StringLiteral:
+				if expr.Op == EQ || expr.Op == NEQ {
+					return nil
+				}
+			case *RegexLiteral:
+				if expr.Op == EQREGEX || expr.Op == NEQREGEX {
+					return nil
+				}
+			}
+			return fmt.Errorf("invalid subscription condition: %s: expected string or regex comparison", expr)
+		}
+	}
+	return fmt.Errorf("invalid subscription condition: %s", expr)
+}
+
 // DropSubscriptionStatement represents a command to drop a subscription to the incoming data stream.
 type DropSubscriptionStatement struct {
 	Name            string
@@ -2547,6 +2730,108 @@ func (s *ShowSubscriptionsStatement) RequiredPrivileges() ExecutionPrivileges {
 	return ExecutionPrivileges{{Admin: true, Name: "", Privilege: AllPrivileges}}
 }
 
+// RollupFunctions lists the functions a rollup can apply to fields of each
+// data type.
+var RollupFunctions = map[DataType][]string{
+	Float:   {"count", "first", "last", "max", "mean", "median", "min", "spread", "stddev", "sum"},
+	Integer: {"count", "first", "last", "max", "mean", "median", "min", "spread", "stddev", "sum"},
+	String:  {"count", "first", "last"},
+	Boolean: {"count", "first", "last"},
+}
+
+// RollupAggregate represents the functions a rollup applies to the fields of
+// a data type.
+type RollupAggregate struct {
+	Type      DataType
+	Functions []string
+}
+
+// String returns a string representation of the aggregate.
+func (a *RollupAggregate) String() string {
+	return fmt.Sprintf("%s(%s)", a.Type, strings.Join(a.Functions, ", "))
+}
+
+// CreateRollupStatement represents a command for creating a rollup, which
+// downsamples the measurements of one retention policy into another.
+type CreateRollupStatement struct {
+	// Name of the rollup to be created.
+	Name string
+
+	// Name of the database and retention policy the data is read from.
+	Database        string
+	RetentionPolicy string
+
+	// Name of the retention policy the results are written to.
+	Target string
+
+	// Duration of each downsampled interval.
+	Interval time.Duration
+
+	// Measurements to downsample.  All measurements are downsampled if nil.
+	Measurements *RegexLiteral
+
+	// Functions applied to fields, by data type.
+	Aggregates []*RollupAggregate
+}
+
+// String returns a string representation of the create rollup statement.
+func (s *CreateRollupStatement) String() string {
+	var buf bytes.Buffer
+	_, _ = buf.WriteString("CREATE ROLLUP ")
+	_, _ = buf.WriteString(QuoteIdent(s.Name))
+	_, _ = buf.WriteString(" ON ")
+	_, _ = buf.WriteString(QuoteIdent(s.Database, s.RetentionPolicy))
+	_, _ = buf.WriteString(" INTO ")
+	_, _ = buf.WriteString(QuoteIdent(s.Target))
+	_, _ = buf.WriteString(" EVERY ")
+	_, _ = buf.WriteString(FormatDuration(s.Interval))
+	if s.Measurements != nil {
+		_, _ = buf.WriteString(" FROM ")
+		_, _ = buf.WriteString(s.Measurements.String())
+	}
+	_, _ = buf.WriteString(" AGGREGATES ")
+	for i, a := range s.Aggregates {
+		if i > 0 {
+			_, _ = buf.WriteString(", ")
+		}
+		_, _ = buf.WriteString(a.String())
+	}
+	return buf.String()
+}
+
+// RequiredPrivileges returns the privilege required to execute a CreateRollupStatement.
+func (s *CreateRollupStatement) RequiredPrivileges() ExecutionPrivileges {
+	return ExecutionPrivileges{{Admin: true, Name: "", Privilege: AllPrivileges}}
+}
+
+// DropRollupStatement represents a command for removing a rollup.
+type DropRollupStatement struct {
+	Name            string
+	Database        string
+	RetentionPolicy string
+}
+
+// String returns a string representation of the drop rollup statement.
+func (s *DropRollupStatement) String() string {
+	return fmt.Sprintf(`DROP ROLLUP %s ON %s`, QuoteIdent(s.Name), QuoteIdent(s.Database, s.RetentionPolicy))
+}
+
+// RequiredPrivileges returns the privilege required to execute a DropRollupStatement.
+func (s *DropRollupStatement) RequiredPrivileges() ExecutionPrivileges {
+	return ExecutionPrivileges{{Admin: true, Name: "", Privilege: AllPrivileges}}
+}
+
+// ShowRollupsStatement represents a command for listing rollups.
+type ShowRollupsStatement struct{}
+
+// String returns a string representation of the show rollups statement.
+func (s *ShowRollupsStatement) String() string { return "SHOW ROLLUPS" }
+
+// RequiredPrivileges returns the privilege required to execute a ShowRollupsStatement.
+func (s *ShowRollupsStatement) RequiredPrivileges() ExecutionPrivileges {
+	return ExecutionPrivileges{{Admin: true, Name: "", Privilege: AllPrivileges}}
+}
+
 // ShowTagKeysStatement represents a command for listing tag keys.
 type ShowTagKeysStatement struct {
 	// Data sources that fields are extracted from.
@@ -917,9 +917,36 @@ func TestParseString(t *testing.T) {
 		{
 			stmt: `CREATE RETENTION POLICY "my rp" ON "a database" DURATION 1d REPLICATION 1`,
 		},
+		{
+			stmt: `CREATE RETENTION POLICY "my rp" ON "a database" DURATION 1d REPLICATION 1 SHARD DURATION 1h`,
+		},
+		{
+			stmt: `CREATE RETENTION POLICY "my rp" ON "a database" DURATION 52w REPLICATION 1 COLD AFTER 4w DEFAULT`,
+		},
 		{
 			stmt: `ALTER RETENTION POLICY "my rp" ON "a database" DEFAULT`,
 		},
+		{
+			stmt: `CREATE ROLLUP r0 ON "a database"."my rp" INTO rp1 EVERY 1h FROM /^cpu/ AGGREGATES float(mean, max), integer(sum)`,
+		},
+		{
+			stmt: `DROP ROLLUP r0 ON "a database"."my rp"`,
+		},
+		{
+			stmt: `BACKFILL CONTINUOUS QUERY "my cq" ON "a database" FROM '2026-01-01T00:00:00Z' TO '2026-02-01T00:00:00Z'`,
+		},
+		{
+			stmt: `COMPACT SHARD 1 FULL`,
+		},
+		{
+			stmt: `COMPACT SHARDS ON "a database"."my rp"`,
+		},
+		{
+			stmt: `ALTER RETENTION POLICY "my rp" ON "a database" SHARD DURATION 1h`,
+		},
+		{
+			stmt: `ALTER RETENTION POLICY "my rp" ON "a database" COLD AFTER 1w`,
+		},
 		{
 			stmt: `SHOW RETENTION POLICIES ON "a database"`,
 		},
@@ -106,7 +106,12 @@ func (p *Parser) ParseStatement() (Statement, error) {
 	case SET:
 		return p.parseSetPasswordUserStatement()
 	default:
-		return nil, newParseError(tokstr(tok, lit), []string{"SELECT", "DELETE", "SHOW", "CREATE", "DROP", "GRANT", "REVOKE", "ALTER", "SET"}, pos)
+		if isIdentKeyword(tok, lit, "BACKFILL") {
+			return p.parseBackfillContinuousQueryStatement()
+		} else if isIdentKeyword(tok, lit, "COMPACT") {
+			return p.parseCompactShardStatement()
+		}
+		return nil, newParseError(tokstr(tok, lit), []string{"SELECT", "DELETE", "SHOW", "CREATE", "DROP", "GRANT", "REVOKE", "ALTER", "SET", "BACKFILL", "COMPACT"}, pos)
 	}
 }
 
@@ -116,7 +121,7 @@ func (p *Parser) parseShowStatement() (Statement, error) {
 	tok, pos, lit := p.scanIgnoreWhitespace()
 	switch tok {
 	case CONTINUOUS:
-		return p.parseShowContinuousQueriesStatement()
+		return p.parseShowContinuousStatement()
 	case GRANTS:
 		return p.parseGrantsForUserStatement()
 	case DATABASES:
@@ -163,6 +168,10 @@ func (p *Parser) parseShowStatement() (Statement, error) {
 		return p.parseShowUsersStatement()
 	case SUBSCRIPTIONS:
 		return p.parseShowSubscriptionsStatement()
+	case IDENT:
+		if isIdentKeyword(tok, lit, "ROLLUPS") {
+			return p.parseShowRollupsStatement()
+		}
 	}
 
 	showQueryKeywords := []string{
@@ -172,6 +181,7 @@ func (p *Parser) parseShowStatement() (Statement, error) {
 		"GRANTS",
 		"MEASUREMENTS",
 		"RETENTION",
+		"ROLLUPS",
 		"SERIES",
 		"SERVERS",
 		"TAG",
@@ -205,9 +215,11 @@ func (p *Parser) parseCreateStatement() (Statement, error) {
 		return p.parseCreateRetentionPolicyStatement()
 	} else if tok == SUBSCRIPTION {
 		return p.parseCreateSubscriptionStatement()
+	} else if isIdentKeyword(tok, lit, "ROLLUP") {
+		return p.parseCreateRollupStatement()
 	}
 
-	return nil, newParseError(tokstr(tok, lit), []string{"CONTINUOUS", "DATABASE", "USER", "RETENTION", "SUBSCRIPTION"}, pos)
+	return nil, newParseError(tokstr(tok, lit), []string{"CONTINUOUS", "DATABASE", "USER", "RETENTION", "SUBSCRIPTION", "ROLLUP"}, pos)
 }
 
 // parseDropStatement parses a string and returns a drop statement.
@@ -237,7 +249,10 @@ func (p *Parser) parseDropStatement() (Statement, error) {
 	case USER:
 		return p.parseDropUserStatement()
 	default:
-		return nil, newParseError(tokstr(tok, lit), []string{"CONTINUOUS", "DATA", "MEASUREMENT", "META", "RETENTION", "SERIES", "SHARD", "SUBSCRIPTION", "USER"}, pos)
+		if isIdentKeyword(tok, lit, "ROLLUP") {
+			return p.parseDropRollupStatement()
+		}
+		return nil, newParseError(tokstr(tok, lit), []string{"CONTINUOUS", "DATA", "MEASUREMENT", "META", "RETENTION", "ROLLUP", "SERIES", "SHARD", "SUBSCRIPTION", "USER"}, pos)
 	}
 }
 
@@ -339,9 +354,161 @@ func (p *Parser) parseCreateSubscriptionStatement() (*CreateSubscriptionStatemen
 	}
 	stmt.Destinations = destinations
 
+	// Parse optional condition: "WHERE EXPR".
+	condition, err := p.parseCondition()
+	if err != nil {
+		return nil, err
+	} else if condition != nil {
+		if err := ValidateSubscriptionCondition(condition); err != nil {
+			return nil, err
+		}
+	}
+	stmt.Condition = condition
+
+	return stmt, nil
+}
+
+// parseCreateRollupStatement parses a string and returns a CreateRollupStatement.
+// This function assumes the "CREATE ROLLUP" tokens have already been consumed.
+func (p *Parser) parseCreateRollupStatement() (*CreateRollupStatement, error) {
+	stmt := &CreateRollupStatement{}
+
+	// Parse the rollup name and the source database and retention policy.
+	var err error
+	if stmt.Name, stmt.Database, stmt.RetentionPolicy, err = p.parseRollupName(); err != nil {
+		return nil, err
+	}
+
+	// Parse the target retention policy.
+	if tok, pos, lit := p.scanIgnoreWhitespace(); tok != INTO {
+		return nil, newParseError(tokstr(tok, lit), []string{"INTO"}, pos)
+	}
+	if stmt.Target, err = p.parseIdent(); err != nil {
+		return nil, err
+	}
+
+	// Parse the interval.
+	if tok, pos, lit := p.scanIgnoreWhitespace(); tok != EVERY {
+		return nil, newParseError(tokstr(tok, lit), []string{"EVERY"}, pos)
+	}
+	if stmt.Interval, err = p.parseDuration(); err != nil {
+		return nil, err
+	} else if stmt.Interval <= 0 {
+		return nil, errors.New("rollup interval must be greater than zero")
+	}
+
+	// Parse the optional measurement pattern.
+	tok, pos, lit := p.scanIgnoreWhitespace()
+	if tok == FROM {
+		re, err := p.parseRegex()
+		if err != nil {
+			return nil, err
+		} else if re == nil {
+			tok, pos, lit := p.scanIgnoreWhitespace()
+			return nil, newParseError(tokstr(tok, lit), []string{"regex"}, pos)
+		}
+		stmt.Measurements = re
+		tok, pos, lit = p.scanIgnoreWhitespace()
+	}
+
+	// Parse the aggregates for each data type.
+	if !isIdentKeyword(tok, lit, "AGGREGATES") {
+		return nil, newParseError(tokstr(tok, lit), []string{"FROM", "AGGREGATES"}, pos)
+	}
+	for {
+		a, err := p.parseRollupAggregate()
+		if err != nil {
+			return nil, err
+		}
+		for _, other := range stmt.Aggregates {
+			if other.Type == a.Type {
+				return nil, fmt.Errorf("duplicate rollup aggregates for type %s", a.Type)
+			}
+		}
+		stmt.Aggregates = append(stmt.Aggregates, a)
+
+		if tok, _, _ := p.scanIgnoreWhitespace(); tok != COMMA {
+			p.unscan()
+			break
+		}
+	}
+
 	return stmt, nil
 }
 
+// parseRollupAggregate parses the functions applied to a data type by a
+// rollup, e.g. "float(mean, max)".
+func (p *Parser) parseRollupAggregate() (*RollupAggregate, error) {
+	tok, pos, lit := p.scanIgnoreWhitespace()
+	a := &RollupAggregate{}
+	if tok == IDENT {
+		switch strings.ToLower(lit) {
+		case "float":
+			a.Type = Float
+		case "integer":
+			a.Type = Integer
+		case "string":
+			a.Type = String
+		case "boolean":
+			a.Type = Boolean
+		}
+	}
+	if a.Type == Unknown {
+		return nil, newParseError(tokstr(tok, lit), []string{"float", "integer", "string", "boolean"}, pos)
+	}
+
+	if tok, pos, lit := p.scanIgnoreWhitespace(); tok != LPAREN {
+		return nil, newParseError(tokstr(tok, lit), []string{"("}, pos)
+	}
+
+	for {
+		tok, pos, lit := p.scanIgnoreWhitespace()
+		if tok != IDENT {
+			return nil, newParseError(tokstr(tok, lit), []string{"function"}, pos)
+		}
+		name := strings.ToLower(lit)
+
+		valid := false
+		for _, fn := range RollupFunctions[a.Type] {
+			valid = valid || fn == name
+		}
+		if !valid {
+			return nil, &ParseError{Message: fmt.Sprintf("invalid rollup function for %s fields: %s", a.Type, name), Pos: pos}
+		}
+		a.Functions = append(a.Functions, name)
+
+		tok, pos, lit = p.scanIgnoreWhitespace()
+		if tok == RPAREN {
+			return a, nil
+		} else if tok != COMMA {
+			return nil, newParseError(tokstr(tok, lit), []string{",", ")"}, pos)
+		}
+	}
+}
+
+// parseRollupName parses the rollup name and the database and retention
+// policy of the form "name ON db.rp".
+func (p *Parser) parseRollupName() (name, database, rp string, err error) {
+	if name, err = p.parseIdent(); err != nil {
+		return "", "", "", err
+	}
+
+	if tok, pos, lit := p.scanIgnoreWhitespace(); tok != ON {
+		return "", "", "", newParseError(tokstr(tok, lit), []string{"ON"}, pos)
+	}
+
+	if database, err = p.parseIdent(); err != nil {
+		return "", "", "", err
+	}
+	if tok, pos, lit := p.scan(); tok != DOT {
+		return "", "", "", newParseError(tokstr(tok, lit), []string{"."}, pos)
+	}
+	if rp, err = p.parseIdent(); err != nil {
+		return "", "", "", err
+	}
+	return name, database, rp, nil
+}
+
 // parseCreateRetentionPolicyStatement parses a string and returns a create retention policy statement.
 // This function assumes the CREATE RETENTION POLICY tokens have already been consumed.
 func (p *Parser) parseCreateRetentionPolicyStatement() (*CreateRetentionPolicyStatement, error) {
@@ -391,11 +558,32 @@ func (p *Parser) parseCreateRetentionPolicyStatement() (*CreateRetentionPolicySt
 	}
 	stmt.Replication = n
 
+	// Parse optional SHARD DURATION tokens.
+	tok, pos, lit = p.scanIgnoreWhitespace()
+	if tok == SHARD {
+		d, err := p.parseShardDuration()
+		if err != nil {
+			return nil, err
+		}
+		stmt.ShardGroupDuration = d
+		tok, pos, lit = p.scanIgnoreWhitespace()
+	}
+
+	// Parse optional COLD AFTER tokens.
+	if isIdentKeyword(tok, lit, "COLD") {
+		d, err := p.parseColdAfter()
+		if err != nil {
+			return nil, err
+		}
+		stmt.ColdAfter = d
+		tok, pos, lit = p.scanIgnoreWhitespace()
+	}
+
 	// Parse optional DEFAULT token.
-	if tok, pos, lit = p.scanIgnoreWhitespace(); tok == DEFAULT {
+	if tok == DEFAULT {
 		stmt.Default = true
 	} else if tok != EOF && tok != SEMICOLON {
-		return nil, newParseError(tokstr(tok, lit), []string{"DEFAULT"}, pos)
+		return nil, newParseError(tokstr(tok, lit), []string{"SHARD", "COLD", "DEFAULT"}, pos)
 	}
 
 	return stmt, nil
@@ -428,8 +616,8 @@ func (p *Parser) parseAlterRetentionPolicyStatement() (*AlterRetentionPolicyStat
 	}
 	stmt.Database = ident
 
-	// Loop through option tokens (DURATION, REPLICATION, DEFAULT, etc.).
-	maxNumOptions := 3
+	// Loop through option tokens (DURATION, REPLICATION, SHARD DURATION, COLD AFTER, DEFAULT, etc.).
+	maxNumOptions := 5
 Loop:
 	for i := 0; i < maxNumOptions; i++ {
 		tok, pos, lit := p.scanIgnoreWhitespace()
@@ -446,11 +634,25 @@ Loop:
 				return nil, err
 			}
 			stmt.Replication = &n
+		case SHARD:
+			d, err := p.parseShardDuration()
+			if err != nil {
+				return nil, err
+			}
+			stmt.ShardGroupDuration = &d
 		case DEFAULT:
 			stmt.Default = true
 		default:
+			if isIdentKeyword(tok, lit, "COLD") {
+				d, err := p.parseColdAfter()
+				if err != nil {
+					return nil, err
+				}
+				stmt.ColdAfter = &d
+				continue
+			}
 			if i < 1 {
-				return nil, newParseError(tokstr(tok, lit), []string{"DURATION", "RETENTION", "DEFAULT"}, pos)
+				return nil, newParseError(tokstr(tok, lit), []string{"DURATION", "RETENTION", "SHARD", "COLD", "DEFAULT"}, pos)
 			}
 			p.unscan()
 			break Loop
@@ -460,6 +662,25 @@ Loop:
 	return stmt, nil
 }
 
+// parseShardDuration parses the duration of a "SHARD DURATION" clause.
+// This function assumes the SHARD token has already been consumed.
+func (p *Parser) parseShardDuration() (time.Duration, error) {
+	if tok, pos, lit := p.scanIgnoreWhitespace(); tok != DURATION {
+		return 0, newParseError(tokstr(tok, lit), []string{"DURATION"}, pos)
+	}
+	return p.parseDuration()
+}
+
+// parseColdAfter parses the duration of a "COLD AFTER" clause. COLD and AFTER
+// are not keywords so they can still be used as identifiers.
+// This function assumes the COLD token has already been consumed.
+func (p *Parser) parseColdAfter() (time.Duration, error) {
+	if tok, pos, lit := p.scanIgnoreWhitespace(); !isIdentKeyword(tok, lit, "AFTER") {
+		return 0, newParseError(tokstr(tok, lit), []string{"AFTER"}, pos)
+	}
+	return p.parseDuration()
+}
+
 // parseInt parses a string and returns an integer literal.
 func (p *Parser) parseInt(min, max int) (int, error) {
 	tok, pos, lit := p.scanIgnoreWhitespace()
@@ -1241,6 +1462,12 @@ func (p *Parser) parseShowSubscriptionsStatement() (*ShowSubscriptionsStatement,
 	return stmt, nil
 }
 
+// parseShowRollupsStatement parses a string and returns a ShowRollupsStatement.
+// This function assumes the "SHOW ROLLUPS" tokens have already been consumed.
+func (p *Parser) parseShowRollupsStatement() (*ShowRollupsStatement, error) {
+	return &ShowRollupsStatement{}, nil
+}
+
 // parseShowFieldKeysStatement parses a string and returns a ShowSeriesStatement.
 // This function assumes the "SHOW FIELD KEYS" tokens have already been consumed.
 func (p *Parser) parseShowFieldKeysStatement() (*ShowFieldKeysStatement, error) {
@@ -1333,6 +1560,49 @@ func (p *Parser) parseDropShardStatement() (*DropShardStatement, error) {
 	return stmt, nil
 }
 
+// parseCompactShardStatement parses a string and returns a
+// CompactShardStatement. This function assumes the "COMPACT" token has
+// already been consumed.
+func (p *Parser) parseCompactShardStatement() (*CompactShardStatement, error) {
+	var err error
+	stmt := &CompactShardStatement{}
+
+	tok, pos, lit := p.scanIgnoreWhitespace()
+	switch tok {
+	case SHARD:
+		// Parse the ID of the shard to be compacted.
+		if stmt.ID, err = p.parseUInt64(); err != nil {
+			return nil, err
+		}
+	case SHARDS:
+		if tok, pos, lit := p.scanIgnoreWhitespace(); tok != ON {
+			return nil, newParseError(tokstr(tok, lit), []string{"ON"}, pos)
+		}
+
+		// Parse the database and the optional retention policy.
+		if stmt.Database, err = p.parseIdent(); err != nil {
+			return nil, err
+		}
+		if tok, _, _ := p.scan(); tok == DOT {
+			if stmt.RetentionPolicy, err = p.parseIdent(); err != nil {
+				return nil, err
+			}
+		} else {
+			p.unscan()
+		}
+	default:
+		return nil, newParseError(tokstr(tok, lit), []string{"SHARD", "SHARDS"}, pos)
+	}
+
+	// FULL is not a keyword so it can still be used as an identifier.
+	if tok, _, lit := p.scanIgnoreWhitespace(); tok == IDENT && strings.ToUpper(lit) == "FULL" {
+		stmt.Full = true
+	} else {
+		p.unscan()
+	}
+	return stmt, nil
+}
+
 // parseDropServerStatement parses a string and returns a DropServerStatement.
 // This function assumes the "DROP <META|DATA>" tokens have already been consumed.
 func (p *Parser) parseDropServerStatement(tok Token) (*DropServerStatement, error) {
@@ -1369,6 +1639,98 @@ func (p *Parser) parseShowContinuousQueriesStatement() (*ShowContinuousQueriesSt
 	return stmt, nil
 }
 
+// parseBackfillContinuousQueryStatement parses a string and returns a BackfillContinuousQueryStatement.
+// This function assumes the "BACKFILL" token has already been consumed.
+func (p *Parser) parseBackfillContinuousQueryStatement() (*BackfillContinuousQueryStatement, error) {
+	stmt := &BackfillContinuousQueryStatement{}
+
+	// Expect "CONTINUOUS QUERY" tokens.
+	if err := p.parseTokens([]Token{CONTINUOUS, QUERY}); err != nil {
+		return nil, err
+	}
+
+	// Read the id of the query to backfill.
+	ident, err := p.parseIdent()
+	if err != nil {
+		return nil, err
+	}
+	stmt.Name = ident
+
+	// Expect an "ON" keyword.
+	if tok, pos, lit := p.scanIgnoreWhitespace(); tok != ON {
+		return nil, newParseError(tokstr(tok, lit), []string{"ON"}, pos)
+	}
+
+	// Read the name of the database.
+	if stmt.Database, err = p.parseIdent(); err != nil {
+		return nil, err
+	}
+
+	// Parse the time range.
+	if tok, pos, lit := p.scanIgnoreWhitespace(); tok != FROM {
+		return nil, newParseError(tokstr(tok, lit), []string{"FROM"}, pos)
+	}
+	if stmt.StartTime, err = p.parseTimeString(); err != nil {
+		return nil, err
+	}
+
+	if tok, pos, lit := p.scanIgnoreWhitespace(); tok != TO {
+		return nil, newParseError(tokstr(tok, lit), []string{"TO"}, pos)
+	}
+	_, pos, _ := p.scanIgnoreWhitespace()
+	p.unscan()
+	if stmt.EndTime, err = p.parseTimeString(); err != nil {
+		return nil, err
+	}
+
+	if !stmt.EndTime.After(stmt.StartTime) {
+		return nil, &ParseError{Message: "backfill end time must be after start time", Pos: pos}
+	}
+
+	return stmt, nil
+}
+
+// parseTimeString parses a date or date time string literal.
+func (p *Parser) parseTimeString() (time.Time, error) {
+	tok, pos, lit := p.scanIgnoreWhitespace()
+	if tok != STRING {
+		return time.Time{}, newParseError(tokstr(tok, lit), []string{"string"}, pos)
+	}
+
+	if isDateTimeString(lit) {
+		if t, err := time.Parse(DateTimeFormat, lit); err == nil {
+			return t, nil
+		} else if t, err := time.Parse(time.RFC3339Nano, lit); err == nil {
+			return t, nil
+		}
+	} else if isDateString(lit) {
+		if t, err := time.Parse(DateFormat, lit); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, &ParseError{Message: "unable to parse time", Pos: pos}
+}
+
+// parseShowContinuousStatement parses a string and returns either a
+// ShowContinuousQueriesStatement or a ShowContinuousQueryStatusStatement.
+// This function assumes the "SHOW CONTINUOUS" tokens have already been consumed.
+func (p *Parser) parseShowContinuousStatement() (Statement, error) {
+	tok, pos, lit := p.scanIgnoreWhitespace()
+	if tok == QUERY {
+		// STATUS is not a keyword so it can still be used as an identifier.
+		if tok, pos, lit := p.scanIgnoreWhitespace(); !isIdentKeyword(tok, lit, "STATUS") {
+			return nil, newParseError(tokstr(tok, lit), []string{"STATUS"}, pos)
+		}
+		return &ShowContinuousQueryStatusStatement{}, nil
+	}
+	p.unscan()
+
+	if tok != QUERIES {
+		return nil, newParseError(tokstr(tok, lit), []string{"QUERIES", "QUERY"}, pos)
+	}
+	return p.parseShowContinuousQueriesStatement()
+}
+
 // parseShowServersStatement parses a string and returns a ShowServersStatement.
 // This function assumes the "SHOW SERVERS" tokens have already been consumed.
 func (p *Parser) parseShowServersStatement() (*ShowServersStatement, error) {
@@ -1616,6 +1978,18 @@ func (p *Parser) parseDropSubscriptionStatement() (*DropSubscriptionStatement, e
 	return stmt, nil
 }
 
+// parseDropRollupStatement parses a string and returns a DropRollupStatement.
+// This function assumes the "DROP ROLLUP" tokens have already been consumed.
+func (p *Parser) parseDropRollupStatement() (*DropRollupStatement, error) {
+	stmt := &DropRollupStatement{}
+
+	var err error
+	if stmt.Name, stmt.Database, stmt.RetentionPolicy, err = p.parseRollupName(); err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
 // parseDropRetentionPolicyStatement parses a string and returns a DropRetentionPolicyStatement.
 // This function assumes the DROP RETENTION POLICY tokens have been consumed.
 func (p *Parser) parseDropRetentionPolicyStatement() (*DropRetentionPolicyStatement, error) {
@@ -2586,6 +2960,14 @@ func (p *Parser) parseTokenMaybe(expected Token) bool {
 	return true
 }
 
+// isIdentKeyword returns true if tok is an identifier matching keyword,
+// ignoring case. Words that are only keywords within a single statement are
+// matched this way so they are not reserved and can still be used as
+// identifiers everywhere else.
+func isIdentKeyword(tok Token, lit, keyword string) bool {
+	return tok == IDENT && strings.EqualFold(lit, keyword)
+}
+
 // QuoteString returns a quoted string.
 func QuoteString(s string) string {
 	return `'` + strings.NewReplacer("\n", `\n`, `\`, `\\`, `'`, `\'`).Replace(s) + `'`
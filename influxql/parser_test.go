@@ -1021,6 +1021,78 @@ func TestParser_ParseStatement(t *testing.T) {
 			stmt: &influxql.DropServerStatement{NodeID: 123, Meta: false},
 		},
 
+		// BACKFILL CONTINUOUS QUERY statement
+		{
+			s: `BACKFILL CONTINUOUS QUERY cq ON db FROM '2026-01-01' TO '2026-02-01 12:00:00'`,
+			stmt: &influxql.BackfillContinuousQueryStatement{
+				Name:      "cq",
+				Database:  "db",
+				StartTime: mustParseTime("2026-01-01T00:00:00Z"),
+				EndTime:   mustParseTime("2026-02-01T12:00:00Z"),
+			},
+		},
+
+		// BACKFILL is not reserved.
+		{
+			s: `SELECT backfill FROM m`,
+			stmt: &influxql.SelectStatement{
+				IsRawQuery: true,
+				Fields: []*influxql.Field{
+					{Expr: &influxql.VarRef{Val: "backfill"}},
+				},
+				Sources: []influxql.Source{&influxql.Measurement{Name: "m"}},
+			},
+		},
+
+		// COMPACT SHARD statement
+		{
+			s:    `COMPACT SHARD 1`,
+			stmt: &influxql.CompactShardStatement{ID: 1},
+		},
+		{
+			s:    `COMPACT SHARD 1 full`,
+			stmt: &influxql.CompactShardStatement{ID: 1, Full: true},
+		},
+		{
+			s:    `COMPACT SHARDS ON db`,
+			stmt: &influxql.CompactShardStatement{Database: "db"},
+		},
+		{
+			s:    `COMPACT SHARDS ON db.rp FULL`,
+			stmt: &influxql.CompactShardStatement{Database: "db", RetentionPolicy: "rp", Full: true},
+		},
+
+		// COMPACT is not reserved.
+		{
+			s: `SELECT * FROM compact`,
+			stmt: &influxql.SelectStatement{
+				IsRawQuery: true,
+				Fields: []*influxql.Field{
+					{Expr: &influxql.Wildcard{}},
+				},
+				Sources: []influxql.Source{&influxql.Measurement{Name: "compact"}},
+			},
+		},
+
+		// SHOW CONTINUOUS QUERY STATUS statement
+		{
+			s:    `SHOW CONTINUOUS QUERY STATUS`,
+			stmt: &influxql.ShowContinuousQueryStatusStatement{},
+		},
+
+		// STATUS is not reserved.
+		{
+			s: `SELECT status FROM m GROUP BY status`,
+			stmt: &influxql.SelectStatement{
+				IsRawQuery: true,
+				Fields: []*influxql.Field{
+					{Expr: &influxql.VarRef{Val: "status"}},
+				},
+				Sources:    []influxql.Source{&influxql.Measurement{Name: "m"}},
+				Dimensions: []*influxql.Dimension{{Expr: &influxql.VarRef{Val: "status"}}},
+			},
+		},
+
 		// SHOW CONTINUOUS QUERIES statement
 		{
 			s:    `SHOW CONTINUOUS QUERIES`,
@@ -1525,6 +1597,32 @@ func TestParser_ParseStatement(t *testing.T) {
 			},
 		},
 
+		// CREATE RETENTION POLICY ... SHARD DURATION
+		{
+			s: `CREATE RETENTION POLICY policy1 ON testdb DURATION 52w REPLICATION 1 SHARD DURATION 1d DEFAULT`,
+			stmt: &influxql.CreateRetentionPolicyStatement{
+				Name:               "policy1",
+				Database:           "testdb",
+				Duration:           52 * 7 * 24 * time.Hour,
+				Replication:        1,
+				ShardGroupDuration: 24 * time.Hour,
+				Default:            true,
+			},
+		},
+
+		// CREATE RETENTION POLICY ... COLD AFTER
+		{
+			s: `CREATE RETENTION POLICY policy1 ON testdb DURATION 52w REPLICATION 1 SHARD DURATION 1d COLD AFTER 4w`,
+			stmt: &influxql.CreateRetentionPolicyStatement{
+				Name:               "policy1",
+				Database:           "testdb",
+				Duration:           52 * 7 * 24 * time.Hour,
+				Replication:        1,
+				ShardGroupDuration: 24 * time.Hour,
+				ColdAfter:          4 * 7 * 24 * time.Hour,
+			},
+		},
+
 		// ALTER RETENTION POLICY
 		{
 			s:    `ALTER RETENTION POLICY policy1 ON testdb DURATION 1m REPLICATION 4 DEFAULT`,
@@ -1560,6 +1658,37 @@ func TestParser_ParseStatement(t *testing.T) {
 			s:    `ALTER RETENTION POLICY policy1 ON testdb REPLICATION 4`,
 			stmt: newAlterRetentionPolicyStatement("policy1", "testdb", -1, 4, false),
 		},
+		// ALTER RETENTION POLICY with SHARD DURATION
+		{
+			s: `ALTER RETENTION POLICY policy1 ON testdb SHARD DURATION 2h REPLICATION 4`,
+			stmt: func() *influxql.AlterRetentionPolicyStatement {
+				stmt := newAlterRetentionPolicyStatement("policy1", "testdb", -1, 4, false)
+				d := 2 * time.Hour
+				stmt.ShardGroupDuration = &d
+				return stmt
+			}(),
+		},
+		// ALTER RETENTION POLICY with COLD AFTER
+		{
+			s: `ALTER RETENTION POLICY policy1 ON testdb COLD AFTER 7d`,
+			stmt: func() *influxql.AlterRetentionPolicyStatement {
+				stmt := newAlterRetentionPolicyStatement("policy1", "testdb", -1, -1, false)
+				d := 7 * 24 * time.Hour
+				stmt.ColdAfter = &d
+				return stmt
+			}(),
+		},
+		// COLD and AFTER are not reserved.
+		{
+			s: `SELECT after FROM cold`,
+			stmt: &influxql.SelectStatement{
+				IsRawQuery: true,
+				Fields: []*influxql.Field{
+					{Expr: &influxql.VarRef{Val: "after"}},
+				},
+				Sources: []influxql.Source{&influxql.Measurement{Name: "cold"}},
+			},
+		},
 		// ALTER default retention policy unquoted
 		{
 			s:    `ALTER RETENTION POLICY default ON testdb REPLICATION 4`,
@@ -1615,6 +1744,75 @@ func TestParser_ParseStatement(t *testing.T) {
 				Mode:            "ANY",
 			},
 		},
+		{
+			s: `CREATE SUBSCRIPTION "name" ON "db"."rp" DESTINATIONS ALL 'udp://host1:9093' WHERE _name =~ /cpu/ AND host != 'a'`,
+			stmt: &influxql.CreateSubscriptionStatement{
+				Name:            "name",
+				Database:        "db",
+				RetentionPolicy: "rp",
+				Destinations:    []string{"udp://host1:9093"},
+				Mode:            "ALL",
+				Condition:       MustParseExpr(`_name =~ /cpu/ AND host != 'a'`),
+			},
+		},
+
+		// CREATE ROLLUP
+		{
+			s: `CREATE ROLLUP "r0" ON "db"."rp" INTO "rp1h" EVERY 1h FROM /^cpu/ AGGREGATES float(mean, MAX), boolean(last)`,
+			stmt: &influxql.CreateRollupStatement{
+				Name:            "r0",
+				Database:        "db",
+				RetentionPolicy: "rp",
+				Target:          "rp1h",
+				Interval:        time.Hour,
+				Measurements:    &influxql.RegexLiteral{Val: regexp.MustCompile(`^cpu`)},
+				Aggregates: []*influxql.RollupAggregate{
+					{Type: influxql.Float, Functions: []string{"mean", "max"}},
+					{Type: influxql.Boolean, Functions: []string{"last"}},
+				},
+			},
+		},
+		{
+			s: `CREATE ROLLUP r0 ON db.rp INTO rp1h EVERY 10m AGGREGATES integer(sum)`,
+			stmt: &influxql.CreateRollupStatement{
+				Name:            "r0",
+				Database:        "db",
+				RetentionPolicy: "rp",
+				Target:          "rp1h",
+				Interval:        10 * time.Minute,
+				Aggregates: []*influxql.RollupAggregate{
+					{Type: influxql.Integer, Functions: []string{"sum"}},
+				},
+			},
+		},
+
+		// DROP ROLLUP
+		{
+			s:    `DROP ROLLUP "r0" ON "db"."rp"`,
+			stmt: &influxql.DropRollupStatement{Name: "r0", Database: "db", RetentionPolicy: "rp"},
+		},
+
+		// SHOW ROLLUPS
+		{
+			s:    `SHOW ROLLUPS`,
+			stmt: &influxql.ShowRollupsStatement{},
+		},
+
+		// Rollup keywords are not reserved.
+		{
+			s:    `CREATE DATABASE rollups`,
+			stmt: &influxql.CreateDatabaseStatement{Name: "rollups"},
+		},
+		{
+			s: `SELECT aggregates FROM rollup`,
+			stmt: &influxql.SelectStatement{
+				IsRawQuery: true,
+				Fields: []*influxql.Field{
+					{Expr: &influxql.VarRef{Val: "aggregates"}},
+				},
+				Sources: []influxql.Source{&influxql.Measurement{Name: "rollup"}},
+			},
+		},
 
 		// DROP SUBSCRIPTION
 		{
@@ -1633,10 +1831,10 @@ func TestParser_ParseStatement(t *testing.T) {
 		},
 
 		// Errors
-		{s: ``, err: `found EOF, expected SELECT, DELETE, SHOW, CREATE, DROP, GRANT, REVOKE, ALTER, SET at line 1, char 1`},
+		{s: ``, err: `found EOF, expected SELECT, DELETE, SHOW, CREATE, DROP, GRANT, REVOKE, ALTER, SET, BACKFILL, COMPACT at line 1, char 1`},
 		{s: `SELECT`, err: `found EOF, expected identifier, string, number, bool at line 1, char 8`},
 		{s: `SELECT time FROM myseries`, err: `at least 1 non-time field must be queried`},
-		{s: `blah blah`, err: `found blah, expected SELECT, DELETE, SHOW, CREATE, DROP, GRANT, REVOKE, ALTER, SET at line 1, char 1`},
+		{s: `blah blah`, err: `found blah, expected SELECT, DELETE, SHOW, CREATE, DROP, GRANT, REVOKE, ALTER, SET, BACKFILL, COMPACT at line 1, char 1`},
 		{s: `SELECT field1 X`, err: `found X, expected FROM at line 1, char 15`},
 		{s: `SELECT field1 FROM "series" WHERE X +;`, err: `found ;, expected identifier, string, number, bool at line 1, char 38`},
 		{s: `SELECT field1 FROM myseries GROUP`, err: `found EOF, expected BY at line 1, char 35`},
@@ -1735,14 +1933,15 @@ func TestParser_ParseStatement(t *testing.T) {
 		{s: `DROP SERIES FROM src WHERE`, err: `found EOF, expected identifier, string, number, bool at line 1, char 28`},
 		{s: `DROP META SERVER`, err: `found EOF, expected number at line 1, char 18`},
 		{s: `DROP DATA SERVER abc`, err: `found abc, expected number at line 1, char 18`},
-		{s: `SHOW CONTINUOUS`, err: `found EOF, expected QUERIES at line 1, char 17`},
+		{s: `SHOW CONTINUOUS`, err: `found EOF, expected QUERIES, QUERY at line 1, char 17`},
+		{s: `SHOW CONTINUOUS QUERY`, err: `found EOF, expected STATUS at line 1, char 23`},
 		{s: `SHOW RETENTION`, err: `found EOF, expected POLICIES at line 1, char 16`},
 		{s: `SHOW RETENTION ON`, err: `found ON, expected POLICIES at line 1, char 16`},
 		{s: `SHOW RETENTION POLICIES`, err: `found EOF, expected ON at line 1, char 25`},
 		{s: `SHOW RETENTION POLICIES mydb`, err: `found mydb, expected ON at line 1, char 25`},
 		{s: `SHOW RETENTION POLICIES ON`, err: `found EOF, expected identifier at line 1, char 28`},
 		{s: `SHOW SHARD`, err: `found EOF, expected GROUPS at line 1, char 12`},
-		{s: `SHOW FOO`, err: `found FOO, expected CONTINUOUS, DATABASES, DIAGNOSTICS, FIELD, GRANTS, MEASUREMENTS, RETENTION, SERIES, SERVERS, SHARD, SHARDS, STATS, SUBSCRIPTIONS, TAG, USERS at line 1, char 6`},
+		{s: `SHOW FOO`, err: `found FOO, expected CONTINUOUS, DATABASES, DIAGNOSTICS, FIELD, GRANTS, MEASUREMENTS, RETENTION, ROLLUPS, SERIES, SERVERS, SHARD, SHARDS, STATS, SUBSCRIPTIONS, TAG, USERS at line 1, char 6`},
 		{s: `SHOW STATS FOR`, err: `found EOF, expected string at line 1, char 16`},
 		{s: `SHOW DIAGNOSTICS FOR`, err: `found EOF, expected string at line 1, char 22`},
 		{s: `SHOW GRANTS`, err: `found EOF, expected FOR at line 1, char 13`},
@@ -1755,8 +1954,8 @@ func TestParser_ParseStatement(t *testing.T) {
 		{s: `CREATE CONTINUOUS QUERY`, err: `found EOF, expected identifier at line 1, char 25`},
 		{s: `CREATE CONTINUOUS QUERY cq ON db RESAMPLE FOR 5s BEGIN SELECT mean(value) INTO cpu_mean FROM cpu GROUP BY time(10s) END`, err: `FOR duration must be >= GROUP BY time duration: must be a minimum of 10s, got 5s`},
 		{s: `CREATE CONTINUOUS QUERY cq ON db RESAMPLE EVERY 10s FOR 5s BEGIN SELECT mean(value) INTO cpu_mean FROM cpu GROUP BY time(5s) END`, err: `FOR duration must be >= GROUP BY time duration: must be a minimum of 10s, got 5s`},
-		{s: `DROP FOO`, err: `found FOO, expected CONTINUOUS, DATA, MEASUREMENT, META, RETENTION, SERIES, SHARD, SUBSCRIPTION, USER at line 1, char 6`},
-		{s: `CREATE FOO`, err: `found FOO, expected CONTINUOUS, DATABASE, USER, RETENTION, SUBSCRIPTION at line 1, char 8`},
+		{s: `DROP FOO`, err: `found FOO, expected CONTINUOUS, DATA, MEASUREMENT, META, RETENTION, ROLLUP, SERIES, SHARD, SUBSCRIPTION, USER at line 1, char 6`},
+		{s: `CREATE FOO`, err: `found FOO, expected CONTINUOUS, DATABASE, USER, RETENTION, SUBSCRIPTION, ROLLUP at line 1, char 8`},
 		{s: `CREATE DATABASE`, err: `found EOF, expected identifier at line 1, char 17`},
 		{s: `CREATE DATABASE "testdb" WITH`, err: `found EOF, expected DURATION, REPLICATION, NAME at line 1, char 31`},
 		{s: `CREATE DATABASE "testdb" WITH DURATION`, err: `found EOF, expected duration at line 1, char 40`},
@@ -1795,6 +1994,24 @@ func TestParser_ParseStatement(t *testing.T) {
 		{s: `CREATE SUBSCRIPTION "name" ON "db"."rp"`, err: `found EOF, expected DESTINATIONS at line 1, char 40`},
 		{s: `CREATE SUBSCRIPTION "name" ON "db"."rp" DESTINATIONS`, err: `found EOF, expected ALL, ANY at line 1, char 54`},
 		{s: `CREATE SUBSCRIPTION "name" ON "db"."rp" DESTINATIONS ALL `, err: `found EOF, expected string at line 1, char 59`},
+		{s: `CREATE SUBSCRIPTION "name" ON "db"."rp" DESTINATIONS ALL 'udp://host1:9093' WHERE time > now()`, err: `invalid subscription condition: time > now()`},
+		{s: `CREATE SUBSCRIPTION "name" ON "db"."rp" DESTINATIONS ALL 'udp://host1:9093' WHERE time = 'a'`, err: `invalid subscription condition: time = 'a': time cannot be used`},
+		{s: `CREATE SUBSCRIPTION "name" ON "db"."rp" DESTINATIONS ALL 'udp://host1:9093' WHERE host = region`, err: `invalid subscription condition: host = region: expected string or regex comparison`},
+		{s: `CREATE ROLLUP r0 ON db`, err: `found EOF, expected . at line 1, char 24`},
+		{s: `CREATE ROLLUP r0 ON db.rp EVERY 1h`, err: `found EVERY, expected INTO at line 1, char 27`},
+		{s: `CREATE ROLLUP r0 ON db.rp INTO rp1 EVERY 1h`, err: `found EOF, expected FROM, AGGREGATES at line 1, char 44`},
+		{s: `CREATE ROLLUP r0 ON db.rp INTO rp1 EVERY 1h FROM cpu AGGREGATES float(mean)`, err: `found cpu, expected regex at line 1, char 50`},
+		{s: `CREATE ROLLUP r0 ON db.rp INTO rp1 EVERY 1h AGGREGATES time(mean)`, err: `found time, expected float, integer, string, boolean at line 1, char 56`},
+		{s: `CREATE ROLLUP r0 ON db.rp INTO rp1 EVERY 1h AGGREGATES string(mean)`, err: `invalid rollup function for string fields: mean at line 1, char 63`},
+		{s: `CREATE ROLLUP r0 ON db.rp INTO rp1 EVERY 1h AGGREGATES float(mean), float(max)`, err: `duplicate rollup aggregates for type float`},
+		{s: `DROP ROLLUP r0`, err: `found EOF, expected ON at line 1, char 16`},
+		{s: `BACKFILL CONTINUOUS QUERY cq ON db`, err: `found EOF, expected FROM at line 1, char 36`},
+		{s: `BACKFILL CONTINUOUS QUERY cq ON db FROM now()`, err: `found now, expected string at line 1, char 41`},
+		{s: `BACKFILL CONTINUOUS QUERY cq ON db FROM 'yesterday' TO '2026-01-01'`, err: `unable to parse time at line 1, char 40`},
+		{s: `BACKFILL CONTINUOUS QUERY cq ON db FROM '2026-01-01' TO '2026-01-01'`, err: `backfill end time must be after start time at line 1, char 56`},
+		{s: `COMPACT`, err: `found EOF, expected SHARD, SHARDS at line 1, char 9`},
+		{s: `COMPACT SHARD`, err: `found EOF, expected number at line 1, char 15`},
+		{s: `COMPACT SHARDS db`, err: `found db, expected ON at line 1, char 16`},
 		{s: `GRANT`, err: `found EOF, expected READ, WRITE, ALL [PRIVILEGES] at line 1, char 7`},
 		{s: `GRANT BOGUS`, err: `found BOGUS, expected READ, WRITE, ALL [PRIVILEGES] at line 1, char 7`},
 		{s: `GRANT READ`, err: `found EOF, expected ON at line 1, char 12`},
@@ -1871,12 +2088,16 @@ func TestParser_ParseStatement(t *testing.T) {
 		{s: `CREATE RETENTION POLICY policy1 ON testdb DURATION 1h REPLICATION 3.14`, err: `number must be an integer at line 1, char 67`},
 		{s: `CREATE RETENTION POLICY policy1 ON testdb DURATION 1h REPLICATION 0`, err: `invalid value 0: must be 1 <= n <= 2147483647 at line 1, char 67`},
 		{s: `CREATE RETENTION POLICY policy1 ON testdb DURATION 1h REPLICATION bad`, err: `found bad, expected number at line 1, char 67`},
-		{s: `CREATE RETENTION POLICY policy1 ON testdb DURATION 1h REPLICATION 1 foo`, err: `found foo, expected DEFAULT at line 1, char 69`},
+		{s: `CREATE RETENTION POLICY policy1 ON testdb DURATION 1h REPLICATION 1 foo`, err: `found foo, expected SHARD, COLD, DEFAULT at line 1, char 69`},
+		{s: `CREATE RETENTION POLICY policy1 ON testdb DURATION 1h REPLICATION 1 COLD 1d`, err: `found 1d, expected AFTER at line 1, char 74`},
+		{s: `CREATE RETENTION POLICY policy1 ON testdb DURATION 1h REPLICATION 1 SHARD`, err: `found EOF, expected DURATION at line 1, char 75`},
+		{s: `CREATE RETENTION POLICY policy1 ON testdb DURATION 1h REPLICATION 1 SHARD DURATION`, err: `found EOF, expected duration at line 1, char 84`},
 		{s: `ALTER`, err: `found EOF, expected RETENTION at line 1, char 7`},
 		{s: `ALTER RETENTION`, err: `found EOF, expected POLICY at line 1, char 17`},
 		{s: `ALTER RETENTION POLICY`, err: `found EOF, expected identifier at line 1, char 24`},
 		{s: `ALTER RETENTION POLICY policy1`, err: `found EOF, expected ON at line 1, char 32`}, {s: `ALTER RETENTION POLICY policy1 ON`, err: `found EOF, expected identifier at line 1, char 35`},
-		{s: `ALTER RETENTION POLICY policy1 ON testdb`, err: `found EOF, expected DURATION, RETENTION, DEFAULT at line 1, char 42`},
+		{s: `ALTER RETENTION POLICY policy1 ON testdb`, err: `found EOF, expected DURATION, RETENTION, SHARD, COLD, DEFAULT at line 1, char 42`},
+		{s: `ALTER RETENTION POLICY policy1 ON testdb SHARD 1h`, err: `found 1h, expected DURATION at line 1, char 48`},
 		{s: `SET`, err: `found EOF, expected PASSWORD at line 1, char 5`},
 		{s: `SET PASSWORD`, err: `found EOF, expected FOR at line 1, char 14`},
 		{s: `SET PASSWORD something`, err: `found something, expected FOR at line 1, char 14`},
@@ -43,3 +43,34 @@ func NewStatistics(key, name string, tags map[string]string) *expvar.Map {
 
 	return statMap
 }
+
+var (
+	gaugesMu sync.RWMutex
+	gauges   = make(map[string]map[string]struct{})
+)
+
+// RegisterGauges records which values of the statistics with the given name
+// are gauges, i.e. values which can go up and down.  All other values are
+// treated as counters when statistics are exported.
+func RegisterGauges(name string, keys ...string) {
+	gaugesMu.Lock()
+	defer gaugesMu.Unlock()
+
+	m := gauges[name]
+	if m == nil {
+		m = make(map[string]struct{}, len(keys))
+		gauges[name] = m
+	}
+	for _, key := range keys {
+		m[key] = struct{}{}
+	}
+}
+
+// IsGauge returns true if the value key of the statistics with the given name
+// has been registered as a gauge.
+func IsGauge(name, key string) bool {
+	gaugesMu.RLock()
+	defer gaugesMu.RUnlock()
+	_, ok := gauges[name][key]
+	return ok
+}
@@ -142,11 +142,25 @@ func ParseKey(buf string) (string, Tags, error) {
 // ParsePointsWithPrecision is similar to ParsePoints, but allows the
 // caller to provide a precision for time.
 func ParsePointsWithPrecision(buf []byte, defaultTime time.Time, precision string) ([]Point, error) {
+	points, _, err := parsePoints(buf, defaultTime, precision, false)
+	return points, err
+}
+
+// ParsePointsWithLines is similar to ParsePointsWithPrecision, but also returns
+// the line number within buf of each parsed point. Lines which fail to parse are
+// returned as LineErrors.
+func ParsePointsWithLines(buf []byte, defaultTime time.Time, precision string) ([]Point, []int, error) {
+	return parsePoints(buf, defaultTime, precision, true)
+}
+
+func parsePoints(buf []byte, defaultTime time.Time, precision string, withLines bool) ([]Point, []int, error) {
 	points := []Point{}
 	var (
 		pos    int
 		block  []byte
-		failed []string
+		line   int
+		lines  []int
+		failed LineErrors
 	)
 	for {
 		pos, block = scanLine(buf, pos)
@@ -156,6 +170,10 @@ func ParsePointsWithPrecision(buf []byte, defaultTime time.Time, precision strin
 			break
 		}
 
+		// quoted field values may contain newlines so count every line in the block
+		lineN := line + 1
+		line += 1 + bytes.Count(block, []byte{'\n'})
+
 		// lines which start with '#' are comments
 		start := skipWhitespace(block, 0)
 
@@ -175,9 +193,12 @@ func ParsePointsWithPrecision(buf []byte, defaultTime time.Time, precision strin
 
 		pt, err := parsePoint(block[start:len(block)], defaultTime, precision)
 		if err != nil {
-			failed = append(failed, fmt.Sprintf("unable to parse '%s': %v", string(block[start:len(block)]), err))
+			failed = append(failed, &LineError{Line: lineN, Text: string(block[start:len(block)]), Err: err})
 		} else {
 			points = append(points, pt)
+			if withLines {
+				lines = append(lines, lineN)
+			}
 		}
 
 		if pos >= len(buf) {
@@ -186,10 +207,32 @@ func ParsePointsWithPrecision(buf []byte, defaultTime time.Time, precision strin
 
 	}
 	if len(failed) > 0 {
-		return points, fmt.Errorf("%s", strings.Join(failed, "\n"))
+		return points, lines, failed
 	}
-	return points, nil
+	return points, lines, nil
+
+}
+
+// LineError is returned when a line of line protocol cannot be parsed.
+type LineError struct {
+	Line int    // line number within the buffer, starting at 1
+	Text string // text of the line
+	Err  error
+}
 
+func (e *LineError) Error() string {
+	return fmt.Sprintf("unable to parse '%s': %v", e.Text, e.Err)
+}
+
+// LineErrors is returned when one or more lines cannot be parsed.
+type LineErrors []*LineError
+
+func (a LineErrors) Error() string {
+	s := make([]string, len(a))
+	for i, e := range a {
+		s[i] = e.Error()
+	}
+	return strings.Join(s, "\n")
 }
 
 func parsePoint(buf []byte, defaultTime time.Time, precision string) (Point, error) {
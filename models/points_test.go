@@ -381,6 +381,34 @@ func TestParsePointBadNumber(t *testing.T) {
 	}
 }
 
+func TestParsePointsWithLines(t *testing.T) {
+	buf := `cpu value=1 1
+# comment
+cpu value=2a 2
+cpu str="multi
+line" 3
+cpu value= 4
+cpu value=5 5`
+
+	points, lines, err := models.ParsePointsWithLines([]byte(buf), time.Unix(0, 0), "n")
+	if len(points) != 3 {
+		t.Fatalf("unexpected point count: %d", len(points))
+	} else if !reflect.DeepEqual(lines, []int{1, 4, 7}) {
+		t.Fatalf("unexpected lines: %v", lines)
+	}
+
+	lerrs, ok := err.(models.LineErrors)
+	if !ok {
+		t.Fatalf("unexpected error: %#v", err)
+	} else if len(lerrs) != 2 {
+		t.Fatalf("unexpected error count: %d", len(lerrs))
+	} else if lerrs[0].Line != 3 || lerrs[0].Text != "cpu value=2a 2" {
+		t.Fatalf("unexpected line error: %#v", lerrs[0])
+	} else if lerrs[1].Line != 6 || lerrs[1].Text != "cpu value= 4" {
+		t.Fatalf("unexpected line error: %#v", lerrs[1])
+	}
+}
+
 func TestParsePointMaxInt64(t *testing.T) {
 	// out of range
 	_, err := models.ParsePointsString(`cpu,host=serverA,region=us-west value=9223372036854775808i`)
@@ -136,6 +136,13 @@ func (m *Monitor) DeregisterDiagnosticsClient(name string) {
 	delete(m.diagRegistrations, name)
 }
 
+func init() {
+	influxdb.RegisterGauges("runtime",
+		"Alloc", "Sys", "HeapAlloc", "HeapSys", "HeapIdle", "HeapInUse",
+		"HeapReleased", "HeapObjects", "NumGoroutine",
+	)
+}
+
 // Statistics returns the combined statistics for all expvar data. The given
 // tags are added to each of the returned statistics.
 func (m *Monitor) Statistics(tags map[string]string) ([]*Statistic, error) {
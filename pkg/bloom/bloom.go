@@ -0,0 +1,133 @@
+// Package bloom implements a Bloom filter for testing set membership.
+package bloom // import "github.com/influxdata/influxdb/pkg/bloom"
+
+import (
+	"errors"
+	"math"
+)
+
+// MaxHashes bounds the number of hash functions of a filter.
+const MaxHashes = 32
+
+// Filter is a Bloom filter. Contains never returns false for an inserted key
+// but may return true for keys that were never inserted.
+type Filter struct {
+	b []byte
+	k uint8
+}
+
+// NewFilter returns a filter sized for n keys using bitsPerKey bits each.
+// About 10 bits per key gives a false positive rate of 1%.
+func NewFilter(n, bitsPerKey int) *Filter {
+	if bitsPerKey < 1 {
+		bitsPerKey = 1
+	}
+
+	// Use at least 64 bits so small filters are still useful.
+	bits := n * bitsPerKey
+	if bits < 64 {
+		bits = 64
+	}
+
+	// ln(2) * bits/key hash functions minimize false positives.
+	k := int(math.Ln2*float64(bitsPerKey) + 0.5)
+	if k < 1 {
+		k = 1
+	} else if k > MaxHashes {
+		k = MaxHashes
+	}
+
+	return &Filter{b: make([]byte, (bits+7)/8), k: uint8(k)}
+}
+
+// Insert adds key to the filter.
+func (f *Filter) Insert(key []byte) {
+	h := uint64(offset64)
+	for _, c := range key {
+		h = (h ^ uint64(c)) * prime64
+	}
+	f.set(h)
+}
+
+// InsertString adds key to the filter.
+func (f *Filter) InsertString(key string) {
+	h := uint64(offset64)
+	for i := 0; i < len(key); i++ {
+		h = (h ^ uint64(key[i])) * prime64
+	}
+	f.set(h)
+}
+
+// Contains returns false if key was definitely not inserted.
+func (f *Filter) Contains(key []byte) bool {
+	h := uint64(offset64)
+	for _, c := range key {
+		h = (h ^ uint64(c)) * prime64
+	}
+	return f.isSet(h)
+}
+
+// ContainsString returns false if key was definitely not inserted.
+func (f *Filter) ContainsString(key string) bool {
+	h := uint64(offset64)
+	for i := 0; i < len(key); i++ {
+		h = (h ^ uint64(key[i])) * prime64
+	}
+	return f.isSet(h)
+}
+
+// FNV-1a constants. The key is hashed once and the two halves of the hash
+// combined to derive each of the k bit positions.
+const (
+	offset64 = 14695981039346656037
+	prime64  = 1099511628211
+)
+
+func (f *Filter) set(h uint64) {
+	m := uint64(len(f.b)) * 8
+	h1, h2 := h&math.MaxUint32, h>>32|1
+	for i := uint64(0); i < uint64(f.k); i++ {
+		pos := (h1 + i*h2) % m
+		f.b[pos/8] |= 1 << (pos % 8)
+	}
+}
+
+func (f *Filter) isSet(h uint64) bool {
+	m := uint64(len(f.b)) * 8
+	h1, h2 := h&math.MaxUint32, h>>32|1
+	for i := uint64(0); i < uint64(f.k); i++ {
+		pos := (h1 + i*h2) % m
+		if f.b[pos/8]&(1<<(pos%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// MarshalBinary encodes the filter as its bits followed by a byte holding
+// the number of hash functions.
+func (f *Filter) MarshalBinary() ([]byte, error) {
+	b := make([]byte, len(f.b)+1)
+	copy(b, f.b)
+	b[len(f.b)] = f.k
+	return b, nil
+}
+
+// UnmarshalBinary decodes a filter encoded by MarshalBinary. The filter
+// refers to b rather than copying it, so b must not be modified while the
+// filter is in use.
+func (f *Filter) UnmarshalBinary(b []byte) error {
+	if len(b) < 2 {
+		return errors.New("bloom filter too short")
+	} else if k := b[len(b)-1]; k < 1 || k > MaxHashes {
+		return errors.New("invalid number of bloom filter hashes")
+	}
+
+	f.b, f.k = b[:len(b)-1], b[len(b)-1]
+	return nil
+}
+
+// Size returns the size of the filter in bytes.
+func (f *Filter) Size() int {
+	return len(f.b)
+}
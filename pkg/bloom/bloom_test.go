@@ -0,0 +1,55 @@
+package bloom
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestFilter_Contains(t *testing.T) {
+	const n = 10000
+	f := NewFilter(n, 10)
+	for i := 0; i < n; i++ {
+		f.Insert([]byte(fmt.Sprintf("cpu,host=server%d", i)))
+	}
+
+	for i := 0; i < n; i++ {
+		key := fmt.Sprintf("cpu,host=server%d", i)
+		if !f.Contains([]byte(key)) || !f.ContainsString(key) {
+			t.Fatalf("expected filter to contain %s", key)
+		}
+	}
+
+	// About 1% of other keys are false positives with 10 bits per key.
+	var fp int
+	for i := 0; i < n; i++ {
+		if f.ContainsString(fmt.Sprintf("mem,host=server%d", i)) {
+			fp++
+		}
+	}
+	if rate := float64(fp) / n; rate > 0.02 {
+		t.Fatalf("false positive rate too high: %f", rate)
+	}
+}
+
+func TestFilter_MarshalBinary(t *testing.T) {
+	f := NewFilter(100, 10)
+	f.InsertString("cpu")
+
+	b, err := f.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var other Filter
+	if err := other.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	} else if !other.ContainsString("cpu") {
+		t.Fatal("expected unmarshaled filter to contain key")
+	} else if other.Size() != f.Size() {
+		t.Fatalf("size: got %d, exp %d", other.Size(), f.Size())
+	}
+
+	if err := other.UnmarshalBinary([]byte{0xff, 0}); err == nil {
+		t.Fatal("expected error unmarshaling filter without hashes")
+	}
+}
@@ -0,0 +1,125 @@
+// Package hll implements the HyperLogLog cardinality estimator.
+package hll // import "github.com/influxdata/influxdb/pkg/hll"
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+)
+
+const (
+	// MinPrecision and MaxPrecision bound the number of bits used to select
+	// a register.
+	MinPrecision = 4
+	MaxPrecision = 18
+
+	// DefaultPrecision uses 16KB of registers for a standard error of ~0.8%.
+	DefaultPrecision = 14
+)
+
+// Sketch estimates the number of distinct values added to it.
+type Sketch struct {
+	p         uint8
+	registers []uint8
+}
+
+// NewSketch returns a sketch with 2^p registers. The standard error of the
+// estimate is about 1.04/sqrt(2^p).
+func NewSketch(p uint8) (*Sketch, error) {
+	if p < MinPrecision || p > MaxPrecision {
+		return nil, fmt.Errorf("precision must be between %d and %d", MinPrecision, MaxPrecision)
+	}
+	return &Sketch{p: p, registers: make([]uint8, 1<<p)}, nil
+}
+
+// MustNewSketch is like NewSketch but panics on an invalid precision.
+func MustNewSketch(p uint8) *Sketch {
+	s, err := NewSketch(p)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// Add adds a value to the sketch.
+func (s *Sketch) Add(v []byte) {
+	x := hash(v)
+
+	// The top p bits select the register and the position of the first set
+	// bit in the rest of the hash is recorded in it.
+	i := x >> (64 - s.p)
+	var rho uint8 = 1
+	for w := x << s.p; rho <= 64-s.p && w&(1<<63) == 0; w <<= 1 {
+		rho++
+	}
+
+	if rho > s.registers[i] {
+		s.registers[i] = rho
+	}
+}
+
+// Merge adds the values of other to the sketch. Both sketches must have the
+// same precision.
+func (s *Sketch) Merge(other *Sketch) error {
+	if s.p != other.p {
+		return fmt.Errorf("cannot merge sketches of precision %d and %d", s.p, other.p)
+	}
+	for i, r := range other.registers {
+		if r > s.registers[i] {
+			s.registers[i] = r
+		}
+	}
+	return nil
+}
+
+// Count returns the estimated number of distinct values added to the sketch.
+func (s *Sketch) Count() uint64 {
+	m := float64(len(s.registers))
+
+	var sum float64
+	var zeros int
+	for _, r := range s.registers {
+		sum += 1 / float64(uint64(1)<<r)
+		if r == 0 {
+			zeros++
+		}
+	}
+
+	estimate := alpha(m) * m * m / sum
+
+	// Use linear counting for small cardinalities, where the raw estimate
+	// is biased.
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(estimate + 0.5)
+}
+
+// alpha returns the bias correction constant for m registers.
+func alpha(m float64) float64 {
+	switch m {
+	case 16:
+		return 0.673
+	case 32:
+		return 0.697
+	case 64:
+		return 0.709
+	}
+	return 0.7213 / (1 + 1.079/m)
+}
+
+// hash returns a 64-bit hash of v. FNV-1a alone does not mix the high bits
+// well enough for short keys, so its result is passed through the finalizer
+// of MurmurHash3.
+func hash(v []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(v)
+	x := h.Sum64()
+
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
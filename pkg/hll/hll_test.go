@@ -0,0 +1,47 @@
+package hll
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestSketch_Count(t *testing.T) {
+	for _, n := range []int{0, 1, 100, 10000, 1000000} {
+		s := MustNewSketch(DefaultPrecision)
+		for i := 0; i < n; i++ {
+			s.Add([]byte(fmt.Sprintf("cpu,host=server%d", i)))
+
+			// Duplicates must not change the estimate.
+			s.Add([]byte(fmt.Sprintf("cpu,host=server%d", i)))
+		}
+
+		if got := s.Count(); math.Abs(float64(got)-float64(n)) > 0.03*float64(n) {
+			t.Errorf("count of %d values: got %d", n, got)
+		}
+	}
+}
+
+func TestSketch_Merge(t *testing.T) {
+	a, b := MustNewSketch(DefaultPrecision), MustNewSketch(DefaultPrecision)
+	for i := 0; i < 20000; i++ {
+		a.Add([]byte(fmt.Sprintf("key%d", i)))
+		b.Add([]byte(fmt.Sprintf("key%d", i+10000)))
+	}
+
+	if err := a.Merge(b); err != nil {
+		t.Fatal(err)
+	} else if got := a.Count(); math.Abs(float64(got)-30000) > 0.03*30000 {
+		t.Fatalf("merged count: got %d, exp ~30000", got)
+	}
+
+	if err := a.Merge(MustNewSketch(10)); err == nil {
+		t.Fatal("expected error merging sketches of different precision")
+	}
+}
+
+func TestNewSketch_InvalidPrecision(t *testing.T) {
+	if _, err := NewSketch(MaxPrecision + 1); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -0,0 +1,244 @@
+// Package prometheus converts Prometheus remote storage requests into points
+// and queries, and query results back into Prometheus time series.
+package prometheus // import "github.com/influxdata/influxdb/prometheus"
+
+//go:generate protoc --gogo_out=. remote/remote.proto
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/influxdata/influxdb/influxql"
+	"github.com/influxdata/influxdb/models"
+	"github.com/influxdata/influxdb/prometheus/remote"
+)
+
+const (
+	// MeasurementName is the measurement used when a time series has no
+	// metric name label.
+	MeasurementName = "prom_metric_not_specified"
+
+	// FieldName is the field that all Prometheus sample values are written to.
+	FieldName = "value"
+
+	// MetricNameLabel is the label Prometheus uses for the metric name.
+	MetricNameLabel = "__name__"
+)
+
+// ErrInvalidValueDropped is returned when samples with NaN or infinite
+// values were dropped from a write since they cannot be stored.
+var ErrInvalidValueDropped = errors.New("dropped NaN or Inf values from Prometheus since they are not supported")
+
+// WriteRequestToPoints converts a Prometheus remote write request into points.
+// The metric name is used as the measurement and the remaining labels as tags.
+// Samples which cannot be stored are dropped and ErrInvalidValueDropped is
+// returned along with the remaining points.
+func WriteRequestToPoints(req *remote.WriteRequest) ([]models.Point, error) {
+	var maxPoints int
+	for _, ts := range req.Timeseries {
+		maxPoints += len(ts.Samples)
+	}
+	points := make([]models.Point, 0, maxPoints)
+
+	var droppedInvalid bool
+	for _, ts := range req.Timeseries {
+		name := MeasurementName
+		tags := make(models.Tags, len(ts.Labels))
+		for _, l := range ts.Labels {
+			if l.Name == MetricNameLabel {
+				name = l.Value
+				continue
+			}
+			tags[l.Name] = l.Value
+		}
+
+		for _, s := range ts.Samples {
+			if math.IsNaN(s.Value) || math.IsInf(s.Value, 0) {
+				droppedInvalid = true
+				continue
+			}
+
+			p, err := models.NewPoint(name, tags, models.Fields{FieldName: s.Value}, time.Unix(0, s.TimestampMs*int64(time.Millisecond)))
+			if err != nil {
+				return nil, err
+			}
+			points = append(points, p)
+		}
+	}
+
+	if droppedInvalid {
+		return points, ErrInvalidValueDropped
+	}
+	return points, nil
+}
+
+// ReadRequestToInfluxQLQuery converts a Prometheus remote read request into a
+// query with one SELECT statement per Prometheus query, in the same order.
+func ReadRequestToInfluxQLQuery(req *remote.ReadRequest, db, rp string) (*influxql.Query, error) {
+	q := &influxql.Query{}
+	for _, pq := range req.Queries {
+		stmt, err := selectStatement(pq, db, rp)
+		if err != nil {
+			return nil, err
+		}
+		q.Statements = append(q.Statements, stmt)
+	}
+	return q, nil
+}
+
+// selectStatement returns a raw query for the sample values of every series
+// matching the query's label matchers and time range.
+func selectStatement(q *remote.Query, db, rp string) (*influxql.SelectStatement, error) {
+	var src influxql.Source = &influxql.Measurement{
+		Database:        db,
+		RetentionPolicy: rp,
+		Regex:           &influxql.RegexLiteral{Val: regexp.MustCompile(".+")},
+	}
+
+	cond := timeCondition(q.StartTimestampMs, q.EndTimestampMs)
+	for _, m := range q.Matchers {
+		if m.Name == MetricNameLabel {
+			var err error
+			if src, err = measurementSource(m, db, rp); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		expr, err := matcherCondition(m)
+		if err != nil {
+			return nil, err
+		}
+		cond = &influxql.BinaryExpr{Op: influxql.AND, LHS: cond, RHS: expr}
+	}
+
+	return &influxql.SelectStatement{
+		Fields:     influxql.Fields{{Expr: &influxql.VarRef{Val: FieldName}}},
+		Sources:    influxql.Sources{src},
+		Condition:  cond,
+		Dimensions: influxql.Dimensions{{Expr: &influxql.Wildcard{}}},
+		IsRawQuery: true,
+	}, nil
+}
+
+// timeCondition returns a condition for an inclusive millisecond time range.
+func timeCondition(start, end int64) influxql.Expr {
+	return &influxql.BinaryExpr{
+		Op: influxql.AND,
+		LHS: &influxql.BinaryExpr{
+			Op:  influxql.GTE,
+			LHS: &influxql.VarRef{Val: "time"},
+			RHS: &influxql.TimeLiteral{Val: time.Unix(0, start*int64(time.Millisecond)).UTC()},
+		},
+		RHS: &influxql.BinaryExpr{
+			Op:  influxql.LTE,
+			LHS: &influxql.VarRef{Val: "time"},
+			RHS: &influxql.TimeLiteral{Val: time.Unix(0, end*int64(time.Millisecond)).UTC()},
+		},
+	}
+}
+
+// measurementSource returns the source for a matcher on the metric name.
+func measurementSource(m *remote.LabelMatcher, db, rp string) (influxql.Source, error) {
+	mm := &influxql.Measurement{Database: db, RetentionPolicy: rp}
+	switch m.Type {
+	case remote.MatchType_EQUAL:
+		mm.Name = m.Value
+	case remote.MatchType_REGEX_MATCH:
+		re, err := anchoredRegex(m.Value)
+		if err != nil {
+			return nil, err
+		}
+		mm.Regex = &influxql.RegexLiteral{Val: re}
+	default:
+		return nil, fmt.Errorf("unsupported match type %s for label %s", m.Type, MetricNameLabel)
+	}
+	return mm, nil
+}
+
+// matcherCondition returns the tag condition for a label matcher.
+func matcherCondition(m *remote.LabelMatcher) (influxql.Expr, error) {
+	var op influxql.Token
+	var rhs influxql.Expr
+	switch m.Type {
+	case remote.MatchType_EQUAL, remote.MatchType_NOT_EQUAL:
+		op = influxql.EQ
+		if m.Type == remote.MatchType_NOT_EQUAL {
+			op = influxql.NEQ
+		}
+		rhs = &influxql.StringLiteral{Val: m.Value}
+	case remote.MatchType_REGEX_MATCH, remote.MatchType_REGEX_NO_MATCH:
+		op = influxql.EQREGEX
+		if m.Type == remote.MatchType_REGEX_NO_MATCH {
+			op = influxql.NEQREGEX
+		}
+		re, err := anchoredRegex(m.Value)
+		if err != nil {
+			return nil, err
+		}
+		rhs = &influxql.RegexLiteral{Val: re}
+	default:
+		return nil, fmt.Errorf("unknown match type %v", m.Type)
+	}
+
+	return &influxql.BinaryExpr{Op: op, LHS: &influxql.VarRef{Val: m.Name}, RHS: rhs}, nil
+}
+
+// anchoredRegex compiles a Prometheus regex, which must match the whole value.
+func anchoredRegex(s string) (*regexp.Regexp, error) {
+	return regexp.Compile("^(?:" + s + ")$")
+}
+
+// RowToTimeSeries converts a row from a query returned by
+// ReadRequestToInfluxQLQuery into a Prometheus time series.
+func RowToTimeSeries(row *models.Row) (*remote.TimeSeries, error) {
+	ts := &remote.TimeSeries{
+		Labels: []*remote.LabelPair{{Name: MetricNameLabel, Value: row.Name}},
+	}
+
+	keys := make([]string, 0, len(row.Tags))
+	for k := range row.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		// Tags which the series does not have are returned as blank values.
+		if row.Tags[k] == "" {
+			continue
+		}
+		ts.Labels = append(ts.Labels, &remote.LabelPair{Name: k, Value: row.Tags[k]})
+	}
+
+	for _, values := range row.Values {
+		if len(values) != 2 {
+			return nil, fmt.Errorf("unexpected column count: %d", len(values))
+		}
+
+		t, ok := values[0].(time.Time)
+		if !ok {
+			return nil, fmt.Errorf("unexpected time value: %v", values[0])
+		}
+
+		var v float64
+		switch value := values[1].(type) {
+		case float64:
+			v = value
+		case int64:
+			v = float64(value)
+		case nil:
+			continue
+		default:
+			return nil, fmt.Errorf("unsupported value type %T for field %s", value, FieldName)
+		}
+
+		ts.Samples = append(ts.Samples, &remote.Sample{
+			Value:       v,
+			TimestampMs: t.UnixNano() / int64(time.Millisecond),
+		})
+	}
+	return ts, nil
+}
@@ -0,0 +1,123 @@
+package prometheus_test
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb/models"
+	"github.com/influxdata/influxdb/prometheus"
+	"github.com/influxdata/influxdb/prometheus/remote"
+)
+
+// Ensure a write request is converted into points and invalid values are dropped.
+func TestWriteRequestToPoints(t *testing.T) {
+	req := &remote.WriteRequest{
+		Timeseries: []*remote.TimeSeries{
+			{
+				Labels: []*remote.LabelPair{
+					{Name: "__name__", Value: "cpu"},
+					{Name: "host", Value: "a"},
+				},
+				Samples: []*remote.Sample{
+					{Value: 1, TimestampMs: 1},
+					{Value: math.Inf(1), TimestampMs: 2},
+				},
+			},
+			{
+				Labels:  []*remote.LabelPair{{Name: "host", Value: "b"}},
+				Samples: []*remote.Sample{{Value: 2, TimestampMs: 3}},
+			},
+		},
+	}
+
+	points, err := prometheus.WriteRequestToPoints(req)
+	if err != prometheus.ErrInvalidValueDropped {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var got []string
+	for _, p := range points {
+		got = append(got, p.String())
+	}
+	if exp := []string{
+		"cpu,host=a value=1 1000000",
+		"prom_metric_not_specified,host=b value=2 3000000",
+	}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("unexpected points: %v", got)
+	}
+}
+
+// Ensure a read request is converted into a query.
+func TestReadRequestToInfluxQLQuery(t *testing.T) {
+	for _, tt := range []struct {
+		matchers []*remote.LabelMatcher
+		exp      string
+		err      bool
+	}{
+		{
+			exp: `SELECT value FROM db0.rp0./.+/ WHERE time >= '1970-01-01T00:00:00Z' AND time <= '1970-01-01T00:00:01Z' GROUP BY *`,
+		},
+		{
+			matchers: []*remote.LabelMatcher{
+				{Type: remote.MatchType_REGEX_MATCH, Name: "__name__", Value: "cpu|mem"},
+				{Type: remote.MatchType_NOT_EQUAL, Name: "host", Value: "a"},
+				{Type: remote.MatchType_REGEX_NO_MATCH, Name: "region", Value: "us.*"},
+			},
+			exp: `SELECT value FROM db0.rp0./^(?:cpu|mem)$/ WHERE time >= '1970-01-01T00:00:00Z' AND time <= '1970-01-01T00:00:01Z' AND host != 'a' AND region !~ /^(?:us.*)$/ GROUP BY *`,
+		},
+		{
+			matchers: []*remote.LabelMatcher{{Type: remote.MatchType_NOT_EQUAL, Name: "__name__", Value: "cpu"}},
+			err:      true,
+		},
+	} {
+		req := &remote.ReadRequest{Queries: []*remote.Query{{
+			StartTimestampMs: 0,
+			EndTimestampMs:   1000,
+			Matchers:         tt.matchers,
+		}}}
+
+		q, err := prometheus.ReadRequestToInfluxQLQuery(req, "db0", "rp0")
+		if tt.err {
+			if err == nil {
+				t.Errorf("expected error for %v", tt.matchers)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("unexpected error: %s", err)
+		} else if s := q.String(); s != tt.exp {
+			t.Errorf("unexpected query:\n\tgot=%s\n\texp=%s", s, tt.exp)
+		}
+	}
+}
+
+// Ensure a row is converted into a time series.
+func TestRowToTimeSeries(t *testing.T) {
+	ts, err := prometheus.RowToTimeSeries(&models.Row{
+		Name:    "cpu",
+		Tags:    map[string]string{"region": "", "host": "a"},
+		Columns: []string{"time", "value"},
+		Values: [][]interface{}{
+			{time.Unix(1, 0), 1.5},
+			{time.Unix(2, 0), nil},
+			{time.Unix(3, 0), int64(3)},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if exp := (&remote.TimeSeries{
+		Labels: []*remote.LabelPair{
+			{Name: "__name__", Value: "cpu"},
+			{Name: "host", Value: "a"},
+		},
+		Samples: []*remote.Sample{
+			{Value: 1.5, TimestampMs: 1000},
+			{Value: 3, TimestampMs: 3000},
+		},
+	}); !reflect.DeepEqual(ts, exp) {
+		t.Fatalf("unexpected time series: %s", ts.String())
+	}
+}
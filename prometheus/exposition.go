@@ -0,0 +1,129 @@
+package prometheus
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/influxdata/influxdb"
+	"github.com/influxdata/influxdb/monitor"
+)
+
+// ExpositionContentType is the content type of the text exposition format.
+const ExpositionContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// MetricPrefix is prepended to the name of every exported metric.
+const MetricPrefix = "influxdb_"
+
+// metricFamily holds the samples sharing a metric name.
+type metricFamily struct {
+	typ     string
+	samples []string
+}
+
+// WriteStatistics writes statistics to w in the Prometheus text exposition
+// format.  Each value becomes a metric named after the statistic and the value,
+// and the statistic's tags become labels.  Values registered as gauges with
+// influxdb.RegisterGauges are typed as gauges and all others as counters.
+func WriteStatistics(w io.Writer, stats []*monitor.Statistic) error {
+	families := make(map[string]*metricFamily)
+	for _, s := range stats {
+		labels := formatLabels(s.Tags)
+		for _, key := range s.ValueNames() {
+			value, ok := formatValue(s.Values[key])
+			if !ok {
+				continue
+			}
+
+			name := MetricPrefix + sanitizeName(s.Name+"_"+key)
+			f := families[name]
+			if f == nil {
+				f = &metricFamily{typ: "counter"}
+				if influxdb.IsGauge(s.Name, key) {
+					f.typ = "gauge"
+				}
+				families[name] = f
+			}
+			f.samples = append(f.samples, name+labels+" "+value)
+		}
+	}
+
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	bw := bufio.NewWriter(w)
+	for _, name := range names {
+		f := families[name]
+		sort.Strings(f.samples)
+
+		fmt.Fprintf(bw, "# TYPE %s %s\n", name, f.typ)
+		for _, sample := range f.samples {
+			bw.WriteString(sample)
+			bw.WriteByte('\n')
+		}
+	}
+	return bw.Flush()
+}
+
+// formatLabels returns the label set for tags, sorted by label name.
+func formatLabels(tags map[string]string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = sanitizeLabelName(k) + `="` + labelValueEscaper.Replace(tags[k]) + `"`
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+// formatValue returns the sample value for a statistic value.
+func formatValue(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), true
+	default:
+		return "", false
+	}
+}
+
+// sanitizeName replaces characters which are not allowed in metric names.
+func sanitizeName(s string) string {
+	return sanitize(s, true)
+}
+
+// sanitizeLabelName replaces characters which are not allowed in label names.
+func sanitizeLabelName(s string) string {
+	return sanitize(s, false)
+}
+
+func sanitize(s string, allowColon bool) string {
+	b := []byte(s)
+	for i, c := range b {
+		switch {
+		case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case c >= '0' && c <= '9' && i > 0:
+		case c == ':' && allowColon:
+		default:
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,50 @@
+package prometheus_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/influxdata/influxdb"
+	"github.com/influxdata/influxdb/monitor"
+	"github.com/influxdata/influxdb/prometheus"
+)
+
+// Ensure statistics are written in the text exposition format.
+func TestWriteStatistics(t *testing.T) {
+	influxdb.RegisterGauges("test_exposition", "active")
+
+	stats := []*monitor.Statistic{
+		{
+			Name:   "test_exposition",
+			Tags:   map[string]string{"path": `/var/lib/"db"`, "bind-address": ":8086"},
+			Values: map[string]interface{}{"req": int64(10), "active": int64(2)},
+		},
+		{
+			Name:   "test_exposition",
+			Tags:   map[string]string{"path": "/tmp"},
+			Values: map[string]interface{}{"req": int64(3), "ignored": "x"},
+		},
+		{
+			Name:   "runtime",
+			Values: map[string]interface{}{"Alloc": int64(100), "TotalAlloc": 1.5},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := prometheus.WriteStatistics(&buf, stats); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, exp := buf.String(), `# TYPE influxdb_runtime_Alloc gauge
+influxdb_runtime_Alloc 100
+# TYPE influxdb_runtime_TotalAlloc counter
+influxdb_runtime_TotalAlloc 1.5
+# TYPE influxdb_test_exposition_active gauge
+influxdb_test_exposition_active{bind_address=":8086",path="/var/lib/\"db\""} 2
+# TYPE influxdb_test_exposition_req counter
+influxdb_test_exposition_req{bind_address=":8086",path="/var/lib/\"db\""} 10
+influxdb_test_exposition_req{path="/tmp"} 3
+`; got != exp {
+		t.Fatalf("unexpected output:\n%s\nexp:\n%s", got, exp)
+	}
+}
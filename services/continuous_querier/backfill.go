@@ -0,0 +1,153 @@
+package continuous_querier
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/influxdata/influxdb/influxql"
+	"github.com/influxdata/influxdb/models"
+	"github.com/influxdata/influxdb/services/meta"
+)
+
+// ErrBackfillInProgress is returned when a continuous query is already being backfilled.
+var ErrBackfillInProgress = errors.New("continuous query backfill already in progress")
+
+// backfill tracks the progress of a backfill so a failed one can be resumed.
+type backfill struct {
+	startTime time.Time
+	endTime   time.Time
+	done      time.Time // end of the last window successfully processed
+	running   bool
+}
+
+// ExecuteBackfillContinuousQueryStatement runs a continuous query over the
+// time range of the statement. The backfill stops when closing is closed.
+func (s *Service) ExecuteBackfillContinuousQueryStatement(stmt *influxql.BackfillContinuousQueryStatement, closing <-chan struct{}) (models.Rows, error) {
+	dbi, err := s.MetaClient.Database(stmt.Database)
+	if err != nil {
+		return nil, err
+	} else if dbi == nil {
+		return nil, influxql.ErrDatabaseNotFound(stmt.Database)
+	}
+
+	for i := range dbi.ContinuousQueries {
+		if cqi := &dbi.ContinuousQueries[i]; cqi.Name == stmt.Name {
+			return s.Backfill(dbi, cqi, stmt.StartTime, stmt.EndTime, closing)
+		}
+	}
+	return nil, meta.ErrContinuousQueryNotFound
+}
+
+// Backfill executes a CQ for every interval between startTime and endTime,
+// oldest first, processing several intervals with each query. The range is
+// widened to whole intervals. If a window fails, running the same backfill
+// again resumes from that window, as does running it again after closing
+// was closed to interrupt it. Returns a row listing each window
+// processed and the number of points written.
+func (s *Service) Backfill(dbi *meta.DatabaseInfo, cqi *meta.ContinuousQueryInfo, startTime, endTime time.Time, closing <-chan struct{}) (models.Rows, error) {
+	cq, err := NewContinuousQuery(dbi.Name, cqi)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set the retention policy to default if it wasn't specified in the query.
+	if cq.intoRP() == "" {
+		cq.setIntoRP(dbi.DefaultRetentionPolicy)
+	}
+
+	// Reject queries that would never be scheduled.
+	if _, _, err := cq.shouldRunContinuousQuery(endTime); err != nil {
+		return nil, err
+	}
+
+	interval, err := cq.q.GroupByInterval()
+	if err != nil {
+		return nil, err
+	} else if interval == 0 {
+		return nil, errors.New("continuous query has no GROUP BY time interval")
+	}
+
+	startTime = startTime.Truncate(interval)
+	if t := endTime.Truncate(interval); t.Before(endTime) {
+		endTime = t.Add(interval)
+	}
+
+	chunk := interval
+	if n := time.Duration(s.Config.BackfillChunkDuration) / interval; n > 1 {
+		chunk = n * interval
+	}
+
+	// Resume a previous failed backfill of the same range.
+	id := fmt.Sprintf("%s:%s", dbi.Name, cqi.Name)
+	s.backfillMu.Lock()
+	bf := s.backfills[id]
+	if bf != nil && bf.running {
+		s.backfillMu.Unlock()
+		return nil, ErrBackfillInProgress
+	} else if bf == nil || !bf.startTime.Equal(startTime) || !bf.endTime.Equal(endTime) {
+		bf = &backfill{startTime: startTime, endTime: endTime, done: startTime}
+		s.backfills[id] = bf
+	}
+	bf.running = true
+	s.backfillMu.Unlock()
+
+	defer func() {
+		s.backfillMu.Lock()
+		bf.running = false
+		s.backfillMu.Unlock()
+	}()
+
+	if bf.done.After(startTime) {
+		s.Logger.Printf("resuming backfill of continuous query %s from %v", cqi.Name, bf.done)
+	}
+
+	row := &models.Row{Name: cqi.Name, Columns: []string{"start", "end", "written"}}
+	for t := bf.done; t.Before(endTime); t = t.Add(chunk) {
+		select {
+		case <-closing:
+			return nil, fmt.Errorf("backfill of %s interrupted at %s; run the statement again to resume", cqi.Name, t.UTC().Format(time.RFC3339Nano))
+		default:
+		}
+
+		end := t.Add(chunk)
+		if end.After(endTime) {
+			end = endTime
+		}
+
+		if err := cq.q.SetTimeRange(t, end); err != nil {
+			return nil, err
+		}
+
+		started := time.Now()
+		n, err := s.runContinuousQueryAndWriteResult(cq)
+		s.recordExecution(dbi.Name, cqi.Name, Execution{
+			StartTime:     t,
+			EndTime:       end,
+			Started:       started,
+			Duration:      time.Since(started),
+			PointsWritten: n,
+			Err:           err,
+			Backfill:      true,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("backfill of %s failed at %s: %s; run the statement again to resume", cqi.Name, t.UTC().Format(time.RFC3339Nano), err)
+		}
+		s.statMap.Add(statPointsWritten, n)
+
+		s.backfillMu.Lock()
+		bf.done = end
+		s.backfillMu.Unlock()
+
+		if s.loggingEnabled {
+			s.Logger.Printf("backfilled continuous query %s (%v to %v), %d%% complete", cqi.Name, t, end, 100*end.Sub(startTime)/endTime.Sub(startTime))
+		}
+		row.Values = append(row.Values, []interface{}{t.UTC().Format(time.RFC3339Nano), end.UTC().Format(time.RFC3339Nano), n})
+	}
+
+	s.backfillMu.Lock()
+	delete(s.backfills, id)
+	s.backfillMu.Unlock()
+
+	return models.Rows{row}, nil
+}
@@ -9,6 +9,15 @@ import (
 // Default values for aspects of interval computation.
 const (
 	DefaultRunInterval = time.Second
+
+	// DefaultHistorySize is the number of executions kept in memory for each continuous query.
+	DefaultHistorySize = 10
+
+	// DefaultHistoryDatabase is the database execution history is stored in when enabled.
+	DefaultHistoryDatabase = "_internal"
+
+	// DefaultBackfillChunkDuration is the time range processed by each query of a backfill.
+	DefaultBackfillChunkDuration = time.Hour
 )
 
 // Config represents a configuration for the continuous query service.
@@ -24,13 +33,30 @@ type Config struct {
 	// every minute, this should be set to 1 minute. The default is set to '1s' so the interval
 	// is compatible with most aggregations.
 	RunInterval toml.Duration `toml:"run-interval"`
+
+	// Number of executions of each continuous query kept in memory and
+	// reported by SHOW CONTINUOUS QUERY STATUS.
+	HistorySize int `toml:"history-size"`
+
+	// If set, every execution is also written as a point to the cq_history
+	// measurement of the history database.
+	StoreHistory    bool   `toml:"store-history"`
+	HistoryDatabase string `toml:"history-database"`
+
+	// Time range processed by each query when backfilling a continuous query.
+	// Rounded down to a multiple of the query's GROUP BY interval.
+	BackfillChunkDuration toml.Duration `toml:"backfill-chunk-duration"`
 }
 
 // NewConfig returns a new instance of Config with defaults.
 func NewConfig() Config {
 	return Config{
-		LogEnabled:  true,
-		Enabled:     true,
-		RunInterval: toml.Duration(DefaultRunInterval),
+		LogEnabled:      true,
+		Enabled:         true,
+		RunInterval:     toml.Duration(DefaultRunInterval),
+		HistorySize:     DefaultHistorySize,
+		HistoryDatabase: DefaultHistoryDatabase,
+
+		BackfillChunkDuration: toml.Duration(DefaultBackfillChunkDuration),
 	}
 }
@@ -14,6 +14,9 @@ func TestConfig_Parse(t *testing.T) {
 	if _, err := toml.Decode(`
 run-interval = "1m"
 enabled = true
+history-size = 20
+store-history = true
+history-database = "cq"
 `, &c); err != nil {
 		t.Fatal(err)
 	}
@@ -23,5 +26,11 @@ enabled = true
 		t.Fatalf("unexpected run interval: %v", c.RunInterval)
 	} else if c.Enabled != true {
 		t.Fatalf("unexpected enabled: %v", c.Enabled)
+	} else if c.HistorySize != 20 {
+		t.Fatalf("unexpected history size: %d", c.HistorySize)
+	} else if !c.StoreHistory {
+		t.Fatalf("unexpected store history: %v", c.StoreHistory)
+	} else if c.HistoryDatabase != "cq" {
+		t.Fatalf("unexpected history database: %s", c.HistoryDatabase)
 	}
 }
@@ -0,0 +1,141 @@
+package continuous_querier
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/influxdata/influxdb/influxql"
+	"github.com/influxdata/influxdb/models"
+)
+
+// historyMeasurement is the measurement executions are stored in when
+// history storage is enabled.
+const historyMeasurement = "cq_history"
+
+// Execution records a single run of a continuous query over one time window.
+type Execution struct {
+	// Time range of the data processed.
+	StartTime time.Time
+	EndTime   time.Time
+
+	// Wall clock time the execution began and how long it took.
+	Started  time.Time
+	Duration time.Duration
+
+	PointsWritten int64
+	Err           error
+
+	// Backfill is set for executions of a BACKFILL CONTINUOUS QUERY
+	// statement. They do not affect the status of the scheduled query.
+	Backfill bool
+}
+
+// cqStatus holds the bounded execution history of a single CQ.
+type cqStatus struct {
+	history     []Execution
+	lastSuccess *Execution
+	lastError   *Execution
+}
+
+// History returns the recorded executions of a CQ, oldest first.
+func (s *Service) History(database, name string) []Execution {
+	s.historyMu.RLock()
+	defer s.historyMu.RUnlock()
+
+	st := s.statuses[fmt.Sprintf("%s:%s", database, name)]
+	if st == nil {
+		return nil
+	}
+	return append([]Execution(nil), st.history...)
+}
+
+// recordExecution adds an execution to the in-memory history of a CQ and,
+// if enabled, writes it to the history database.
+func (s *Service) recordExecution(database, name string, e Execution) {
+	s.historyMu.Lock()
+	id := fmt.Sprintf("%s:%s", database, name)
+	st := s.statuses[id]
+	if st == nil {
+		st = &cqStatus{}
+		s.statuses[id] = st
+	}
+
+	n := s.Config.HistorySize
+	if n <= 0 {
+		n = DefaultHistorySize
+	}
+	if len(st.history) >= n {
+		st.history = append(st.history[:0], st.history[len(st.history)-n+1:]...)
+	}
+	st.history = append(st.history, e)
+
+	// Backfilled windows are usually old so they are kept out of the status
+	// of the scheduled query, where they would report a misleading lag.
+	if !e.Backfill {
+		if e.Err == nil {
+			st.lastSuccess = &e
+		} else {
+			st.lastError = &e
+		}
+	}
+	s.historyMu.Unlock()
+
+	if !s.Config.StoreHistory || s.PointsWriter == nil {
+		return
+	}
+
+	fields := map[string]interface{}{
+		"windowStart":   e.StartTime.UnixNano(),
+		"windowEnd":     e.EndTime.UnixNano(),
+		"durationNs":    int64(e.Duration),
+		"pointsWritten": e.PointsWritten,
+		"success":       e.Err == nil,
+		"backfill":      e.Backfill,
+	}
+	if e.Err != nil {
+		fields["error"] = e.Err.Error()
+	}
+	pt, err := models.NewPoint(historyMeasurement, map[string]string{"database": database, "name": name}, fields, e.Started)
+	if err != nil {
+		s.Logger.Printf("failed to create history point: %s", err)
+		return
+	}
+	if err := s.PointsWriter.WritePoints(s.Config.HistoryDatabase, "", models.Points{pt}); err != nil {
+		s.Logger.Printf("failed to store continuous query history: %s", err)
+	}
+}
+
+// ExecuteShowContinuousQueryStatusStatement returns the last success, last
+// error and lag of every continuous query, grouped by database.
+func (s *Service) ExecuteShowContinuousQueryStatusStatement(stmt *influxql.ShowContinuousQueryStatusStatement) (models.Rows, error) {
+	dis, err := s.MetaClient.Databases()
+	if err != nil {
+		return nil, err
+	}
+
+	s.historyMu.RLock()
+	defer s.historyMu.RUnlock()
+
+	now := time.Now()
+	rows := []*models.Row{}
+	for _, di := range dis {
+		row := &models.Row{Columns: []string{"name", "last_success", "last_error_time", "last_error", "points_written", "lag"}, Name: di.Name}
+		for _, cqi := range di.ContinuousQueries {
+			values := []interface{}{cqi.Name, nil, nil, nil, nil, nil}
+			if st := s.statuses[fmt.Sprintf("%s:%s", di.Name, cqi.Name)]; st != nil {
+				if e := st.lastSuccess; e != nil {
+					values[1] = e.Started.UTC().Format(time.RFC3339Nano)
+					values[4] = e.PointsWritten
+					values[5] = now.Sub(e.EndTime).String()
+				}
+				if e := st.lastError; e != nil {
+					values[2] = e.Started.UTC().Format(time.RFC3339Nano)
+					values[3] = e.Err.Error()
+				}
+			}
+			row.Values = append(row.Values, values)
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
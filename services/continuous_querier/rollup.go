@@ -0,0 +1,268 @@
+package continuous_querier
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/influxdata/influxdb/influxql"
+	"github.com/influxdata/influxdb/services/meta"
+)
+
+// errRollupAborted is returned when a rollup is interrupted by the service closing.
+var errRollupAborted = errors.New("rollup aborted")
+
+// runRollups executes every rollup defined on the retention policies of the
+// given databases. Rollups that have not yet been backfilled are executed in
+// the background so a long backfill does not hold up continuous queries.
+func (s *Service) runRollups(dbs []meta.DatabaseInfo, now time.Time) {
+	if s.TSDBStore == nil {
+		return
+	}
+
+	for _, db := range dbs {
+		for _, rp := range db.RetentionPolicies {
+			for _, ri := range rp.Rollups {
+				db, rp, ri := db, rp, ri
+				if ri.Backfilled || s.wg == nil {
+					s.executeRollup(&db, &rp, &ri, now)
+					continue
+				}
+
+				if s.rollupRunning(rollupID(db.Name, rp.Name, ri.Name)) {
+					continue
+				}
+				s.wg.Add(1)
+				go func() {
+					defer s.wg.Done()
+					s.executeRollup(&db, &rp, &ri, now)
+				}()
+			}
+		}
+	}
+}
+
+// executeRollup executes a single rollup and records the result.
+func (s *Service) executeRollup(dbi *meta.DatabaseInfo, rpi *meta.RetentionPolicyInfo, ri *meta.RollupInfo, now time.Time) {
+	if err := s.ExecuteRollup(dbi, rpi, ri, now); err != nil {
+		s.Logger.Printf("error executing rollup %s on %s.%s: err = %s", ri.Name, dbi.Name, rpi.Name, err)
+		s.statMap.Add(statRollupFail, 1)
+	} else {
+		s.statMap.Add(statRollupOK, 1)
+	}
+}
+
+// rollupID returns the key of a rollup in rollupRuns.
+func rollupID(database, rp, name string) string {
+	return fmt.Sprintf("%s:%s:%s", database, rp, name)
+}
+
+// rollupRunning returns true if the rollup is currently being executed.
+func (s *Service) rollupRunning(id string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.rollupsRunning[id]
+	return ok
+}
+
+// ExecuteRollup aggregates the data of a retention policy into the rollup's
+// target retention policy. A rollup that has not yet been backfilled
+// processes all existing data in the source retention policy first and is
+// then marked as backfilled in the meta store. If the rollup is already being
+// executed, ExecuteRollup returns without doing anything.
+func (s *Service) ExecuteRollup(dbi *meta.DatabaseInfo, rpi *meta.RetentionPolicyInfo, ri *meta.RollupInfo, now time.Time) error {
+	if ri.Interval <= 0 {
+		return nil
+	}
+
+	// The lock is only held to access the run state so that CQs are not
+	// blocked while the rollup queries execute.
+	id := rollupID(dbi.Name, rpi.Name, ri.Name)
+	s.mu.Lock()
+	if _, ok := s.rollupsRunning[id]; ok {
+		s.mu.Unlock()
+		return nil
+	}
+	s.rollupsRunning[id] = struct{}{}
+	lastRun, hasRun := s.rollupRuns[id]
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.rollupsRunning, id)
+		s.mu.Unlock()
+	}()
+
+	// Only aggregate intervals that have completely elapsed.
+	endTime := now.Truncate(ri.Interval)
+
+	var startTime time.Time
+	if !ri.Backfilled {
+		startTime = endTime
+		for _, sg := range rpi.ShardGroups {
+			if sg.Deleted() {
+				continue
+			}
+			if t := sg.StartTime.Truncate(ri.Interval); t.Before(startTime) {
+				startTime = t
+			}
+		}
+	} else if hasRun {
+		startTime = lastRun
+	} else {
+		startTime = endTime.Add(-ri.Interval)
+	}
+
+	// Process the range in windows no larger than a shard group so that a
+	// backfill does not have to aggregate the whole retention policy at once.
+	window := ri.Interval
+	if n := rpi.ShardGroupDuration / ri.Interval; n > 1 {
+		window = n * ri.Interval
+	}
+	for t := startTime; t.Before(endTime); t = t.Add(window) {
+		// Stop between windows if the service is closing. The rollup is
+		// not marked as backfilled so the backfill restarts on next run.
+		select {
+		case <-s.stop:
+			return errRollupAborted
+		default:
+		}
+
+		end := t.Add(window)
+		if end.After(endTime) {
+			end = endTime
+		}
+
+		if s.loggingEnabled {
+			s.Logger.Printf("executing rollup %s on %s.%s (%v to %v)", ri.Name, dbi.Name, rpi.Name, t, end)
+		}
+
+		if err := s.runRollup(dbi.Name, rpi, ri, t, end); err != nil {
+			return err
+		}
+
+		s.mu.Lock()
+		s.rollupRuns[id] = end
+		s.mu.Unlock()
+	}
+
+	if !ri.Backfilled {
+		if err := s.MetaClient.SetRollupBackfilled(dbi.Name, rpi.Name, ri.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runRollup executes the rollup for every matching measurement with data
+// between startTime and endTime.
+func (s *Service) runRollup(database string, rpi *meta.RetentionPolicyInfo, ri *meta.RollupInfo, startTime, endTime time.Time) error {
+	var ids []uint64
+	for _, sg := range rpi.ShardGroups {
+		if sg.Deleted() || !sg.Overlaps(startTime, endTime) {
+			continue
+		}
+		for _, sh := range sg.Shards {
+			ids = append(ids, sh.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var re *regexp.Regexp
+	if ri.Measurements != "" {
+		var err error
+		if re, err = regexp.Compile(ri.Measurements); err != nil {
+			return err
+		}
+	}
+
+	mfs := s.TSDBStore.MeasurementFields(ids)
+	names := make([]string, 0, len(mfs))
+	for name := range mfs {
+		if re == nil || re.MatchString(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		stmt := NewRollupStatement(database, rpi.Name, name, ri, mfs[name])
+		if stmt == nil {
+			continue
+		}
+
+		if err := stmt.SetTimeRange(startTime, endTime); err != nil {
+			return err
+		}
+
+		q := &influxql.Query{Statements: influxql.Statements{stmt}}
+		if err := s.executeQuery(q, database); err != nil {
+			s.Logger.Printf("error: %s. running: %s\n", err, stmt.String())
+			return err
+		}
+	}
+	return nil
+}
+
+// executeQuery runs a single statement query and returns its error, if any.
+func (s *Service) executeQuery(q *influxql.Query, database string) error {
+	closing := make(chan struct{})
+	defer close(closing)
+
+	ch := s.QueryExecutor.ExecuteQuery(q, database, NoChunkingSize, closing)
+
+	// There is only one statement, so we will only ever receive one result
+	res, ok := <-ch
+	if !ok {
+		panic("result channel was closed")
+	}
+	return res.Err
+}
+
+// NewRollupStatement returns the SELECT INTO statement that aggregates a
+// single measurement for a rollup. The aggregate of each field is written
+// to a field named after the function and the source field, e.g. mean_value.
+// Returns nil if the rollup defines no aggregates for any of the fields.
+func NewRollupStatement(database, rp, measurement string, ri *meta.RollupInfo, fields map[string]influxql.DataType) *influxql.SelectStatement {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	stmt := &influxql.SelectStatement{
+		Target: &influxql.Target{
+			Measurement: &influxql.Measurement{Database: database, RetentionPolicy: ri.Target, Name: measurement},
+		},
+		Sources: influxql.Sources{
+			&influxql.Measurement{Database: database, RetentionPolicy: rp, Name: measurement},
+		},
+		Dimensions: influxql.Dimensions{
+			{Expr: &influxql.Call{Name: "time", Args: []influxql.Expr{&influxql.DurationLiteral{Val: ri.Interval}}}},
+			{Expr: &influxql.Wildcard{}},
+		},
+	}
+
+	for _, k := range keys {
+		typ := fields[k].String()
+		for _, a := range ri.Aggregates {
+			if a.Type != typ {
+				continue
+			}
+			for _, fn := range a.Functions {
+				stmt.Fields = append(stmt.Fields, &influxql.Field{
+					Expr:  &influxql.Call{Name: fn, Args: []influxql.Expr{&influxql.VarRef{Val: k}}},
+					Alias: fn + "_" + k,
+				})
+			}
+		}
+	}
+	if len(stmt.Fields) == 0 {
+		return nil
+	}
+	return stmt
+}
@@ -12,6 +12,7 @@ import (
 
 	"github.com/influxdata/influxdb"
 	"github.com/influxdata/influxdb/influxql"
+	"github.com/influxdata/influxdb/models"
 	"github.com/influxdata/influxdb/services/meta"
 )
 
@@ -27,6 +28,8 @@ const (
 	statQueryOK       = "queryOk"
 	statQueryFail     = "queryFail"
 	statPointsWritten = "pointsWritten"
+	statRollupOK      = "rollupOk"
+	statRollupFail    = "rollupFail"
 )
 
 // ContinuousQuerier represents a service that executes continuous queries.
@@ -40,6 +43,7 @@ type metaClient interface {
 	AcquireLease(name string) (l *meta.Lease, err error)
 	Databases() ([]meta.DatabaseInfo, error)
 	Database(name string) (*meta.DatabaseInfo, error)
+	SetRollupBackfilled(database, rp, name string) error
 }
 
 // RunRequest is a request to run one or more CQs.
@@ -70,6 +74,14 @@ type Service struct {
 	QueryExecutor influxql.QueryExecutor
 	Config        *Config
 	RunInterval   time.Duration
+	// TSDBStore is used to find the measurements and fields to roll up.
+	TSDBStore interface {
+		MeasurementFields(ids []uint64) map[string]map[string]influxql.DataType
+	}
+	// PointsWriter is used to store execution history, if enabled.
+	PointsWriter interface {
+		WritePoints(database, retentionPolicy string, points models.Points) error
+	}
 	// RunCh can be used by clients to signal service to run CQs.
 	RunCh          chan *RunRequest
 	Logger         *log.Logger
@@ -78,8 +90,18 @@ type Service struct {
 	// lastRuns maps CQ name to last time it was run.
 	mu       sync.RWMutex
 	lastRuns map[string]time.Time
-	stop     chan struct{}
-	wg       *sync.WaitGroup
+	// rollupRuns maps rollups to the end of the last interval aggregated.
+	rollupRuns map[string]time.Time
+	// rollupsRunning holds the rollups currently being executed.
+	rollupsRunning map[string]struct{}
+	// statuses maps CQ name to its execution history.
+	historyMu sync.RWMutex
+	statuses  map[string]*cqStatus
+	// backfills maps CQ name to the progress of its backfill.
+	backfillMu sync.Mutex
+	backfills  map[string]*backfill
+	stop       chan struct{}
+	wg         *sync.WaitGroup
 }
 
 // NewService returns a new instance of Service.
@@ -92,6 +114,10 @@ func NewService(c Config) *Service {
 		statMap:        influxdb.NewStatistics("cq", "cq", nil),
 		Logger:         log.New(os.Stderr, "[continuous_querier] ", log.LstdFlags),
 		lastRuns:       map[string]time.Time{},
+		rollupRuns:     map[string]time.Time{},
+		rollupsRunning: map[string]struct{}{},
+		statuses:       map[string]*cqStatus{},
+		backfills:      map[string]*backfill{},
 	}
 
 	return s
@@ -204,7 +230,7 @@ func (s *Service) backgroundLoop() {
 	}
 }
 
-// hasContinuousQueries returns true if any CQs exist.
+// hasContinuousQueries returns true if any CQs or rollups exist.
 func (s *Service) hasContinuousQueries() bool {
 	// Get list of all databases.
 	dbs, err := s.MetaClient.Databases()
@@ -217,6 +243,11 @@ func (s *Service) hasContinuousQueries() bool {
 		if len(db.ContinuousQueries) > 0 {
 			return true
 		}
+		for _, rp := range db.RetentionPolicies {
+			if len(rp.Rollups) > 0 {
+				return true
+			}
+		}
 	}
 	return false
 }
@@ -244,6 +275,11 @@ func (s *Service) runContinuousQueries(req *RunRequest) {
 			}
 		}
 	}
+
+	// Rollups are only run when all queries are requested.
+	if req.CQs == nil {
+		s.runRollups(dbs, req.Now)
+	}
 }
 
 // ExecuteContinuousQuery executes a single CQ.
@@ -327,16 +363,28 @@ func (s *Service) ExecuteContinuousQuery(dbi *meta.DatabaseInfo, cqi *meta.Conti
 		}
 
 		// Do the actual processing of the query & writing of results.
-		if err := s.runContinuousQueryAndWriteResult(cq); err != nil {
+		started := time.Now()
+		n, err := s.runContinuousQueryAndWriteResult(cq)
+		s.recordExecution(dbi.Name, cqi.Name, Execution{
+			StartTime:     startTime,
+			EndTime:       endTime,
+			Started:       started,
+			Duration:      time.Since(started),
+			PointsWritten: n,
+			Err:           err,
+		})
+		if err != nil {
 			s.Logger.Printf("error: %s. running: %s\n", err, cq.q.String())
 			return err
 		}
+		s.statMap.Add(statPointsWritten, n)
 	}
 	return nil
 }
 
-// runContinuousQueryAndWriteResult will run the query against the cluster and write the results back in
-func (s *Service) runContinuousQueryAndWriteResult(cq *ContinuousQuery) error {
+// runContinuousQueryAndWriteResult will run the query against the cluster and write the results back in.
+// Returns the number of points written.
+func (s *Service) runContinuousQueryAndWriteResult(cq *ContinuousQuery) (int64, error) {
 	// Wrap the CQ's inner SELECT statement in a Query for the QueryExecutor.
 	q := &influxql.Query{
 		Statements: influxql.Statements([]influxql.Statement{cq.q}),
@@ -354,9 +402,20 @@ func (s *Service) runContinuousQueryAndWriteResult(cq *ContinuousQuery) error {
 		panic("result channel was closed")
 	}
 	if res.Err != nil {
-		return res.Err
+		return 0, res.Err
 	}
-	return nil
+
+	// The result of a SELECT INTO is the number of points written.
+	var n int64
+	for _, row := range res.Series {
+		if row.Name != "result" || len(row.Values) == 0 || len(row.Values[0]) < 2 {
+			continue
+		}
+		if v, ok := row.Values[0][1].(int64); ok {
+			n += v
+		}
+	}
+	return n, nil
 }
 
 // ContinuousQuery is a local wrapper / helper around continuous queries.
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"reflect"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -13,6 +15,7 @@ import (
 	"github.com/influxdata/influxdb/influxql"
 	"github.com/influxdata/influxdb/models"
 	"github.com/influxdata/influxdb/services/meta"
+	"github.com/influxdata/influxdb/toml"
 )
 
 var (
@@ -331,6 +334,306 @@ func TestExecuteContinuousQuery_QueryExecutor_Error(t *testing.T) {
 	}
 }
 
+// Test that executions are recorded in the history and reported by SHOW CONTINUOUS QUERY STATUS.
+func TestExecuteContinuousQuery_History(t *testing.T) {
+	s := NewTestService(t)
+	s.Config.HistorySize = 2
+	s.Config.StoreHistory = true
+
+	var points models.Points
+	s.PointsWriter = &historyPointsWriter{fn: func(database, retentionPolicy string, pts models.Points) error {
+		if database != "_internal" {
+			t.Fatalf("unexpected database: %s", database)
+		}
+		points = append(points, pts...)
+		return nil
+	}}
+
+	var err error
+	qe := s.QueryExecutor.(*QueryExecutor)
+	qe.ExecuteQueryFn = func(query *influxql.Query, database string, chunkSize int, closing chan struct{}) <-chan *influxql.Result {
+		ch := make(chan *influxql.Result, 1)
+		if err != nil {
+			ch <- &influxql.Result{Err: err}
+		} else {
+			ch <- &influxql.Result{Series: models.Rows{{
+				Name:    "result",
+				Columns: []string{"time", "written"},
+				Values:  [][]interface{}{{time.Unix(0, 0).UTC(), int64(5)}},
+			}}}
+		}
+		return ch
+	}
+
+	dbis, _ := s.MetaClient.Databases()
+	dbi := dbis[0]
+	cqi := dbi.ContinuousQueries[0]
+
+	now := time.Now().Truncate(time.Minute)
+	for i := 0; i < 3; i++ {
+		if i == 2 {
+			err = errExpected
+		}
+		now = now.Add(time.Second)
+		if e := s.ExecuteContinuousQuery(&dbi, &cqi, now); e != err {
+			t.Fatalf("unexpected error: %v", e)
+		}
+	}
+
+	// Only the last two executions are kept.
+	history := s.History("db", "cq")
+	if len(history) != 2 {
+		t.Fatalf("unexpected history length: %d", len(history))
+	} else if history[0].PointsWritten != 5 || history[0].Err != nil {
+		t.Fatalf("unexpected execution: %#v", history[0])
+	} else if history[1].Err != errExpected {
+		t.Fatalf("unexpected execution: %#v", history[1])
+	} else if !history[1].EndTime.Equal(now) || !history[1].StartTime.Equal(now.Add(-time.Second)) {
+		t.Fatalf("unexpected window: %s - %s", history[1].StartTime, history[1].EndTime)
+	}
+
+	if len(points) != 3 {
+		t.Fatalf("unexpected points stored: %v", points)
+	} else if exp := "cq_history,database=db,name=cq"; string(points[2].Key()) != exp {
+		t.Fatalf("unexpected point key: %s", points[2].Key())
+	} else if v := points[2].Fields()["error"]; v != errExpected.Error() {
+		t.Fatalf("unexpected error field: %v", v)
+	}
+
+	rows, e := s.ExecuteShowContinuousQueryStatusStatement(&influxql.ShowContinuousQueryStatusStatement{})
+	if e != nil {
+		t.Fatal(e)
+	} else if len(rows) != 3 || rows[0].Name != "db" || len(rows[0].Values) != 1 {
+		t.Fatalf("unexpected rows: %v", rows)
+	}
+	values := rows[0].Values[0]
+	if values[0] != "cq" || values[1] == nil || values[3] != errExpected.Error() || values[4] != int64(5) {
+		t.Fatalf("unexpected status: %v", values)
+	} else if values := rows[1].Values[0]; values[1] != nil || values[2] != nil {
+		t.Fatalf("unexpected status for a query that has not run: %v", values)
+	}
+}
+
+// Test that a backfill processes the range in chunks and resumes after a failure.
+func TestService_Backfill(t *testing.T) {
+	s := NewTestService(t)
+	s.Config.BackfillChunkDuration = toml.Duration(10 * time.Second)
+
+	var windows []string
+	fail := true
+	qe := s.QueryExecutor.(*QueryExecutor)
+	qe.ExecuteQueryFn = func(query *influxql.Query, database string, chunkSize int, closing chan struct{}) <-chan *influxql.Result {
+		stmt := query.Statements[0].(*influxql.SelectStatement)
+		min, max := influxql.TimeRange(stmt.Condition)
+		windows = append(windows, fmt.Sprintf("%d-%d", min.Unix(), max.Add(time.Nanosecond).Unix()))
+
+		ch := make(chan *influxql.Result, 1)
+		if fail && min.Unix() == 10 {
+			fail = false
+			ch <- &influxql.Result{Err: errExpected}
+			return ch
+		}
+		ch <- &influxql.Result{}
+		return ch
+	}
+
+	stmt := &influxql.BackfillContinuousQueryStatement{
+		Name:      "cq",
+		Database:  "db",
+		StartTime: time.Unix(0, 0),
+		EndTime:   time.Unix(24, 500),
+	}
+
+	// The second window fails.
+	if _, err := s.ExecuteBackfillContinuousQueryStatement(stmt, nil); err == nil {
+		t.Fatal("expected error")
+	} else if exp := []string{"0-10", "10-20"}; !reflect.DeepEqual(windows, exp) {
+		t.Fatalf("unexpected windows: exp=%v got=%v", exp, windows)
+	}
+
+	// Running it again resumes from the failed window.
+	windows = nil
+	rows, err := s.ExecuteBackfillContinuousQueryStatement(stmt, nil)
+	if err != nil {
+		t.Fatal(err)
+	} else if exp := []string{"10-20", "20-25"}; !reflect.DeepEqual(windows, exp) {
+		t.Fatalf("unexpected windows: exp=%v got=%v", exp, windows)
+	} else if len(rows) != 1 || len(rows[0].Values) != 2 {
+		t.Fatalf("unexpected rows: %v", rows)
+	}
+
+	// Backfilled windows are recorded in the history but not in the status
+	// of the scheduled query.
+	if history := s.History("db", "cq"); len(history) != 4 || !history[0].Backfill {
+		t.Fatalf("unexpected history: %v", history)
+	}
+	rows, err = s.ExecuteShowContinuousQueryStatusStatement(&influxql.ShowContinuousQueryStatusStatement{})
+	if err != nil {
+		t.Fatal(err)
+	} else if values := rows[0].Values[0]; values[1] != nil || values[2] != nil || values[5] != nil {
+		t.Fatalf("unexpected status: %v", values)
+	}
+
+	// An interrupted backfill stops before the next window.
+	closing := make(chan struct{})
+	close(closing)
+	windows = nil
+	if _, err := s.ExecuteBackfillContinuousQueryStatement(stmt, closing); err == nil || !strings.Contains(err.Error(), "interrupted") {
+		t.Fatalf("unexpected error: %v", err)
+	} else if len(windows) != 0 {
+		t.Fatalf("unexpected windows: %v", windows)
+	}
+
+	// Backfilling an unknown query fails.
+	stmt.Name = "foo"
+	if _, err := s.ExecuteBackfillContinuousQueryStatement(stmt, nil); err != meta.ErrContinuousQueryNotFound {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Test ExecuteRollup backfills existing data and then aggregates new intervals.
+func TestExecuteRollup(t *testing.T) {
+	s := NewTestService(t)
+	ms := s.MetaClient.(*MetaClient)
+	s.TSDBStore = &TSDBStore{
+		MeasurementFieldsFn: func(ids []uint64) map[string]map[string]influxql.DataType {
+			if !reflect.DeepEqual(ids, []uint64{1}) {
+				t.Fatalf("unexpected shard ids: %v", ids)
+			}
+			return map[string]map[string]influxql.DataType{
+				"cpu":  {"value": influxql.Float, "host_id": influxql.String},
+				"mem":  {"free": influxql.Integer},
+				"disk": {"used": influxql.Float},
+			}
+		},
+	}
+
+	now := time.Date(2000, 1, 1, 3, 30, 0, 0, time.UTC)
+	dbi := meta.DatabaseInfo{Name: "db"}
+	rpi := meta.RetentionPolicyInfo{
+		Name:               "rp",
+		ShardGroupDuration: 2 * time.Hour,
+		ShardGroups: []meta.ShardGroupInfo{
+			{ID: 1, StartTime: now.Add(-3 * time.Hour).Truncate(2 * time.Hour), EndTime: now.Truncate(2 * time.Hour).Add(2 * time.Hour), Shards: []meta.ShardInfo{{ID: 1}}},
+		},
+	}
+	ri := meta.RollupInfo{
+		Name:         "r0",
+		Target:       "rp1h",
+		Interval:     time.Hour,
+		Measurements: "^(cpu|mem)$",
+		Aggregates: []meta.RollupAggregateInfo{
+			{Type: "float", Functions: []string{"mean", "max"}},
+			{Type: "integer", Functions: []string{"sum"}},
+		},
+	}
+
+	var queries []string
+	qe := s.QueryExecutor.(*QueryExecutor)
+	qe.ExecuteQueryFn = func(query *influxql.Query, database string, chunkSize int, closing chan struct{}) <-chan *influxql.Result {
+		queries = append(queries, query.String())
+		dummych := make(chan *influxql.Result, 1)
+		dummych <- &influxql.Result{}
+		return dummych
+	}
+
+	// The first run backfills from the start of the first shard group.
+	if err := s.ExecuteRollup(&dbi, &rpi, &ri, now); err != nil {
+		t.Fatal(err)
+	}
+	exp := []string{
+		`SELECT mean(value) AS mean_value, max(value) AS max_value INTO db.rp1h.cpu FROM db.rp.cpu WHERE time >= '2000-01-01T00:00:00Z' AND time < '2000-01-01T02:00:00Z' GROUP BY time(1h), *`,
+		`SELECT sum(free) AS sum_free INTO db.rp1h.mem FROM db.rp.mem WHERE time >= '2000-01-01T00:00:00Z' AND time < '2000-01-01T02:00:00Z' GROUP BY time(1h), *`,
+		`SELECT mean(value) AS mean_value, max(value) AS max_value INTO db.rp1h.cpu FROM db.rp.cpu WHERE time >= '2000-01-01T02:00:00Z' AND time < '2000-01-01T03:00:00Z' GROUP BY time(1h), *`,
+		`SELECT sum(free) AS sum_free INTO db.rp1h.mem FROM db.rp.mem WHERE time >= '2000-01-01T02:00:00Z' AND time < '2000-01-01T03:00:00Z' GROUP BY time(1h), *`,
+	}
+	if !reflect.DeepEqual(queries, exp) {
+		t.Fatalf("unexpected queries:\n\nexp=%v\n\ngot=%v", exp, queries)
+	} else if !reflect.DeepEqual(ms.Backfilled, []string{"db.rp.r0"}) {
+		t.Fatalf("unexpected backfilled rollups: %v", ms.Backfilled)
+	}
+
+	// Later runs only aggregate the intervals that elapsed since.
+	ri.Backfilled = true
+	queries = nil
+	if err := s.ExecuteRollup(&dbi, &rpi, &ri, now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	exp = []string{
+		`SELECT mean(value) AS mean_value, max(value) AS max_value INTO db.rp1h.cpu FROM db.rp.cpu WHERE time >= '2000-01-01T03:00:00Z' AND time < '2000-01-01T04:00:00Z' GROUP BY time(1h), *`,
+		`SELECT sum(free) AS sum_free INTO db.rp1h.mem FROM db.rp.mem WHERE time >= '2000-01-01T03:00:00Z' AND time < '2000-01-01T04:00:00Z' GROUP BY time(1h), *`,
+	}
+	if !reflect.DeepEqual(queries, exp) {
+		t.Fatalf("unexpected queries:\n\nexp=%v\n\ngot=%v", exp, queries)
+	}
+}
+
+// Test that a rollup backfill runs in the background without holding the service lock.
+func TestService_RunRollups_Backfill(t *testing.T) {
+	s := NewTestService(t)
+	ms := s.MetaClient.(*MetaClient)
+	s.TSDBStore = &TSDBStore{
+		MeasurementFieldsFn: func(ids []uint64) map[string]map[string]influxql.DataType {
+			return map[string]map[string]influxql.DataType{"cpu": {"value": influxql.Float}}
+		},
+	}
+	s.wg = &sync.WaitGroup{}
+
+	now := time.Date(2000, 1, 1, 3, 30, 0, 0, time.UTC)
+	dbs := []meta.DatabaseInfo{{
+		Name: "db",
+		RetentionPolicies: []meta.RetentionPolicyInfo{{
+			Name:               "rp",
+			ShardGroupDuration: time.Hour,
+			ShardGroups: []meta.ShardGroupInfo{
+				{ID: 1, StartTime: now.Add(-3 * time.Hour), EndTime: now.Add(time.Hour), Shards: []meta.ShardInfo{{ID: 1}}},
+			},
+			Rollups: []meta.RollupInfo{{
+				Name:       "r0",
+				Target:     "rp1h",
+				Interval:   time.Hour,
+				Aggregates: []meta.RollupAggregateInfo{{Type: "float", Functions: []string{"mean"}}},
+			}},
+		}},
+	}}
+
+	// Block the first rollup query until the test releases it.
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var once sync.Once
+	qe := s.QueryExecutor.(*QueryExecutor)
+	qe.ExecuteQueryFn = func(query *influxql.Query, database string, chunkSize int, closing chan struct{}) <-chan *influxql.Result {
+		once.Do(func() {
+			close(started)
+			<-release
+		})
+		dummych := make(chan *influxql.Result, 1)
+		dummych <- &influxql.Result{}
+		return dummych
+	}
+
+	s.runRollups(dbs, now)
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("rollup backfill did not start")
+	}
+
+	// The service lock is free and a second run does not start another backfill.
+	s.mu.Lock()
+	s.mu.Unlock()
+	s.runRollups(dbs, now)
+
+	close(release)
+	s.wg.Wait()
+
+	if !reflect.DeepEqual(ms.Backfilled, []string{"db.rp.r0"}) {
+		t.Fatalf("unexpected backfilled rollups: %v", ms.Backfilled)
+	} else if exp := now.Truncate(time.Hour); !s.rollupRuns["db:rp:r0"].Equal(exp) {
+		t.Fatalf("unexpected last run: %v", s.rollupRuns["db:rp:r0"])
+	}
+}
+
 // NewTestService returns a new *Service with default mock object members.
 func NewTestService(t *testing.T) *Service {
 	s := NewService(NewConfig())
@@ -362,6 +665,7 @@ type MetaClient struct {
 	AllowLease    bool
 	DatabaseInfos []meta.DatabaseInfo
 	Err           error
+	Backfilled    []string
 	t             *testing.T
 	nodeID        uint64
 }
@@ -471,6 +775,33 @@ func (ms *MetaClient) CreateContinuousQuery(database, name, query string) error
 	return nil
 }
 
+// SetRollupBackfilled records that a rollup has been backfilled.
+func (ms *MetaClient) SetRollupBackfilled(database, rp, name string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.Backfilled = append(ms.Backfilled, database+"."+rp+"."+name)
+	return ms.Err
+}
+
+// TSDBStore is a mock TSDB store.
+type TSDBStore struct {
+	MeasurementFieldsFn func(ids []uint64) map[string]map[string]influxql.DataType
+}
+
+// MeasurementFields returns the field types of the measurements in the given shards.
+func (s *TSDBStore) MeasurementFields(ids []uint64) map[string]map[string]influxql.DataType {
+	return s.MeasurementFieldsFn(ids)
+}
+
+// historyPointsWriter is a mock points writer for execution history.
+type historyPointsWriter struct {
+	fn func(database, retentionPolicy string, points models.Points) error
+}
+
+func (pw *historyPointsWriter) WritePoints(database, retentionPolicy string, points models.Points) error {
+	return pw.fn(database, retentionPolicy, points)
+}
+
 // QueryExecutor is a mock query executor.
 type QueryExecutor struct {
 	ExecuteQueryFn func(query *influxql.Query, database string, chunkSize int, closing chan struct{}) <-chan *influxql.Result
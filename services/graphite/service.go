@@ -38,6 +38,10 @@ const (
 	statConnectionsHandled  = "connsHandled"
 )
 
+func init() {
+	influxdb.RegisterGauges("graphite", statConnectionsActive)
+}
+
 type tcpConnection struct {
 	conn        net.Conn
 	connectTime time.Time
@@ -8,21 +8,30 @@ import (
 	"expvar"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"net/http/pprof"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/bmizerany/pat"
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
 	"github.com/influxdata/influxdb"
 	"github.com/influxdata/influxdb/client"
 	"github.com/influxdata/influxdb/influxql"
 	"github.com/influxdata/influxdb/models"
+	"github.com/influxdata/influxdb/monitor"
+	"github.com/influxdata/influxdb/prometheus"
+	"github.com/influxdata/influxdb/prometheus/remote"
 	"github.com/influxdata/influxdb/services/continuous_querier"
 	"github.com/influxdata/influxdb/services/meta"
+	"github.com/influxdata/influxdb/tsdb"
 	"github.com/influxdata/influxdb/uuid"
 )
 
@@ -73,6 +82,10 @@ type Handler struct {
 
 	ContinuousQuerier continuous_querier.ContinuousQuerier
 
+	Monitor interface {
+		Statistics(tags map[string]string) ([]*monitor.Statistic, error)
+	}
+
 	Logger           *log.Logger
 	loggingEnabled   bool // Log every HTTP access.
 	WriteTrace       bool // Detailed logging of write path
@@ -109,6 +122,14 @@ func NewHandler(requireAuthentication, loggingEnabled, writeTrace, JSONWriteEnab
 			"write", // Data-ingest route.
 			"POST", "/write", true, true, h.serveWrite,
 		},
+		route{ // Prometheus remote write
+			"prometheus-write",
+			"POST", "/api/v1/prom/write", false, true, h.servePromWrite,
+		},
+		route{ // Prometheus remote read
+			"prometheus-read",
+			"POST", "/api/v1/prom/read", false, true, h.servePromRead,
+		},
 		route{ // Ping
 			"ping",
 			"GET", "/ping", true, true, h.servePing,
@@ -121,6 +142,10 @@ func NewHandler(requireAuthentication, loggingEnabled, writeTrace, JSONWriteEnab
 			"status",
 			"GET", "/status", true, true, h.serveStatus,
 		},
+		route{ // Statistics in the Prometheus exposition format
+			"metrics",
+			"GET", "/metrics", true, false, h.serveMetrics,
+		},
 		route{ // Ping w/ status
 			"status-head",
 			"HEAD", "/status", true, true, h.serveStatus,
@@ -511,38 +536,165 @@ func (h *Handler) serveWriteLine(w http.ResponseWriter, r *http.Request, body []
 		precision = "n"
 	}
 
-	points, parseError := models.ParsePointsWithPrecision(body, time.Now().UTC(), precision)
+	points, lines, parseError := models.ParsePointsWithLines(body, time.Now().UTC(), precision)
 	// Not points parsed correctly so return the error now
 	if parseError != nil && len(points) == 0 {
 		if parseError.Error() == "EOF" {
 			w.WriteHeader(http.StatusOK)
 			return
 		}
-		resultError(w, influxql.Result{Err: parseError}, http.StatusBadRequest)
+		writeResultError(w, newWriteResult(0, parseError, nil, nil, nil))
 		return
 	}
 
 	database := r.FormValue("db")
+	if !h.authorizeWrite(w, database, user) {
+		return
+	}
+
+	// Write points.
+	err := h.PointsWriter.WritePoints(database, r.FormValue("rp"), models.ConsistencyLevelAny, points)
+	partial, isPartial := err.(tsdb.PartialWriteError)
+	if err != nil && !isPartial {
+		h.statMap.Add(statPointsWrittenFail, int64(len(points)))
+		if influxdb.IsClientError(err) {
+			resultError(w, influxql.Result{Err: err}, http.StatusBadRequest)
+		} else {
+			resultError(w, influxql.Result{Err: err}, http.StatusInternalServerError)
+		}
+		return
+	} else if parseError != nil || isPartial {
+		// We wrote some of the points. The others failed to parse or were rejected by the
+		// shards, so we return a 400 response code along with each line that was rejected.
+		h.statMap.Add(statPointsWrittenOK, int64(len(points)-partial.Dropped))
+		h.statMap.Add(statPointsWrittenFail, int64(partial.Dropped))
+		writeResultError(w, newWriteResult(len(points)-partial.Dropped, parseError, partial.DroppedPoints, points, lines))
+		return
+	}
+
+	h.statMap.Add(statPointsWrittenOK, int64(len(points)))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// WriteResult is returned when some lines of a write were rejected.
+type WriteResult struct {
+	Err      string      `json:"error"`
+	Accepted int         `json:"accepted"`
+	Rejected int         `json:"rejected"`
+	Lines    []LineError `json:"lines"`
+}
+
+// LineError describes a rejected line of a write.
+type LineError struct {
+	Line int    `json:"line"`
+	Err  string `json:"error"`
+}
+
+// newWriteResult returns the result of a write with lines which failed to parse
+// and points which were dropped. lines holds the line number of each point.
+func newWriteResult(accepted int, parseError error, dropped []tsdb.DroppedPoint, points []models.Point, lines []int) *WriteResult {
+	result := &WriteResult{Accepted: accepted}
+
+	if a, ok := parseError.(models.LineErrors); ok {
+		for _, e := range a {
+			result.Lines = append(result.Lines, LineError{Line: e.Line, Err: e.Error()})
+		}
+	} else if parseError != nil {
+		result.Lines = append(result.Lines, LineError{Err: parseError.Error()})
+	}
+
+	if len(dropped) > 0 {
+		lineByPoint := make(map[models.Point]int, len(points))
+		for i, p := range points {
+			lineByPoint[p] = lines[i]
+		}
+		for _, p := range dropped {
+			result.Lines = append(result.Lines, LineError{Line: lineByPoint[p.Point], Err: p.Reason})
+		}
+	}
+	sort.Stable(lineErrors(result.Lines))
+
+	msgs := make([]string, len(result.Lines))
+	for i, l := range result.Lines {
+		msgs[i] = l.Err
+	}
+	result.Rejected = len(result.Lines)
+	result.Err = "partial write:\n" + strings.Join(msgs, "\n")
+	if accepted == 0 {
+		result.Err = strings.Join(msgs, "\n")
+	}
+	return result
+}
+
+// lineErrors sorts line errors by line number.
+type lineErrors []LineError
+
+func (a lineErrors) Len() int           { return len(a) }
+func (a lineErrors) Less(i, j int) bool { return a[i].Line < a[j].Line }
+func (a lineErrors) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+
+// writeResultError writes a write result to the client with a 400 status code.
+func writeResultError(w http.ResponseWriter, result *WriteResult) {
+	w.Header().Add("content-type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	_ = json.NewEncoder(w).Encode(result)
+}
+
+// authorizeWrite checks that the database exists and that the user may write
+// to it. If not, it writes an error response and returns false.
+func (h *Handler) authorizeWrite(w http.ResponseWriter, database string, user *meta.UserInfo) bool {
 	if database == "" {
 		resultError(w, influxql.Result{Err: fmt.Errorf("database is required")}, http.StatusBadRequest)
-		return
+		return false
 	}
 
 	if di, err := h.MetaClient.Database(database); err != nil {
 		resultError(w, influxql.Result{Err: fmt.Errorf("metastore database error: %s", err)}, http.StatusInternalServerError)
-		return
+		return false
 	} else if di == nil {
 		resultError(w, influxql.Result{Err: fmt.Errorf("database not found: %q", database)}, http.StatusNotFound)
-		return
+		return false
 	}
 
 	if h.requireAuthentication && user == nil {
 		resultError(w, influxql.Result{Err: fmt.Errorf("user is required to write to database %q", database)}, http.StatusUnauthorized)
-		return
+		return false
 	}
 
 	if h.requireAuthentication && !user.Authorize(influxql.WritePrivilege, database) {
 		resultError(w, influxql.Result{Err: fmt.Errorf("%q user is not authorized to write to database %q", user.Name, database)}, http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// servePromWrite receives a snappy-compressed Prometheus remote write request
+// and writes its samples to the database.
+func (h *Handler) servePromWrite(w http.ResponseWriter, r *http.Request, user *meta.UserInfo) {
+	h.statMap.Add(statPromWriteRequest, 1)
+	defer func(start time.Time) {
+		h.statMap.Add(statWriteRequestDuration, time.Since(start).Nanoseconds())
+	}(time.Now())
+
+	var req remote.WriteRequest
+	if err := readPromRequest(r, &req); err != nil {
+		resultError(w, influxql.Result{Err: err}, http.StatusBadRequest)
+		return
+	}
+
+	points, err := prometheus.WriteRequestToPoints(&req)
+	if err == prometheus.ErrInvalidValueDropped {
+		// Prometheus cannot resend these samples so write the remaining points.
+		if h.WriteTrace {
+			h.Logger.Printf("prom write handler: %s", err)
+		}
+	} else if err != nil {
+		resultError(w, influxql.Result{Err: err}, http.StatusBadRequest)
+		return
+	}
+
+	database := r.FormValue("db")
+	if !h.authorizeWrite(w, database, user) {
 		return
 	}
 
@@ -555,19 +707,130 @@ func (h *Handler) serveWriteLine(w http.ResponseWriter, r *http.Request, body []
 		h.statMap.Add(statPointsWrittenFail, int64(len(points)))
 		resultError(w, influxql.Result{Err: err}, http.StatusInternalServerError)
 		return
-	} else if parseError != nil {
-		// We wrote some of the points
-		h.statMap.Add(statPointsWrittenOK, int64(len(points)))
-		// The other points failed to parse which means the client sent invalid line protocol.  We return a 400
-		// response code as well as the lines that failed to parse.
-		resultError(w, influxql.Result{Err: fmt.Errorf("partial write:\n%v", parseError)}, http.StatusBadRequest)
-		return
 	}
 
 	h.statMap.Add(statPointsWrittenOK, int64(len(points)))
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// servePromRead receives a snappy-compressed Prometheus remote read request,
+// queries the matching series and returns them as a snappy-compressed response.
+func (h *Handler) servePromRead(w http.ResponseWriter, r *http.Request, user *meta.UserInfo) {
+	h.statMap.Add(statPromReadRequest, 1)
+	defer func(start time.Time) {
+		h.statMap.Add(statQueryRequestDuration, time.Since(start).Nanoseconds())
+	}(time.Now())
+
+	var req remote.ReadRequest
+	if err := readPromRequest(r, &req); err != nil {
+		httpError(w, err.Error(), false, http.StatusBadRequest)
+		return
+	}
+
+	db, rp := r.FormValue("db"), r.FormValue("rp")
+	query, err := prometheus.ReadRequestToInfluxQLQuery(&req, db, rp)
+	if err != nil {
+		httpError(w, err.Error(), false, http.StatusBadRequest)
+		return
+	}
+
+	// Check authorization.
+	if h.requireAuthentication {
+		if err := h.QueryAuthorizer.AuthorizeQuery(user, query, db); err != nil {
+			httpError(w, "error authorizing query: "+err.Error(), false, http.StatusUnauthorized)
+			return
+		}
+	}
+
+	// Make sure if the client disconnects or a result fails we signal the
+	// query to abort.
+	closing := make(chan struct{})
+	var closeOnce sync.Once
+	abort := func() { closeOnce.Do(func() { close(closing) }) }
+	defer abort()
+	if notifier, ok := w.(http.CloseNotifier); ok {
+		notify := notifier.CloseNotify()
+		go func() {
+			select {
+			case <-notify:
+				abort()
+			case <-closing:
+			}
+		}()
+	}
+
+	// Build a result for each query, merging rows from the same series.
+	resp := &remote.ReadResponse{Results: make([]*remote.QueryResult, len(query.Statements))}
+	series := make([]map[string]*remote.TimeSeries, len(query.Statements))
+	for i := range resp.Results {
+		resp.Results[i] = &remote.QueryResult{}
+		series[i] = make(map[string]*remote.TimeSeries)
+	}
+
+	// The executor blocks until each result is received, so keep draining
+	// the results after an error until the query has stopped.
+	var queryErr error
+	for result := range h.QueryExecutor.ExecuteQuery(query, db, DefaultChunkSize, closing) {
+		if result == nil || queryErr != nil {
+			continue
+		} else if result.Err != nil {
+			queryErr = result.Err
+			abort()
+			continue
+		} else if result.StatementID < 0 || result.StatementID >= len(resp.Results) {
+			continue
+		}
+
+		for _, row := range result.Series {
+			ts, err := prometheus.RowToTimeSeries(row)
+			if err != nil {
+				queryErr = err
+				abort()
+				break
+			}
+
+			key := row.Name + "\x00" + string(models.Tags(row.Tags).HashKey())
+			if prev := series[result.StatementID][key]; prev != nil {
+				prev.Samples = append(prev.Samples, ts.Samples...)
+				continue
+			}
+			series[result.StatementID][key] = ts
+
+			qr := resp.Results[result.StatementID]
+			qr.Timeseries = append(qr.Timeseries, ts)
+		}
+	}
+	if queryErr != nil {
+		httpError(w, queryErr.Error(), false, http.StatusInternalServerError)
+		return
+	}
+
+	data, err := proto.Marshal(resp)
+	if err != nil {
+		httpError(w, err.Error(), false, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.Header().Set("Content-Encoding", "snappy")
+	n, _ := w.Write(snappy.Encode(nil, data))
+	h.statMap.Add(statQueryRequestBytesTransmitted, int64(n))
+}
+
+// readPromRequest decodes a snappy-compressed protobuf request body into pb.
+func readPromRequest(r *http.Request, pb proto.Message) error {
+	compressed, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+
+	buf, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		return err
+	}
+	return proto.Unmarshal(buf, pb)
+}
+
 // serveOptions returns an empty response to comply with OPTIONS pre-flight requests
 func (h *Handler) serveOptions(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
@@ -586,6 +849,25 @@ func (h *Handler) serveStatus(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// serveMetrics returns the server statistics in the Prometheus text exposition format.
+func (h *Handler) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	h.statMap.Add(statMetricsRequest, 1)
+
+	if h.Monitor == nil {
+		w.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+
+	stats, err := h.Monitor.Statistics(nil)
+	if err != nil {
+		httpError(w, err.Error(), false, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", prometheus.ExpositionContentType)
+	prometheus.WriteStatistics(w, stats)
+}
+
 // convertToEpoch converts result timestamps from time.Time to the specified epoch.
 func convertToEpoch(r *influxql.Result, epoch string) {
 	divisor := int64(1)
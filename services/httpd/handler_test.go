@@ -6,19 +6,27 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
 	"regexp"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
 	"github.com/influxdata/influxdb"
 	"github.com/influxdata/influxdb/client"
 	"github.com/influxdata/influxdb/influxql"
 	"github.com/influxdata/influxdb/models"
+	"github.com/influxdata/influxdb/monitor"
+	"github.com/influxdata/influxdb/prometheus"
+	"github.com/influxdata/influxdb/prometheus/remote"
 	"github.com/influxdata/influxdb/services/httpd"
 	"github.com/influxdata/influxdb/services/meta"
+	"github.com/influxdata/influxdb/tsdb"
 )
 
 func TestBatchWrite_UnmarshalEpoch(t *testing.T) {
@@ -287,6 +295,236 @@ func TestHandler_Query_ErrResult(t *testing.T) {
 	}
 }
 
+// Ensure the handler reports each rejected line of a partial write.
+func TestHandler_Write_PartialWrite(t *testing.T) {
+	h := NewHandler(false)
+	h.MetaClient.DatabaseFn = func(name string) (*meta.DatabaseInfo, error) {
+		return &meta.DatabaseInfo{Name: name}, nil
+	}
+	h.PointsWriter.WritePointsFn = func(database, retentionPolicy string, consistencyLevel models.ConsistencyLevel, points []models.Point) error {
+		if len(points) != 4 {
+			t.Fatalf("unexpected point count: %d", len(points))
+		}
+		return tsdb.PartialWriteError{
+			Reason:        "field type conflict",
+			Dropped:       1,
+			DroppedPoints: []tsdb.DroppedPoint{{Point: points[3], Reason: "field type conflict"}},
+		}
+	}
+
+	body := "cpu value=1 1\ncpu value=2a 2\ncpu value=3 3\n\tcpu value=4 4\ncpu value=5i 5"
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, MustNewRequest("POST", "/write?db=foo", bytes.NewBufferString(body)))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("unexpected status: %d", w.Code)
+	}
+
+	var result httpd.WriteResult
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	} else if result.Accepted != 3 || result.Rejected != 2 {
+		t.Fatalf("unexpected counts: accepted=%d rejected=%d", result.Accepted, result.Rejected)
+	} else if !reflect.DeepEqual(result.Lines, []httpd.LineError{
+		{Line: 2, Err: `unable to parse 'cpu value=2a 2': invalid number`},
+		{Line: 5, Err: "field type conflict"},
+	}) {
+		t.Fatalf("unexpected lines: %#v", result.Lines)
+	}
+}
+
+// Ensure the handler writes Prometheus remote write samples as points.
+func TestHandler_PromWrite(t *testing.T) {
+	req := &remote.WriteRequest{
+		Timeseries: []*remote.TimeSeries{
+			{
+				Labels: []*remote.LabelPair{
+					{Name: "__name__", Value: "cpu"},
+					{Name: "host", Value: "a"},
+				},
+				Samples: []*remote.Sample{
+					{Value: 1.5, TimestampMs: 1000},
+					{Value: math.NaN(), TimestampMs: 2000},
+				},
+			},
+		},
+	}
+	data, err := proto.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewHandler(false)
+	h.MetaClient.DatabaseFn = func(name string) (*meta.DatabaseInfo, error) {
+		return &meta.DatabaseInfo{Name: name}, nil
+	}
+
+	var called bool
+	h.PointsWriter.WritePointsFn = func(database, retentionPolicy string, consistencyLevel models.ConsistencyLevel, points []models.Point) error {
+		called = true
+		if database != "foo" {
+			t.Fatalf("unexpected database: %s", database)
+		} else if len(points) != 1 {
+			t.Fatalf("unexpected point count: %d", len(points))
+		} else if s := points[0].String(); s != "cpu,host=a value=1.5 1000000000" {
+			t.Fatalf("unexpected point: %s", s)
+		}
+		return nil
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, MustNewRequest("POST", "/api/v1/prom/write?db=foo", bytes.NewReader(snappy.Encode(nil, data))))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("unexpected status: %d: %s", w.Code, w.Body.String())
+	} else if !called {
+		t.Fatal("points not written")
+	}
+}
+
+// Ensure the handler returns series from the query executor for Prometheus remote reads.
+func TestHandler_PromRead(t *testing.T) {
+	req := &remote.ReadRequest{
+		Queries: []*remote.Query{{
+			StartTimestampMs: 1000,
+			EndTimestampMs:   2000,
+			Matchers: []*remote.LabelMatcher{
+				{Type: remote.MatchType_EQUAL, Name: "__name__", Value: "cpu"},
+				{Type: remote.MatchType_EQUAL, Name: "host", Value: "a"},
+			},
+		}},
+	}
+	data, err := proto.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewHandler(false)
+	h.QueryExecutor.ExecuteQueryFn = func(q *influxql.Query, db string, chunkSize int, closing chan struct{}) <-chan *influxql.Result {
+		if s := q.String(); s != `SELECT value FROM foo..cpu WHERE time >= '1970-01-01T00:00:01Z' AND time <= '1970-01-01T00:00:02Z' AND host = 'a' GROUP BY *` {
+			t.Fatalf("unexpected query: %s", s)
+		}
+		return NewResultChan(
+			&influxql.Result{StatementID: 0, Series: models.Rows{{
+				Name:    "cpu",
+				Tags:    map[string]string{"host": "a"},
+				Columns: []string{"time", "value"},
+				Values:  [][]interface{}{{time.Unix(1, 0), 1.5}},
+			}}},
+			&influxql.Result{StatementID: 0, Series: models.Rows{{
+				Name:    "cpu",
+				Tags:    map[string]string{"host": "a"},
+				Columns: []string{"time", "value"},
+				Values:  [][]interface{}{{time.Unix(2, 0), int64(2)}},
+			}}},
+		)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, MustNewRequest("POST", "/api/v1/prom/read?db=foo", bytes.NewReader(snappy.Encode(nil, data))))
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d: %s", w.Code, w.Body.String())
+	}
+
+	buf, err := snappy.Decode(nil, w.Body.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resp remote.ReadResponse
+	if err := proto.Unmarshal(buf, &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	if exp := (&remote.ReadResponse{Results: []*remote.QueryResult{{
+		Timeseries: []*remote.TimeSeries{{
+			Labels: []*remote.LabelPair{
+				{Name: "__name__", Value: "cpu"},
+				{Name: "host", Value: "a"},
+			},
+			Samples: []*remote.Sample{
+				{Value: 1.5, TimestampMs: 1000},
+				{Value: 2, TimestampMs: 2000},
+			},
+		}},
+	}}}); !reflect.DeepEqual(&resp, exp) {
+		t.Fatalf("unexpected response: %s", resp.String())
+	}
+}
+
+// Ensure a failed Prometheus remote read drains the remaining results and
+// aborts the query so the executor does not block.
+func TestHandler_PromRead_Error(t *testing.T) {
+	req := &remote.ReadRequest{
+		Queries: []*remote.Query{
+			{Matchers: []*remote.LabelMatcher{{Type: remote.MatchType_EQUAL, Name: "__name__", Value: "cpu"}}},
+			{Matchers: []*remote.LabelMatcher{{Type: remote.MatchType_EQUAL, Name: "__name__", Value: "mem"}}},
+		},
+	}
+	data, err := proto.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Like the cluster executor, send each result on an unbuffered channel.
+	done := make(chan struct{})
+	var closed chan struct{}
+	h := NewHandler(false)
+	h.QueryExecutor.ExecuteQueryFn = func(q *influxql.Query, db string, chunkSize int, closing chan struct{}) <-chan *influxql.Result {
+		closed = closing
+		ch := make(chan *influxql.Result)
+		go func() {
+			defer close(done)
+			defer close(ch)
+			ch <- &influxql.Result{StatementID: 0, Err: errors.New("marker")}
+			ch <- &influxql.Result{StatementID: 1}
+		}()
+		return ch
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, MustNewRequest("POST", "/api/v1/prom/read?db=foo", bytes.NewReader(snappy.Encode(nil, data))))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("unexpected status: %d: %s", w.Code, w.Body.String())
+	} else if !strings.Contains(w.Body.String(), "marker") {
+		t.Fatalf("unexpected body: %s", w.Body.String())
+	}
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("query executor blocked")
+	}
+
+	select {
+	case <-closed:
+	default:
+		t.Fatal("query not aborted")
+	}
+}
+
+// Ensure the handler serves statistics in the Prometheus exposition format.
+func TestHandler_Metrics(t *testing.T) {
+	h := NewHandler(false)
+	h.Handler.Monitor = &HandlerMonitor{
+		StatisticsFn: func(tags map[string]string) ([]*monitor.Statistic, error) {
+			return []*monitor.Statistic{{
+				Name:   "write",
+				Tags:   map[string]string{},
+				Values: map[string]interface{}{"req": int64(5)},
+			}}, nil
+		},
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, MustNewRequest("GET", "/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", w.Code)
+	} else if ct := w.Header().Get("Content-Type"); ct != prometheus.ExpositionContentType {
+		t.Fatalf("unexpected content type: %s", ct)
+	} else if body := w.Body.String(); body != "# TYPE influxdb_write_req counter\ninfluxdb_write_req 5\n" {
+		t.Fatalf("unexpected body: %s", body)
+	}
+}
+
 // Ensure the handler handles ping requests correctly.
 // TODO: This should be expanded to verify the MetaClient check in servePing is working correctly
 func TestHandler_Ping(t *testing.T) {
@@ -461,6 +699,7 @@ type Handler struct {
 	*httpd.Handler
 	MetaClient    HandlerMetaStore
 	QueryExecutor HandlerQueryExecutor
+	PointsWriter  HandlerPointsWriter
 }
 
 // NewHandler returns a new instance of Handler.
@@ -471,6 +710,7 @@ func NewHandler(requireAuthentication bool) *Handler {
 	}
 	h.Handler.MetaClient = &h.MetaClient
 	h.Handler.QueryExecutor = &h.QueryExecutor
+	h.Handler.PointsWriter = &h.PointsWriter
 	h.Handler.Version = "0.0.0"
 	return h
 }
@@ -517,6 +757,24 @@ func (e *HandlerQueryExecutor) ExecuteQuery(q *influxql.Query, db string, chunkS
 	return e.ExecuteQueryFn(q, db, chunkSize, closing)
 }
 
+// HandlerMonitor is a mock implementation of Handler.Monitor.
+type HandlerMonitor struct {
+	StatisticsFn func(tags map[string]string) ([]*monitor.Statistic, error)
+}
+
+func (m *HandlerMonitor) Statistics(tags map[string]string) ([]*monitor.Statistic, error) {
+	return m.StatisticsFn(tags)
+}
+
+// HandlerPointsWriter is a mock implementation of Handler.PointsWriter.
+type HandlerPointsWriter struct {
+	WritePointsFn func(database, retentionPolicy string, consistencyLevel models.ConsistencyLevel, points []models.Point) error
+}
+
+func (w *HandlerPointsWriter) WritePoints(database, retentionPolicy string, consistencyLevel models.ConsistencyLevel, points []models.Point) error {
+	return w.WritePointsFn(database, retentionPolicy, consistencyLevel, points)
+}
+
 // MustNewRequest returns a new HTTP request. Panic on error.
 func MustNewRequest(method, urlStr string, body io.Reader) *http.Request {
 	r, err := http.NewRequest(method, urlStr, body)
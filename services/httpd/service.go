@@ -31,8 +31,15 @@ const (
 	statQueryRequestDuration         = "queryReqDurationNs" // Number of (wall-time) nanoseconds spent inside query requests
 	statWriteRequestDuration         = "writeReqDurationNs" // Number of (wall-time) nanoseconds spent inside write requests
 	statRequestsActive               = "reqActive"          // Number of currently active requests
+	statPromWriteRequest             = "promWriteReq"       // Number of Prometheus remote write requests served
+	statPromReadRequest              = "promReadReq"        // Number of Prometheus remote read requests served
+	statMetricsRequest               = "metricsReq"         // Number of Prometheus metrics requests served
 )
 
+func init() {
+	influxdb.RegisterGauges("httpd", statRequestsActive)
+}
+
 // Service manages the listener and handler for an HTTP endpoint.
 type Service struct {
 	ln    net.Listener
@@ -229,7 +229,8 @@ func (c *Client) CreateDatabaseWithRetentionPolicy(name string, rpi *RetentionPo
 		// Check if the retention policy already exists. If it does and matches
 		// the desired retention policy, exit with no error.
 		if rp := db.RetentionPolicy(rpi.Name); rp != nil {
-			if rp.ReplicaN != rpi.ReplicaN || rp.Duration != rpi.Duration {
+			if rp.ReplicaN != rpi.ReplicaN || rp.Duration != rpi.Duration ||
+				(rpi.ShardGroupDuration != 0 && rp.ShardGroupDuration != rpi.ShardGroupDuration) {
 				return nil, ErrRetentionPolicyConflict
 			}
 			return db, nil
@@ -850,13 +851,13 @@ func (c *Client) DropContinuousQuery(database, name string) error {
 	return nil
 }
 
-func (c *Client) CreateSubscription(database, rp, name, mode string, destinations []string) error {
+func (c *Client) CreateSubscription(database, rp, name, mode string, destinations []string, condition string) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	data := c.cacheData.Clone()
 
-	if err := data.CreateSubscription(database, rp, name, mode, destinations); err != nil {
+	if err := data.CreateSubscription(database, rp, name, mode, destinations, condition); err != nil {
 		return err
 	}
 
@@ -867,6 +868,48 @@ func (c *Client) CreateSubscription(database, rp, name, mode string, destination
 	return nil
 }
 
+// CreateRollup adds a rollup to a retention policy.
+func (c *Client) CreateRollup(database, rp string, ri *RollupInfo) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data := c.cacheData.Clone()
+
+	if err := data.CreateRollup(database, rp, ri); err != nil {
+		return err
+	}
+
+	return c.commit(data)
+}
+
+// DropRollup removes a rollup from a retention policy.
+func (c *Client) DropRollup(database, rp, name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data := c.cacheData.Clone()
+
+	if err := data.DropRollup(database, rp, name); err != nil {
+		return err
+	}
+
+	return c.commit(data)
+}
+
+// SetRollupBackfilled marks the existing data of a rollup as downsampled.
+func (c *Client) SetRollupBackfilled(database, rp, name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data := c.cacheData.Clone()
+
+	if err := data.SetRollupBackfilled(database, rp, name); err != nil {
+		return err
+	}
+
+	return c.commit(data)
+}
+
 func (c *Client) DropSubscription(database, rp, name string) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
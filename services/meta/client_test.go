@@ -6,6 +6,7 @@ import (
 	"net"
 	"os"
 	"path"
+	"reflect"
 	"runtime"
 	"testing"
 	"time"
@@ -241,6 +242,214 @@ func TestMetaClient_CreateRetentionPolicy(t *testing.T) {
 	}
 }
 
+func TestMetaClient_RetentionPolicy_ShardGroupDuration(t *testing.T) {
+	t.Parallel()
+
+	d, c := newClient()
+	defer os.RemoveAll(d)
+	defer c.Close()
+
+	if _, err := c.CreateDatabase("db0"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Create a policy with an explicit shard group duration.
+	if _, err := c.CreateRetentionPolicy("db0", &meta.RetentionPolicyInfo{
+		Name:               "rp0",
+		Duration:           365 * 24 * time.Hour,
+		ShardGroupDuration: 24 * time.Hour,
+		ReplicaN:           1,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	rp, err := c.RetentionPolicy("db0", "rp0")
+	if err != nil {
+		t.Fatal(err)
+	} else if rp.ShardGroupDuration != 24*time.Hour {
+		t.Fatalf("rp shard group duration wrong: %s", rp.ShardGroupDuration)
+	}
+
+	// A shard group duration below the minimum is rejected.
+	if _, err := c.CreateRetentionPolicy("db0", &meta.RetentionPolicyInfo{
+		Name:               "rp1",
+		Duration:           24 * time.Hour,
+		ShardGroupDuration: time.Minute,
+		ReplicaN:           1,
+	}); err != meta.ErrShardGroupDurationTooLow {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Update the shard group duration.
+	rpu := &meta.RetentionPolicyUpdate{}
+	rpu.SetShardGroupDuration(2 * time.Hour)
+	if err := c.UpdateRetentionPolicy("db0", "rp0", rpu); err != nil {
+		t.Fatal(err)
+	} else if rp, _ = c.RetentionPolicy("db0", "rp0"); rp.ShardGroupDuration != 2*time.Hour {
+		t.Fatalf("rp shard group duration wrong: %s", rp.ShardGroupDuration)
+	}
+
+	// A shard group duration longer than the policy duration is rejected.
+	rpu = &meta.RetentionPolicyUpdate{}
+	rpu.SetShardGroupDuration(2 * 365 * 24 * time.Hour)
+	if err := c.UpdateRetentionPolicy("db0", "rp0", rpu); err != meta.ErrIncompatibleDurations {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Changing only the duration keeps an explicit shard group duration.
+	rpu = &meta.RetentionPolicyUpdate{}
+	rpu.SetDuration(24 * time.Hour)
+	if err := c.UpdateRetentionPolicy("db0", "rp0", rpu); err != nil {
+		t.Fatal(err)
+	} else if rp, _ = c.RetentionPolicy("db0", "rp0"); rp.ShardGroupDuration != 2*time.Hour {
+		t.Fatalf("rp shard group duration wrong: %s", rp.ShardGroupDuration)
+	}
+
+	// The shard group duration is derived again once it is longer than the
+	// policy duration.
+	rpu = &meta.RetentionPolicyUpdate{}
+	rpu.SetDuration(time.Hour)
+	if err := c.UpdateRetentionPolicy("db0", "rp0", rpu); err != nil {
+		t.Fatal(err)
+	} else if rp, _ = c.RetentionPolicy("db0", "rp0"); rp.ShardGroupDuration != time.Hour {
+		t.Fatalf("rp shard group duration wrong: %s", rp.ShardGroupDuration)
+	}
+
+	// A derived shard group duration follows the policy duration.
+	if _, err := c.CreateRetentionPolicy("db0", &meta.RetentionPolicyInfo{
+		Name:     "rp2",
+		Duration: 365 * 24 * time.Hour,
+		ReplicaN: 1,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	rpu = &meta.RetentionPolicyUpdate{}
+	rpu.SetDuration(7 * 24 * time.Hour)
+	if err := c.UpdateRetentionPolicy("db0", "rp2", rpu); err != nil {
+		t.Fatal(err)
+	} else if rp, _ := c.RetentionPolicy("db0", "rp2"); rp.ShardGroupDuration != 24*time.Hour {
+		t.Fatalf("rp shard group duration wrong: %s", rp.ShardGroupDuration)
+	}
+
+	// Shard groups are created using the policy's shard group duration.
+	sg, err := c.CreateShardGroup("db0", "rp0", time.Unix(0, 0).Add(90*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	} else if sg.StartTime != time.Unix(0, 0).Add(time.Hour).UTC() || sg.EndTime != time.Unix(0, 0).Add(2*time.Hour).UTC() {
+		t.Fatalf("unexpected shard group range: %s - %s", sg.StartTime, sg.EndTime)
+	}
+}
+
+func TestMetaClient_RetentionPolicy_ColdAfter(t *testing.T) {
+	t.Parallel()
+
+	d, c := newClient()
+	defer os.RemoveAll(d)
+	defer c.Close()
+
+	if _, err := c.CreateDatabase("db0"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.CreateRetentionPolicy("db0", &meta.RetentionPolicyInfo{
+		Name:      "rp0",
+		ReplicaN:  1,
+		ColdAfter: 24 * time.Hour,
+	}); err != nil {
+		t.Fatal(err)
+	} else if rp, _ := c.RetentionPolicy("db0", "rp0"); rp.ColdAfter != 24*time.Hour {
+		t.Fatalf("rp cold age wrong: %s", rp.ColdAfter)
+	}
+
+	rpu := &meta.RetentionPolicyUpdate{}
+	rpu.SetColdAfter(2 * time.Hour)
+	if err := c.UpdateRetentionPolicy("db0", "rp0", rpu); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only shard groups that ended more than two hours ago are cold.
+	now := time.Now().UTC()
+	if _, err := c.CreateShardGroup("db0", "rp0", now.Add(-14*24*time.Hour)); err != nil {
+		t.Fatal(err)
+	} else if _, err := c.CreateShardGroup("db0", "rp0", now); err != nil {
+		t.Fatal(err)
+	}
+	rp, err := c.RetentionPolicy("db0", "rp0")
+	if err != nil {
+		t.Fatal(err)
+	} else if rp.ColdAfter != 2*time.Hour {
+		t.Fatalf("rp cold age wrong: %s", rp.ColdAfter)
+	} else if groups := rp.ColdShardGroups(now); len(groups) != 1 {
+		t.Fatalf("unexpected cold shard group count: %d", len(groups))
+	} else if !groups[0].Contains(now.Add(-14 * 24 * time.Hour)) {
+		t.Fatalf("unexpected cold shard group: %s - %s", groups[0].StartTime, groups[0].EndTime)
+	}
+}
+
+func TestMetaClient_Rollups(t *testing.T) {
+	t.Parallel()
+
+	d, c := newClient()
+	defer os.RemoveAll(d)
+	defer c.Close()
+
+	if _, err := c.CreateDatabase("db0"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"rp0", "rp1"} {
+		if _, err := c.CreateRetentionPolicy("db0", &meta.RetentionPolicyInfo{Name: name, ReplicaN: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ri := &meta.RollupInfo{
+		Name:         "r0",
+		Target:       "rp1",
+		Interval:     time.Hour,
+		Measurements: "^cpu",
+		Aggregates: []meta.RollupAggregateInfo{
+			{Type: "float", Functions: []string{"mean", "max"}},
+		},
+	}
+	if err := c.CreateRollup("db0", "rp0", ri); err != nil {
+		t.Fatal(err)
+	}
+
+	rp, err := c.RetentionPolicy("db0", "rp0")
+	if err != nil {
+		t.Fatal(err)
+	} else if len(rp.Rollups) != 1 {
+		t.Fatalf("rollup not created: %v", rp.Rollups)
+	} else if !reflect.DeepEqual(rp.Rollups[0], *ri) {
+		t.Fatalf("unexpected rollup:\n\nexp=%#v\n\ngot=%#v", *ri, rp.Rollups[0])
+	}
+
+	// Invalid rollups are rejected.
+	if err := c.CreateRollup("db0", "rp0", ri); err != meta.ErrRollupExists {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := c.CreateRollup("db0", "rp0", &meta.RollupInfo{Name: "r1", Target: "rp0", Interval: time.Hour}); err != meta.ErrRollupTargetInvalid {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := c.CreateRollup("db0", "rp0", &meta.RollupInfo{Name: "r1", Target: "rp2", Interval: time.Hour}); err == nil || err.Error() != influxdb.ErrRetentionPolicyNotFound("rp2").Error() {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := c.CreateRollup("db0", "rp0", &meta.RollupInfo{Name: "r1", Target: "rp1"}); err != meta.ErrRollupIntervalRequired {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := c.SetRollupBackfilled("db0", "rp0", "r0"); err != nil {
+		t.Fatal(err)
+	} else if rp, _ = c.RetentionPolicy("db0", "rp0"); !rp.Rollups[0].Backfilled {
+		t.Fatal("rollup not marked as backfilled")
+	}
+
+	if err := c.DropRollup("db0", "rp0", "r0"); err != nil {
+		t.Fatal(err)
+	} else if rp, _ = c.RetentionPolicy("db0", "rp0"); len(rp.Rollups) != 0 {
+		t.Fatalf("rollup not dropped: %v", rp.Rollups)
+	} else if err := c.DropRollup("db0", "rp0", "r0"); err != meta.ErrRollupNotFound {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
 func TestMetaClient_SetDefaultRetentionPolicy(t *testing.T) {
 	t.Parallel()
 
@@ -571,19 +780,37 @@ func TestMetaClient_Subscriptions_Create(t *testing.T) {
 	}
 
 	// Create a subscription
-	if err := c.CreateSubscription("db0", "default", "sub0", "ALL", []string{"udp://example.com:9090"}); err != nil {
+	if err := c.CreateSubscription("db0", "default", "sub0", "ALL", []string{"udp://example.com:9090"}, ""); err != nil {
 		t.Fatal(err)
 	}
 
 	// Re-create a subscription
-	if err := c.CreateSubscription("db0", "default", "sub0", "ALL", []string{"udp://example.com:9090"}); err == nil || err.Error() != `subscription already exists` {
+	if err := c.CreateSubscription("db0", "default", "sub0", "ALL", []string{"udp://example.com:9090"}, ""); err == nil || err.Error() != `subscription already exists` {
 		t.Fatalf("unexpected error: %s", err)
 	}
 
 	// Create another subscription.
-	if err := c.CreateSubscription("db0", "default", "sub1", "ALL", []string{"udp://example.com:6060"}); err != nil {
+	if err := c.CreateSubscription("db0", "default", "sub1", "ALL", []string{"udp://example.com:6060"}, ""); err != nil {
 		t.Fatal(err)
 	}
+
+	// Create a subscription with a condition.
+	if err := c.CreateSubscription("db0", "default", "sub2", "ALL", []string{"udp://example.com:7070"}, "host = 'a'"); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = c.Database("db0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rp := db.RetentionPolicy("default")
+	if rp == nil {
+		t.Fatal("retention policy not found")
+	} else if len(rp.Subscriptions) != 3 {
+		t.Fatalf("unexpected subscription count: %d", len(rp.Subscriptions))
+	} else if cond := rp.Subscriptions[2].Condition; cond != "host = 'a'" {
+		t.Fatalf("unexpected condition: %s", cond)
+	}
 }
 
 func TestMetaClient_Subscriptions_Drop(t *testing.T) {
@@ -606,7 +833,7 @@ func TestMetaClient_Subscriptions_Drop(t *testing.T) {
 	}
 
 	// Create a subscription.
-	if err := c.CreateSubscription("db0", "default", "sub0", "ALL", []string{"udp://example.com:9090"}); err != nil {
+	if err := c.CreateSubscription("db0", "default", "sub0", "ALL", []string{"udp://example.com:9090"}, ""); err != nil {
 		t.Fatal(err)
 	}
 
@@ -24,6 +24,9 @@ const (
 
 	// MinRetentionPolicyDuration represents the minimum duration for a policy.
 	MinRetentionPolicyDuration = time.Hour
+
+	// MinShardGroupDuration represents the minimum shard group duration for a policy.
+	MinShardGroupDuration = time.Hour
 )
 
 // Data represents the top level collection of all metadata.
@@ -144,18 +147,28 @@ func (data *Data) CreateRetentionPolicy(database string, rpi *RetentionPolicyInf
 		return influxdb.ErrDatabaseNotFound(database)
 	} else if rp := di.RetentionPolicy(rpi.Name); rp != nil {
 		// RP with that name already exists.  Make sure they're the same.
-		if rp.ReplicaN != rpi.ReplicaN || rp.Duration != rpi.Duration {
+		if rp.ReplicaN != rpi.ReplicaN || rp.Duration != rpi.Duration ||
+			(rpi.ShardGroupDuration != 0 && rp.ShardGroupDuration != rpi.ShardGroupDuration) {
 			return ErrRetentionPolicyExists
 		}
 		return nil
 	}
 
+	// Derive the shard group duration from the policy duration if not set.
+	sgDuration := rpi.ShardGroupDuration
+	if sgDuration == 0 {
+		sgDuration = shardGroupDuration(rpi.Duration)
+	} else if err := validateShardGroupDuration(rpi.Duration, sgDuration); err != nil {
+		return err
+	}
+
 	// Append new policy.
 	di.RetentionPolicies = append(di.RetentionPolicies, RetentionPolicyInfo{
 		Name:               rpi.Name,
 		Duration:           rpi.Duration,
-		ShardGroupDuration: shardGroupDuration(rpi.Duration),
+		ShardGroupDuration: sgDuration,
 		ReplicaN:           rpi.ReplicaN,
+		ColdAfter:          rpi.ColdAfter,
 	})
 
 	return nil
@@ -183,9 +196,11 @@ func (data *Data) DropRetentionPolicy(database, name string) error {
 
 // RetentionPolicyUpdate represents retention policy fields to be updated.
 type RetentionPolicyUpdate struct {
-	Name     *string
-	Duration *time.Duration
-	ReplicaN *int
+	Name               *string
+	Duration           *time.Duration
+	ShardGroupDuration *time.Duration
+	ReplicaN           *int
+	ColdAfter          *time.Duration
 }
 
 // SetName sets the RetentionPolicyUpdate.Name
@@ -194,9 +209,15 @@ func (rpu *RetentionPolicyUpdate) SetName(v string) { rpu.Name = &v }
 // SetDuration sets the RetentionPolicyUpdate.Duration
 func (rpu *RetentionPolicyUpdate) SetDuration(v time.Duration) { rpu.Duration = &v }
 
+// SetShardGroupDuration sets the RetentionPolicyUpdate.ShardGroupDuration
+func (rpu *RetentionPolicyUpdate) SetShardGroupDuration(v time.Duration) { rpu.ShardGroupDuration = &v }
+
 // SetReplicaN sets the RetentionPolicyUpdate.ReplicaN
 func (rpu *RetentionPolicyUpdate) SetReplicaN(v int) { rpu.ReplicaN = &v }
 
+// SetColdAfter sets the RetentionPolicyUpdate.ColdAfter
+func (rpu *RetentionPolicyUpdate) SetColdAfter(v time.Duration) { rpu.ColdAfter = &v }
+
 // UpdateRetentionPolicy updates an existing retention policy.
 func (data *Data) UpdateRetentionPolicy(database, name string, rpu *RetentionPolicyUpdate) error {
 	// Find database.
@@ -221,17 +242,38 @@ func (data *Data) UpdateRetentionPolicy(database, name string, rpu *RetentionPol
 		return ErrRetentionPolicyDurationTooLow
 	}
 
+	// A shard group duration of zero is derived from the policy duration.
+	// When only the policy duration changes, a derived shard group duration
+	// is derived again and an explicit one is kept unless it is no longer
+	// valid for the new duration.
+	duration, sgDuration := rpi.Duration, rpi.ShardGroupDuration
+	if rpu.Duration != nil {
+		duration = *rpu.Duration
+		if sgDuration == shardGroupDuration(rpi.Duration) || validateShardGroupDuration(duration, sgDuration) != nil {
+			sgDuration = 0
+		}
+	}
+	if rpu.ShardGroupDuration != nil {
+		sgDuration = *rpu.ShardGroupDuration
+	}
+	if sgDuration == 0 {
+		sgDuration = shardGroupDuration(duration)
+	} else if err := validateShardGroupDuration(duration, sgDuration); err != nil {
+		return err
+	}
+
 	// Update fields.
 	if rpu.Name != nil {
 		rpi.Name = *rpu.Name
 	}
-	if rpu.Duration != nil {
-		rpi.Duration = *rpu.Duration
-		rpi.ShardGroupDuration = shardGroupDuration(rpi.Duration)
-	}
+	rpi.Duration = duration
+	rpi.ShardGroupDuration = sgDuration
 	if rpu.ReplicaN != nil {
 		rpi.ReplicaN = *rpu.ReplicaN
 	}
+	if rpu.ColdAfter != nil {
+		rpi.ColdAfter = *rpu.ColdAfter
+	}
 
 	return nil
 }
@@ -433,7 +475,8 @@ func (data *Data) DropContinuousQuery(database, name string) error {
 }
 
 // CreateSubscription adds a named subscription to a database and retention policy.
-func (data *Data) CreateSubscription(database, rp, name, mode string, destinations []string) error {
+// Only points matching condition are forwarded, unless it is blank.
+func (data *Data) CreateSubscription(database, rp, name, mode string, destinations []string, condition string) error {
 	rpi, err := data.RetentionPolicy(database, rp)
 	if err != nil {
 		return err
@@ -453,6 +496,7 @@ func (data *Data) CreateSubscription(database, rp, name, mode string, destinatio
 		Name:         name,
 		Mode:         mode,
 		Destinations: destinations,
+		Condition:    condition,
 	})
 
 	return nil
@@ -476,6 +520,73 @@ func (data *Data) DropSubscription(database, rp, name string) error {
 	return ErrSubscriptionNotFound
 }
 
+// CreateRollup adds a rollup to a retention policy.
+func (data *Data) CreateRollup(database, rp string, ri *RollupInfo) error {
+	rpi, err := data.RetentionPolicy(database, rp)
+	if err != nil {
+		return err
+	} else if rpi == nil {
+		return influxdb.ErrRetentionPolicyNotFound(rp)
+	}
+
+	// Validate the rollup.
+	if ri.Name == "" {
+		return ErrRollupNameRequired
+	} else if ri.Target == rp {
+		return ErrRollupTargetInvalid
+	} else if target, _ := data.RetentionPolicy(database, ri.Target); target == nil {
+		return influxdb.ErrRetentionPolicyNotFound(ri.Target)
+	} else if ri.Interval <= 0 {
+		return ErrRollupIntervalRequired
+	}
+
+	// Ensure the name doesn't already exist.
+	for i := range rpi.Rollups {
+		if rpi.Rollups[i].Name == ri.Name {
+			return ErrRollupExists
+		}
+	}
+
+	rpi.Rollups = append(rpi.Rollups, ri.clone())
+	return nil
+}
+
+// DropRollup removes a rollup from a retention policy.
+func (data *Data) DropRollup(database, rp, name string) error {
+	rpi, err := data.RetentionPolicy(database, rp)
+	if err != nil {
+		return err
+	} else if rpi == nil {
+		return influxdb.ErrRetentionPolicyNotFound(rp)
+	}
+
+	for i := range rpi.Rollups {
+		if rpi.Rollups[i].Name == name {
+			rpi.Rollups = append(rpi.Rollups[:i], rpi.Rollups[i+1:]...)
+			return nil
+		}
+	}
+	return ErrRollupNotFound
+}
+
+// SetRollupBackfilled marks the existing data of a rollup as downsampled.
+func (data *Data) SetRollupBackfilled(database, rp, name string) error {
+	rpi, err := data.RetentionPolicy(database, rp)
+	if err != nil {
+		return err
+	} else if rpi == nil {
+		return influxdb.ErrRetentionPolicyNotFound(rp)
+	}
+
+	for i := range rpi.Rollups {
+		if rpi.Rollups[i].Name == name {
+			rpi.Rollups[i].Backfilled = true
+			return nil
+		}
+	}
+	return ErrRollupNotFound
+}
+
 // User returns a user by username.
 func (data *Data) User(username string) *UserInfo {
 	for i := range data.Users {
@@ -809,6 +920,11 @@ type RetentionPolicyInfo struct {
 	ShardGroupDuration time.Duration
 	ShardGroups        []ShardGroupInfo
 	Subscriptions      []SubscriptionInfo
+	Rollups            []RollupInfo
+
+	// ColdAfter is the age, measured from the end of a shard group, after
+	// which its shards are moved to cold storage. Zero disables tiering.
+	ColdAfter time.Duration
 }
 
 // NewRetentionPolicyInfo returns a new instance of RetentionPolicyInfo with defaults set.
@@ -844,6 +960,24 @@ func (rpi *RetentionPolicyInfo) ExpiredShardGroups(t time.Time) []*ShardGroupInf
 	return groups
 }
 
+// ColdShardGroups returns the Shard Groups which are old enough to be moved
+// to cold storage at the given time.
+func (rpi *RetentionPolicyInfo) ColdShardGroups(t time.Time) []*ShardGroupInfo {
+	var groups = make([]*ShardGroupInfo, 0)
+	if rpi.ColdAfter == 0 {
+		return groups
+	}
+	for i := range rpi.ShardGroups {
+		if rpi.ShardGroups[i].Deleted() {
+			continue
+		}
+		if rpi.ShardGroups[i].EndTime.Add(rpi.ColdAfter).Before(t) {
+			groups = append(groups, &rpi.ShardGroups[i])
+		}
+	}
+	return groups
+}
+
 // DeletedShardGroups returns the Shard Groups which are marked as deleted.
 func (rpi *RetentionPolicyInfo) DeletedShardGroups() []*ShardGroupInfo {
 	var groups = make([]*ShardGroupInfo, 0)
@@ -863,6 +997,9 @@ func (rpi *RetentionPolicyInfo) marshal() *internal.RetentionPolicyInfo {
 		Duration:           proto.Int64(int64(rpi.Duration)),
 		ShardGroupDuration: proto.Int64(int64(rpi.ShardGroupDuration)),
 	}
+	if rpi.ColdAfter != 0 {
+		pb.ColdAfter = proto.Int64(int64(rpi.ColdAfter))
+	}
 
 	pb.ShardGroups = make([]*internal.ShardGroupInfo, len(rpi.ShardGroups))
 	for i, sgi := range rpi.ShardGroups {
@@ -874,6 +1011,11 @@ func (rpi *RetentionPolicyInfo) marshal() *internal.RetentionPolicyInfo {
 		pb.Subscriptions[i] = sub.marshal()
 	}
 
+	pb.Rollups = make([]*internal.RollupInfo, len(rpi.Rollups))
+	for i, ri := range rpi.Rollups {
+		pb.Rollups[i] = ri.marshal()
+	}
+
 	return pb
 }
 
@@ -883,6 +1025,7 @@ func (rpi *RetentionPolicyInfo) unmarshal(pb *internal.RetentionPolicyInfo) {
 	rpi.ReplicaN = int(pb.GetReplicaN())
 	rpi.Duration = time.Duration(pb.GetDuration())
 	rpi.ShardGroupDuration = time.Duration(pb.GetShardGroupDuration())
+	rpi.ColdAfter = time.Duration(pb.GetColdAfter())
 
 	if len(pb.GetShardGroups()) > 0 {
 		rpi.ShardGroups = make([]ShardGroupInfo, len(pb.GetShardGroups()))
@@ -896,6 +1039,12 @@ func (rpi *RetentionPolicyInfo) unmarshal(pb *internal.RetentionPolicyInfo) {
 			rpi.Subscriptions[i].unmarshal(x)
 		}
 	}
+	if len(pb.GetRollups()) > 0 {
+		rpi.Rollups = make([]RollupInfo, len(pb.GetRollups()))
+		for i, x := range pb.GetRollups() {
+			rpi.Rollups[i].unmarshal(x)
+		}
+	}
 }
 
 // clone returns a deep copy of rpi.
@@ -909,6 +1058,13 @@ func (rpi RetentionPolicyInfo) clone() RetentionPolicyInfo {
 		}
 	}
 
+	if rpi.Rollups != nil {
+		other.Rollups = make([]RollupInfo, len(rpi.Rollups))
+		for i := range rpi.Rollups {
+			other.Rollups[i] = rpi.Rollups[i].clone()
+		}
+	}
+
 	return other
 }
 
@@ -937,6 +1093,17 @@ func shardGroupDuration(d time.Duration) time.Duration {
 	return 1 * time.Hour
 }
 
+// validateShardGroupDuration returns an error if sgDuration cannot be used as
+// the shard group duration of a policy retaining data for duration.
+func validateShardGroupDuration(duration, sgDuration time.Duration) error {
+	if sgDuration < MinShardGroupDuration {
+		return ErrShardGroupDurationTooLow
+	} else if duration != 0 && sgDuration > duration {
+		return ErrIncompatibleDurations
+	}
+	return nil
+}
+
 // ShardGroupInfo represents metadata about a shard group. The DeletedAt field is important
 // because it makes it clear that a ShardGroup has been marked as deleted, and allow the system
 // to be sure that a ShardGroup is not simply missing. If the DeletedAt is set, the system can
@@ -1102,6 +1269,10 @@ type SubscriptionInfo struct {
 	Name         string
 	Mode         string
 	Destinations []string
+
+	// Condition is an InfluxQL expression points must match to be
+	// forwarded. All points are forwarded when it is blank.
+	Condition string
 }
 
 // marshal serializes to a protobuf representation.
@@ -1110,6 +1281,9 @@ func (si SubscriptionInfo) marshal() *internal.SubscriptionInfo {
 		Name: proto.String(si.Name),
 		Mode: proto.String(si.Mode),
 	}
+	if si.Condition != "" {
+		pb.Condition = proto.String(si.Condition)
+	}
 
 	pb.Destinations = make([]string, len(si.Destinations))
 	for i := range si.Destinations {
@@ -1122,6 +1296,7 @@ func (si SubscriptionInfo) marshal() *internal.SubscriptionInfo {
 func (si *SubscriptionInfo) unmarshal(pb *internal.SubscriptionInfo) {
 	si.Name = pb.GetName()
 	si.Mode = pb.GetMode()
+	si.Condition = pb.GetCondition()
 
 	if len(pb.GetDestinations()) > 0 {
 		si.Destinations = make([]string, len(pb.GetDestinations()))
@@ -1131,6 +1306,94 @@ func (si *SubscriptionInfo) unmarshal(pb *internal.SubscriptionInfo) {
 	}
 }
 
+// RollupInfo represents a rule which downsamples the measurements of a
+// retention policy into another retention policy.
+type RollupInfo struct {
+	Name string
+
+	// Target is the retention policy the downsampled data is written to.
+	Target string
+
+	// Interval is the duration of each downsampled interval.
+	Interval time.Duration
+
+	// Measurements is a regular expression matching the measurements to
+	// downsample.  All measurements are downsampled when it is blank.
+	Measurements string
+
+	// Aggregates are the functions applied to fields of each data type.
+	Aggregates []RollupAggregateInfo
+
+	// Backfilled is set once the data written before the rollup was created
+	// has been downsampled.
+	Backfilled bool
+}
+
+// RollupAggregateInfo represents the functions a rollup applies to the fields
+// of a data type.
+type RollupAggregateInfo struct {
+	Type      string
+	Functions []string
+}
+
+// clone returns a deep copy of ri.
+func (ri RollupInfo) clone() RollupInfo {
+	other := ri
+
+	if ri.Aggregates != nil {
+		other.Aggregates = make([]RollupAggregateInfo, len(ri.Aggregates))
+		for i, a := range ri.Aggregates {
+			other.Aggregates[i] = RollupAggregateInfo{
+				Type:      a.Type,
+				Functions: append([]string(nil), a.Functions...),
+			}
+		}
+	}
+
+	return other
+}
+
+// marshal serializes to a protobuf representation.
+func (ri RollupInfo) marshal() *internal.RollupInfo {
+	pb := &internal.RollupInfo{
+		Name:       proto.String(ri.Name),
+		Target:     proto.String(ri.Target),
+		Interval:   proto.Int64(int64(ri.Interval)),
+		Backfilled: proto.Bool(ri.Backfilled),
+	}
+	if ri.Measurements != "" {
+		pb.Measurements = proto.String(ri.Measurements)
+	}
+
+	pb.Aggregates = make([]*internal.RollupAggregateInfo, len(ri.Aggregates))
+	for i, a := range ri.Aggregates {
+		pb.Aggregates[i] = &internal.RollupAggregateInfo{
+			Type:      proto.String(a.Type),
+			Functions: a.Functions,
+		}
+	}
+	return pb
+}
+
+// unmarshal deserializes from a protobuf representation.
+func (ri *RollupInfo) unmarshal(pb *internal.RollupInfo) {
+	ri.Name = pb.GetName()
+	ri.Target = pb.GetTarget()
+	ri.Interval = time.Duration(pb.GetInterval())
+	ri.Measurements = pb.GetMeasurements()
+	ri.Backfilled = pb.GetBackfilled()
+
+	if len(pb.GetAggregates()) > 0 {
+		ri.Aggregates = make([]RollupAggregateInfo, len(pb.GetAggregates()))
+		for i, x := range pb.GetAggregates() {
+			ri.Aggregates[i] = RollupAggregateInfo{
+				Type:      x.GetType(),
+				Functions: x.GetFunctions(),
+			}
+		}
+	}
+}
+
 // ShardOwner represents a node that owns a shard.
 type ShardOwner struct {
 	NodeID uint64
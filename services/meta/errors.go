@@ -66,6 +66,15 @@ var (
 	ErrRetentionPolicyDurationTooLow = errors.New(fmt.Sprintf("retention policy duration must be at least %s",
 		MinRetentionPolicyDuration))
 
+	// ErrShardGroupDurationTooLow is returned when a retention policy has a
+	// shard group duration lower than the allowed minimum.
+	ErrShardGroupDurationTooLow = errors.New(fmt.Sprintf("shard group duration must be at least %s",
+		MinShardGroupDuration))
+
+	// ErrIncompatibleDurations is returned when a retention policy has a
+	// shard group duration longer than its duration.
+	ErrIncompatibleDurations = errors.New("retention policy duration must be greater than the shard group duration")
+
 	// ErrRetentionPolicyConflict is returned when creating a retention policy conflicts
 	// with an existing policy.
 	ErrRetentionPolicyConflict = errors.New("retention policy conflicts with an existing policy")
@@ -101,6 +110,23 @@ var (
 
 	// ErrSubscriptionNotFound is returned when removing a subscription that doesn't exist.
 	ErrSubscriptionNotFound = errors.New("subscription not found")
+
+	// ErrRollupExists is returned when creating an already existing rollup.
+	ErrRollupExists = errors.New("rollup already exists")
+
+	// ErrRollupNotFound is returned when removing a rollup that doesn't exist.
+	ErrRollupNotFound = errors.New("rollup not found")
+
+	// ErrRollupNameRequired is returned when creating a rollup without a name.
+	ErrRollupNameRequired = errors.New("rollup name required")
+
+	// ErrRollupTargetInvalid is returned when a rollup writes to the retention
+	// policy it reads from.
+	ErrRollupTargetInvalid = errors.New("rollup target must be a different retention policy")
+
+	// ErrRollupIntervalRequired is returned when creating a rollup without an
+	// interval.
+	ErrRollupIntervalRequired = errors.New("rollup interval must be greater than zero")
 )
 
 var (
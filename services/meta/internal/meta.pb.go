@@ -16,6 +16,8 @@ It has these top-level messages:
 	ShardGroupInfo
 	ShardInfo
 	SubscriptionInfo
+	RollupInfo
+	RollupAggregateInfo
 	ShardOwner
 	ContinuousQueryInfo
 	UserInfo
@@ -353,6 +355,8 @@ type RetentionPolicyInfo struct {
 	ReplicaN           *uint32             `protobuf:"varint,4,req,name=ReplicaN" json:"ReplicaN,omitempty"`
 	ShardGroups        []*ShardGroupInfo   `protobuf:"bytes,5,rep,name=ShardGroups" json:"ShardGroups,omitempty"`
 	Subscriptions      []*SubscriptionInfo `protobuf:"bytes,6,rep,name=Subscriptions" json:"Subscriptions,omitempty"`
+	Rollups            []*RollupInfo       `protobuf:"bytes,7,rep,name=Rollups" json:"Rollups,omitempty"`
+	ColdAfter          *int64              `protobuf:"varint,8,opt,name=ColdAfter" json:"ColdAfter,omitempty"`
 	XXX_unrecognized   []byte              `json:"-"`
 }
 
@@ -402,6 +406,20 @@ func (m *RetentionPolicyInfo) GetSubscriptions() []*SubscriptionInfo {
 	return nil
 }
 
+func (m *RetentionPolicyInfo) GetRollups() []*RollupInfo {
+	if m != nil {
+		return m.Rollups
+	}
+	return nil
+}
+
+func (m *RetentionPolicyInfo) GetColdAfter() int64 {
+	if m != nil && m.ColdAfter != nil {
+		return *m.ColdAfter
+	}
+	return 0
+}
+
 type ShardGroupInfo struct {
 	ID               *uint64      `protobuf:"varint,1,req,name=ID" json:"ID,omitempty"`
 	StartTime        *int64       `protobuf:"varint,2,req,name=StartTime" json:"StartTime,omitempty"`
@@ -486,6 +504,7 @@ type SubscriptionInfo struct {
 	Name             *string  `protobuf:"bytes,1,req,name=Name" json:"Name,omitempty"`
 	Mode             *string  `protobuf:"bytes,2,req,name=Mode" json:"Mode,omitempty"`
 	Destinations     []string `protobuf:"bytes,3,rep,name=Destinations" json:"Destinations,omitempty"`
+	Condition        *string  `protobuf:"bytes,4,opt,name=Condition" json:"Condition,omitempty"`
 	XXX_unrecognized []byte   `json:"-"`
 }
 
@@ -514,6 +533,93 @@ func (m *SubscriptionInfo) GetDestinations() []string {
 	return nil
 }
 
+func (m *SubscriptionInfo) GetCondition() string {
+	if m != nil && m.Condition != nil {
+		return *m.Condition
+	}
+	return ""
+}
+
+type RollupInfo struct {
+	Name             *string                `protobuf:"bytes,1,req,name=Name" json:"Name,omitempty"`
+	Target           *string                `protobuf:"bytes,2,req,name=Target" json:"Target,omitempty"`
+	Interval         *int64                 `protobuf:"varint,3,req,name=Interval" json:"Interval,omitempty"`
+	Measurements     *string                `protobuf:"bytes,4,opt,name=Measurements" json:"Measurements,omitempty"`
+	Aggregates       []*RollupAggregateInfo `protobuf:"bytes,5,rep,name=Aggregates" json:"Aggregates,omitempty"`
+	Backfilled       *bool                  `protobuf:"varint,6,opt,name=Backfilled" json:"Backfilled,omitempty"`
+	XXX_unrecognized []byte                 `json:"-"`
+}
+
+func (m *RollupInfo) Reset()         { *m = RollupInfo{} }
+func (m *RollupInfo) String() string { return proto.CompactTextString(m) }
+func (*RollupInfo) ProtoMessage()    {}
+
+func (m *RollupInfo) GetName() string {
+	if m != nil && m.Name != nil {
+		return *m.Name
+	}
+	return ""
+}
+
+func (m *RollupInfo) GetTarget() string {
+	if m != nil && m.Target != nil {
+		return *m.Target
+	}
+	return ""
+}
+
+func (m *RollupInfo) GetInterval() int64 {
+	if m != nil && m.Interval != nil {
+		return *m.Interval
+	}
+	return 0
+}
+
+func (m *RollupInfo) GetMeasurements() string {
+	if m != nil && m.Measurements != nil {
+		return *m.Measurements
+	}
+	return ""
+}
+
+func (m *RollupInfo) GetAggregates() []*RollupAggregateInfo {
+	if m != nil {
+		return m.Aggregates
+	}
+	return nil
+}
+
+func (m *RollupInfo) GetBackfilled() bool {
+	if m != nil && m.Backfilled != nil {
+		return *m.Backfilled
+	}
+	return false
+}
+
+type RollupAggregateInfo struct {
+	Type             *string  `protobuf:"bytes,1,req,name=Type" json:"Type,omitempty"`
+	Functions        []string `protobuf:"bytes,2,rep,name=Functions" json:"Functions,omitempty"`
+	XXX_unrecognized []byte   `json:"-"`
+}
+
+func (m *RollupAggregateInfo) Reset()         { *m = RollupAggregateInfo{} }
+func (m *RollupAggregateInfo) String() string { return proto.CompactTextString(m) }
+func (*RollupAggregateInfo) ProtoMessage()    {}
+
+func (m *RollupAggregateInfo) GetType() string {
+	if m != nil && m.Type != nil {
+		return *m.Type
+	}
+	return ""
+}
+
+func (m *RollupAggregateInfo) GetFunctions() []string {
+	if m != nil {
+		return m.Functions
+	}
+	return nil
+}
+
 type ShardOwner struct {
 	NodeID           *uint64 `protobuf:"varint,1,req,name=NodeID" json:"NodeID,omitempty"`
 	XXX_unrecognized []byte  `json:"-"`
@@ -1693,6 +1799,8 @@ func init() {
 	proto.RegisterType((*ShardGroupInfo)(nil), "internal.ShardGroupInfo")
 	proto.RegisterType((*ShardInfo)(nil), "internal.ShardInfo")
 	proto.RegisterType((*SubscriptionInfo)(nil), "internal.SubscriptionInfo")
+	proto.RegisterType((*RollupInfo)(nil), "internal.RollupInfo")
+	proto.RegisterType((*RollupAggregateInfo)(nil), "internal.RollupAggregateInfo")
 	proto.RegisterType((*ShardOwner)(nil), "internal.ShardOwner")
 	proto.RegisterType((*ContinuousQueryInfo)(nil), "internal.ContinuousQueryInfo")
 	proto.RegisterType((*UserInfo)(nil), "internal.UserInfo")
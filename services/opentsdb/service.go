@@ -44,6 +44,10 @@ const (
 	statDroppedPointsInvalid     = "droppedPointsInvalid"
 )
 
+func init() {
+	influxdb.RegisterGauges("opentsdb", statTelnetConnectionsActive, statConnectionsActive)
+}
+
 // Service manages the listener and handler for an HTTP endpoint.
 type Service struct {
 	ln     net.Listener  // main listener
@@ -6,6 +6,7 @@ import (
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"os"
@@ -37,6 +38,9 @@ type Service struct {
 	MetaClient interface {
 		encoding.BinaryMarshaler
 		Database(name string) (*meta.DatabaseInfo, error)
+		CreateDatabase(name string) (*meta.DatabaseInfo, error)
+		CreateRetentionPolicy(database string, rpi *meta.RetentionPolicyInfo) (*meta.RetentionPolicyInfo, error)
+		CreateShardGroup(database, policy string, timestamp time.Time) (*meta.ShardGroupInfo, error)
 	}
 
 	TSDBStore *tsdb.Store
@@ -108,13 +112,16 @@ func (s *Service) serve() {
 
 // handleConn processes conn. This is run in a separate goroutine.
 func (s *Service) handleConn(conn net.Conn) error {
-	r, err := s.readRequest(conn)
+	r, body, err := s.readRequest(conn)
 	if err != nil {
 		return fmt.Errorf("read request: %s", err)
 	}
 
 	switch r.Type {
 	case RequestShardBackup:
+		if len(r.Files) > 0 {
+			return s.TSDBStore.BackupShardFiles(r.ShardID, r.Files, conn)
+		}
 		if err := s.TSDBStore.BackupShard(r.ShardID, r.Since, conn); err != nil {
 			return err
 		}
@@ -126,6 +133,10 @@ func (s *Service) handleConn(conn net.Conn) error {
 		return s.writeDatabaseInfo(conn, r.Database)
 	case RequestRetentionPolicyInfo:
 		return s.writeRetentionPolicyInfo(conn, r.Database, r.RetentionPolicy)
+	case RequestShardFiles:
+		return s.writeShardFiles(conn, r.ShardID)
+	case RequestShardRestore:
+		return s.restoreShard(conn, r, body)
 	default:
 		return fmt.Errorf("request type unknown: %v", r.Type)
 	}
@@ -255,13 +266,102 @@ func (s *Service) writeRetentionPolicyInfo(conn net.Conn, database, retentionPol
 	return nil
 }
 
-// readRequest Unmarshals a request object from the conn
-func (s *Service) readRequest(conn net.Conn) (Request, error) {
+// writeShardFiles will write the names and sizes of the data files of a
+// shard into the connection.
+func (s *Service) writeShardFiles(conn net.Conn, id uint64) error {
+	files, err := s.TSDBStore.ShardDataFiles(id)
+	if err != nil {
+		return err
+	}
+
+	if err := json.NewEncoder(conn).Encode(Response{Files: files}); err != nil {
+		return fmt.Errorf("encode resonse: %s", err.Error())
+	}
+
+	return nil
+}
+
+// restoreShard imports the tar archive read from body into the shard of the
+// shard group containing r.Time, creating the database, retention policy
+// and shard group if they don't exist. The result is written into the
+// connection.
+func (s *Service) restoreShard(conn net.Conn, r Request, body io.Reader) error {
+	res := Response{}
+	path, err := s.importShard(r, body)
+	if err != nil {
+		res.Err = err.Error()
+	} else {
+		res.Paths = []string{path}
+	}
+
+	if err := json.NewEncoder(conn).Encode(res); err != nil {
+		return fmt.Errorf("encode resonse: %s", err.Error())
+	}
+	return err
+}
+
+// importShard restores the archive in body and returns the relative path of
+// the shard it was restored to.
+func (s *Service) importShard(r Request, body io.Reader) (string, error) {
+	if _, err := s.MetaClient.CreateDatabase(r.Database); err != nil {
+		return "", err
+	}
+
+	rpi := meta.NewRetentionPolicyInfo(r.RetentionPolicy)
+	rpi.Duration = r.Duration
+	rpi.ShardGroupDuration = r.ShardGroupDuration
+	if r.ReplicaN > 0 {
+		rpi.ReplicaN = r.ReplicaN
+	}
+	if _, err := s.MetaClient.CreateRetentionPolicy(r.Database, rpi); err != nil {
+		return "", err
+	}
+
+	sgi, err := s.MetaClient.CreateShardGroup(r.Database, r.RetentionPolicy, r.Time)
+	if err != nil {
+		return "", err
+	} else if len(sgi.Shards) == 0 {
+		return "", fmt.Errorf("shard group %d has no shards", sgi.ID)
+	}
+
+	// Restore into the shard owned by this node, if it is known.
+	si := sgi.Shards[0]
+	if s.Node != nil {
+		for _, sh := range sgi.Shards {
+			if sh.OwnedBy(s.Node.ID) {
+				si = sh
+				break
+			}
+		}
+	}
+
+	if err := s.TSDBStore.CreateShard(r.Database, r.RetentionPolicy, si.ID); err != nil {
+		return "", err
+	}
+	if err := s.TSDBStore.RestoreShard(si.ID, body); err != nil {
+		return "", err
+	}
+
+	s.Logger.Printf("restored shard %d of database %s, retention policy %s", si.ID, r.Database, r.RetentionPolicy)
+	return s.TSDBStore.ShardRelativePath(si.ID)
+}
+
+// readRequest Unmarshals a request object from the conn. Returns a reader
+// for any data sent after the request.
+func (s *Service) readRequest(conn net.Conn) (Request, io.Reader, error) {
 	var r Request
-	if err := json.NewDecoder(conn).Decode(&r); err != nil {
-		return r, err
+	dec := json.NewDecoder(conn)
+	if err := dec.Decode(&r); err != nil {
+		return r, nil, err
+	}
+
+	// Skip the newline written after the request by json.Encoder.
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(dec.Buffered()); err != nil {
+		return r, nil, err
 	}
-	return r, nil
+	rest := bytes.TrimLeft(buf.Bytes(), " \t\r\n")
+	return r, io.MultiReader(bytes.NewReader(rest), conn), nil
 }
 
 type RequestType uint8
@@ -271,6 +371,8 @@ const (
 	RequestMetastoreBackup
 	RequestDatabaseInfo
 	RequestRetentionPolicyInfo
+	RequestShardFiles
+	RequestShardRestore
 )
 
 // Request represents a request for a specific backup or for information
@@ -281,10 +383,28 @@ type Request struct {
 	RetentionPolicy string
 	ShardID         uint64
 	Since           time.Time
+
+	// Names of the shard files to backup. All files modified since Since
+	// are backed up if empty.
+	Files []string
+
+	// Time within the shard group restored data belongs to.
+	Time time.Time
+
+	// Settings used to create the retention policy of restored data if it
+	// doesn't exist.
+	Duration           time.Duration
+	ShardGroupDuration time.Duration
+	ReplicaN           int
 }
 
 // Response contains the relative paths for all the shards on this server
-// that are in the requested database or retention policy
+// that are in the requested database or retention policy, or the data
+// files of a shard.
 type Response struct {
 	Paths []string
+	Files []tsdb.DataFile
+
+	// Err is set if a restore failed.
+	Err string
 }
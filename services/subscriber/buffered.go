@@ -0,0 +1,98 @@
+package subscriber
+
+import (
+	"errors"
+	"expvar"
+	"log"
+	"sync"
+
+	"github.com/influxdata/influxdb/cluster"
+)
+
+// ErrBufferFull is returned when a write is dropped because a destination is
+// not keeping up with writes.
+var ErrBufferFull = errors.New("subscriber write buffer full")
+
+// bufferedWriter delivers writes from its own goroutine so a slow destination
+// does not hold up writes to other destinations and subscriptions.
+type bufferedWriter struct {
+	w       PointsWriter
+	statMap *expvar.Map
+	Logger  *log.Logger
+
+	points  chan *cluster.WritePointsRequest
+	closing chan struct{}
+	wg      sync.WaitGroup
+}
+
+// newBufferedWriter returns a writer which buffers up to size writes to w
+// and starts delivering them.
+func newBufferedWriter(w PointsWriter, size int, statMap *expvar.Map, logger *log.Logger) *bufferedWriter {
+	bw := &bufferedWriter{
+		w:       w,
+		statMap: statMap,
+		Logger:  logger,
+		points:  make(chan *cluster.WritePointsRequest, size),
+		closing: make(chan struct{}),
+	}
+
+	bw.wg.Add(1)
+	go bw.run()
+	return bw
+}
+
+// WritePoints adds the points to the buffer.  The points are dropped if the
+// buffer is full.
+func (w *bufferedWriter) WritePoints(p *cluster.WritePointsRequest) error {
+	select {
+	case w.points <- p:
+		return nil
+	default:
+		w.statMap.Add(statPointsDropped, int64(len(p.Points)))
+		return ErrBufferFull
+	}
+}
+
+// Close stops delivering writes.  Buffered writes are discarded.
+func (w *bufferedWriter) Close() error {
+	close(w.closing)
+	w.wg.Wait()
+	closeSubscription(w.w)
+	return nil
+}
+
+// run delivers buffered writes to the destination until the writer is closed.
+func (w *bufferedWriter) run() {
+	defer w.wg.Done()
+	for {
+		select {
+		case p := <-w.points:
+			if err := w.w.WritePoints(p); err != nil {
+				w.Logger.Println(err)
+			}
+		case <-w.closing:
+			return
+		}
+	}
+}
+
+// destination counts the writes delivered to a subscription destination.
+type destination struct {
+	w       PointsWriter
+	statMap *expvar.Map
+}
+
+func (d *destination) WritePoints(p *cluster.WritePointsRequest) error {
+	if err := d.w.WritePoints(p); err != nil {
+		d.statMap.Add(statWriteFailures, 1)
+		return err
+	}
+	d.statMap.Add(statPointsWritten, int64(len(p.Points)))
+	return nil
+}
+
+// Close closes the destination writer if it needs to be closed.
+func (d *destination) Close() error {
+	closeSubscription(d.w)
+	return nil
+}
@@ -1,12 +1,136 @@
 package subscriber
 
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/influxdata/influxdb/toml"
+)
+
+const (
+	// DefaultHTTPTimeout is the default time to wait for an HTTP destination
+	// to accept a write.
+	DefaultHTTPTimeout = 30 * time.Second
+
+	// DefaultWriteBufferSize is the default number of writes buffered for
+	// each destination while earlier writes are delivered.
+	DefaultWriteBufferSize = 1000
+
+	// DefaultQueueMaxSize is the default maximum size of each destination's
+	// queue on disk.
+	DefaultQueueMaxSize = 1024 * 1024 * 1024
+
+	// DefaultQueueMaxSegmentSize is the default maximum size of each queue
+	// segment file.
+	DefaultQueueMaxSegmentSize = 10 * 1024 * 1024
+
+	// DefaultRetryInterval is the default time to wait before retrying a
+	// queued write which failed.
+	DefaultRetryInterval = time.Second
+
+	// DefaultRetryMaxInterval is the default maximum time to wait between
+	// retries as the interval backs off.
+	DefaultRetryMaxInterval = time.Minute
+)
+
 // Config represents a configuration of the subscriber service.
 type Config struct {
 	// Whether to enable to Subscriber service
 	Enabled bool `toml:"enabled"`
+
+	// HTTPTimeout is the maximum time to wait for an HTTP or HTTPS
+	// destination to accept a write.
+	HTTPTimeout toml.Duration `toml:"http-timeout"`
+
+	// InsecureSkipVerify disables verification of HTTPS destination
+	// certificates.
+	InsecureSkipVerify bool `toml:"insecure-skip-verify"`
+
+	// CaCerts is the path to a PEM encoded file of CA certificates used to
+	// verify HTTPS destinations. The system roots are used when empty.
+	CaCerts string `toml:"ca-certs"`
+
+	// WriteBufferSize is the number of writes buffered for each destination
+	// while earlier writes are delivered. Writes are dropped when the buffer
+	// is full.
+	WriteBufferSize int `toml:"write-buffer-size"`
+
+	// QueueEnabled buffers writes for each destination in a queue on disk
+	// so they are retried when the destination is unavailable.
+	QueueEnabled bool `toml:"queue-enabled"`
+
+	// QueueDir is the directory the queues are stored in.
+	QueueDir string `toml:"queue-dir"`
+
+	// QueueMaxSize is the maximum size in bytes of each destination's queue.
+	// Writes are dropped when the queue is full.
+	QueueMaxSize int64 `toml:"queue-max-size"`
+
+	// QueueMaxSegmentSize is the maximum size in bytes of each queue segment.
+	QueueMaxSegmentSize int64 `toml:"queue-max-segment-size"`
+
+	// RetryInterval is the initial time to wait before retrying a failed
+	// write. It doubles on each failure up to RetryMaxInterval.
+	RetryInterval    toml.Duration `toml:"retry-interval"`
+	RetryMaxInterval toml.Duration `toml:"retry-max-interval"`
 }
 
 // NewConfig returns a new instance of a subscriber config.
 func NewConfig() Config {
-	return Config{Enabled: true}
+	return Config{
+		Enabled:             true,
+		HTTPTimeout:         toml.Duration(DefaultHTTPTimeout),
+		WriteBufferSize:     DefaultWriteBufferSize,
+		QueueMaxSize:        DefaultQueueMaxSize,
+		QueueMaxSegmentSize: DefaultQueueMaxSegmentSize,
+		RetryInterval:       toml.Duration(DefaultRetryInterval),
+		RetryMaxInterval:    toml.Duration(DefaultRetryMaxInterval),
+	}
+}
+
+// Validate returns an error if the config is invalid.
+func (c Config) Validate() error {
+	if c.HTTPTimeout <= 0 {
+		return errors.New("http-timeout must be greater than 0")
+	} else if c.WriteBufferSize <= 0 {
+		return errors.New("write-buffer-size must be greater than 0")
+	}
+
+	if c.CaCerts != "" {
+		if _, err := c.certPool(); err != nil {
+			return err
+		}
+	}
+
+	if c.QueueEnabled {
+		if c.QueueDir == "" {
+			return errors.New("queue-dir must be specified when the queue is enabled")
+		} else if c.QueueMaxSize <= 0 {
+			return errors.New("queue-max-size must be greater than 0")
+		} else if c.QueueMaxSegmentSize <= 0 {
+			return errors.New("queue-max-segment-size must be greater than 0")
+		} else if c.RetryInterval <= 0 {
+			return errors.New("retry-interval must be greater than 0")
+		} else if c.RetryMaxInterval < c.RetryInterval {
+			return errors.New("retry-max-interval must not be less than retry-interval")
+		}
+	}
+	return nil
+}
+
+// certPool returns the CA certificates in the CaCerts file.
+func (c Config) certPool() (*x509.CertPool, error) {
+	buf, err := ioutil.ReadFile(c.CaCerts)
+	if err != nil {
+		return nil, fmt.Errorf("ca-certs: %s", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(buf) {
+		return nil, fmt.Errorf("ca-certs: no certificates found in %s", c.CaCerts)
+	}
+	return pool, nil
 }
@@ -1,7 +1,10 @@
 package subscriber_test
 
 import (
+	"io/ioutil"
+	"os"
 	"testing"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	"github.com/influxdata/influxdb/services/subscriber"
@@ -12,6 +15,9 @@ func TestConfig_Parse(t *testing.T) {
 	var c subscriber.Config
 	if _, err := toml.Decode(`
 enabled = false
+http-timeout = "5s"
+insecure-skip-verify = true
+ca-certs = "/etc/ssl/certs/ca.pem"
 `, &c); err != nil {
 		t.Fatal(err)
 	}
@@ -19,5 +25,49 @@ enabled = false
 	// Validate configuration.
 	if c.Enabled != false {
 		t.Fatalf("unexpected enabled state: %v", c.Enabled)
+	} else if time.Duration(c.HTTPTimeout) != 5*time.Second {
+		t.Fatalf("unexpected http timeout: %v", c.HTTPTimeout)
+	} else if !c.InsecureSkipVerify {
+		t.Fatalf("unexpected insecure skip verify: %v", c.InsecureSkipVerify)
+	} else if c.CaCerts != "/etc/ssl/certs/ca.pem" {
+		t.Fatalf("unexpected ca certs: %s", c.CaCerts)
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	c := subscriber.NewConfig()
+	if err := c.Validate(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	c.HTTPTimeout = 0
+	if err := c.Validate(); err == nil {
+		t.Fatal("expected error for zero http timeout")
+	}
+
+	c = subscriber.NewConfig()
+	c.WriteBufferSize = 0
+	if err := c.Validate(); err == nil {
+		t.Fatal("expected error for zero write buffer size")
+	}
+
+	c = subscriber.NewConfig()
+	c.QueueEnabled = true
+	if err := c.Validate(); err == nil {
+		t.Fatal("expected error for missing queue dir")
+	}
+
+	f, err := ioutil.TempFile("", "subscriber-ca-certs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("not a certificate")
+	f.Close()
+
+	c = subscriber.NewConfig()
+	c.CaCerts = f.Name()
+	if err := c.Validate(); err == nil {
+		t.Fatal("expected error for invalid ca certs")
 	}
 }
@@ -0,0 +1,106 @@
+package subscriber
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/influxdata/influxdb/cluster"
+)
+
+// HTTP supports writing points over HTTP using the line protocol.
+type HTTP struct {
+	url      url.URL
+	username string
+	password string
+	client   *http.Client
+}
+
+// NewHTTP returns a new HTTP points writer which writes to the /write endpoint
+// under the path of u. Credentials in u are sent using basic authentication.
+func NewHTTP(u url.URL, timeout time.Duration, tlsConfig *tls.Config) (*HTTP, error) {
+	h := &HTTP{
+		client: &http.Client{
+			Timeout:   timeout,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		},
+	}
+	if u.User != nil {
+		h.username = u.User.Username()
+		h.password, _ = u.User.Password()
+	}
+
+	u.User = nil
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/write"
+	u.RawQuery = ""
+	h.url = u
+	return h, nil
+}
+
+// WritePoints writes points over HTTP transport.
+func (h *HTTP) WritePoints(p *cluster.WritePointsRequest) error {
+	var buf bytes.Buffer
+	for _, pt := range p.Points {
+		buf.WriteString(pt.String())
+		buf.WriteByte('\n')
+	}
+
+	u := h.url
+	params := url.Values{}
+	params.Set("db", p.Database)
+	params.Set("rp", p.RetentionPolicy)
+	u.RawQuery = params.Encode()
+
+	req, err := http.NewRequest("POST", u.String(), &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "InfluxDBSubscriber")
+	if h.username != "" {
+		req.SetBasicAuth(h.username, h.password)
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return &HTTPError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(body))}
+	}
+	return nil
+}
+
+// HTTPError is returned when a destination responds to a write with an error.
+type HTTPError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *HTTPError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return e.Message
+}
+
+// isRetryable returns true if a write which failed with err may succeed when
+// retried. Writes the destination rejects as invalid, such as writes with a
+// field type conflict, fail the same way every time.
+func isRetryable(err error) bool {
+	if e, ok := err.(*HTTPError); ok && e.StatusCode >= 400 && e.StatusCode < 500 {
+		return e.StatusCode == http.StatusRequestTimeout || e.StatusCode == http.StatusTooManyRequests
+	}
+	return true
+}
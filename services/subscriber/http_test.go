@@ -0,0 +1,105 @@
+package subscriber_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb/cluster"
+	"github.com/influxdata/influxdb/models"
+	"github.com/influxdata/influxdb/services/subscriber"
+)
+
+// Ensure points are posted as line protocol to the destination's write endpoint.
+func TestHTTP_WritePoints(t *testing.T) {
+	var called bool
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		if r.Method != "POST" || r.URL.Path != "/write" {
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+		} else if db, rp := r.FormValue("db"), r.FormValue("rp"); db != "db0" || rp != "rp0" {
+			t.Errorf("unexpected db/rp: %s/%s", db, rp)
+		} else if u, p, ok := r.BasicAuth(); !ok || u != "user" || p != "pass" {
+			t.Errorf("unexpected credentials: %s:%s", u, p)
+		}
+
+		body, _ := ioutil.ReadAll(r.Body)
+		if exp := "cpu value=1 1000000000\nmem value=2 2000000000\n"; string(body) != exp {
+			t.Errorf("unexpected body: %q", body)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	u, _ := url.Parse(ts.URL)
+	u.User = url.UserPassword("user", "pass")
+
+	h, err := subscriber.NewHTTP(*u, time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := h.WritePoints(&cluster.WritePointsRequest{
+		Database:        "db0",
+		RetentionPolicy: "rp0",
+		Points: []models.Point{
+			models.MustNewPoint("cpu", nil, models.Fields{"value": 1.0}, time.Unix(1, 0)),
+			models.MustNewPoint("mem", nil, models.Fields{"value": 2.0}, time.Unix(2, 0)),
+		},
+	}); err != nil {
+		t.Fatal(err)
+	} else if !called {
+		t.Fatal("destination not called")
+	}
+}
+
+// Ensure a failed write to the destination returns an error.
+func TestHTTP_WritePoints_Error(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "database not found", http.StatusNotFound)
+	}))
+	defer ts.Close()
+
+	u, _ := url.Parse(ts.URL)
+	h, err := subscriber.NewHTTP(*u, time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := h.WritePoints(&cluster.WritePointsRequest{
+		Database: "db0",
+		Points:   []models.Point{models.MustNewPoint("cpu", nil, models.Fields{"value": 1.0}, time.Unix(1, 0))},
+	}); err == nil {
+		t.Fatal("expected error")
+	} else if e, ok := err.(*subscriber.HTTPError); !ok || e.StatusCode != http.StatusNotFound || e.Message != "database not found" {
+		t.Fatalf("unexpected error: %#v", err)
+	}
+}
+
+// Ensure the path of the destination URL is kept as a prefix of the write
+// endpoint.
+func TestHTTP_WritePoints_PathPrefix(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/influxdb/write" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	u, _ := url.Parse(ts.URL + "/influxdb/")
+	h, err := subscriber.NewHTTP(*u, time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := h.WritePoints(&cluster.WritePointsRequest{
+		Database: "db0",
+		Points:   []models.Point{models.MustNewPoint("cpu", nil, models.Fields{"value": 1.0}, time.Unix(1, 0))},
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
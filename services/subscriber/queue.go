@@ -0,0 +1,468 @@
+package subscriber
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+/*
+A Queue is a FIFO of byte slices stored on disk in a directory of segment
+files.  Entries are appended to the last segment and read from the first.  A new
+segment is started when the last one reaches the maximum segment size, and a
+segment is removed once every entry in it has been read.
+
+Segment files are named by increasing integer IDs and only ever appended to.
+
+┌─────────┬─────────┬─────┬─────────┐
+│ Entry 1 │ Entry 2 │ ... │ Entry N │
+└─────────┴─────────┴─────┴─────────┘
+
+┌───────────────────┐
+│       Entry       │
+├─────────┬─────────┤
+│   Len   │  Data   │
+│ 8 bytes │ N bytes │
+└─────────┴─────────┘
+
+The read position is stored in a separate position file so it survives
+restarts.  It holds the ID of the first segment and the offset of the next
+entry to read within it.
+
+┌────────────┬─────────┐
+│ Segment ID │ Offset  │
+│  8 bytes   │ 8 bytes │
+└────────────┴─────────┘
+
+A partially written entry at the end of a segment, left by a crash, is
+truncated when the segment is opened.  A position past the end of the first
+segment, left by a crash while emptying it, is moved to the end.
+*/
+
+// PositionFileName is the name of the file holding a queue's read position.
+const PositionFileName = "position"
+
+var (
+	// ErrQueueFull is returned when appending to a queue would exceed its
+	// maximum size.
+	ErrQueueFull = errors.New("queue is full")
+
+	// ErrQueueClosed is returned when the queue is not open.
+	ErrQueueClosed = errors.New("queue is closed")
+
+	// errSegmentFull is returned when appending to a segment would exceed
+	// its maximum size.
+	errSegmentFull = errors.New("segment is full")
+)
+
+// Queue is a durable FIFO of byte slices.
+type Queue struct {
+	mu sync.RWMutex
+
+	dir            string
+	maxSize        int64
+	maxSegmentSize int64
+
+	// segments in the order they were created.  The first segment is read
+	// from and the last one is appended to.
+	segments []*segment
+	position *os.File
+}
+
+// NewQueue returns a queue stored in dir.  The total size of the segment files
+// is limited to maxSize bytes and each segment to maxSegmentSize bytes.
+func NewQueue(dir string, maxSize, maxSegmentSize int64) *Queue {
+	return &Queue{
+		dir:            dir,
+		maxSize:        maxSize,
+		maxSegmentSize: maxSegmentSize,
+	}
+}
+
+// Open opens the queue, loading any existing segments.
+func (q *Queue) Open() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if err := os.MkdirAll(q.dir, 0700); err != nil {
+		return err
+	}
+
+	if err := q.open(); err != nil {
+		q.close()
+		return err
+	}
+	return nil
+}
+
+func (q *Queue) open() error {
+	f, err := os.OpenFile(filepath.Join(q.dir, PositionFileName), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+	q.position = f
+
+	var headID, offset uint64
+	var buf [positionSize]byte
+	if n, err := f.ReadAt(buf[:], 0); err == nil {
+		headID = binary.BigEndian.Uint64(buf[0:8])
+		offset = binary.BigEndian.Uint64(buf[8:16])
+	} else if err != io.EOF || n != 0 {
+		return fmt.Errorf("read queue position: %s", err)
+	}
+
+	fis, err := ioutil.ReadDir(q.dir)
+	if err != nil {
+		return err
+	}
+
+	var ids []uint64
+	for _, fi := range fis {
+		id, err := strconv.ParseUint(fi.Name(), 10, 64)
+		if err != nil || fi.IsDir() {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Sort(uint64Slice(ids))
+
+	for _, id := range ids {
+		// Segments before the read position were fully read but not removed.
+		if id < headID {
+			if err := os.Remove(q.segmentPath(id)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var pos int64
+		if id == headID {
+			pos = int64(offset)
+		}
+
+		s, err := openSegment(q.segmentPath(id), id, pos)
+		if err != nil {
+			return err
+		}
+		q.segments = append(q.segments, s)
+	}
+
+	if len(q.segments) == 0 {
+		if err := q.addSegment(headID + 1); err != nil {
+			return err
+		}
+	}
+	return q.writePosition()
+}
+
+// Close closes the queue.  Unread entries remain on disk.
+func (q *Queue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.close()
+}
+
+func (q *Queue) close() error {
+	var err error
+	for _, s := range q.segments {
+		if e := s.close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	q.segments = nil
+
+	if q.position != nil {
+		if e := q.position.Close(); e != nil && err == nil {
+			err = e
+		}
+		q.position = nil
+	}
+	return err
+}
+
+// Append adds b to the end of the queue.
+func (q *Queue) Append(b []byte) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.segments) == 0 {
+		return ErrQueueClosed
+	}
+
+	if q.diskSize()+int64(entryHeaderSize+len(b)) > q.maxSize {
+		return ErrQueueFull
+	}
+
+	tail := q.segments[len(q.segments)-1]
+	if err := tail.append(b, q.maxSegmentSize); err == errSegmentFull {
+		if err := q.addSegment(tail.id + 1); err != nil {
+			return err
+		}
+		tail = q.segments[len(q.segments)-1]
+		return tail.append(b, 0)
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Current returns the entry at the front of the queue without removing it.
+// io.EOF is returned if the queue is empty.
+func (q *Queue) Current() ([]byte, error) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if len(q.segments) == 0 {
+		return nil, ErrQueueClosed
+	}
+	return q.segments[0].current()
+}
+
+// Advance removes the entry at the front of the queue.
+func (q *Queue) Advance() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.segments) == 0 {
+		return ErrQueueClosed
+	}
+
+	head := q.segments[0]
+	if err := head.advance(); err != nil {
+		return err
+	}
+
+	// Reclaim the space used by a fully read segment.
+	if head.n == 0 {
+		if len(q.segments) == 1 {
+			if err := head.reset(); err != nil {
+				return err
+			}
+		} else {
+			if err := head.close(); err != nil {
+				return err
+			}
+			q.segments = q.segments[1:]
+
+			// Move the position first so a crash cannot leave it pointing
+			// at a removed segment.
+			if err := q.writePosition(); err != nil {
+				return err
+			}
+			return os.Remove(head.path)
+		}
+	}
+	return q.writePosition()
+}
+
+// Len returns the number of unread entries in the queue.
+func (q *Queue) Len() int {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	var n int
+	for _, s := range q.segments {
+		n += s.n
+	}
+	return n
+}
+
+// Size returns the size of the segment files in bytes.
+func (q *Queue) Size() int64 {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	return q.diskSize()
+}
+
+func (q *Queue) diskSize() int64 {
+	var n int64
+	for _, s := range q.segments {
+		n += s.size
+	}
+	return n
+}
+
+// addSegment starts a new segment with the given ID after the last one.
+func (q *Queue) addSegment(id uint64) error {
+	s, err := openSegment(q.segmentPath(id), id, 0)
+	if err != nil {
+		return err
+	}
+	q.segments = append(q.segments, s)
+	return nil
+}
+
+// writePosition records the read position of the first segment.
+func (q *Queue) writePosition() error {
+	head := q.segments[0]
+
+	var buf [positionSize]byte
+	binary.BigEndian.PutUint64(buf[0:8], head.id)
+	binary.BigEndian.PutUint64(buf[8:16], uint64(head.pos))
+	if _, err := q.position.WriteAt(buf[:], 0); err != nil {
+		return err
+	}
+	return q.position.Sync()
+}
+
+func (q *Queue) segmentPath(id uint64) string {
+	return filepath.Join(q.dir, strconv.FormatUint(id, 10))
+}
+
+const (
+	entryHeaderSize = 8
+	positionSize    = 16
+)
+
+// segment is a single file of queue entries.
+type segment struct {
+	id   uint64
+	path string
+	file *os.File
+
+	size int64 // size of the file
+	pos  int64 // offset of the next entry to read
+	n    int   // number of unread entries
+}
+
+// openSegment opens or creates the segment at path with the next entry to read
+// at pos.
+func openSegment(path string, id uint64, pos int64) (*segment, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &segment{id: id, path: path, file: f, pos: pos}
+	if err := s.load(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("open segment %s: %s", path, err)
+	}
+	return s, nil
+}
+
+// load counts the unread entries, truncating a partially written entry.
+func (s *segment) load() error {
+	fi, err := s.file.Stat()
+	if err != nil {
+		return err
+	}
+	s.size = fi.Size()
+
+	// A crash after a fully read segment was truncated but before the new
+	// position was written leaves the position past the end of the file.
+	// Every entry before it was read, so continue from the end.
+	if s.pos > s.size {
+		s.pos = s.size
+	}
+
+	var hdr [entryHeaderSize]byte
+	for off := s.pos; off < s.size; {
+		if s.size-off < entryHeaderSize {
+			return s.truncate(off)
+		}
+		if _, err := s.file.ReadAt(hdr[:], off); err != nil {
+			return err
+		}
+
+		next := off + entryHeaderSize + int64(binary.BigEndian.Uint64(hdr[:]))
+		if next > s.size || next < off {
+			return s.truncate(off)
+		}
+		off = next
+		s.n++
+	}
+	return nil
+}
+
+// append writes b to the end of the segment.  errSegmentFull is returned if the
+// segment already has entries and would grow beyond maxSize.
+func (s *segment) append(b []byte, maxSize int64) error {
+	sz := int64(entryHeaderSize + len(b))
+	if maxSize > 0 && s.size > 0 && s.size+sz > maxSize {
+		return errSegmentFull
+	}
+
+	buf := make([]byte, sz)
+	binary.BigEndian.PutUint64(buf[0:entryHeaderSize], uint64(len(b)))
+	copy(buf[entryHeaderSize:], b)
+
+	if _, err := s.file.WriteAt(buf, s.size); err != nil {
+		return err
+	}
+	if err := s.file.Sync(); err != nil {
+		return err
+	}
+
+	s.size += sz
+	s.n++
+	return nil
+}
+
+// current returns the next unread entry.
+func (s *segment) current() ([]byte, error) {
+	if s.n == 0 {
+		return nil, io.EOF
+	}
+
+	var hdr [entryHeaderSize]byte
+	if _, err := s.file.ReadAt(hdr[:], s.pos); err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, binary.BigEndian.Uint64(hdr[:]))
+	if _, err := s.file.ReadAt(b, s.pos+entryHeaderSize); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// advance moves the read position past the next unread entry.
+func (s *segment) advance() error {
+	if s.n == 0 {
+		return io.EOF
+	}
+
+	var hdr [entryHeaderSize]byte
+	if _, err := s.file.ReadAt(hdr[:], s.pos); err != nil {
+		return err
+	}
+	s.pos += entryHeaderSize + int64(binary.BigEndian.Uint64(hdr[:]))
+	s.n--
+	return nil
+}
+
+// reset discards all entries in the segment.
+func (s *segment) reset() error {
+	s.n = 0
+	return s.truncate(0)
+}
+
+// truncate discards the segment from off onwards.
+func (s *segment) truncate(off int64) error {
+	if err := s.file.Truncate(off); err != nil {
+		return err
+	}
+	s.size = off
+	if s.pos > off {
+		s.pos = off
+	}
+	return nil
+}
+
+func (s *segment) close() error {
+	return s.file.Close()
+}
+
+type uint64Slice []uint64
+
+func (a uint64Slice) Len() int           { return len(a) }
+func (a uint64Slice) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a uint64Slice) Less(i, j int) bool { return a[i] < a[j] }
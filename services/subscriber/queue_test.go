@@ -0,0 +1,188 @@
+package subscriber_test
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/influxdata/influxdb/services/subscriber"
+)
+
+// Ensure entries are read back in order across segments and after reopening.
+func TestQueue_AppendAdvance(t *testing.T) {
+	q := MustOpenQueue(1024, 64)
+	defer q.Close()
+
+	for i := 0; i < 10; i++ {
+		if err := q.Append([]byte(fmt.Sprintf("entry-%02d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := q.Len(); n != 10 {
+		t.Fatalf("unexpected length: %d", n)
+	}
+
+	// Read half the entries then reopen the queue.
+	for i := 0; i < 5; i++ {
+		q.MustRead(t, fmt.Sprintf("entry-%02d", i))
+	}
+	q.Reopen(t)
+
+	if n := q.Len(); n != 5 {
+		t.Fatalf("unexpected length after reopen: %d", n)
+	}
+	for i := 5; i < 10; i++ {
+		q.MustRead(t, fmt.Sprintf("entry-%02d", i))
+	}
+
+	if _, err := q.Current(); err != io.EOF {
+		t.Fatalf("expected EOF, got %v", err)
+	}
+
+	// Read segments are removed and the last one is emptied.
+	if fis, err := ioutil.ReadDir(q.Dir); err != nil {
+		t.Fatal(err)
+	} else if len(fis) != 2 {
+		t.Fatalf("unexpected file count: %d", len(fis))
+	} else if sz := q.Size(); sz != 0 {
+		t.Fatalf("unexpected size: %d", sz)
+	}
+}
+
+// Ensure appending beyond the maximum size is rejected.
+func TestQueue_Full(t *testing.T) {
+	q := MustOpenQueue(64, 1024)
+	defer q.Close()
+
+	if err := q.Append(make([]byte, 32)); err != nil {
+		t.Fatal(err)
+	} else if err := q.Append(make([]byte, 32)); err != subscriber.ErrQueueFull {
+		t.Fatalf("expected queue full, got %v", err)
+	}
+
+	// Space is available again once the entry has been read.
+	if err := q.Advance(); err != nil {
+		t.Fatal(err)
+	} else if err := q.Append(make([]byte, 32)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Ensure a partially written entry is discarded when the queue is opened.
+func TestQueue_PartialEntry(t *testing.T) {
+	q := MustOpenQueue(1024, 1024)
+	defer q.Close()
+
+	if err := q.Append([]byte("complete")); err != nil {
+		t.Fatal(err)
+	}
+	q.Queue.Close()
+
+	// Simulate a crash while appending by writing a header with no data.
+	path := filepath.Join(q.Dir, "1")
+	f, err := os.OpenFile(path, os.O_RDWR, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, _ := f.Stat()
+	f.WriteAt([]byte{0, 0, 0, 0, 0, 0, 0, 100, 'x'}, fi.Size())
+	f.Close()
+
+	q.Reopen(t)
+	if n := q.Len(); n != 1 {
+		t.Fatalf("unexpected length: %d", n)
+	}
+	q.MustRead(t, "complete")
+}
+
+// Ensure the queue opens if a crash left the position past the end of a
+// truncated head segment.
+func TestQueue_TruncatedHead(t *testing.T) {
+	q := MustOpenQueue(1024, 1024)
+	defer q.Close()
+
+	if err := q.Append([]byte("entry-00")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Save the position after the entry has been read but before the
+	// emptied segment was truncated.
+	b, err := q.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pos, err := ioutil.ReadFile(filepath.Join(q.Dir, subscriber.PositionFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary.BigEndian.PutUint64(pos[8:16], uint64(8+len(b)))
+	q.MustRead(t, "entry-00")
+	q.Queue.Close()
+
+	// Simulate a crash before the new position was written.
+	if err := ioutil.WriteFile(filepath.Join(q.Dir, subscriber.PositionFileName), pos, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	q.Reopen(t)
+	if n := q.Len(); n != 0 {
+		t.Fatalf("unexpected length: %d", n)
+	}
+	if err := q.Append([]byte("entry-01")); err != nil {
+		t.Fatal(err)
+	}
+	q.MustRead(t, "entry-01")
+}
+
+// Queue is a test wrapper for subscriber.Queue.
+type Queue struct {
+	*subscriber.Queue
+	Dir                     string
+	maxSize, maxSegmentSize int64
+}
+
+// MustOpenQueue returns an open queue in a temporary directory.
+func MustOpenQueue(maxSize, maxSegmentSize int64) *Queue {
+	dir, err := ioutil.TempDir("", "subscriber-queue-")
+	if err != nil {
+		panic(err)
+	}
+
+	q := &Queue{Dir: dir, maxSize: maxSize, maxSegmentSize: maxSegmentSize}
+	q.Queue = subscriber.NewQueue(dir, maxSize, maxSegmentSize)
+	if err := q.Open(); err != nil {
+		panic(err)
+	}
+	return q
+}
+
+// Close closes the queue and removes its directory.
+func (q *Queue) Close() error {
+	defer os.RemoveAll(q.Dir)
+	return q.Queue.Close()
+}
+
+// Reopen closes and reopens the queue.
+func (q *Queue) Reopen(t *testing.T) {
+	q.Queue.Close()
+	q.Queue = subscriber.NewQueue(q.Dir, q.maxSize, q.maxSegmentSize)
+	if err := q.Open(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// MustRead reads and removes the front entry, which must equal exp.
+func (q *Queue) MustRead(t *testing.T, exp string) {
+	b, err := q.Current()
+	if err != nil {
+		t.Fatal(err)
+	} else if string(b) != exp {
+		t.Fatalf("unexpected entry: got %q, exp %q", b, exp)
+	} else if err := q.Advance(); err != nil {
+		t.Fatal(err)
+	}
+}
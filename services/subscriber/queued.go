@@ -0,0 +1,192 @@
+package subscriber
+
+import (
+	"encoding/binary"
+	"errors"
+	"expvar"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/influxdata/influxdb/cluster"
+	"github.com/influxdata/influxdb/models"
+)
+
+// queuedWriter buffers writes to a destination in an on-disk queue and
+// delivers them in the background, retrying failed writes with exponential
+// backoff.  Writes the destination rejects are dropped.
+type queuedWriter struct {
+	w       PointsWriter
+	q       *Queue
+	statMap *expvar.Map
+	Logger  *log.Logger
+
+	retryInterval    time.Duration
+	retryMaxInterval time.Duration
+
+	notify  chan struct{}
+	closing chan struct{}
+	wg      sync.WaitGroup
+}
+
+// newQueuedWriter returns a writer which queues writes to w in q and starts
+// delivering them.  q must be open.
+func newQueuedWriter(w PointsWriter, q *Queue, c Config, statMap *expvar.Map, logger *log.Logger) *queuedWriter {
+	qw := &queuedWriter{
+		w:                w,
+		q:                q,
+		statMap:          statMap,
+		Logger:           logger,
+		retryInterval:    time.Duration(c.RetryInterval),
+		retryMaxInterval: time.Duration(c.RetryMaxInterval),
+		notify:           make(chan struct{}, 1),
+		closing:          make(chan struct{}),
+	}
+	qw.updateQueueStats()
+
+	qw.wg.Add(1)
+	go qw.run()
+	return qw
+}
+
+// WritePoints appends the points to the queue.  The points are dropped if the
+// queue is full.
+func (w *queuedWriter) WritePoints(p *cluster.WritePointsRequest) error {
+	if err := w.q.Append(marshalWritePointsRequest(p)); err != nil {
+		w.statMap.Add(statPointsDropped, int64(len(p.Points)))
+		return err
+	}
+	w.updateQueueStats()
+
+	// Wake up the delivery goroutine if it is waiting for writes.
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Close stops delivering writes and closes the destination writer.
+// Undelivered writes remain in the queue.
+func (w *queuedWriter) Close() error {
+	close(w.closing)
+	w.wg.Wait()
+	closeSubscription(w.w)
+	return w.q.Close()
+}
+
+// run delivers queued writes to the destination until the writer is closed.
+func (w *queuedWriter) run() {
+	defer w.wg.Done()
+
+	interval := w.retryInterval
+	for {
+		b, err := w.q.Current()
+		if err == io.EOF {
+			select {
+			case <-w.notify:
+				continue
+			case <-w.closing:
+				return
+			}
+		} else if err != nil {
+			w.Logger.Printf("failed to read subscription queue: %s", err)
+			if !w.wait(interval) {
+				return
+			}
+			continue
+		}
+
+		p, err := unmarshalWritePointsRequest(b)
+		if err != nil {
+			// A corrupt entry can never be delivered so skip it.
+			w.Logger.Printf("dropping corrupt subscription queue entry: %s", err)
+		} else if err := w.w.WritePoints(p); err != nil && !isRetryable(err) {
+			// Retrying a rejected write would block the queue forever.
+			w.Logger.Printf("dropping write rejected by subscription destination: %s", err)
+			w.statMap.Add(statPointsRejected, int64(len(p.Points)))
+		} else if err != nil {
+			w.statMap.Add(statWriteRetries, 1)
+			if !w.wait(interval) {
+				return
+			}
+
+			// Back off exponentially while the destination is failing.
+			interval *= 2
+			if interval > w.retryMaxInterval {
+				interval = w.retryMaxInterval
+			}
+			continue
+		}
+		interval = w.retryInterval
+
+		if err := w.q.Advance(); err != nil {
+			w.Logger.Printf("failed to advance subscription queue: %s", err)
+		}
+		w.updateQueueStats()
+	}
+}
+
+// wait waits for d or until the writer is closed.  Returns false if closed.
+func (w *queuedWriter) wait(d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return true
+	case <-w.closing:
+		return false
+	}
+}
+
+func (w *queuedWriter) updateQueueStats() {
+	depth, size := new(expvar.Int), new(expvar.Int)
+	depth.Set(int64(w.q.Len()))
+	size.Set(w.q.Size())
+	w.statMap.Set(statQueueDepth, depth)
+	w.statMap.Set(statQueueBytes, size)
+}
+
+// marshalWritePointsRequest encodes a request as the length prefixed database
+// and retention policy followed by the points in line protocol.
+func marshalWritePointsRequest(p *cluster.WritePointsRequest) []byte {
+	var buf []byte
+	var tmp [binary.MaxVarintLen64]byte
+	for _, s := range []string{p.Database, p.RetentionPolicy} {
+		buf = append(buf, tmp[:binary.PutUvarint(tmp[:], uint64(len(s)))]...)
+		buf = append(buf, s...)
+	}
+
+	for _, pt := range p.Points {
+		buf = append(buf, pt.String()...)
+		buf = append(buf, '\n')
+	}
+	return buf
+}
+
+// unmarshalWritePointsRequest decodes a request encoded by
+// marshalWritePointsRequest.
+func unmarshalWritePointsRequest(b []byte) (*cluster.WritePointsRequest, error) {
+	var strs [2]string
+	for i := range strs {
+		n, sz := binary.Uvarint(b)
+		if sz <= 0 || uint64(len(b)-sz) < n {
+			return nil, errors.New("invalid write request")
+		}
+		strs[i] = string(b[sz : sz+int(n)])
+		b = b[sz+int(n):]
+	}
+
+	points, err := models.ParsePointsWithPrecision(b, time.Now().UTC(), "n")
+	if err != nil {
+		return nil, err
+	}
+
+	return &cluster.WritePointsRequest{
+		Database:        strs[0],
+		RetentionPolicy: strs[1],
+		Points:          points,
+	}, nil
+}
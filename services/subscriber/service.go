@@ -1,25 +1,40 @@
 package subscriber // import "github.com/influxdata/influxdb/services/subscriber"
 
 import (
+	"crypto/tls"
 	"expvar"
 	"fmt"
+	"io"
 	"log"
 	"net/url"
 	"os"
+	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/influxdata/influxdb"
 	"github.com/influxdata/influxdb/cluster"
+	"github.com/influxdata/influxdb/influxql"
+	"github.com/influxdata/influxdb/models"
 	"github.com/influxdata/influxdb/services/meta"
 )
 
 // Statistics for the Subscriber service.
 const (
-	statPointsWritten = "pointsWritten"
-	statWriteFailures = "writeFailures"
+	statPointsWritten  = "pointsWritten"
+	statWriteFailures  = "writeFailures"
+	statPointsDropped  = "pointsDropped"  // Number of points dropped because the buffer or queue was full
+	statPointsRejected = "pointsRejected" // Number of queued points dropped because the destination rejected them
+	statWriteRetries   = "writeRetries"   // Number of failed deliveries of queued writes
+	statQueueDepth     = "queueDepth"     // Number of writes waiting in the queue
+	statQueueBytes     = "queueBytes"     // Size of the queue on disk in bytes
 )
 
+func init() {
+	influxdb.RegisterGauges("subscriber", statQueueDepth, statQueueBytes)
+}
+
 // PointsWriter is an interface for writing points to a subscription destination.
 // Only WritePoints() needs to be satisfied.
 type PointsWriter interface {
@@ -37,7 +52,8 @@ type subEntry struct {
 // to defined third party destinations.
 // Subscriptions are defined per database and retention policy.
 type Service struct {
-	subs       map[subEntry]PointsWriter
+	subs       map[subEntry]*subscription
+	subMu      sync.RWMutex
 	MetaClient interface {
 		Databases() ([]meta.DatabaseInfo, error)
 		WaitForDataChanged() chan struct{}
@@ -50,19 +66,22 @@ type Service struct {
 	closed          bool
 	closing         chan struct{}
 	mu              sync.Mutex
+	conf            Config
 }
 
 // NewService returns a subscriber service with given settings
 func NewService(c Config) *Service {
-	return &Service{
-		subs:            make(map[subEntry]PointsWriter),
-		NewPointsWriter: newPointsWriter,
-		Logger:          log.New(os.Stderr, "[subscriber] ", log.LstdFlags),
-		statMap:         influxdb.NewStatistics("subscriber", "subscriber", nil),
-		points:          make(chan *cluster.WritePointsRequest),
-		closed:          true,
-		closing:         make(chan struct{}),
+	s := &Service{
+		subs:    make(map[subEntry]*subscription),
+		Logger:  log.New(os.Stderr, "[subscriber] ", log.LstdFlags),
+		statMap: influxdb.NewStatistics("subscriber", "subscriber", nil),
+		points:  make(chan *cluster.WritePointsRequest),
+		closed:  true,
+		closing: make(chan struct{}),
+		conf:    c,
 	}
+	s.NewPointsWriter = s.newPointsWriter
+	return s
 }
 
 // Open starts the subscription service.
@@ -104,6 +123,14 @@ func (s *Service) Close() error {
 	}
 
 	s.wg.Wait()
+
+	s.subMu.Lock()
+	for se, sub := range s.subs {
+		closeSubscription(sub.PointsWriter)
+		delete(s.subs, se)
+	}
+	s.subMu.Unlock()
+
 	s.Logger.Println("closed service")
 	return nil
 }
@@ -140,6 +167,10 @@ func (s *Service) Update() error {
 	if err != nil {
 		return err
 	}
+
+	s.subMu.Lock()
+	defer s.subMu.Unlock()
+
 	allEntries := make(map[subEntry]bool, 0)
 	// Add in new subscriptions
 	for _, dbi := range dbis {
@@ -154,19 +185,31 @@ func (s *Service) Update() error {
 				if _, ok := s.subs[se]; ok {
 					continue
 				}
-				sub, err := s.createSubscription(se, si.Mode, si.Destinations)
+				cond, err := parseCondition(si.Condition)
+				if err != nil {
+					return err
+				}
+				w, err := s.createSubscription(se, si.Mode, si.Destinations)
 				if err != nil {
 					return err
 				}
-				s.subs[se] = sub
+				s.subs[se] = &subscription{PointsWriter: w, cond: cond}
 			}
 		}
 	}
 
 	// Remove deleted subs
-	for se := range s.subs {
+	for se, sub := range s.subs {
 		if !allEntries[se] {
+			closeSubscription(sub.PointsWriter)
 			delete(s.subs, se)
+
+			// Undelivered writes for a deleted subscription are discarded.
+			if s.conf.QueueEnabled {
+				if err := os.RemoveAll(s.queuePath(se)); err != nil {
+					s.Logger.Printf("failed to remove queue for subscription %s: %s", se.name, err)
+				}
+			}
 			s.Logger.Println("deleted old subscription for", se.db, se.rp)
 		}
 	}
@@ -185,17 +228,19 @@ func (s *Service) createSubscription(se subEntry, mode string, destinations []st
 		return nil, fmt.Errorf("unknown balance mode %q", mode)
 	}
 	writers := make([]PointsWriter, len(destinations))
-	statMaps := make([]*expvar.Map, len(writers))
 	for i, dest := range destinations {
 		u, err := url.Parse(dest)
 		if err != nil {
+			closeWriters(writers)
 			return nil, err
 		}
 		w, err := s.NewPointsWriter(*u)
 		if err != nil {
+			closeWriters(writers)
 			return nil, err
 		}
-		writers[i] = w
+		// Never expose destination passwords in statistics.
+		dest = redactURL(*u)
 		tags := map[string]string{
 			"database":         se.db,
 			"retention_policy": se.rp,
@@ -204,14 +249,75 @@ func (s *Service) createSubscription(se subEntry, mode string, destinations []st
 			"destination":      dest,
 		}
 		key := strings.Join([]string{"subscriber", se.db, se.rp, se.name, dest}, ":")
-		statMaps[i] = influxdb.NewStatistics(key, "subscriber", tags)
+		statMap := influxdb.NewStatistics(key, "subscriber", tags)
+		w = &destination{w: w, statMap: statMap}
+
+		// Each destination is written to independently in ALL mode.
+		if bm == ALL {
+			w, err = s.newDeliveryWriter(w, filepath.Join(s.queuePath(se), url.QueryEscape(dest)), statMap)
+			if err != nil {
+				closeWriters(writers)
+				return nil, err
+			}
+		}
+		writers[i] = w
+	}
+
+	var w PointsWriter = &balancewriter{bm: bm, writers: writers}
+	if bm == ANY {
+		// Writes fail over between destinations so they are delivered
+		// through the balancewriter from a single buffer or queue.
+		tags := map[string]string{
+			"database":         se.db,
+			"retention_policy": se.rp,
+			"name":             se.name,
+			"mode":             mode,
+		}
+		key := strings.Join([]string{"subscriber", se.db, se.rp, se.name}, ":")
+		statMap := influxdb.NewStatistics(key, "subscriber", tags)
+
+		var err error
+		w, err = s.newDeliveryWriter(w, filepath.Join(s.queuePath(se), "any"), statMap)
+		if err != nil {
+			closeWriters(writers)
+			return nil, err
+		}
 	}
 	s.Logger.Println("created new subscription for", se.db, se.rp)
-	return &balancewriter{
-		bm:       bm,
-		writers:  writers,
-		statMaps: statMaps,
-	}, nil
+	return w, nil
+}
+
+// newDeliveryWriter returns a writer which delivers writes to w in the
+// background, through a queue at path if the queue is enabled.
+func (s *Service) newDeliveryWriter(w PointsWriter, path string, statMap *expvar.Map) (PointsWriter, error) {
+	if !s.conf.QueueEnabled {
+		return newBufferedWriter(w, s.conf.WriteBufferSize, statMap, s.Logger), nil
+	}
+
+	q := NewQueue(path, s.conf.QueueMaxSize, s.conf.QueueMaxSegmentSize)
+	if err := q.Open(); err != nil {
+		return nil, err
+	}
+	return newQueuedWriter(w, q, s.conf, statMap, s.Logger), nil
+}
+
+// queuePath returns the directory holding the queues of a subscription.
+func (s *Service) queuePath(se subEntry) string {
+	return filepath.Join(s.conf.QueueDir, se.db, se.rp, se.name)
+}
+
+// closeSubscription stops a subscription's writers if they need to be closed.
+func closeSubscription(sub PointsWriter) {
+	if c, ok := sub.(io.Closer); ok {
+		c.Close()
+	}
+}
+
+// closeWriters closes each writer which needs to be closed.
+func closeWriters(writers []PointsWriter) {
+	for _, w := range writers {
+		closeSubscription(w)
+	}
 }
 
 // Points returns a channel into which write point requests can be sent.
@@ -223,19 +329,95 @@ func (s *Service) Points() chan<- *cluster.WritePointsRequest {
 func (s *Service) writePoints() {
 	defer s.wg.Done()
 	for p := range s.points {
+		s.subMu.RLock()
 		for se, sub := range s.subs {
 			if p.Database == se.db && p.RetentionPolicy == se.rp {
-				err := sub.WritePoints(p)
+				// Skip writes with no points matching the subscription's condition.
+				wp := sub.filter(p)
+				if len(wp.Points) == 0 && len(p.Points) > 0 {
+					continue
+				}
+
+				err := sub.WritePoints(wp)
 				if err != nil {
 					s.Logger.Println(err)
 					s.statMap.Add(statWriteFailures, 1)
 				}
 			}
 		}
+		s.subMu.RUnlock()
 		s.statMap.Add(statPointsWritten, int64(len(p.Points)))
 	}
 }
 
+// subscription is a running subscription.
+type subscription struct {
+	PointsWriter
+
+	// Only points matching cond are forwarded, if set.
+	cond influxql.Expr
+}
+
+// parseCondition parses a subscription condition, which may be blank.
+func parseCondition(s string) (influxql.Expr, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	cond, err := influxql.ParseExpr(s)
+	if err != nil {
+		return nil, err
+	} else if err := influxql.ValidateSubscriptionCondition(cond); err != nil {
+		return nil, err
+	}
+	return cond, nil
+}
+
+// filter returns a request containing only the points matching the
+// subscription's condition.  p is returned if every point matches.
+func (s *subscription) filter(p *cluster.WritePointsRequest) *cluster.WritePointsRequest {
+	if s.cond == nil {
+		return p
+	}
+
+	var points []models.Point
+	for i, pt := range p.Points {
+		if s.match(pt) {
+			if points != nil {
+				points = append(points, pt)
+			}
+			continue
+		}
+
+		// Copy the matching points once the first point is filtered out.
+		if points == nil {
+			points = make([]models.Point, i, len(p.Points))
+			copy(points, p.Points[:i])
+		}
+	}
+
+	if points == nil {
+		return p
+	}
+	return &cluster.WritePointsRequest{
+		Database:        p.Database,
+		RetentionPolicy: p.RetentionPolicy,
+		Points:          points,
+	}
+}
+
+// match returns true if the point's measurement and tags match the condition.
+// Tags the point does not have are treated as blank.
+func (s *subscription) match(pt models.Point) bool {
+	tags := pt.Tags()
+	m := make(map[string]interface{}, len(tags)+1)
+	for _, name := range influxql.ExprNames(s.cond) {
+		m[name] = tags[name]
+	}
+	m[influxql.SubscriptionMeasurementKey] = pt.Name()
+	return influxql.EvalBool(s.cond, m)
+}
+
 // BalanceMode sets what balance mode to use on a subscription.
 // valid options are currently ALL or ANY
 type BalanceMode int
@@ -248,41 +430,66 @@ const (
 
 // balances writes across PointsWriters according to BalanceMode
 type balancewriter struct {
-	bm       BalanceMode
-	writers  []PointsWriter
-	statMaps []*expvar.Map
-	i        int
+	bm      BalanceMode
+	writers []PointsWriter
+	i       int
 }
 
 func (b *balancewriter) WritePoints(p *cluster.WritePointsRequest) error {
 	var lastErr error
 	for range b.writers {
 		// round robin through destinations.
-		i := b.i
-		w := b.writers[i]
+		w := b.writers[b.i]
 		b.i = (b.i + 1) % len(b.writers)
 
 		// write points to destination.
 		err := w.WritePoints(p)
 		if err != nil {
-			lastErr = err
-			b.statMaps[i].Add(statWriteFailures, 1)
-		} else {
-			b.statMaps[i].Add(statPointsWritten, int64(len(p.Points)))
-			if b.bm == ANY {
-				break
+			// Prefer reporting errors which may succeed on retry.
+			if lastErr == nil || !isRetryable(lastErr) {
+				lastErr = err
 			}
+		} else if b.bm == ANY {
+			return nil
 		}
 	}
 	return lastErr
 }
 
+// Close closes any of the destination writers which need to be closed.
+func (b *balancewriter) Close() error {
+	closeWriters(b.writers)
+	return nil
+}
+
 // Creates a PointsWriter from the given URL
-func newPointsWriter(u url.URL) (PointsWriter, error) {
+func (s *Service) newPointsWriter(u url.URL) (PointsWriter, error) {
 	switch u.Scheme {
 	case "udp":
 		return NewUDP(u.Host), nil
+	case "http":
+		return NewHTTP(u, time.Duration(s.conf.HTTPTimeout), nil)
+	case "https":
+		tlsConfig := &tls.Config{InsecureSkipVerify: s.conf.InsecureSkipVerify}
+		if s.conf.CaCerts != "" {
+			pool, err := s.conf.certPool()
+			if err != nil {
+				return nil, err
+			}
+			tlsConfig.RootCAs = pool
+		}
+		return NewHTTP(u, time.Duration(s.conf.HTTPTimeout), tlsConfig)
 	default:
 		return nil, fmt.Errorf("unknown destination scheme %s", u.Scheme)
 	}
 }
+
+// redactURL returns the URL as a string with any password replaced.
+func redactURL(u url.URL) string {
+	if u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), "xxxxx")
+		}
+	}
+	return u.String()
+}
@@ -1,13 +1,19 @@
 package subscriber_test
 
 import (
+	"errors"
+	"io/ioutil"
 	"net/url"
+	"os"
+	"reflect"
 	"testing"
 	"time"
 
 	"github.com/influxdata/influxdb/cluster"
+	"github.com/influxdata/influxdb/models"
 	"github.com/influxdata/influxdb/services/meta"
 	"github.com/influxdata/influxdb/services/subscriber"
+	"github.com/influxdata/influxdb/toml"
 )
 
 type MetaClient struct {
@@ -31,6 +37,16 @@ func (s Subscription) WritePoints(p *cluster.WritePointsRequest) error {
 	return s.WritePointsFn(p)
 }
 
+// ClosingSubscription is a Subscription which must be closed.
+type ClosingSubscription struct {
+	Subscription
+	CloseFn func() error
+}
+
+func (s ClosingSubscription) Close() error {
+	return s.CloseFn()
+}
+
 func TestService_IgnoreNonMatch(t *testing.T) {
 	dataChanged := make(chan struct{})
 	ms := MetaClient{}
@@ -441,3 +457,406 @@ func TestService_WaitForDataChanged(t *testing.T) {
 
 	close(dataChanged)
 }
+
+// Ensure queued writes are retried until the destination accepts them.
+// Ensure a destination which is slow to accept writes does not hold up
+// writes to other destinations.
+func TestService_SlowDestination(t *testing.T) {
+	ms := MetaClient{}
+	ms.WaitForDataChangedFn = func() chan struct{} {
+		return make(chan struct{})
+	}
+	ms.DatabasesFn = func() ([]meta.DatabaseInfo, error) {
+		return []meta.DatabaseInfo{
+			{
+				Name: "db0",
+				RetentionPolicies: []meta.RetentionPolicyInfo{
+					{
+						Name: "rp0",
+						Subscriptions: []meta.SubscriptionInfo{
+							{Name: "s0", Mode: "ALL", Destinations: []string{"udp://slow:9093"}},
+							{Name: "s1", Mode: "ALL", Destinations: []string{"udp://fast:9093"}},
+						},
+					},
+				},
+			},
+		}, nil
+	}
+
+	unblock := make(chan struct{})
+	prs := make(chan *cluster.WritePointsRequest, 2)
+	newPointsWriter := func(u url.URL) (subscriber.PointsWriter, error) {
+		sub := Subscription{}
+		sub.WritePointsFn = func(p *cluster.WritePointsRequest) error {
+			if u.Host == "slow:9093" {
+				<-unblock
+				return nil
+			}
+			prs <- p
+			return nil
+		}
+		return sub, nil
+	}
+
+	s := subscriber.NewService(subscriber.NewConfig())
+	s.MetaClient = ms
+	s.NewPointsWriter = newPointsWriter
+	s.Open()
+	defer s.Close()
+	defer close(unblock)
+
+	for i := 0; i < 2; i++ {
+		s.Points() <- &cluster.WritePointsRequest{Database: "db0", RetentionPolicy: "rp0"}
+		select {
+		case <-prs:
+		case <-time.After(100 * time.Millisecond):
+			t.Fatal("expected points request")
+		}
+	}
+}
+
+func TestService_Queue_Retry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "subscriber-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ms := MetaClient{}
+	ms.WaitForDataChangedFn = func() chan struct{} {
+		return make(chan struct{})
+	}
+	ms.DatabasesFn = func() ([]meta.DatabaseInfo, error) {
+		return []meta.DatabaseInfo{
+			{
+				Name: "db0",
+				RetentionPolicies: []meta.RetentionPolicyInfo{
+					{
+						Name: "rp0",
+						Subscriptions: []meta.SubscriptionInfo{
+							{Name: "s0", Mode: "ALL", Destinations: []string{"udp://h0:9093"}},
+						},
+					},
+				},
+			},
+		}, nil
+	}
+
+	var attempts int
+	prs := make(chan *cluster.WritePointsRequest, 1)
+	newPointsWriter := func(u url.URL) (subscriber.PointsWriter, error) {
+		sub := Subscription{}
+		sub.WritePointsFn = func(p *cluster.WritePointsRequest) error {
+			// Fail the first two attempts.
+			if attempts++; attempts <= 2 {
+				return errors.New("destination unavailable")
+			}
+			prs <- p
+			return nil
+		}
+		return sub, nil
+	}
+
+	c := subscriber.NewConfig()
+	c.QueueEnabled = true
+	c.QueueDir = dir
+	c.RetryInterval = toml.Duration(time.Millisecond)
+	c.RetryMaxInterval = toml.Duration(2 * time.Millisecond)
+
+	s := subscriber.NewService(c)
+	s.MetaClient = ms
+	s.NewPointsWriter = newPointsWriter
+	s.Open()
+	defer s.Close()
+
+	s.Points() <- &cluster.WritePointsRequest{
+		Database:        "db0",
+		RetentionPolicy: "rp0",
+		Points:          []models.Point{models.MustNewPoint("cpu", models.Tags{"host": "a"}, models.Fields{"value": 1.0}, time.Unix(1, 0))},
+	}
+
+	select {
+	case pr := <-prs:
+		if pr.Database != "db0" || pr.RetentionPolicy != "rp0" {
+			t.Fatalf("unexpected db/rp: %s/%s", pr.Database, pr.RetentionPolicy)
+		} else if len(pr.Points) != 1 || pr.Points[0].String() != "cpu,host=a value=1 1000000000" {
+			t.Fatalf("unexpected points: %v", pr.Points)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected points request")
+	}
+
+	if attempts != 3 {
+		t.Fatalf("unexpected attempts: %d", attempts)
+	}
+}
+
+// Ensure queued writes rejected by the destination are dropped rather than
+// retried.
+func TestService_Queue_Rejected(t *testing.T) {
+	dir, err := ioutil.TempDir("", "subscriber-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ms := MetaClient{}
+	ms.WaitForDataChangedFn = func() chan struct{} {
+		return make(chan struct{})
+	}
+	ms.DatabasesFn = func() ([]meta.DatabaseInfo, error) {
+		return []meta.DatabaseInfo{
+			{
+				Name: "db0",
+				RetentionPolicies: []meta.RetentionPolicyInfo{
+					{
+						Name: "rp0",
+						Subscriptions: []meta.SubscriptionInfo{
+							{Name: "s0", Mode: "ALL", Destinations: []string{"udp://h0:9093"}},
+						},
+					},
+				},
+			},
+		}, nil
+	}
+
+	prs := make(chan *cluster.WritePointsRequest, 2)
+	newPointsWriter := func(u url.URL) (subscriber.PointsWriter, error) {
+		sub := Subscription{}
+		sub.WritePointsFn = func(p *cluster.WritePointsRequest) error {
+			prs <- p
+			return &subscriber.HTTPError{StatusCode: 400, Message: "partial write: field type conflict"}
+		}
+		return sub, nil
+	}
+
+	c := subscriber.NewConfig()
+	c.QueueEnabled = true
+	c.QueueDir = dir
+	c.RetryInterval = toml.Duration(time.Hour)
+	c.RetryMaxInterval = toml.Duration(time.Hour)
+
+	s := subscriber.NewService(c)
+	s.MetaClient = ms
+	s.NewPointsWriter = newPointsWriter
+	s.Open()
+	defer s.Close()
+
+	s.Points() <- &cluster.WritePointsRequest{Database: "db0", RetentionPolicy: "rp0"}
+	s.Points() <- &cluster.WritePointsRequest{Database: "db0", RetentionPolicy: "rp0"}
+
+	// Both writes are attempted once without waiting for a retry.
+	for i := 0; i < 2; i++ {
+		select {
+		case <-prs:
+		case <-time.After(time.Second):
+			t.Fatal("expected points request")
+		}
+	}
+}
+
+// Ensure queued writes in ANY mode fail over to another destination.
+func TestService_Queue_ModeANY(t *testing.T) {
+	dir, err := ioutil.TempDir("", "subscriber-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ms := MetaClient{}
+	ms.WaitForDataChangedFn = func() chan struct{} {
+		return make(chan struct{})
+	}
+	ms.DatabasesFn = func() ([]meta.DatabaseInfo, error) {
+		return []meta.DatabaseInfo{
+			{
+				Name: "db0",
+				RetentionPolicies: []meta.RetentionPolicyInfo{
+					{
+						Name: "rp0",
+						Subscriptions: []meta.SubscriptionInfo{
+							{Name: "s0", Mode: "ANY", Destinations: []string{"udp://down:9093", "udp://up:9093"}},
+						},
+					},
+				},
+			},
+		}, nil
+	}
+
+	prs := make(chan *cluster.WritePointsRequest, 1)
+	newPointsWriter := func(u url.URL) (subscriber.PointsWriter, error) {
+		sub := Subscription{}
+		sub.WritePointsFn = func(p *cluster.WritePointsRequest) error {
+			if u.Host == "down:9093" {
+				return errors.New("destination unavailable")
+			}
+			prs <- p
+			return nil
+		}
+		return sub, nil
+	}
+
+	c := subscriber.NewConfig()
+	c.QueueEnabled = true
+	c.QueueDir = dir
+	c.RetryInterval = toml.Duration(time.Hour)
+	c.RetryMaxInterval = toml.Duration(time.Hour)
+
+	s := subscriber.NewService(c)
+	s.MetaClient = ms
+	s.NewPointsWriter = newPointsWriter
+	s.Open()
+	defer s.Close()
+
+	s.Points() <- &cluster.WritePointsRequest{Database: "db0", RetentionPolicy: "rp0"}
+
+	select {
+	case <-prs:
+	case <-time.After(time.Second):
+		t.Fatal("expected points request")
+	}
+}
+
+// Ensure closing the service closes the destinations of queued subscriptions.
+func TestService_Queue_Close(t *testing.T) {
+	dir, err := ioutil.TempDir("", "subscriber-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ms := MetaClient{}
+	ms.WaitForDataChangedFn = func() chan struct{} {
+		return make(chan struct{})
+	}
+	ms.DatabasesFn = func() ([]meta.DatabaseInfo, error) {
+		return []meta.DatabaseInfo{
+			{
+				Name: "db0",
+				RetentionPolicies: []meta.RetentionPolicyInfo{
+					{
+						Name: "rp0",
+						Subscriptions: []meta.SubscriptionInfo{
+							{Name: "s0", Mode: "ALL", Destinations: []string{"udp://h0:9093"}},
+						},
+					},
+				},
+			},
+		}, nil
+	}
+
+	prs := make(chan *cluster.WritePointsRequest, 1)
+	closed := make(chan struct{})
+	newPointsWriter := func(u url.URL) (subscriber.PointsWriter, error) {
+		sub := ClosingSubscription{}
+		sub.WritePointsFn = func(p *cluster.WritePointsRequest) error {
+			prs <- p
+			return nil
+		}
+		sub.CloseFn = func() error {
+			close(closed)
+			return nil
+		}
+		return sub, nil
+	}
+
+	c := subscriber.NewConfig()
+	c.QueueEnabled = true
+	c.QueueDir = dir
+
+	s := subscriber.NewService(c)
+	s.MetaClient = ms
+	s.NewPointsWriter = newPointsWriter
+	s.Open()
+
+	s.Points() <- &cluster.WritePointsRequest{Database: "db0", RetentionPolicy: "rp0"}
+	select {
+	case <-prs:
+	case <-time.After(time.Second):
+		t.Fatal("expected points request")
+	}
+
+	s.Close()
+	select {
+	case <-closed:
+	default:
+		t.Fatal("destination not closed")
+	}
+}
+
+// Ensure only points matching a subscription's condition are forwarded.
+func TestService_Condition(t *testing.T) {
+	ms := MetaClient{}
+	ms.WaitForDataChangedFn = func() chan struct{} {
+		return make(chan struct{})
+	}
+	ms.DatabasesFn = func() ([]meta.DatabaseInfo, error) {
+		return []meta.DatabaseInfo{
+			{
+				Name: "db0",
+				RetentionPolicies: []meta.RetentionPolicyInfo{
+					{
+						Name: "rp0",
+						Subscriptions: []meta.SubscriptionInfo{
+							{Name: "s0", Mode: "ALL", Destinations: []string{"udp://h0:9093"}, Condition: `_name = 'cpu' AND host !~ /^b/`},
+						},
+					},
+				},
+			},
+		}, nil
+	}
+
+	prs := make(chan *cluster.WritePointsRequest, 2)
+	newPointsWriter := func(u url.URL) (subscriber.PointsWriter, error) {
+		sub := Subscription{}
+		sub.WritePointsFn = func(p *cluster.WritePointsRequest) error {
+			prs <- p
+			return nil
+		}
+		return sub, nil
+	}
+
+	s := subscriber.NewService(subscriber.NewConfig())
+	s.MetaClient = ms
+	s.NewPointsWriter = newPointsWriter
+	s.Open()
+	defer s.Close()
+
+	// Write points where only some match.
+	s.Points() <- &cluster.WritePointsRequest{
+		Database:        "db0",
+		RetentionPolicy: "rp0",
+		Points: []models.Point{
+			models.MustNewPoint("cpu", models.Tags{"host": "b"}, models.Fields{"value": 1.0}, time.Unix(1, 0)),
+			models.MustNewPoint("cpu", models.Tags{"host": "a"}, models.Fields{"value": 2.0}, time.Unix(1, 0)),
+			models.MustNewPoint("mem", models.Tags{"host": "a"}, models.Fields{"value": 3.0}, time.Unix(1, 0)),
+			models.MustNewPoint("cpu", nil, models.Fields{"value": 4.0}, time.Unix(1, 0)),
+		},
+	}
+
+	// Write points where none match.
+	s.Points() <- &cluster.WritePointsRequest{
+		Database:        "db0",
+		RetentionPolicy: "rp0",
+		Points:          []models.Point{models.MustNewPoint("mem", nil, models.Fields{"value": 5.0}, time.Unix(1, 0))},
+	}
+
+	select {
+	case pr := <-prs:
+		var got []string
+		for _, p := range pr.Points {
+			got = append(got, p.String())
+		}
+		if exp := []string{"cpu,host=a value=2 1000000000", "cpu value=4 1000000000"}; !reflect.DeepEqual(got, exp) {
+			t.Fatalf("unexpected points: %v", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected points request")
+	}
+
+	select {
+	case pr := <-prs:
+		t.Fatalf("unexpected points request %v", pr)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
@@ -0,0 +1,18 @@
+package tiering
+
+import (
+	"time"
+
+	"github.com/influxdata/influxdb/toml"
+)
+
+// Config represents the configuration for the tiering service.
+type Config struct {
+	Enabled       bool          `toml:"enabled"`
+	CheckInterval toml.Duration `toml:"check-interval"`
+}
+
+// NewConfig returns an instance of Config with defaults.
+func NewConfig() Config {
+	return Config{Enabled: true, CheckInterval: toml.Duration(30 * time.Minute)}
+}
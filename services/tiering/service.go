@@ -0,0 +1,122 @@
+package tiering // import "github.com/influxdata/influxdb/services/tiering"
+
+import (
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/influxdata/influxdb/services/meta"
+	"github.com/influxdata/influxdb/tsdb"
+)
+
+// Service represents the storage tiering service. It periodically moves
+// shards older than the cold age of their retention policy to cold storage.
+type Service struct {
+	MetaClient interface {
+		Databases() ([]meta.DatabaseInfo, error)
+	}
+	TSDBStore interface {
+		ShardIDs() []uint64
+		ShardTier(id uint64) string
+		MoveShardToCold(id uint64) error
+	}
+
+	checkInterval time.Duration
+	wg            sync.WaitGroup
+	done          chan struct{}
+
+	logger *log.Logger
+}
+
+// NewService returns a configured tiering service.
+func NewService(c Config) *Service {
+	return &Service{
+		checkInterval: time.Duration(c.CheckInterval),
+		done:          make(chan struct{}),
+		logger:        log.New(os.Stderr, "[tiering] ", log.LstdFlags),
+	}
+}
+
+// Open starts moving shards to cold storage.
+func (s *Service) Open() error {
+	s.logger.Println("Starting tiering service with check interval of", s.checkInterval)
+	s.wg.Add(1)
+	go s.run()
+	return nil
+}
+
+// Close stops the service.
+func (s *Service) Close() error {
+	s.logger.Println("tiering service terminating")
+	close(s.done)
+	s.wg.Wait()
+	return nil
+}
+
+// SetLogger sets the internal logger to the logger passed in.
+func (s *Service) SetLogger(l *log.Logger) {
+	s.logger = l
+}
+
+func (s *Service) run() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.checkInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+
+		case <-ticker.C:
+			s.moveShards()
+		}
+	}
+}
+
+// moveShards moves every local hot shard belonging to a cold shard group.
+func (s *Service) moveShards() {
+	type shardInfo struct {
+		db string
+		rp string
+	}
+	coldShardIDs := make(map[uint64]shardInfo)
+
+	dbs, err := s.MetaClient.Databases()
+	if err != nil {
+		s.logger.Printf("error getting databases: %s", err.Error())
+		return
+	}
+	now := time.Now().UTC()
+	for _, d := range dbs {
+		for _, r := range d.RetentionPolicies {
+			for _, g := range r.ColdShardGroups(now) {
+				for _, sh := range g.Shards {
+					coldShardIDs[sh.ID] = shardInfo{db: d.Name, rp: r.Name}
+				}
+			}
+		}
+	}
+
+	for _, id := range s.TSDBStore.ShardIDs() {
+		si, ok := coldShardIDs[id]
+		if !ok || s.TSDBStore.ShardTier(id) != tsdb.HotTier {
+			continue
+		}
+
+		select {
+		case <-s.done:
+			return
+		default:
+		}
+
+		if err := s.TSDBStore.MoveShardToCold(id); err != nil {
+			s.logger.Printf("failed to move shard ID %d from database %s, retention policy %s to cold storage: %s",
+				id, si.db, si.rp, err.Error())
+			continue
+		}
+		s.logger.Printf("shard ID %d from database %s, retention policy %s, moved to cold storage",
+			id, si.db, si.rp)
+	}
+}
@@ -0,0 +1,233 @@
+package tsdb
+
+import (
+	"expvar"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/influxdata/influxdb"
+	"github.com/influxdata/influxdb/monitor/diagnostics"
+)
+
+// CompactionLevelFull is the level full compactions, which rewrite all of a
+// shard's files, are scheduled at. Levels 1 to 3 are the TSM file levels.
+const CompactionLevelFull = 4
+
+// compactionLevelNames are the names of the scheduled levels in statistics.
+var compactionLevelNames = [...]string{"", "level1", "level2", "level3", "full"}
+
+// Statistics maintained by the compaction scheduler. Each level also has an
+// active and a queued gauge, such as "level1Active" and "level1Queued".
+const (
+	statCompactionWriteBytes       = "writeBytes"       // counter: Total number of bytes written by compactions
+	statCompactionWriteThrottledNs = "writeThrottledNs" // counter: Total number of nanoseconds compactions waited for the throughput limit
+)
+
+func init() {
+	var gauges []string
+	for _, name := range compactionLevelNames[1:] {
+		gauges = append(gauges, name+"Active", name+"Queued")
+	}
+	influxdb.RegisterGauges("compaction", gauges...)
+}
+
+// CompactionScheduler limits the compactions running across all shards of a
+// store, so that many shards compacting at once do not starve queries of IO.
+type CompactionScheduler struct {
+	mu            sync.Mutex
+	maxConcurrent int
+	active        [len(compactionLevelNames)]int
+	queued        [len(compactionLevelNames)][]*compactionWaiter
+	seq           uint64
+
+	// throughput is the number of bytes per second compactions may write.
+	// next is when the bytes written so far have been paid for.
+	limitMu    sync.Mutex
+	throughput int64
+	next       time.Time
+
+	statMap *expvar.Map
+}
+
+// compactionWaiter is a compaction waiting for the scheduler to start it.
+type compactionWaiter struct {
+	priority int64
+	seq      uint64
+	ready    chan struct{}
+}
+
+// NewCompactionScheduler returns a scheduler that runs at most maxConcurrent
+// compactions of each level at once and limits compactions to writing
+// throughput bytes per second. Zero disables either limit.
+func NewCompactionScheduler(maxConcurrent int, throughput int64) *CompactionScheduler {
+	s := &CompactionScheduler{
+		maxConcurrent: maxConcurrent,
+		throughput:    throughput,
+		statMap:       influxdb.NewStatistics("compaction", "compaction", nil),
+	}
+	for level := 1; level < len(compactionLevelNames); level++ {
+		s.updateStats(level)
+	}
+	return s
+}
+
+// Acquire blocks until a compaction of level may start. Waiting compactions
+// of a level start in order of highest priority, then arrival. Returns false
+// if cancel is closed first. Otherwise the returned function must be called
+// once the compaction has finished.
+func (s *CompactionScheduler) Acquire(level int, priority int64, cancel <-chan struct{}) (func(), bool) {
+	s.mu.Lock()
+	if s.maxConcurrent <= 0 || (s.active[level] < s.maxConcurrent && len(s.queued[level]) == 0) {
+		s.active[level]++
+		s.updateStats(level)
+		s.mu.Unlock()
+		return s.releaser(level), true
+	}
+
+	w := &compactionWaiter{priority: priority, seq: s.seq, ready: make(chan struct{})}
+	s.seq++
+	s.queued[level] = append(s.queued[level], w)
+	s.updateStats(level)
+	s.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return s.releaser(level), true
+	case <-cancel:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		for i, q := range s.queued[level] {
+			if q == w {
+				s.queued[level] = append(s.queued[level][:i], s.queued[level][i+1:]...)
+				s.updateStats(level)
+				return nil, false
+			}
+		}
+
+		// The compaction was started while being cancelled, so hand its
+		// slot to the next one.
+		s.release(level)
+		return nil, false
+	}
+}
+
+// releaser returns a function that releases a slot of level once.
+func (s *CompactionScheduler) releaser(level int) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.release(level)
+		})
+	}
+}
+
+// release frees a slot of level and starts the next waiting compaction. The
+// lock must be held.
+func (s *CompactionScheduler) release(level int) {
+	s.active[level]--
+
+	if queue := s.queued[level]; len(queue) > 0 {
+		next := 0
+		for i, w := range queue {
+			if w.priority > queue[next].priority || (w.priority == queue[next].priority && w.seq < queue[next].seq) {
+				next = i
+			}
+		}
+		w := queue[next]
+		s.queued[level] = append(queue[:next], queue[next+1:]...)
+		s.active[level]++
+		close(w.ready)
+	}
+	s.updateStats(level)
+}
+
+// Active returns the number of running compactions of level.
+func (s *CompactionScheduler) Active(level int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.active[level]
+}
+
+// Queued returns the number of compactions of level waiting to start.
+func (s *CompactionScheduler) Queued(level int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.queued[level])
+}
+
+// Diagnostics returns the running and waiting compactions of each level, so
+// the queue state is shown by SHOW DIAGNOSTICS.
+func (s *CompactionScheduler) Diagnostics() (*diagnostics.Diagnostics, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d := diagnostics.NewDiagnostics([]string{"level", "active", "queued", "maxConcurrent"})
+	for level := 1; level < len(compactionLevelNames); level++ {
+		d.AddRow([]interface{}{compactionLevelNames[level], s.active[level], len(s.queued[level]), s.maxConcurrent})
+	}
+	return d, nil
+}
+
+// updateStats sets the active and queued gauges of level. The lock must be
+// held.
+func (s *CompactionScheduler) updateStats(level int) {
+	active, queued := new(expvar.Int), new(expvar.Int)
+	active.Set(int64(s.active[level]))
+	queued.Set(int64(len(s.queued[level])))
+	s.statMap.Set(compactionLevelNames[level]+"Active", active)
+	s.statMap.Set(compactionLevelNames[level]+"Queued", queued)
+}
+
+// LimitWriter returns a writer that writes to w no faster than the
+// throughput shared by all compactions. If w is an io.Closer, so is the
+// returned writer.
+func (s *CompactionScheduler) LimitWriter(w io.Writer) io.Writer {
+	return &compactionWriter{w: w, s: s}
+}
+
+// wait blocks until n more bytes may be written.
+func (s *CompactionScheduler) wait(n int) {
+	if s.throughput <= 0 {
+		return
+	}
+
+	s.limitMu.Lock()
+	now := time.Now()
+	if s.next.Before(now) {
+		s.next = now
+	}
+	d := s.next.Sub(now)
+	s.next = s.next.Add(time.Duration(float64(n) / float64(s.throughput) * float64(time.Second)))
+	s.limitMu.Unlock()
+
+	if d > 0 {
+		s.statMap.Add(statCompactionWriteThrottledNs, int64(d))
+		time.Sleep(d)
+	}
+}
+
+// compactionWriter is a writer limited to the compaction throughput.
+type compactionWriter struct {
+	w io.Writer
+	s *CompactionScheduler
+}
+
+// Write writes p once the throughput limit allows it.
+func (w *compactionWriter) Write(p []byte) (int, error) {
+	w.s.wait(len(p))
+	n, err := w.w.Write(p)
+	w.s.statMap.Add(statCompactionWriteBytes, int64(n))
+	return n, err
+}
+
+// Close closes the underlying writer if it is an io.Closer.
+func (w *compactionWriter) Close() error {
+	if c, ok := w.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
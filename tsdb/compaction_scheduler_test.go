@@ -0,0 +1,117 @@
+package tsdb_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb/tsdb"
+)
+
+// Ensure compactions beyond the limit of a level wait and start by priority.
+func TestCompactionScheduler_Acquire(t *testing.T) {
+	s := tsdb.NewCompactionScheduler(1, 0)
+
+	release, ok := s.Acquire(1, 0, nil)
+	if !ok {
+		t.Fatal("expected compaction to start")
+	}
+
+	// Other levels have their own slots.
+	if r, ok := s.Acquire(2, 0, nil); !ok {
+		t.Fatal("expected compaction of another level to start")
+	} else {
+		r()
+	}
+
+	// Queue a cold and a hot compaction behind the running one.
+	started := make(chan int64, 2)
+	for _, priority := range []int64{1, 2} {
+		go func(priority int64) {
+			r, ok := s.Acquire(1, priority, nil)
+			if !ok {
+				panic("expected queued compaction to start")
+			}
+			started <- priority
+			r()
+		}(priority)
+	}
+	for s.Queued(1) != 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// A cancelled compaction leaves the queue.
+	cancel := make(chan struct{})
+	close(cancel)
+	if _, ok := s.Acquire(1, 3, cancel); ok {
+		t.Fatal("expected cancelled compaction not to start")
+	} else if n := s.Queued(1); n != 2 {
+		t.Fatalf("queued: got %d, exp 2", n)
+	}
+
+	release()
+	if p := <-started; p != 2 {
+		t.Fatalf("expected hot compaction to start first, got priority %d", p)
+	} else if p := <-started; p != 1 {
+		t.Fatalf("expected cold compaction to start second, got priority %d", p)
+	}
+
+	for s.Active(1) != 0 {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// Ensure the diagnostics show the running and waiting compactions of each level.
+func TestCompactionScheduler_Diagnostics(t *testing.T) {
+	s := tsdb.NewCompactionScheduler(1, 0)
+
+	release, ok := s.Acquire(2, 0, nil)
+	if !ok {
+		t.Fatal("expected compaction to start")
+	}
+	defer release()
+
+	go func() {
+		if r, ok := s.Acquire(2, 0, nil); ok {
+			r()
+		}
+	}()
+	for s.Queued(2) != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	d, err := s.Diagnostics()
+	if err != nil {
+		t.Fatal(err)
+	} else if exp := []string{"level", "active", "queued", "maxConcurrent"}; !reflect.DeepEqual(d.Columns, exp) {
+		t.Fatalf("unexpected columns: %v", d.Columns)
+	} else if exp := [][]interface{}{
+		{"level1", 0, 0, 1},
+		{"level2", 1, 1, 1},
+		{"level3", 0, 0, 1},
+		{"full", 0, 0, 1},
+	}; !reflect.DeepEqual(d.Rows, exp) {
+		t.Fatalf("unexpected rows: %v", d.Rows)
+	}
+}
+
+// Ensure compaction writes are limited to the throughput.
+func TestCompactionScheduler_LimitWriter(t *testing.T) {
+	s := tsdb.NewCompactionScheduler(0, 1000)
+
+	var buf bytes.Buffer
+	w := s.LimitWriter(&buf)
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if _, err := w.Write(make([]byte, 50)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d := time.Since(start); d < 100*time.Millisecond {
+		t.Fatalf("writes not throttled, took %s", d)
+	} else if buf.Len() != 150 {
+		t.Fatalf("bytes written: got %d, exp 150", buf.Len())
+	}
+}
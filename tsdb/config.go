@@ -3,6 +3,7 @@ package tsdb
 import (
 	"errors"
 	"fmt"
+	"path/filepath"
 	"time"
 
 	"github.com/influxdata/influxdb/toml"
@@ -12,6 +13,9 @@ const (
 	// DefaultEngine is the default engine for new shards
 	DefaultEngine = "tsm1"
 
+	// DefaultIndex is the default series index for new shards
+	DefaultIndex = InmemIndexName
+
 	// DefaultMaxWALSize is the default size of the WAL before it is flushed.
 	DefaultMaxWALSize = 100 * 1024 * 1024 // 100MB
 
@@ -22,6 +26,13 @@ const (
 	// DefaultWALPartitionFlushDelay is the sleep time between WAL partition flushes.
 	DefaultWALPartitionFlushDelay = 2 * time.Second
 
+	// DefaultWALFsyncMode is the default durability mode of tsm1 WAL writes.
+	DefaultWALFsyncMode = WALFsyncWrite
+
+	// DefaultWALFsyncDelay is the longest a write waits for other writes to
+	// share its fsync in group mode, and the fsync interval in periodic mode.
+	DefaultWALFsyncDelay = 10 * time.Millisecond
+
 	// tsdb/engine/wal configuration options
 
 	// DefaultReadySeriesSize of 32KB specifies when a series is eligible to be flushed
@@ -52,6 +63,10 @@ const (
 	// reach before it starts rejecting writes.
 	DefaultCacheMaxMemorySize = 500 * 1024 * 1024 // 500MB
 
+	// DefaultCacheWriteTimeout is how long a write waits for a full cache
+	// to be snapshotted before it is rejected. Zero rejects it immediately.
+	DefaultCacheWriteTimeout = time.Duration(0)
+
 	// DefaultCacheSnapshotMemorySize is the size at which the engine will
 	// snapshot the cache and write it to a TSM file, freeing up memory
 	DefaultCacheSnapshotMemorySize = 25 * 1024 * 1024 // 25MB
@@ -68,6 +83,32 @@ const (
 	// DefaultMaxPointsPerBlock is the maximum number of points in an encoded
 	// block in a TSM file
 	DefaultMaxPointsPerBlock = 1000
+
+	// DefaultMaxIndexLogFileSize is the size at which a persistent series
+	// index compacts its log file into its index file
+	DefaultMaxIndexLogFileSize = 1 * 1024 * 1024 // 1MB
+
+	// DefaultMaxSeriesPerDatabase is the maximum number of series a node can hold per database.
+	// The limit is disabled by default.
+	DefaultMaxSeriesPerDatabase = 0
+
+	// DefaultMaxValuesPerTag is the maximum number of values a tag can have within a measurement.
+	// The limit is disabled by default.
+	DefaultMaxValuesPerTag = 0
+)
+
+// WAL fsync modes.
+const (
+	// WALFsyncWrite fsyncs every write before acknowledging it.
+	WALFsyncWrite = "write"
+
+	// WALFsyncGroup delays acknowledging a write for up to the fsync delay
+	// so that concurrent writes are made durable by a single fsync.
+	WALFsyncGroup = "group"
+
+	// WALFsyncPeriodic acknowledges writes immediately and fsyncs once per
+	// fsync delay. Writes since the last fsync may be lost on a crash.
+	WALFsyncPeriodic = "periodic"
 )
 
 // Config holds the configuration for the tsbd package.
@@ -75,6 +116,14 @@ type Config struct {
 	Dir    string `toml:"dir"`
 	Engine string `toml:"engine"`
 
+	// ColdDir is the data directory shards are moved to once they are older
+	// than the cold age of their retention policy. Blank disables tiering.
+	ColdDir string `toml:"cold-dir"`
+
+	// Series index options
+	IndexVersion        string `toml:"index-version"`
+	MaxIndexLogFileSize int64  `toml:"max-index-log-file-size"`
+
 	// WAL config options for b1 (introduced in 0.9.2)
 	MaxWALSize             int           `toml:"max-wal-size"`
 	WALFlushInterval       toml.Duration `toml:"wal-flush-interval"`
@@ -89,23 +138,62 @@ type Config struct {
 	WALFlushColdInterval      toml.Duration `toml:"wal-flush-cold-interval"`
 	WALPartitionSizeThreshold uint64        `toml:"wal-partition-size-threshold"`
 
+	// WAL durability options for tsm1
+	WALFsyncMode  string        `toml:"wal-fsync-mode"`
+	WALFsyncDelay toml.Duration `toml:"wal-fsync-delay"`
+
 	// Query logging
 	QueryLogEnabled bool `toml:"query-log-enabled"`
 
 	// Compaction options for tsm1 (descriptions above with defaults)
 	CacheMaxMemorySize             uint64        `toml:"cache-max-memory-size"`
+	CacheMaxMemorySizeTotal        uint64        `toml:"cache-max-memory-size-total"`
+	CacheWriteTimeout              toml.Duration `toml:"cache-write-timeout"`
 	CacheSnapshotMemorySize        uint64        `toml:"cache-snapshot-memory-size"`
 	CacheSnapshotWriteColdDuration toml.Duration `toml:"cache-snapshot-write-cold-duration"`
 	CompactFullWriteColdDuration   toml.Duration `toml:"compact-full-write-cold-duration"`
 	MaxPointsPerBlock              int           `toml:"max-points-per-block"`
 
+	// BloomFilterBitsPerKey sizes the bloom filter of the keys written to
+	// each new TSM file. Zero writes no bloom filters.
+	BloomFilterBitsPerKey int `toml:"bloom-filter-bits-per-key"`
+
+	// Compaction scheduling options shared by all shards. Zero disables
+	// either limit.
+	MaxConcurrentCompactions int   `toml:"max-concurrent-compactions"`
+	CompactThroughput        int64 `toml:"compact-throughput"`
+
 	DataLoggingEnabled bool `toml:"data-logging-enabled"`
+
+	// QuarantineCorruptFiles moves TSM files with a corrupt header or index out
+	// of the way when a shard is opened instead of failing to open the shard.
+	// Other errors opening a file, such as running out of file descriptors,
+	// still fail the open.
+	QuarantineCorruptFiles bool `toml:"quarantine-corrupt-files"`
+
+	// EncryptionKeyFile is the path of the key file used to encrypt TSM and
+	// WAL files at rest. Blank disables encryption.
+	EncryptionKeyFile string `toml:"encryption-key-file"`
+
+	// Limits
+
+	// MaxSeriesPerDatabase is the maximum number of series a node can hold per database.
+	// When this limit is exceeded, writes return a partial write error.
+	// A value of 0 disables the limit.
+	MaxSeriesPerDatabase int `toml:"max-series-per-database"`
+
+	// MaxValuesPerTag is the maximum number of tag values a single tag key can have within
+	// a measurement. When this limit is exceeded, writes return a partial write error.
+	// A value of 0 disables the limit.
+	MaxValuesPerTag int `toml:"max-values-per-tag"`
 }
 
 // NewConfig returns the default configuration for tsdb.
 func NewConfig() Config {
 	return Config{
 		Engine:                 DefaultEngine,
+		IndexVersion:           DefaultIndex,
+		MaxIndexLogFileSize:    DefaultMaxIndexLogFileSize,
 		MaxWALSize:             DefaultMaxWALSize,
 		WALFlushInterval:       toml.Duration(DefaultWALFlushInterval),
 		WALPartitionFlushDelay: toml.Duration(DefaultWALPartitionFlushDelay),
@@ -116,15 +204,21 @@ func NewConfig() Config {
 		WALMaxSeriesSize:          DefaultMaxSeriesSize,
 		WALFlushColdInterval:      toml.Duration(DefaultFlushColdInterval),
 		WALPartitionSizeThreshold: DefaultPartitionSizeThreshold,
+		WALFsyncMode:              DefaultWALFsyncMode,
+		WALFsyncDelay:             toml.Duration(DefaultWALFsyncDelay),
 
 		QueryLogEnabled: true,
 
 		CacheMaxMemorySize:             DefaultCacheMaxMemorySize,
+		CacheWriteTimeout:              toml.Duration(DefaultCacheWriteTimeout),
 		CacheSnapshotMemorySize:        DefaultCacheSnapshotMemorySize,
 		CacheSnapshotWriteColdDuration: toml.Duration(DefaultCacheSnapshotWriteColdDuration),
 		CompactFullWriteColdDuration:   toml.Duration(DefaultCompactFullWriteColdDuration),
 
 		DataLoggingEnabled: true,
+
+		MaxSeriesPerDatabase: DefaultMaxSeriesPerDatabase,
+		MaxValuesPerTag:      DefaultMaxValuesPerTag,
 	}
 }
 
@@ -134,6 +228,8 @@ func (c *Config) Validate() error {
 		return errors.New("Data.Dir must be specified")
 	} else if c.WALDir == "" {
 		return errors.New("Data.WALDir must be specified")
+	} else if c.ColdDir != "" && filepath.Clean(c.ColdDir) == filepath.Clean(c.Dir) {
+		return errors.New("Data.ColdDir must differ from Data.Dir")
 	}
 
 	valid := false
@@ -147,5 +243,41 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("unrecognized engine %s", c.Engine)
 	}
 
+	valid = false
+	for _, idx := range RegisteredIndexes() {
+		if idx == c.IndexVersion {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return fmt.Errorf("unrecognized index %s", c.IndexVersion)
+	}
+
+	switch c.WALFsyncMode {
+	case "", WALFsyncWrite, WALFsyncGroup, WALFsyncPeriodic:
+	default:
+		return fmt.Errorf("unrecognized wal-fsync-mode %s", c.WALFsyncMode)
+	}
+	if (c.WALFsyncMode == WALFsyncGroup || c.WALFsyncMode == WALFsyncPeriodic) && c.WALFsyncDelay <= 0 {
+		return errors.New("wal-fsync-delay must be positive")
+	}
+
+	if c.CacheWriteTimeout < 0 {
+		return errors.New("cache-write-timeout must be non-negative")
+	} else if c.MaxConcurrentCompactions < 0 {
+		return errors.New("max-concurrent-compactions must be non-negative")
+	} else if c.CompactThroughput < 0 {
+		return errors.New("compact-throughput must be non-negative")
+	} else if c.BloomFilterBitsPerKey < 0 {
+		return errors.New("bloom-filter-bits-per-key must be non-negative")
+	}
+
+	if c.MaxSeriesPerDatabase < 0 {
+		return errors.New("max-series-per-database must be non-negative")
+	} else if c.MaxValuesPerTag < 0 {
+		return errors.New("max-values-per-tag must be non-negative")
+	}
+
 	return nil
 }
@@ -18,3 +18,23 @@ enabled = false
 
 	// TODO: add remaining config tests
 }
+
+func TestConfig_Validate_WALFsyncMode(t *testing.T) {
+	c := tsdb.NewConfig()
+	c.Dir = "/var/lib/influxdb/data"
+	c.WALDir = "/var/lib/influxdb/wal"
+	if err := c.Validate(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	c.WALFsyncMode = tsdb.WALFsyncGroup
+	c.WALFsyncDelay = 0
+	if err := c.Validate(); err == nil || err.Error() != "wal-fsync-delay must be positive" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	c.WALFsyncMode = "sometimes"
+	if err := c.Validate(); err == nil || err.Error() != "unrecognized wal-fsync-mode sometimes" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"io"
 	"os"
 	"sort"
+	"sync"
 	"time"
 
 	"github.com/influxdata/influxdb/influxql"
@@ -44,6 +45,15 @@ type Engine interface {
 	io.WriterTo
 
 	Backup(w io.Writer, basePath string, since time.Time) error
+	BackupFiles(w io.Writer, basePath string, names []string) error
+	DataFiles() ([]DataFile, error)
+	Restore(r io.Reader, basePath string, lock sync.Locker) error
+}
+
+// DataFile describes a file holding the data of a shard.
+type DataFile struct {
+	Name string
+	Size int64
 }
 
 // EngineFormat represents the format for an engine.
@@ -112,6 +122,17 @@ type EngineOptions struct {
 	WALFlushInterval       time.Duration
 	WALPartitionFlushDelay time.Duration
 
+	// CacheBudget is shared by the caches of all shards when the total
+	// cache size is limited.
+	CacheBudget *MemoryBudget
+
+	// CompactionScheduler limits the compactions of all shards.
+	CompactionScheduler *CompactionScheduler
+
+	// Keyring holds the keys TSM and WAL files are encrypted with. Nil
+	// disables encryption.
+	Keyring *Keyring
+
 	Config Config
 }
 
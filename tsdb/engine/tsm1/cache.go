@@ -91,8 +91,15 @@ const (
 
 	statCachedBytes         = "cachedBytes"         // counter: Total number of bytes written into snapshots.
 	statWALCompactionTimeMs = "WALCompactionTimeMs" // counter: Total number of milliseconds spent compacting snapshots
+	statWriteThrottled      = "writeThrottled"      // counter: Number of times writes waited for a full cache
+	statWriteThrottledNs    = "writeThrottledNs"    // counter: Total number of nanoseconds writes waited for a full cache
+	statWriteRejected       = "writeRejected"       // counter: Number of writes rejected because the cache was full
 )
 
+func init() {
+	influxdb.RegisterGauges("tsm1_cache", statCacheMemoryBytes, statCacheDiskBytes, statSnapshots, statCacheAgeMs)
+}
+
 // Cache maintains an in-memory store of Values for a set of keys.
 type Cache struct {
 	commit  sync.Mutex
@@ -108,9 +115,20 @@ type Cache struct {
 	snapshotSize uint64
 	snapshotting bool
 
+	// snapshotReserved is the number of bytes of the memory budget held by the snapshot.
+	snapshotReserved uint64
+
 	// This number is the number of pending or failed WriteSnaphot attempts since the last successful one.
 	snapshotAttempts int
 
+	// budget, if set, limits the total size of this and other caches.
+	budget *tsdb.MemoryBudget
+
+	// full is set when a write is rejected for lack of room and cleared when
+	// a snapshot frees memory. freed is closed and replaced at the same time.
+	full  bool
+	freed chan struct{}
+
 	statMap      *expvar.Map // nil for snapshots.
 	lastSnapshot time.Time
 }
@@ -122,6 +140,7 @@ func NewCache(maxSize uint64, path string) *Cache {
 	c := &Cache{
 		maxSize: maxSize,
 		store:   make(map[string]*entry),
+		freed:   make(chan struct{}),
 		statMap: influxdb.NewStatistics(
 			"tsm1_cache:"+path,
 			"tsm1_cache",
@@ -140,18 +159,16 @@ func NewCache(maxSize uint64, path string) *Cache {
 // Write writes the set of values for the key to the cache. This function is goroutine-safe.
 // It returns an error if the cache has exceeded its max size.
 func (c *Cache) Write(key string, values []Value) error {
-	c.mu.Lock()
+	addedSize := Values(values).Size()
 
 	// Enough room in the cache?
-	addedSize := Values(values).Size()
-	newSize := c.size + uint64(addedSize)
-	if c.maxSize > 0 && newSize+c.snapshotSize > c.maxSize {
+	c.mu.Lock()
+	if err := c.reserve(uint64(addedSize)); err != nil {
 		c.mu.Unlock()
-		return ErrCacheMemoryExceeded
+		return err
 	}
 
 	c.write(key, values)
-	c.size = newSize
 	c.mu.Unlock()
 
 	// Update the memory size stat
@@ -169,19 +186,15 @@ func (c *Cache) WriteMulti(values map[string][]Value) error {
 	}
 
 	// Enough room in the cache?
-	c.mu.RLock()
-	newSize := c.size + uint64(totalSz)
-	if c.maxSize > 0 && newSize+c.snapshotSize > c.maxSize {
-		c.mu.RUnlock()
-		return ErrCacheMemoryExceeded
+	c.mu.Lock()
+	if err := c.reserve(uint64(totalSz)); err != nil {
+		c.mu.Unlock()
+		return err
 	}
-	c.mu.RUnlock()
 
-	c.mu.Lock()
 	for k, v := range values {
 		c.write(k, v)
 	}
-	c.size = newSize
 	c.mu.Unlock()
 
 	// Update the memory size stat
@@ -190,6 +203,87 @@ func (c *Cache) WriteMulti(values map[string][]Value) error {
 	return nil
 }
 
+// reserve adds n bytes to the size of the cache and to its memory budget. It
+// returns ErrCacheMemoryExceeded if there is no room for them. The lock must
+// be held.
+func (c *Cache) reserve(n uint64) error {
+	if c.maxSize > 0 && c.size+n+c.snapshotSize > c.maxSize {
+		c.full = true
+		return ErrCacheMemoryExceeded
+	}
+	if c.budget != nil && !c.budget.Reserve(n) {
+		return ErrCacheMemoryExceeded
+	}
+	c.size += n
+	return nil
+}
+
+// WaitForSpace blocks until n bytes could be written to the cache without
+// exceeding its maximum size or memory budget, or until deadline. Returns
+// false if the deadline passed first. It does not reserve the space, so a
+// write may still be rejected by the time it is retried.
+func (c *Cache) WaitForSpace(n uint64, deadline time.Time) bool {
+	var timeout <-chan time.Time
+	var start time.Time
+	defer func() {
+		if !start.IsZero() {
+			c.statMap.Add(statWriteThrottledNs, int64(time.Since(start)))
+		}
+	}()
+
+	for {
+		// Grab the channels before checking for room so a snapshot freeing
+		// memory in between is not missed.
+		var freed, budgetFreed <-chan struct{}
+		c.mu.RLock()
+		if c.maxSize > 0 && c.size+n+c.snapshotSize > c.maxSize {
+			freed = c.freed
+		}
+		c.mu.RUnlock()
+		if c.budget != nil {
+			budgetFreed = c.budget.Wait(n)
+		}
+
+		if freed == nil && budgetFreed == nil {
+			return true
+		}
+
+		// Writes that can never fit, or that may not wait, fail right away.
+		d := deadline.Sub(time.Now())
+		if d <= 0 || (c.maxSize > 0 && n > c.maxSize) || (c.budget != nil && n > c.budget.Limit()) {
+			c.statMap.Add(statWriteRejected, 1)
+			return false
+		}
+
+		if start.IsZero() {
+			start = time.Now()
+			c.statMap.Add(statWriteThrottled, 1)
+
+			timer := time.NewTimer(d)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+
+		select {
+		case <-freed:
+		case <-budgetFreed:
+		case <-timeout:
+			c.statMap.Add(statWriteRejected, 1)
+			return false
+		}
+	}
+}
+
+// Full returns true if writes to the cache, or to any cache sharing its
+// memory budget, have been rejected for lack of room since memory was last
+// freed.
+func (c *Cache) Full() bool {
+	c.mu.RLock()
+	full := c.full
+	c.mu.RUnlock()
+	return full || (c.budget != nil && c.budget.Full())
+}
+
 // Snapshot will take a snapshot of the current cache, add it to the slice of caches that
 // are being flushed, and reset the current cache with new values
 func (c *Cache) Snapshot() (*Cache, error) {
@@ -226,6 +320,7 @@ func (c *Cache) Snapshot() (*Cache, error) {
 	}
 
 	snapshotSize := c.size // record the number of bytes written into a snapshot
+	c.snapshotReserved += snapshotSize
 
 	// Reset the cache
 	c.store = make(map[string]*entry)
@@ -260,10 +355,48 @@ func (c *Cache) ClearSnapshot(success bool) {
 		c.snapshotSize = 0
 		c.snapshot = nil
 
+		if c.budget != nil {
+			c.budget.Release(c.snapshotReserved)
+		}
+		c.snapshotReserved = 0
+		c.wake()
+
 		c.updateSnapshots()
 	}
 }
 
+// Free drops all values held by the cache and returns their memory to the
+// budget. It is used when the engine is closed.
+func (c *Cache) Free() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.budget != nil {
+		c.budget.Release(c.size + c.snapshotReserved)
+	}
+	c.updateMemSize(-int64(c.size))
+
+	c.store = make(map[string]*entry)
+	c.size = 0
+	c.snapshot = nil
+	c.snapshotSize = 0
+	c.snapshotReserved = 0
+	c.snapshotting = false
+	c.wake()
+
+	c.updateSnapshots()
+}
+
+// wake clears the full flag and wakes writers waiting for room. The lock
+// must be held.
+func (c *Cache) wake() {
+	c.full = false
+	if c.freed != nil {
+		close(c.freed)
+	}
+	c.freed = make(chan struct{})
+}
+
 // Size returns the number of point-calcuated bytes the cache currently uses.
 func (c *Cache) Size() uint64 {
 	c.mu.RLock()
@@ -408,6 +541,9 @@ func (c *Cache) write(key string, values []Value) {
 type CacheLoader struct {
 	files []string
 
+	// Keyring holds the keys to decrypt encrypted segments with.
+	Keyring *tsdb.Keyring
+
 	Logger *log.Logger
 }
 
@@ -439,11 +575,15 @@ func (cl *CacheLoader) Load(cache *Cache) error {
 			cl.Logger.Printf("reading file %s, size %d", f.Name(), stat.Size())
 
 			r := NewWALSegmentReader(f)
+			r.Keyring = cl.Keyring
 			defer r.Close()
 
 			for r.Next() {
 				entry, err := r.Read()
-				if err != nil {
+				if _, ok := err.(EncryptionKeyError); ok {
+					// The segment is intact but cannot be read without its key.
+					return fmt.Errorf("file %s: %v", f.Name(), err)
+				} else if err != nil {
 					n := r.Count()
 					cl.Logger.Printf("file %s corrupt at position %d, truncating", f.Name(), n)
 					if err := f.Truncate(n); err != nil {
@@ -6,8 +6,10 @@ import (
 	"os"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/golang/snappy"
+	"github.com/influxdata/influxdb/tsdb"
 )
 
 func TestCache_NewCache(t *testing.T) {
@@ -276,6 +278,78 @@ func TestCache_CacheWriteMemoryExceeded(t *testing.T) {
 	}
 }
 
+// Ensure writes can wait for a snapshot to free room in a full cache.
+func TestCache_WaitForSpace(t *testing.T) {
+	v0 := NewValue(1, 1.0)
+	v1 := NewValue(2, 2.0)
+
+	c := NewCache(uint64(v1.Size()), "")
+	if err := c.Write("foo", Values{v0}); err != nil {
+		t.Fatalf("failed to write key foo to cache: %s", err.Error())
+	}
+	if err := c.Write("bar", Values{v1}); err != ErrCacheMemoryExceeded {
+		t.Fatalf("wrong error writing key bar to cache")
+	} else if !c.Full() {
+		t.Fatalf("expected cache to be full")
+	}
+
+	// Nothing frees memory, so the wait times out.
+	if c.WaitForSpace(uint64(v1.Size()), time.Now().Add(10*time.Millisecond)) {
+		t.Fatalf("expected wait for space to time out")
+	}
+
+	// Clearing a snapshot wakes the waiting write.
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		if _, err := c.Snapshot(); err != nil {
+			panic(err)
+		}
+		c.ClearSnapshot(true)
+	}()
+	if !c.WaitForSpace(uint64(v1.Size()), time.Now().Add(10*time.Second)) {
+		t.Fatalf("expected space after snapshot")
+	} else if c.Full() {
+		t.Fatalf("expected cache not to be full after snapshot")
+	}
+	if err := c.Write("bar", Values{v1}); err != nil {
+		t.Fatalf("failed to write key bar to cache: %s", err.Error())
+	}
+}
+
+// Ensure caches sharing a memory budget are limited by their total size.
+func TestCache_MemoryBudget(t *testing.T) {
+	v0 := NewValue(1, 1.0)
+	v1 := NewValue(2, 2.0)
+
+	budget := tsdb.NewMemoryBudget(uint64(v0.Size()))
+	c0, c1 := NewCache(0, ""), NewCache(0, "")
+	c0.budget, c1.budget = budget, budget
+
+	if err := c0.Write("foo", Values{v0}); err != nil {
+		t.Fatalf("failed to write key foo to cache: %s", err.Error())
+	}
+	if err := c1.Write("bar", Values{v1}); err != ErrCacheMemoryExceeded {
+		t.Fatalf("wrong error writing key bar to cache")
+	} else if !c0.Full() {
+		t.Fatalf("expected caches sharing the budget to be full")
+	}
+
+	// Snapshotting the other cache frees its memory.
+	if _, err := c0.Snapshot(); err != nil {
+		t.Fatalf("failed to snapshot cache: %v", err)
+	}
+	c0.ClearSnapshot(true)
+	if err := c1.Write("bar", Values{v1}); err != nil {
+		t.Fatalf("failed to write key bar to cache: %s", err.Error())
+	}
+
+	// Freeing a cache returns its memory.
+	c1.Free()
+	if n := budget.Used(); n != 0 {
+		t.Fatalf("budget used: got %d, exp 0", n)
+	}
+}
+
 // Ensure the CacheLoader can correctly load from a single segment, even if it's corrupted.
 func TestCacheLoader_LoadSingle(t *testing.T) {
 	// Create a WAL segment.
@@ -406,6 +480,47 @@ func TestCacheLoader_LoadDouble(t *testing.T) {
 	}
 }
 
+// Ensure the CacheLoader decrypts encrypted segments and does not truncate
+// segments whose key is missing.
+func TestCacheLoader_LoadEncrypted(t *testing.T) {
+	dir := mustTempDir()
+	defer os.RemoveAll(dir)
+	f := mustTempFile(dir)
+
+	keyring := tsdb.NewKeyring()
+	if err := keyring.Add("k1", make([]byte, 16)); err != nil {
+		t.Fatal(err)
+	}
+	w := NewWALSegmentWriter(f)
+	w.key = keyring.Current()
+
+	p1 := NewValue(1, 1.1)
+	if err := w.Write(mustMarshalEntry(&WriteWALEntry{Values: map[string][]Value{"foo": []Value{p1}}})); err != nil {
+		t.Fatal("write points", err)
+	}
+	size := w.size
+
+	cache := NewCache(1024, "")
+	loader := NewCacheLoader([]string{f.Name()})
+	loader.Keyring = keyring
+	if err := loader.Load(cache); err != nil {
+		t.Fatalf("failed to load cache: %s", err.Error())
+	} else if values := cache.Values("foo"); !reflect.DeepEqual(values, Values{p1}) {
+		t.Fatalf("cache key foo not as expected, got %v, exp %v", values, Values{p1})
+	}
+
+	loader = NewCacheLoader([]string{f.Name()})
+	if err := loader.Load(NewCache(1024, "")); err == nil {
+		t.Fatal("expected error loading segment without its key")
+	}
+
+	if stat, err := os.Stat(f.Name()); err != nil {
+		t.Fatal(err)
+	} else if stat.Size() != int64(size) {
+		t.Fatalf("segment size: got %d, exp %d", stat.Size(), size)
+	}
+}
+
 func mustTempDir() string {
 	dir, err := ioutil.TempDir("", "tsm1-test")
 	if err != nil {
@@ -14,6 +14,7 @@ package tsm1
 
 import (
 	"fmt"
+	"io"
 	"math"
 	"os"
 	"path/filepath"
@@ -44,6 +45,10 @@ type CompactionGroup []string
 type CompactionPlanner interface {
 	Plan(lastWrite time.Time) []CompactionGroup
 	PlanLevel(level int) []CompactionGroup
+
+	// PlanFull returns the full compaction that Plan would return once the
+	// shard is cold for writes, regardless of when it was last written.
+	PlanFull() []CompactionGroup
 }
 
 // DefaultPlanner implements CompactionPlanner using a strategy to roll up
@@ -202,42 +207,8 @@ func (c *DefaultPlanner) Plan(lastWrite time.Time) []CompactionGroup {
 
 	// first check if we should be doing a full compaction because nothing has been written in a long time
 	if !c.lastPlanCompactedFull && c.CompactFullWriteColdDuration > 0 && time.Now().Sub(lastWrite) > c.CompactFullWriteColdDuration && len(generations) > 1 {
-		var tsmFiles []string
-		for i, group := range generations {
-			var skip bool
-
-			// Skip the file if it's over the max size and contains a full block and it does not have any tombstones
-			if group.size() > uint64(maxTSMFileSize) && c.FileStore.BlockCount(group.files[0].Path, 1) == tsdb.DefaultMaxPointsPerBlock && !group.hasTombstones() {
-				skip = true
-			}
-
-			// We need to look at the level of the next file because it may need to be combined with this generation
-			// but won't get picked up on it's own if this generation is skipped.  This allows the most recently
-			// created files to get picked up by the full compaction planner and avoids having a few less optimally
-			// compressed files.
-			if i < len(generations)-1 {
-				if generations[i+1].level() <= 3 {
-					skip = false
-				}
-			}
-
-			if skip {
-				continue
-			}
-
-			for _, f := range group.files {
-				tsmFiles = append(tsmFiles, f.Path)
-			}
-		}
-		sort.Strings(tsmFiles)
-
 		c.lastPlanCompactedFull = true
-
-		if len(tsmFiles) <= 1 {
-			return nil
-		}
-
-		return []CompactionGroup{tsmFiles}
+		return c.planFull(generations)
 	}
 
 	// don't plan if nothing has changed in the filestore
@@ -374,6 +345,56 @@ func (c *DefaultPlanner) Plan(lastWrite time.Time) []CompactionGroup {
 	return tsmFiles
 }
 
+// PlanFull returns a compaction of all generations that are not already fully
+// compacted, as done once the shard is cold for writes.
+func (c *DefaultPlanner) PlanFull() []CompactionGroup {
+	generations := c.findGenerations()
+	if len(generations) <= 1 {
+		return nil
+	}
+	return c.planFull(generations)
+}
+
+// planFull returns a single group of the files of all generations, skipping
+// generations that are full size and do not need to be combined with the
+// next one.
+func (c *DefaultPlanner) planFull(generations tsmGenerations) []CompactionGroup {
+	var tsmFiles []string
+	for i, group := range generations {
+		var skip bool
+
+		// Skip the file if it's over the max size and contains a full block and it does not have any tombstones
+		if group.size() > uint64(maxTSMFileSize) && c.FileStore.BlockCount(group.files[0].Path, 1) == tsdb.DefaultMaxPointsPerBlock && !group.hasTombstones() {
+			skip = true
+		}
+
+		// We need to look at the level of the next file because it may need to be combined with this generation
+		// but won't get picked up on it's own if this generation is skipped.  This allows the most recently
+		// created files to get picked up by the full compaction planner and avoids having a few less optimally
+		// compressed files.
+		if i < len(generations)-1 {
+			if generations[i+1].level() <= 3 {
+				skip = false
+			}
+		}
+
+		if skip {
+			continue
+		}
+
+		for _, f := range group.files {
+			tsmFiles = append(tsmFiles, f.Path)
+		}
+	}
+	sort.Strings(tsmFiles)
+
+	if len(tsmFiles) <= 1 {
+		return nil
+	}
+
+	return []CompactionGroup{tsmFiles}
+}
+
 // findGenerations groups all the TSM files by they generation based
 // on their filename then returns the generations in descending order (newest first)
 func (c *DefaultPlanner) findGenerations() tsmGenerations {
@@ -408,6 +429,19 @@ type Compactor struct {
 	Cancel chan struct{}
 	Size   int
 
+	// Scheduler, if set, limits the throughput of TSM compactions. Cache
+	// snapshots are not limited since they free memory.
+	Scheduler *tsdb.CompactionScheduler
+
+	// Keyring, if set, holds the keys to read encrypted files with. New
+	// files are encrypted with its current key, so compactions re-encrypt
+	// data written with older keys.
+	Keyring *tsdb.Keyring
+
+	// BloomFilterBitsPerKey, if positive, adds a bloom filter of the keys
+	// to new files using this many bits per key.
+	BloomFilterBitsPerKey int
+
 	FileStore interface {
 		NextGeneration() int
 	}
@@ -416,7 +450,7 @@ type Compactor struct {
 // WriteSnapshot will write a Cache snapshot to a new TSM files.
 func (c *Compactor) WriteSnapshot(cache *Cache) ([]string, error) {
 	iter := NewCacheKeyIterator(cache, tsdb.DefaultMaxPointsPerBlock)
-	return c.writeNewFiles(c.FileStore.NextGeneration(), 0, iter)
+	return c.writeNewFiles(c.FileStore.NextGeneration(), 0, iter, false)
 }
 
 // Compact will write multiple smaller TSM files into 1 or more larger files
@@ -456,6 +490,7 @@ func (c *Compactor) compact(fast bool, tsmFiles []string) ([]string, error) {
 		tr, err := NewTSMReaderWithOptions(
 			TSMReaderOptions{
 				MMAPFile: f,
+				Keyring:  c.Keyring,
 			})
 		if err != nil {
 			return nil, err
@@ -473,7 +508,7 @@ func (c *Compactor) compact(fast bool, tsmFiles []string) ([]string, error) {
 		return nil, err
 	}
 
-	return c.writeNewFiles(maxGeneration, maxSequence, tsm)
+	return c.writeNewFiles(maxGeneration, maxSequence, tsm, true)
 }
 
 // Compact will write multiple smaller TSM files into 1 or more larger files
@@ -492,12 +527,17 @@ func (c *Compactor) Clone() *Compactor {
 		Dir:       c.Dir,
 		FileStore: c.FileStore,
 		Cancel:    c.Cancel,
+		Scheduler: c.Scheduler,
+		Keyring:   c.Keyring,
+
+		BloomFilterBitsPerKey: c.BloomFilterBitsPerKey,
 	}
 }
 
 // writeNewFiles will write from the iterator into new TSM files, rotating
-// to a new file when we've reached the max TSM file size
-func (c *Compactor) writeNewFiles(generation, sequence int, iter KeyIterator) ([]string, error) {
+// to a new file when we've reached the max TSM file size. If throttle is set,
+// writes are limited by the throughput of the scheduler.
+func (c *Compactor) writeNewFiles(generation, sequence int, iter KeyIterator, throttle bool) ([]string, error) {
 	// These are the new TSM files written
 	var files []string
 
@@ -507,7 +547,7 @@ func (c *Compactor) writeNewFiles(generation, sequence int, iter KeyIterator) ([
 		fileName := filepath.Join(c.Dir, fmt.Sprintf("%09d-%09d.%s.tmp", generation, sequence, TSMFileExtension))
 
 		// Write as much as possible to this file
-		err := c.write(fileName, iter)
+		err := c.write(fileName, iter, throttle)
 
 		// We've hit the max file limit and there is more to write.  Create a new file
 		// and continue.
@@ -538,7 +578,7 @@ func (c *Compactor) writeNewFiles(generation, sequence int, iter KeyIterator) ([
 	return files, nil
 }
 
-func (c *Compactor) write(path string, iter KeyIterator) error {
+func (c *Compactor) write(path string, iter KeyIterator, throttle bool) error {
 	if _, err := os.Stat(path); !os.IsNotExist(err) {
 		return fmt.Errorf("%v already file exists. aborting", path)
 	}
@@ -548,8 +588,17 @@ func (c *Compactor) write(path string, iter KeyIterator) error {
 		return err
 	}
 
+	var f io.Writer = fd
+	if throttle && c.Scheduler != nil {
+		f = c.Scheduler.LimitWriter(fd)
+	}
+
 	// Create the write for the new TSM file.
-	w, err := NewTSMWriter(fd)
+	opt := TSMWriterOptions{BloomFilterBitsPerKey: c.BloomFilterBitsPerKey}
+	if c.Keyring != nil {
+		opt.Key = c.Keyring.Current()
+	}
+	w, err := NewTSMWriterWithOptions(f, opt)
 	if err != nil {
 		return err
 	}
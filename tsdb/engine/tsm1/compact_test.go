@@ -1,6 +1,7 @@
 package tsm1_test
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -8,6 +9,7 @@ import (
 	"time"
 
 	"github.com/influxdata/influxdb/models"
+	"github.com/influxdata/influxdb/tsdb"
 	"github.com/influxdata/influxdb/tsdb/engine/tsm1"
 )
 
@@ -170,6 +172,63 @@ func TestCompactor_CompactFull(t *testing.T) {
 	}
 }
 
+// Ensures that compactions encrypt with the current key, so rotated keys are
+// no longer needed once files written with them are compacted.
+func TestCompactor_CompactFull_Encrypted(t *testing.T) {
+	dir := MustTempDir()
+	defer os.RemoveAll(dir)
+
+	a1 := tsm1.NewValue(1, 1.1)
+	f1 := MustWriteTSM(dir, 1, map[string][]tsm1.Value{"cpu,host=A#!~#value": []tsm1.Value{a1}})
+	b1 := tsm1.NewValue(1, 2.1)
+	f2 := MustWriteTSM(dir, 2, map[string][]tsm1.Value{"cpu,host=B#!~#value": []tsm1.Value{b1}})
+
+	// Encrypt the unencrypted files with the first key.
+	keyring := MustKeyring("k1")
+	compactor := &tsm1.Compactor{
+		Dir:       dir,
+		FileStore: &fakeFileStore{},
+		Keyring:   keyring,
+	}
+	files, err := compactor.CompactFull([]string{f1, f2})
+	if err != nil {
+		t.Fatalf("unexpected error compacting: %v", err)
+	}
+
+	// Rotate the key and compact again.
+	k2 := bytes.Repeat([]byte{2}, 32)
+	if err := keyring.Add("k2", k2); err != nil {
+		t.Fatal(err)
+	}
+	files, err = compactor.CompactFull(files)
+	if err != nil {
+		t.Fatalf("unexpected error compacting: %v", err)
+	} else if len(files) != 1 {
+		t.Fatalf("files length mismatch: got %v, exp 1", len(files))
+	}
+
+	// The new file only needs the new key.
+	rotated := tsdb.NewKeyring()
+	if err := rotated.Add("k2", k2); err != nil {
+		t.Fatal(err)
+	}
+	r, err := tsm1.NewTSMReaderWithOptions(tsm1.TSMReaderOptions{MMAPFile: MustOpenFile(files[0]), Keyring: rotated})
+	if err != nil {
+		t.Fatalf("unexpected error opening compacted file: %v", err)
+	}
+	defer r.Close()
+
+	for key, exp := range map[string]tsm1.Value{"cpu,host=A#!~#value": a1, "cpu,host=B#!~#value": b1} {
+		values, err := r.ReadAll(key)
+		if err != nil {
+			t.Fatalf("unexpected error reading: %v", err)
+		} else if len(values) != 1 {
+			t.Fatalf("values length mismatch %s: got %v, exp 1", key, len(values))
+		}
+		assertValueEqual(t, values[0], exp)
+	}
+}
+
 // Ensures that a compaction will properly merge multiple TSM files
 func TestCompactor_CompactFull_SkipFullBlocks(t *testing.T) {
 	dir := MustTempDir()
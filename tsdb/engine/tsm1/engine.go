@@ -44,6 +44,19 @@ type Engine struct {
 	index             *tsdb.DatabaseIndex
 	measurementFields map[string]*tsdb.MeasurementFields
 
+	// seriesIndex is the shard's persistent series index. If set, series
+	// are looked up in it instead of the database index.
+	seriesIndex tsdb.SeriesIndex
+
+	// snapshotMu serializes writes of the index snapshot and protects the
+	// generation of the last snapshot written or loaded.
+	snapshotMu         sync.Mutex
+	snapshotGeneration uint64
+
+	// compactionMu is held for reading by the background compactions and
+	// for writing by CompactFull so they never compact the same files.
+	compactionMu sync.RWMutex
+
 	WAL            *WAL
 	Cache          *Cache
 	Compactor      *Compactor
@@ -60,21 +73,38 @@ type Engine struct {
 	// no writes have been committed to the WAL, the engine will write
 	// a snapshot of the cache to a TSM file
 	CacheFlushWriteColdDuration time.Duration
+
+	// CacheWriteTimeout is how long a write waits for room in a full cache
+	// before it is rejected.
+	CacheWriteTimeout time.Duration
+
+	// CompactionScheduler, if set, decides when TSM compactions may run.
+	CompactionScheduler *tsdb.CompactionScheduler
 }
 
 // NewEngine returns a new instance of Engine.
 func NewEngine(path string, walPath string, opt tsdb.EngineOptions) tsdb.Engine {
 	w := NewWAL(walPath)
 	w.LoggingEnabled = opt.Config.WALLoggingEnabled
+	w.SyncMode = opt.Config.WALFsyncMode
+	w.SyncDelay = time.Duration(opt.Config.WALFsyncDelay)
+	w.Keyring = opt.Keyring
 
 	fs := NewFileStore(path)
 	fs.traceLogging = opt.Config.DataLoggingEnabled
+	fs.quarantineCorrupt = opt.Config.QuarantineCorruptFiles
+	fs.keyring = opt.Keyring
 
 	cache := NewCache(uint64(opt.Config.CacheMaxMemorySize), path)
+	cache.budget = opt.CacheBudget
 
 	c := &Compactor{
 		Dir:       path,
 		FileStore: fs,
+		Scheduler: opt.CompactionScheduler,
+		Keyring:   opt.Keyring,
+
+		BloomFilterBitsPerKey: opt.Config.BloomFilterBitsPerKey,
 	}
 
 	e := &Engine{
@@ -94,6 +124,8 @@ func NewEngine(path string, walPath string, opt tsdb.EngineOptions) tsdb.Engine
 
 		CacheFlushMemorySizeThreshold: opt.Config.CacheSnapshotMemorySize,
 		CacheFlushWriteColdDuration:   time.Duration(opt.Config.CacheSnapshotWriteColdDuration),
+		CacheWriteTimeout:             time.Duration(opt.Config.CacheWriteTimeout),
+		CompactionScheduler:           opt.CompactionScheduler,
 	}
 
 	return e
@@ -180,37 +212,76 @@ func (e *Engine) Close() error {
 	if err := e.FileStore.Close(); err != nil {
 		return err
 	}
-	return e.WAL.Close()
+	if err := e.WAL.Close(); err != nil {
+		return err
+	}
+
+	// Return the memory of the cache to the budget shared with other shards.
+	e.Cache.Free()
+	return nil
 }
 
 // SetLogOutput is a no-op.
 func (e *Engine) SetLogOutput(w io.Writer) {}
 
 // LoadMetadataIndex loads the shard metadata into memory.
-func (e *Engine) LoadMetadataIndex(_ *tsdb.Shard, index *tsdb.DatabaseIndex, measurementFields map[string]*tsdb.MeasurementFields) error {
+func (e *Engine) LoadMetadataIndex(sh *tsdb.Shard, index *tsdb.DatabaseIndex, measurementFields map[string]*tsdb.MeasurementFields) error {
 	// Save reference to index for iterator creation.
 	e.index = index
 	e.measurementFields = measurementFields
+	if sh != nil {
+		e.seriesIndex = sh.SeriesIndex()
+	}
 
-	keys := e.FileStore.Keys()
+	// An existing series index already holds the series of the TSM files so
+	// only their fields need to be loaded.
+	loadSeries := e.seriesIndex == nil || sh.SeriesIndexCreated()
 
 	keysLoaded := make(map[string]bool)
 
-	for _, k := range keys {
-		typ, err := e.FileStore.Type(k)
-		if err != nil {
-			return err
-		}
-		fieldType, err := tsmFieldTypeToInfluxQLDataType(typ)
-		if err != nil {
-			return err
+	// Load the series and fields from the index snapshot if it matches the
+	// current TSM files, otherwise fall back to scanning every key.
+	snapshot, err := e.loadIndexSnapshot(index, measurementFields, loadSeries)
+	if err != nil {
+		if !os.IsNotExist(err) && err != ErrIndexSnapshotStale {
+			e.logger.Printf("error loading index snapshot: %v", err)
 		}
+		snapshot = nil
 
-		if err := e.addToIndexFromKey(k, fieldType, index, measurementFields); err != nil {
-			return err
+		keys := e.FileStore.Keys()
+		for _, k := range keys {
+			typ, err := e.FileStore.Type(k)
+			if err != nil {
+				return err
+			}
+			fieldType, err := tsmFieldTypeToInfluxQLDataType(typ)
+			if err != nil {
+				return err
+			}
+
+			if loadSeries {
+				err = e.addToIndexFromKey(k, fieldType, index, measurementFields)
+			} else {
+				seriesKey, field := SeriesAndFieldFromCompositeKey(k)
+				err = e.addFieldToIndex(tsdb.MeasurementFromSeriesKey(seriesKey), field, fieldType, index, measurementFields)
+			}
+			if err != nil {
+				return err
+			}
+
+			keysLoaded[k] = true
 		}
 
-		keysLoaded[k] = true
+		// Write a snapshot in the background so the next open is faster.
+		e.mu.RLock()
+		if e.done != nil && len(keys) > 0 {
+			e.wg.Add(1)
+			go func() {
+				defer e.wg.Done()
+				e.writeIndexSnapshot()
+			}()
+		}
+		e.mu.RUnlock()
 	}
 
 	// load metadata from the Cache
@@ -218,7 +289,7 @@ func (e *Engine) LoadMetadataIndex(_ *tsdb.Shard, index *tsdb.DatabaseIndex, mea
 	defer e.Cache.Unlock()
 
 	for key, entry := range e.Cache.Store() {
-		if keysLoaded[key] {
+		if keysLoaded[key] || snapshot.Contains(key) {
 			continue
 		}
 
@@ -236,6 +307,72 @@ func (e *Engine) LoadMetadataIndex(_ *tsdb.Shard, index *tsdb.DatabaseIndex, mea
 	return nil
 }
 
+// loadIndexSnapshot adds the fields and, if loadSeries is set, the series
+// from the shard's index snapshot to the index. Returns ErrIndexSnapshotStale
+// if the snapshot was written for a different set of TSM files.
+func (e *Engine) loadIndexSnapshot(index *tsdb.DatabaseIndex, measurementFields map[string]*tsdb.MeasurementFields, loadSeries bool) (*IndexSnapshot, error) {
+	if e.FileStore.Count() == 0 {
+		return nil, ErrIndexSnapshotStale
+	}
+
+	s, err := ReadIndexSnapshot(filepath.Join(e.path, IndexSnapshotFileName))
+	if err != nil {
+		return nil, err
+	} else if s.Generation != e.FileStore.FileSetGeneration() {
+		return nil, ErrIndexSnapshotStale
+	}
+
+	for name, m := range s.Measurements {
+		for field, typ := range m.Fields {
+			fieldType, err := tsmFieldTypeToInfluxQLDataType(typ)
+			if err != nil {
+				return nil, err
+			}
+			if err := e.addFieldToIndex(name, field, fieldType, index, measurementFields); err != nil {
+				return nil, err
+			}
+		}
+
+		if !loadSeries {
+			continue
+		}
+		for key := range m.Series {
+			if err := e.addSeriesToIndex(name, key, index); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	e.snapshotMu.Lock()
+	e.snapshotGeneration = s.Generation
+	e.snapshotMu.Unlock()
+
+	return s, nil
+}
+
+// writeIndexSnapshot writes a snapshot of the series and fields in the TSM
+// files so the index can be loaded without scanning keys on the next open.
+func (e *Engine) writeIndexSnapshot() {
+	e.snapshotMu.Lock()
+	defer e.snapshotMu.Unlock()
+
+	if e.FileStore.Count() == 0 || e.FileStore.FileSetGeneration() == e.snapshotGeneration {
+		return
+	}
+
+	s, err := e.FileStore.IndexSnapshot()
+	if err != nil {
+		e.logger.Printf("error creating index snapshot: %v", err)
+		return
+	}
+
+	if err := WriteIndexSnapshot(filepath.Join(e.path, IndexSnapshotFileName), s); err != nil {
+		e.logger.Printf("error writing index snapshot: %v", err)
+		return
+	}
+	e.snapshotGeneration = s.Generation
+}
+
 // Backup will write a tar archive of any TSM files modified since the passed
 // in time to the passed in writer. The basePath will be prepended to the names
 // of the files in the archive. It will force a snapshot of the WAL first
@@ -299,12 +436,203 @@ func (e *Engine) writeFileToBackup(f FileStat, shardRelativePath string, tw *tar
 	return err
 }
 
+// DataFiles returns the names and sizes of the TSM and tombstone files of
+// the engine. It forces a snapshot of the WAL first so that all data written
+// so far is contained in the files.
+func (e *Engine) DataFiles() ([]tsdb.DataFile, error) {
+	if err := e.WriteSnapshot(); err != nil {
+		return nil, err
+	}
+	e.FileStore.mu.RLock()
+	defer e.FileStore.mu.RUnlock()
+
+	var files []tsdb.DataFile
+	for _, f := range e.FileStore.files {
+		stat := f.Stats()
+		files = append(files, tsdb.DataFile{Name: filepath.Base(stat.Path), Size: int64(stat.Size)})
+		for _, t := range f.TombstoneFiles() {
+			files = append(files, tsdb.DataFile{Name: filepath.Base(t.Path), Size: int64(t.Size)})
+		}
+	}
+	return files, nil
+}
+
+// BackupFiles will write a tar archive of the named TSM and tombstone files
+// to the passed in writer. Names of files that no longer exist, e.g. because
+// they were compacted, are ignored. The basePath will be prepended to the
+// names of the files in the archive.
+func (e *Engine) BackupFiles(w io.Writer, basePath string, names []string) error {
+	wanted := make(map[string]bool, len(names))
+	for _, name := range names {
+		wanted[name] = true
+	}
+
+	e.FileStore.mu.RLock()
+	defer e.FileStore.mu.RUnlock()
+
+	var files []FileStat
+	for _, f := range e.FileStore.files {
+		if stat := f.Stats(); wanted[filepath.Base(stat.Path)] {
+			files = append(files, stat)
+		}
+		for _, t := range f.TombstoneFiles() {
+			if wanted[t.Path] {
+				t.Path = filepath.Join(e.path, t.Path)
+				files = append(files, t)
+			}
+		}
+	}
+
+	tw := tar.NewWriter(w)
+	defer tw.Close()
+
+	for _, f := range files {
+		if err := e.writeFileToBackup(f, basePath, tw); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Restore reads a tar archive of TSM and tombstone files, as written by
+// Backup, and adds them to the engine. The files are given new generations
+// so they never replace existing files. The series and fields of the
+// restored files are added to the index. The files are read from the archive
+// without holding lock, which is only held while they are added to the file
+// store and the index.
+func (e *Engine) Restore(r io.Reader, basePath string, lock sync.Locker) error {
+	generations := make(map[string]int) // file name without extension to new generation
+	newFiles := make(map[string]bool)   // TSM files written, by temporary path
+
+	// Remove any files written if the archive can't be restored.
+	var written []string
+	restored := false
+	defer func() {
+		if !restored {
+			for _, path := range written {
+				os.Remove(path)
+			}
+		}
+	}()
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		name := filepath.Base(hdr.Name)
+		ext := filepath.Ext(name)
+		if ext != "."+TSMFileExtension && ext != ".tombstone" {
+			continue
+		}
+
+		_, sequence, err := ParseTSMFileName(name)
+		if err != nil {
+			return err
+		}
+
+		stem := strings.TrimSuffix(name, ext)
+		generation, ok := generations[stem]
+		if !ok {
+			generation = e.FileStore.NextGeneration()
+			generations[stem] = generation
+		}
+
+		var path string
+		if ext == ".tombstone" {
+			path = filepath.Join(e.path, fmt.Sprintf("%09d-%09d.tombstone", generation, sequence))
+		} else {
+			path = filepath.Join(e.path, fmt.Sprintf("%09d-%09d.%s.tmp", generation, sequence, TSMFileExtension))
+		}
+
+		if err := e.readFileFromBackup(tr, path); err != nil {
+			return err
+		}
+		written = append(written, path)
+		if ext != ".tombstone" {
+			newFiles[path] = true
+		}
+	}
+
+	if len(newFiles) == 0 {
+		return nil
+	}
+
+	paths := make([]string, 0, len(newFiles))
+	for path := range newFiles {
+		paths = append(paths, path)
+	}
+
+	if err := func() error {
+		lock.Lock()
+		defer lock.Unlock()
+
+		if err := e.FileStore.Replace(nil, paths); err != nil {
+			return err
+		}
+		restored = true
+
+		// Add the series and fields of the new files to the index.
+		for _, f := range e.FileStore.Files() {
+			if !newFiles[f.Path()+".tmp"] {
+				continue
+			}
+			for _, k := range f.Keys() {
+				typ, err := f.Type(k)
+				if err != nil {
+					return err
+				}
+				fieldType, err := tsmFieldTypeToInfluxQLDataType(typ)
+				if err != nil {
+					return err
+				}
+				if err := e.addToIndexFromKey(k, fieldType, e.index, e.measurementFields); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}(); err != nil {
+		return err
+	}
+
+	e.writeIndexSnapshot()
+	return nil
+}
+
+// readFileFromBackup copies the current file of the tar archive to path.
+func (e *Engine) readFileFromBackup(tr *tar.Reader, path string) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, tr); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
 // addToIndexFromKey will pull the measurement name, series key, and field name from a composite key and add it to the
 // database index and measurement fields
 func (e *Engine) addToIndexFromKey(key string, fieldType influxql.DataType, index *tsdb.DatabaseIndex, measurementFields map[string]*tsdb.MeasurementFields) error {
-	seriesKey, field := seriesAndFieldFromCompositeKey(key)
+	seriesKey, field := SeriesAndFieldFromCompositeKey(key)
 	measurement := tsdb.MeasurementFromSeriesKey(seriesKey)
 
+	if err := e.addFieldToIndex(measurement, field, fieldType, index, measurementFields); err != nil {
+		return err
+	}
+	return e.addSeriesToIndex(measurement, seriesKey, index)
+}
+
+// addFieldToIndex adds a measurement's field to the index and measurement fields.
+func (e *Engine) addFieldToIndex(measurement, field string, fieldType influxql.DataType, index *tsdb.DatabaseIndex, measurementFields map[string]*tsdb.MeasurementFields) error {
 	m := index.CreateMeasurementIndexIfNotExists(measurement)
 	m.SetFieldName(field)
 
@@ -316,8 +644,19 @@ func (e *Engine) addToIndexFromKey(key string, fieldType influxql.DataType, inde
 		measurementFields[measurement] = mf
 	}
 
-	if err := mf.CreateFieldIfNotExists(field, fieldType, false); err != nil {
-		return err
+	return mf.CreateFieldIfNotExists(field, fieldType, false)
+}
+
+// addSeriesToIndex adds a series to the index if it does not already exist.
+func (e *Engine) addSeriesToIndex(measurement, seriesKey string, index *tsdb.DatabaseIndex) error {
+	// Series are persisted by the series index so only ensure that series
+	// written before an unclean shutdown were not lost.
+	if e.seriesIndex != nil {
+		if e.seriesIndex.HasSeries(seriesKey) {
+			return nil
+		}
+		_, tags, _ := models.ParseKey(seriesKey)
+		return e.seriesIndex.CreateSeriesIfNotExists(measurement, seriesKey, tags)
 	}
 
 	_, tags, err := models.ParseKey(seriesKey)
@@ -343,9 +682,38 @@ func (e *Engine) WritePoints(points []models.Point, measurementFieldsToSave map[
 		}
 	}
 
+	var deadline time.Time
+	for {
+		err := e.writeValues(values)
+		if err != ErrCacheMemoryExceeded {
+			return err
+		}
+
+		// The cache is full. Wait for a snapshot to free memory, without
+		// holding the engine lock since snapshots need it.
+		if deadline.IsZero() {
+			deadline = time.Now().Add(e.CacheWriteTimeout)
+		}
+		var sz int
+		for _, v := range values {
+			sz += Values(v).Size()
+		}
+		if !e.Cache.WaitForSpace(uint64(sz), deadline) {
+			return err
+		}
+	}
+}
+
+// writeValues writes values to the cache and then the WAL.
+func (e *Engine) writeValues(values map[string][]Value) error {
 	e.mu.RLock()
 	defer e.mu.RUnlock()
 
+	// A closed engine has freed its cache so the write must not reach it.
+	if e.done == nil {
+		return tsdb.ErrEngineClosed
+	}
+
 	// first try to write to the cache
 	err := e.Cache.WriteMulti(values)
 	if err != nil {
@@ -371,7 +739,7 @@ func (e *Engine) DeleteSeries(seriesKeys []string) error {
 	var deleteKeys []string
 	// go through the keys in the file store
 	for _, k := range e.FileStore.Keys() {
-		seriesKey, _ := seriesAndFieldFromCompositeKey(k)
+		seriesKey, _ := SeriesAndFieldFromCompositeKey(k)
 		if _, ok := keyMap[seriesKey]; ok {
 			deleteKeys = append(deleteKeys, k)
 		}
@@ -385,7 +753,7 @@ func (e *Engine) DeleteSeries(seriesKeys []string) error {
 
 	s := e.Cache.Store()
 	for k, _ := range s {
-		seriesKey, _ := seriesAndFieldFromCompositeKey(k)
+		seriesKey, _ := SeriesAndFieldFromCompositeKey(k)
 		if _, ok := keyMap[seriesKey]; ok {
 			walKeys = append(walKeys, k)
 			delete(s, k)
@@ -507,6 +875,8 @@ func (e *Engine) compactCache() {
 				err := e.WriteSnapshot()
 				if err != nil {
 					e.logger.Printf("error writing snapshot: %v", err)
+				} else {
+					e.writeIndexSnapshot()
 				}
 			}
 		}
@@ -514,8 +884,9 @@ func (e *Engine) compactCache() {
 	}
 }
 
-// ShouldCompactCache returns true if the Cache is over its flush threshold
-// or if the passed in lastWriteTime is older than the write cold threshold
+// ShouldCompactCache returns true if the Cache is over its flush threshold,
+// if writes are waiting for room in it or in the memory budget it shares, or
+// if the passed in lastWriteTime is older than the write cold threshold
 func (e *Engine) ShouldCompactCache(lastWriteTime time.Time) bool {
 	sz := e.Cache.Size()
 
@@ -523,7 +894,7 @@ func (e *Engine) ShouldCompactCache(lastWriteTime time.Time) bool {
 		return false
 	}
 
-	return sz > e.CacheFlushMemorySizeThreshold ||
+	return sz > e.CacheFlushMemorySizeThreshold || e.Cache.Full() ||
 		time.Now().Sub(lastWriteTime) > e.CacheFlushWriteColdDuration
 }
 
@@ -536,9 +907,11 @@ func (e *Engine) compactTSMLevel(fast bool, level int) {
 			return
 
 		default:
+			e.compactionMu.RLock()
 			tsmFiles := e.CompactionPlan.PlanLevel(level)
 
 			if len(tsmFiles) == 0 {
+				e.compactionMu.RUnlock()
 				time.Sleep(time.Second)
 				continue
 			}
@@ -548,6 +921,13 @@ func (e *Engine) compactTSMLevel(fast bool, level int) {
 				wg.Add(1)
 				go func(groupNum int, group CompactionGroup) {
 					defer wg.Done()
+
+					release, ok := e.scheduleCompaction(level)
+					if !ok {
+						return
+					}
+					defer release()
+
 					start := time.Now()
 					e.logger.Printf("beginning level %d compaction of group %d, %d TSM files", level, groupNum, len(group))
 					for i, f := range group {
@@ -587,6 +967,9 @@ func (e *Engine) compactTSMLevel(fast bool, level int) {
 				}(i, group)
 			}
 			wg.Wait()
+			e.compactionMu.RUnlock()
+
+			e.writeIndexSnapshot()
 		}
 	}
 }
@@ -600,9 +983,11 @@ func (e *Engine) compactTSMFull() {
 			return
 
 		default:
+			e.compactionMu.RLock()
 			tsmFiles := e.CompactionPlan.Plan(e.WAL.LastWriteTime())
 
 			if len(tsmFiles) == 0 {
+				e.compactionMu.RUnlock()
 				time.Sleep(time.Second)
 				continue
 			}
@@ -612,6 +997,13 @@ func (e *Engine) compactTSMFull() {
 				wg.Add(1)
 				go func(groupNum int, group CompactionGroup) {
 					defer wg.Done()
+
+					release, ok := e.scheduleCompaction(tsdb.CompactionLevelFull)
+					if !ok {
+						return
+					}
+					defer release()
+
 					start := time.Now()
 					e.logger.Printf("beginning full compaction of group %d, %d TSM files", groupNum, len(group))
 					for i, f := range group {
@@ -639,8 +1031,99 @@ func (e *Engine) compactTSMFull() {
 				}(i, group)
 			}
 			wg.Wait()
+			e.compactionMu.RUnlock()
+
+			e.writeIndexSnapshot()
+		}
+	}
+}
+
+// scheduleCompaction waits until the scheduler allows a compaction of level
+// to start. Shards written to more recently are given priority. Returns false
+// if the engine is closed first, otherwise the returned function must be
+// called when the compaction is done.
+func (e *Engine) scheduleCompaction(level int) (func(), bool) {
+	if e.CompactionScheduler == nil {
+		return func() {}, true
+	}
+	return e.CompactionScheduler.Acquire(level, e.WAL.LastWriteTime().UnixNano(), e.done)
+}
+
+// CompactFull writes the cache to a new TSM file and then compacts all
+// TSM files of the engine into as few files as possible.
+func (e *Engine) CompactFull() error {
+	e.compactionMu.Lock()
+	defer e.compactionMu.Unlock()
+
+	if e.Cache.Size() > 0 {
+		if err := e.WriteSnapshot(); err != nil {
+			return err
+		}
+	}
+
+	var tsmFiles []string
+	for _, f := range e.FileStore.Stats() {
+		tsmFiles = append(tsmFiles, f.Path)
+	}
+	if len(tsmFiles) <= 1 {
+		return nil
+	}
+
+	release, ok := e.scheduleCompaction(tsdb.CompactionLevelFull)
+	if !ok {
+		return tsdb.ErrEngineClosed
+	}
+	defer release()
+
+	start := time.Now()
+	files, err := e.Compactor.CompactFull(tsmFiles)
+	if err != nil {
+		return err
+	}
+	if err := e.FileStore.Replace(tsmFiles, files); err != nil {
+		return err
+	}
+	e.logger.Printf("compacted all %d files into %d files in %s", len(tsmFiles), len(files), time.Since(start))
+
+	e.writeIndexSnapshot()
+	return nil
+}
+
+// CompactPlanned runs the full compaction the planner schedules once a shard
+// is cold for writes, without waiting for the shard to turn cold.
+func (e *Engine) CompactPlanned() error {
+	e.compactionMu.Lock()
+	defer e.compactionMu.Unlock()
+
+	for _, group := range e.CompactionPlan.PlanFull() {
+		if err := e.compactPlannedGroup(group); err != nil {
+			return err
 		}
 	}
+
+	e.writeIndexSnapshot()
+	return nil
+}
+
+// compactPlannedGroup fully compacts a group of files once the scheduler
+// allows a full compaction to start.
+func (e *Engine) compactPlannedGroup(group CompactionGroup) error {
+	release, ok := e.scheduleCompaction(tsdb.CompactionLevelFull)
+	if !ok {
+		return tsdb.ErrEngineClosed
+	}
+	defer release()
+
+	start := time.Now()
+	files, err := e.Compactor.CompactFull(group)
+	if err != nil {
+		return err
+	}
+	if err := e.FileStore.Replace(group, files); err != nil {
+		return err
+	}
+	e.logger.Printf("compacted planned %d files into %d files in %s", len(group), len(files), time.Since(start))
+	return nil
 }
 
 // reloadCache reads the WAL segment files and loads them into the cache.
@@ -650,7 +1133,19 @@ func (e *Engine) reloadCache() error {
 		return err
 	}
 
+	// Writes in the WAL were already accepted, so they are reloaded even if
+	// that exceeds the memory budget. The budget is charged for them after.
+	budget := e.Cache.budget
+	e.Cache.budget = nil
+	defer func() {
+		e.Cache.budget = budget
+		if budget != nil {
+			budget.Charge(e.Cache.Size())
+		}
+	}()
+
 	loader := NewCacheLoader(files)
+	loader.Keyring = e.WAL.Keyring
 	if err := loader.Load(e.Cache); err != nil {
 		return err
 	}
@@ -698,10 +1193,9 @@ func (e *Engine) CreateIterator(opt influxql.IteratorOptions) (influxql.Iterator
 
 func (e *Engine) SeriesKeys(opt influxql.IteratorOptions) (influxql.SeriesList, error) {
 	seriesList := influxql.SeriesList{}
-	mms := tsdb.Measurements(e.index.MeasurementsByName(influxql.Sources(opt.Sources).Names()))
-	for _, mm := range mms {
+	for _, name := range e.measurementNames(opt.Sources) {
 		// Determine tagsets for this measurement based on dimensions and filters.
-		tagSets, err := mm.TagSets(opt.Dimensions, opt.Condition)
+		tagSets, err := e.tagSets(name, opt)
 		if err != nil {
 			return nil, err
 		}
@@ -719,17 +1213,17 @@ func (e *Engine) SeriesKeys(opt influxql.IteratorOptions) (influxql.SeriesList,
 			tags := influxql.NewTags(tagMap)
 
 			series := influxql.Series{
-				Name: mm.Name,
+				Name: name,
 				Tags: tags,
 				Aux:  make([]influxql.DataType, len(opt.Aux)),
 			}
 
 			// Determine the aux field types.
 			for _, seriesKey := range t.SeriesKeys {
-				tags := influxql.NewTags(e.index.TagsForSeries(seriesKey))
+				tags := influxql.NewTags(e.tagsForSeries(seriesKey))
 				for i, field := range opt.Aux {
 					typ := func() influxql.DataType {
-						mf := e.measurementFields[mm.Name]
+						mf := e.measurementFields[name]
 						if mf == nil {
 							return influxql.Unknown
 						}
@@ -767,14 +1261,12 @@ func (e *Engine) createVarRefIterator(opt influxql.IteratorOptions) ([]influxql.
 
 	var itrs []influxql.Iterator
 	if err := func() error {
-		mms := tsdb.Measurements(e.index.MeasurementsByName(influxql.Sources(opt.Sources).Names()))
-
 		// Retrieve non-time names from condition (includes tags).
 		conditionNames := influxql.ExprNames(opt.Condition)
 
-		for _, mm := range mms {
+		for _, name := range e.measurementNames(opt.Sources) {
 			// Determine tagsets for this measurement based on dimensions and filters.
-			tagSets, err := mm.TagSets(opt.Dimensions, opt.Condition)
+			tagSets, err := e.tagSets(name, opt)
 			if err != nil {
 				return err
 			}
@@ -785,14 +1277,14 @@ func (e *Engine) createVarRefIterator(opt influxql.IteratorOptions) ([]influxql.
 			// Filter the names from condition to only fields from the measurement.
 			conditionFields := make([]string, 0, len(conditionNames))
 			for _, f := range conditionNames {
-				if mm.HasField(f) {
+				if e.hasField(name, f) {
 					conditionFields = append(conditionFields, f)
 				}
 			}
 
 			for _, t := range tagSets {
 				for i, seriesKey := range t.SeriesKeys {
-					itr, err := e.createVarRefSeriesIterator(ref, mm, seriesKey, t, t.Filters[i], conditionFields, opt)
+					itr, err := e.createVarRefSeriesIterator(ref, name, seriesKey, t, t.Filters[i], conditionFields, opt)
 					if err != nil {
 						return err
 					} else if itr == nil {
@@ -812,8 +1304,8 @@ func (e *Engine) createVarRefIterator(opt influxql.IteratorOptions) ([]influxql.
 }
 
 // createVarRefSeriesIterator creates an iterator for a variable reference for a series.
-func (e *Engine) createVarRefSeriesIterator(ref *influxql.VarRef, mm *tsdb.Measurement, seriesKey string, t *influxql.TagSet, filter influxql.Expr, conditionFields []string, opt influxql.IteratorOptions) (influxql.Iterator, error) {
-	tags := influxql.NewTags(e.index.TagsForSeries(seriesKey))
+func (e *Engine) createVarRefSeriesIterator(ref *influxql.VarRef, name string, seriesKey string, t *influxql.TagSet, filter influxql.Expr, conditionFields []string, opt influxql.IteratorOptions) (influxql.Iterator, error) {
+	tags := influxql.NewTags(e.tagsForSeries(seriesKey))
 
 	// Create options specific for this series.
 	itrOpt := opt
@@ -826,7 +1318,7 @@ func (e *Engine) createVarRefSeriesIterator(ref *influxql.VarRef, mm *tsdb.Measu
 		aux = make([]cursorAt, len(opt.Aux))
 		for i := range aux {
 			// Create cursor from field.
-			cur := e.buildCursor(mm.Name, seriesKey, opt.Aux[i], opt)
+			cur := e.buildCursor(name, seriesKey, opt.Aux[i], opt)
 			if cur != nil {
 				aux[i] = newBufCursor(cur)
 				continue
@@ -848,7 +1340,7 @@ func (e *Engine) createVarRefSeriesIterator(ref *influxql.VarRef, mm *tsdb.Measu
 	if len(conditionFields) > 0 {
 		conds = make([]*bufCursor, len(conditionFields))
 		for i := range conds {
-			cur := e.buildCursor(mm.Name, seriesKey, conditionFields[i], opt)
+			cur := e.buildCursor(name, seriesKey, conditionFields[i], opt)
 			if cur == nil {
 				return nil, nil
 			}
@@ -861,11 +1353,11 @@ func (e *Engine) createVarRefSeriesIterator(ref *influxql.VarRef, mm *tsdb.Measu
 
 	// If it's only auxiliary fields then it doesn't matter what type of iterator we use.
 	if ref == nil {
-		return newFloatIterator(mm.Name, tags, itrOpt, nil, aux, conds, conditionFields), nil
+		return newFloatIterator(name, tags, itrOpt, nil, aux, conds, conditionFields), nil
 	}
 
 	// Build main cursor.
-	cur := e.buildCursor(mm.Name, seriesKey, ref.Val, opt)
+	cur := e.buildCursor(name, seriesKey, ref.Val, opt)
 
 	// If the field doesn't exist then don't build an iterator.
 	if cur == nil {
@@ -874,18 +1366,74 @@ func (e *Engine) createVarRefSeriesIterator(ref *influxql.VarRef, mm *tsdb.Measu
 
 	switch cur := cur.(type) {
 	case floatCursor:
-		return newFloatIterator(mm.Name, tags, itrOpt, cur, aux, conds, conditionFields), nil
+		return newFloatIterator(name, tags, itrOpt, cur, aux, conds, conditionFields), nil
 	case integerCursor:
-		return newIntegerIterator(mm.Name, tags, itrOpt, cur, aux, conds, conditionFields), nil
+		return newIntegerIterator(name, tags, itrOpt, cur, aux, conds, conditionFields), nil
 	case stringCursor:
-		return newStringIterator(mm.Name, tags, itrOpt, cur, aux, conds, conditionFields), nil
+		return newStringIterator(name, tags, itrOpt, cur, aux, conds, conditionFields), nil
 	case booleanCursor:
-		return newBooleanIterator(mm.Name, tags, itrOpt, cur, aux, conds, conditionFields), nil
+		return newBooleanIterator(name, tags, itrOpt, cur, aux, conds, conditionFields), nil
 	default:
 		panic("unreachable")
 	}
 }
 
+// measurementNames returns the names of the measurements in sources which
+// exist in the shard.
+func (e *Engine) measurementNames(sources influxql.Sources) []string {
+	names := sources.Names()
+	if e.seriesIndex == nil {
+		mms := e.index.MeasurementsByName(names)
+		a := make([]string, len(mms))
+		for i, mm := range mms {
+			a[i] = mm.Name
+		}
+		return a
+	}
+
+	a := make([]string, 0, len(names))
+	for _, name := range names {
+		if e.seriesIndex.HasMeasurement(name) {
+			a = append(a, name)
+		}
+	}
+	return a
+}
+
+// tagSets returns the tag sets of a measurement for the dimensions and
+// condition of opt.
+func (e *Engine) tagSets(name string, opt influxql.IteratorOptions) ([]*influxql.TagSet, error) {
+	if e.seriesIndex != nil {
+		return e.seriesIndex.TagSets(name, opt.Dimensions, opt.Condition, e.measurementFields[name])
+	}
+
+	mm := e.index.Measurement(name)
+	if mm == nil {
+		return nil, nil
+	}
+	return mm.TagSets(opt.Dimensions, opt.Condition)
+}
+
+// hasField returns true if the measurement has a field by the given name.
+func (e *Engine) hasField(name, field string) bool {
+	if e.seriesIndex != nil {
+		mf := e.measurementFields[name]
+		return mf != nil && mf.Fields[field] != nil
+	}
+
+	mm := e.index.Measurement(name)
+	return mm != nil && mm.HasField(field)
+}
+
+// tagsForSeries returns the tags of a series.
+func (e *Engine) tagsForSeries(key string) map[string]string {
+	if e.seriesIndex != nil {
+		_, tags, _ := models.ParseKey(key)
+		return tags
+	}
+	return e.index.TagsForSeries(key)
+}
+
 // buildCursor creates an untyped cursor for a field.
 func (e *Engine) buildCursor(measurement, seriesKey, field string, opt influxql.IteratorOptions) cursor {
 	// Look up fields for measurement.
@@ -963,7 +1511,7 @@ func tsmFieldTypeToInfluxQLDataType(typ byte) (influxql.DataType, error) {
 	}
 }
 
-func seriesAndFieldFromCompositeKey(key string) (string, string) {
+func SeriesAndFieldFromCompositeKey(key string) (string, string) {
 	parts := strings.Split(key, keyFieldSeparator)
 	if len(parts) != 0 {
 		return parts[0], strings.Join(parts[1:], keyFieldSeparator)
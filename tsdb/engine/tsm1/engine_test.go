@@ -8,6 +8,7 @@ import (
 	"path/filepath"
 	"reflect"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -96,6 +97,77 @@ func TestEngine_LoadMetadataIndex(t *testing.T) {
 	}
 }
 
+// Ensure engine writes an index snapshot and loads the index from it on open.
+func TestEngine_LoadMetadataIndex_Snapshot(t *testing.T) {
+	e := MustOpenEngine()
+	defer e.Close()
+
+	if err := e.WritePointsString(
+		`cpu,host=A value=1.1 1000000000`,
+		`mem,host=B free=10i 1000000000`,
+	); err != nil {
+		t.Fatalf("failed to write points: %s", err.Error())
+	}
+	e.MustWriteSnapshot()
+
+	// The first open scans the TSM files and writes a snapshot in the background.
+	if err := e.Reopen(); err != nil {
+		t.Fatal(err)
+	} else if err := e.LoadMetadataIndex(nil, tsdb.NewDatabaseIndex("db"), make(map[string]*tsdb.MeasurementFields)); err != nil {
+		t.Fatal(err)
+	} else if err := e.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshotPath := filepath.Join(e.root, "data", tsm1.IndexSnapshotFileName)
+	s, err := tsm1.ReadIndexSnapshot(snapshotPath)
+	if err != nil {
+		t.Fatalf("unexpected error reading snapshot: %s", err)
+	} else if s.Generation != e.FileStore.FileSetGeneration() {
+		t.Fatalf("unexpected generation: %d", s.Generation)
+	}
+
+	// Remove the TSM keys from the snapshot to ensure the index is loaded from it.
+	delete(s.Measurements["mem"].Series, "mem,host=B")
+	if err := tsm1.WriteIndexSnapshot(snapshotPath, s); err != nil {
+		t.Fatal(err)
+	}
+
+	index, fields := tsdb.NewDatabaseIndex("db"), make(map[string]*tsdb.MeasurementFields)
+	if err := e.LoadMetadataIndex(nil, index, fields); err != nil {
+		t.Fatal(err)
+	}
+	if m := index.Measurement("cpu"); m == nil {
+		t.Fatal("measurement not found")
+	} else if s := m.SeriesByID(1); s == nil || s.Key != "cpu,host=A" || !reflect.DeepEqual(s.Tags, map[string]string{"host": "A"}) {
+		t.Fatalf("unexpected series: %#v", s)
+	}
+	if m := index.Measurement("mem"); m == nil {
+		t.Fatal("measurement not found")
+	} else if n := len(m.SeriesKeys()); n != 0 {
+		t.Fatalf("unexpected series count: %d", n)
+	} else if f := fields["mem"].Fields["free"]; f == nil || f.Type != influxql.Integer {
+		t.Fatalf("unexpected field: %#v", f)
+	}
+
+	// Add a new TSM file so the snapshot is stale and the keys are scanned.
+	if err := e.WritePointsString(`cpu,host=C value=1.3 2000000000`); err != nil {
+		t.Fatalf("failed to write points: %s", err.Error())
+	}
+	e.MustWriteSnapshot()
+	if err := e.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+
+	index = tsdb.NewDatabaseIndex("db")
+	if err := e.LoadMetadataIndex(nil, index, make(map[string]*tsdb.MeasurementFields)); err != nil {
+		t.Fatal(err)
+	}
+	if n := index.SeriesN(); n != 3 {
+		t.Fatalf("unexpected series count: %d", n)
+	}
+}
+
 // Ensure that deletes only sent to the WAL will clear out the data from the cache on restart
 func TestEngine_DeleteWALLoadMetadata(t *testing.T) {
 	e := MustOpenEngine()
@@ -210,6 +282,152 @@ func TestEngine_Backup(t *testing.T) {
 	}
 }
 
+// Ensure that files backed up from one engine can be restored into another.
+func TestEngine_Restore(t *testing.T) {
+	src := MustOpenEngine()
+	defer src.Close()
+
+	if err := src.WritePointsString(`cpu,host=A value=1.1 1000000000`); err != nil {
+		t.Fatalf("failed to write points: %s", err.Error())
+	}
+
+	// Listing the data files forces a snapshot of the WAL.
+	files, err := src.DataFiles()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(files) != 1 {
+		t.Fatalf("file count wrong: exp: %d, got: %d", 1, len(files))
+	}
+
+	b := bytes.NewBuffer(nil)
+	if err := src.BackupFiles(b, "db/rp/1", []string{files[0].Name, "missing.tsm"}); err != nil {
+		t.Fatalf("failed to backup: %s", err.Error())
+	}
+
+	// Restore into an engine that already has a TSM file of the same generation.
+	dst := NewEngine()
+	defer dst.Close()
+	if err := dst.Open(); err != nil {
+		t.Fatal(err)
+	}
+	index := tsdb.NewDatabaseIndex("db")
+	if err := dst.LoadMetadataIndex(nil, index, make(map[string]*tsdb.MeasurementFields)); err != nil {
+		t.Fatal(err)
+	}
+	if err := dst.WritePointsString(`mem,host=A value=2 1000000000`); err != nil {
+		t.Fatalf("failed to write points: %s", err.Error())
+	} else if err := dst.WriteSnapshot(); err != nil {
+		t.Fatalf("failed to snapshot: %s", err.Error())
+	}
+
+	if err := dst.Restore(b, "db/rp/1", &sync.Mutex{}); err != nil {
+		t.Fatalf("failed to restore: %s", err.Error())
+	} else if n := dst.FileStore.Count(); n != 2 {
+		t.Fatalf("file count wrong: exp: %d, got: %d", 2, n)
+	}
+
+	// Verify the restored data can be read and is in the index.
+	if values, err := dst.FileStore.Read(tsm1.SeriesFieldKey("cpu,host=A", "value"), 1000000000); err != nil {
+		t.Fatal(err)
+	} else if len(values) != 1 || values[0].Value() != 1.1 {
+		t.Fatalf("unexpected values: %v", values)
+	} else if m := index.Measurement("cpu"); m == nil {
+		t.Fatal("measurement not found")
+	}
+
+	// Ensure the restored files are loaded after reopening.
+	if err := dst.Reopen(); err != nil {
+		t.Fatal(err)
+	} else if n := dst.FileStore.Count(); n != 2 {
+		t.Fatalf("file count wrong after reopen: exp: %d, got: %d", 2, n)
+	}
+}
+
+// Ensure corrupt TSM files fail to open unless they are quarantined.
+func TestEngine_Open_QuarantineCorruptFiles(t *testing.T) {
+	root, err := ioutil.TempDir("", "tsm1-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	dataDir := filepath.Join(root, "data")
+	if err := os.MkdirAll(dataDir, 0777); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dataDir, "000000001-000000001.tsm")
+	if err := ioutil.WriteFile(path, []byte("not a tsm file"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	opt := tsdb.NewEngineOptions()
+	e := tsm1.NewEngine(dataDir, filepath.Join(root, "wal"), opt)
+	if err := e.Open(); err == nil {
+		e.Close()
+		t.Fatal("expected error opening corrupt file")
+	}
+
+	opt.Config.QuarantineCorruptFiles = true
+	e = tsm1.NewEngine(dataDir, filepath.Join(root, "wal"), opt)
+	if err := e.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+
+	if _, err := os.Stat(path + "." + tsm1.QuarantineExtension); err != nil {
+		t.Fatalf("file not quarantined: %s", err)
+	} else if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("corrupt file still present: %v", err)
+	}
+}
+
+// Ensure TSM files which can't be opened for reasons other than corruption
+// fail the open and are not quarantined.
+func TestEngine_Open_QuarantineCorruptFiles_ReadError(t *testing.T) {
+	root, err := ioutil.TempDir("", "tsm1-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	dataDir := filepath.Join(root, "data")
+	if err := os.MkdirAll(dataDir, 0777); err != nil {
+		t.Fatal(err)
+	}
+
+	// Write a valid file whose tombstone file can't be read.
+	path := filepath.Join(dataDir, "000000001-000000001.tsm")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := tsm1.NewTSMWriter(f)
+	if err != nil {
+		t.Fatal(err)
+	} else if err := w.Write("cpu,host=A#!~#value", []tsm1.Value{tsm1.NewValue(1, 1.0)}); err != nil {
+		t.Fatal(err)
+	} else if err := w.WriteIndex(); err != nil {
+		t.Fatal(err)
+	} else if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dataDir, "000000001-000000001.tombstone"), 0777); err != nil {
+		t.Fatal(err)
+	}
+
+	opt := tsdb.NewEngineOptions()
+	opt.Config.QuarantineCorruptFiles = true
+	e := tsm1.NewEngine(dataDir, filepath.Join(root, "wal"), opt)
+	if err := e.Open(); err == nil {
+		e.Close()
+		t.Fatal("expected error opening file")
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("file quarantined: %s", err)
+	}
+}
+
 // Ensure engine can create an ascending iterator for cached values.
 func TestEngine_CreateIterator_Cache_Ascending(t *testing.T) {
 	t.Parallel()
@@ -578,6 +796,7 @@ type mockPlanner struct{}
 
 func (m *mockPlanner) Plan(lastWrite time.Time) []tsm1.CompactionGroup { return nil }
 func (m *mockPlanner) PlanLevel(level int) []tsm1.CompactionGroup      { return nil }
+func (m *mockPlanner) PlanFull() []tsm1.CompactionGroup                { return nil }
 
 // ParseTags returns an instance of Tags for a comma-delimited list of key/values.
 func ParseTags(s string) influxql.Tags {
@@ -42,6 +42,11 @@ type TSMFile interface {
 	// key.
 	Contains(key string) bool
 
+	// MayContain returns false if the file's bloom filter shows it does not
+	// contain the key.  It is cheaper than Contains but may return true for
+	// keys the file does not contain.
+	MayContain(key string) bool
+
 	// TimeRange returns the min and max time across all keys in the file.
 	TimeRange() (int64, int64)
 
@@ -85,9 +90,15 @@ type TSMFile interface {
 
 // Statistics gathered by the FileStore.
 const (
-	statFileStoreBytes = "diskBytes"
+	statFileStoreBytes       = "diskBytes"
+	statFileStoreQuarantined = "quarantinedFiles"
+	statFileStoreBloomSkips  = "bloomFilterSkips" // counter: Number of times a bloom filter showed a file did not contain a key
 )
 
+func init() {
+	influxdb.RegisterGauges("tsm1_filestore", statFileStoreBytes)
+}
+
 type FileStore struct {
 	mu           sync.RWMutex
 	lastModified time.Time
@@ -100,6 +111,13 @@ type FileStore struct {
 	Logger       *log.Logger
 	traceLogging bool
 
+	// quarantineCorrupt moves files with a corrupt header or index aside
+	// instead of failing Open.
+	quarantineCorrupt bool
+
+	// keyring holds the keys to read encrypted files with.
+	keyring *tsdb.Keyring
+
 	statMap *expvar.Map
 }
 
@@ -227,13 +245,40 @@ func (f *FileStore) Type(key string) (byte, error) {
 	defer f.mu.RUnlock()
 
 	for _, f := range f.files {
-		if f.Contains(key) {
+		if f.MayContain(key) && f.Contains(key) {
 			return f.Type(key)
 		}
 	}
 	return 0, fmt.Errorf("unknown type for %v", key)
 }
 
+// FileSetGeneration returns a hash identifying the current set of TSM files
+// and their tombstones.
+func (f *FileStore) FileSetGeneration() uint64 {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return fileSetGeneration(f.files)
+}
+
+// IndexSnapshot returns a snapshot of the series and fields stored in the
+// current set of TSM files.
+func (f *FileStore) IndexSnapshot() (*IndexSnapshot, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	s := NewIndexSnapshot(fileSetGeneration(f.files))
+	for _, f := range f.files {
+		for _, key := range f.Keys() {
+			typ, err := f.Type(key)
+			if err != nil {
+				return nil, err
+			}
+			s.Add(key, typ)
+		}
+	}
+	return s, nil
+}
+
 func (f *FileStore) Delete(keys []string) error {
 	f.mu.Lock()
 	defer f.mu.Unlock()
@@ -264,8 +309,13 @@ func (f *FileStore) Open() error {
 
 	// struct to hold the result of opening each reader in a goroutine
 	type res struct {
-		r   *TSMReader
-		err error
+		r    *TSMReader
+		path string
+		err  error
+
+		// corrupt is set if the file's header or index is corrupt. Only
+		// corrupt files are quarantined, any other error fails the open.
+		corrupt bool
 	}
 
 	readerC := make(chan *res)
@@ -292,35 +342,80 @@ func (f *FileStore) Open() error {
 
 		go func(idx int, file *os.File) {
 			start := time.Now()
-			df, err := NewTSMReaderWithOptions(TSMReaderOptions{
-				MMAPFile: file,
-			})
+			df, err := openTSMReader(file, f.keyring)
 			if f.traceLogging {
 				f.Logger.Printf("%s (#%d) opened in %v", file.Name(), idx, time.Now().Sub(start))
 			}
 
 			if err != nil {
-				readerC <- &res{r: df, err: fmt.Errorf("error opening memory map for file %s: %v", file.Name(), err)}
+				_, corrupt := err.(CorruptFileError)
+				readerC <- &res{path: file.Name(), err: fmt.Errorf("error opening memory map for file %s: %v", file.Name(), err), corrupt: corrupt}
 				return
 			}
 			readerC <- &res{r: df}
 		}(i, file)
 	}
 
+	var openErr error
+	var corrupt []string
 	for range files {
 		res := <-readerC
 		if res.err != nil {
-
-			return res.err
+			if res.corrupt && f.quarantineCorrupt {
+				f.Logger.Println(res.err)
+				corrupt = append(corrupt, res.path)
+			} else if openErr == nil {
+				openErr = res.err
+			}
+			continue
 		}
 		f.files = append(f.files, res.r)
 	}
 	close(readerC)
 
+	if openErr != nil {
+		for _, r := range f.files {
+			r.Close()
+		}
+		f.files = nil
+		return openErr
+	}
+
+	// Quarantine the files that are corrupt.
+	for _, fn := range corrupt {
+		if fi, err := os.Stat(fn); err == nil {
+			f.statMap.Add(statFileStoreBytes, -fi.Size())
+		}
+		if err := QuarantineTSMFile(fn); err != nil {
+			return err
+		}
+		f.Logger.Printf("quarantined corrupt file %s", fn)
+		f.statMap.Add(statFileStoreQuarantined, 1)
+	}
+
 	sort.Sort(tsmReaders(f.files))
 	return nil
 }
 
+// openTSMReader opens a memory mapped reader of file, closing file if the
+// reader cannot be created. The index of a corrupt file may cause a panic
+// while it is being loaded, which is returned as an error.
+func openTSMReader(file *os.File, keyring *tsdb.Keyring) (r *TSMReader, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = CorruptFileError{Err: fmt.Errorf("corrupt index: %v", e)}
+		}
+		if err != nil {
+			file.Close()
+		}
+	}()
+
+	return NewTSMReaderWithOptions(TSMReaderOptions{
+		MMAPFile: file,
+		Keyring:  keyring,
+	})
+}
+
 func (f *FileStore) Close() error {
 	f.mu.Lock()
 	defer f.mu.Unlock()
@@ -339,7 +434,7 @@ func (f *FileStore) Read(key string, t int64) ([]Value, error) {
 
 	for _, f := range f.files {
 		// Can this file possibly contain this key and timestamp?
-		if !f.Contains(key) {
+		if !f.MayContain(key) || !f.Contains(key) {
 			continue
 		}
 
@@ -406,6 +501,7 @@ func (f *FileStore) Replace(oldFiles, newFiles []string) error {
 
 		tsm, err := NewTSMReaderWithOptions(TSMReaderOptions{
 			MMAPFile: fd,
+			Keyring:  f.keyring,
 		})
 		if err != nil {
 			return err
@@ -499,6 +595,7 @@ func (f *FileStore) locations(key string, t int64, ascending bool) []*location {
 	}
 	f.mu.RUnlock()
 
+	var skips int64
 	for _, fd := range filesSnapshot {
 		minTime, maxTime := fd.TimeRange()
 
@@ -512,6 +609,12 @@ func (f *FileStore) locations(key string, t int64, ascending bool) []*location {
 			continue
 		}
 
+		// Skip searching the index of files whose bloom filter rules the key out.
+		if !fd.MayContain(key) {
+			skips++
+			continue
+		}
+
 		// This file could potential contain points we are looking for so find the blocks for
 		// the given key.
 		for _, ie := range fd.Entries(key) {
@@ -532,6 +635,10 @@ func (f *FileStore) locations(key string, t int64, ascending bool) []*location {
 			})
 		}
 	}
+
+	if skips > 0 {
+		f.statMap.Add(statFileStoreBloomSkips, skips)
+	}
 	return locations
 }
 
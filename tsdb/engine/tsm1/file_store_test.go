@@ -83,6 +83,64 @@ func TestFileStore_SeekToAsc_FromStart(t *testing.T) {
 	}
 }
 
+// Ensure cursors find keys in files with bloom filters.
+func TestFileStore_SeekToAsc_BloomFilter(t *testing.T) {
+	fs := tsm1.NewFileStore("")
+
+	data := []keyValues{
+		keyValues{"cpu", []tsm1.Value{tsm1.NewValue(0, 1.0)}},
+		keyValues{"mem", []tsm1.Value{tsm1.NewValue(1, 2.0)}},
+		keyValues{"cpu", []tsm1.Value{tsm1.NewValue(2, 3.0)}},
+	}
+
+	var files []tsm1.TSMFile
+	for _, v := range data {
+		var b bytes.Buffer
+		w, err := tsm1.NewTSMWriterWithOptions(&b, tsm1.TSMWriterOptions{BloomFilterBitsPerKey: 10})
+		if err != nil {
+			t.Fatalf("unexpected error creating writer: %v", err)
+		} else if err := w.Write(v.key, v.values); err != nil {
+			t.Fatalf("unexpected error writing: %v", err)
+		} else if err := w.WriteIndex(); err != nil {
+			t.Fatalf("unexpected error writing index: %v", err)
+		} else if err := w.Close(); err != nil {
+			t.Fatalf("unexpected error closing: %v", err)
+		}
+
+		r, err := tsm1.NewTSMReader(bytes.NewReader(b.Bytes()))
+		if err != nil {
+			t.Fatalf("unexpected error creating reader: %v", err)
+		} else if r.MayContain("disk") {
+			t.Fatal("expected bloom filter to rule out missing key")
+		}
+		files = append(files, r)
+	}
+	fs.Add(files...)
+
+	buf := make(tsm1.FloatValues, 1000)
+	c := fs.KeyCursor("cpu", 0, true)
+	values, err := c.ReadFloatBlock(buf)
+	if err != nil {
+		t.Fatalf("unexpected error reading values: %v", err)
+	} else if len(values) != 1 || values[0].Value() != 1.0 {
+		t.Fatalf("unexpected values: %v", values)
+	}
+
+	c.Next()
+	values, err = c.ReadFloatBlock(buf)
+	if err != nil {
+		t.Fatalf("unexpected error reading values: %v", err)
+	} else if len(values) != 1 || values[0].Value() != 3.0 {
+		t.Fatalf("unexpected values: %v", values)
+	}
+
+	if typ, err := fs.Type("mem"); err != nil {
+		t.Fatalf("unexpected error reading type: %v", err)
+	} else if typ != tsm1.BlockFloat64 {
+		t.Fatalf("type mismatch: got %v, exp %v", typ, tsm1.BlockFloat64)
+	}
+}
+
 func TestFileStore_SeekToAsc_Duplicate(t *testing.T) {
 	fs := tsm1.NewFileStore("")
 
@@ -0,0 +1,386 @@
+package tsm1
+
+/*
+An index snapshot records the series and fields contributed by a shard's TSM
+files so the in-memory index can be rebuilt on open without reading every key
+in every TSM file.  It is written alongside the TSM files after compactions and
+is only used when its generation matches the current set of TSM files.
+
+┌────────┬────────────┬─────────────────────────────────────────┬──────────┐
+│ Header │ Generation │              Measurements               │ Checksum │
+│5 bytes │  8 bytes   │                 N bytes                 │ 4 bytes  │
+└────────┴────────────┴─────────────────────────────────────────┴──────────┘
+
+The header is a magic number followed by a version number, the same as a TSM
+file.  The generation is a hash of the names and sizes of the TSM files and
+their tombstones at the time the snapshot was written.
+
+The measurements section starts with the number of measurements followed by
+each measurement.  All counts and lengths are unsigned varints.
+
+┌────────────────────────────────────────────────────────────┐
+│                        Measurement                         │
+├──────────┬─────────┬─────────┬─────────┬─────────┬─────────┤
+│ Name Len │  Name   │ Field N │ Fields  │Series N │ Series  │
+│  varint  │ N bytes │ varint  │ N bytes │ varint  │ N bytes │
+└──────────┴─────────┴─────────┴─────────┴─────────┴─────────┘
+
+Each field is the block type of its values followed by the length and name of
+the field.  Each series is the length of its key followed by the key.  Tags are
+not stored as they are parsed from the series key when the snapshot is loaded.
+
+┌──────────────────────────────┐   ┌───────────────────┐
+│            Field             │   │      Series       │
+├────────┬──────────┬──────────┤   ├─────────┬─────────┤
+│  Type  │ Name Len │   Name   │   │ Key Len │   Key   │
+│ 1 byte │  varint  │ N bytes  │   │ varint  │ N bytes │
+└────────┴──────────┴──────────┘   └─────────┴─────────┘
+
+The checksum is a CRC32 of all preceding bytes.
+*/
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/influxdata/influxdb/tsdb"
+)
+
+const (
+	// IndexSnapshotMagicNumber identifies an index snapshot file.
+	IndexSnapshotMagicNumber uint32 = 0x16D116D2
+
+	// IndexSnapshotVersion is the current index snapshot version.
+	IndexSnapshotVersion byte = 1
+
+	// IndexSnapshotFileName is the name of the index snapshot within a shard.
+	IndexSnapshotFileName = "index.snapshot"
+)
+
+var (
+	// ErrIndexSnapshotStale is returned when the snapshot does not match the
+	// current set of TSM files.
+	ErrIndexSnapshotStale = errors.New("index snapshot stale")
+
+	// ErrInvalidIndexSnapshot is returned when a snapshot is corrupt or
+	// has an unknown format.
+	ErrInvalidIndexSnapshot = errors.New("invalid index snapshot")
+)
+
+// IndexSnapshot holds the measurements, fields and series stored in a set
+// of TSM files.
+type IndexSnapshot struct {
+	Generation   uint64
+	Measurements map[string]*IndexSnapshotMeasurement
+}
+
+// IndexSnapshotMeasurement holds the fields and series keys for a measurement.
+type IndexSnapshotMeasurement struct {
+	Fields map[string]byte
+	Series map[string]struct{}
+}
+
+// NewIndexSnapshot returns an empty snapshot for the given file set generation.
+func NewIndexSnapshot(generation uint64) *IndexSnapshot {
+	return &IndexSnapshot{
+		Generation:   generation,
+		Measurements: make(map[string]*IndexSnapshotMeasurement),
+	}
+}
+
+// Add adds a composite series and field key with the given block type.
+func (s *IndexSnapshot) Add(key string, typ byte) {
+	seriesKey, field := SeriesAndFieldFromCompositeKey(key)
+	name := tsdb.MeasurementFromSeriesKey(seriesKey)
+
+	m := s.Measurements[name]
+	if m == nil {
+		m = &IndexSnapshotMeasurement{
+			Fields: make(map[string]byte),
+			Series: make(map[string]struct{}),
+		}
+		s.Measurements[name] = m
+	}
+	if _, ok := m.Fields[field]; !ok {
+		m.Fields[field] = typ
+	}
+	m.Series[seriesKey] = struct{}{}
+}
+
+// Contains returns true if the composite series and field key is in the
+// snapshot.
+func (s *IndexSnapshot) Contains(key string) bool {
+	if s == nil {
+		return false
+	}
+
+	seriesKey, field := SeriesAndFieldFromCompositeKey(key)
+	m := s.Measurements[tsdb.MeasurementFromSeriesKey(seriesKey)]
+	if m == nil {
+		return false
+	}
+
+	_, hasField := m.Fields[field]
+	_, hasSeries := m.Series[seriesKey]
+	return hasField && hasSeries
+}
+
+// WriteTo writes the snapshot to w.
+func (s *IndexSnapshot) WriteTo(w io.Writer) (int64, error) {
+	h := crc32.NewIEEE()
+	bw := bufio.NewWriter(io.MultiWriter(w, h))
+
+	var n int64
+	var buf [binary.MaxVarintLen64]byte
+	write := func(b []byte) error {
+		nn, err := bw.Write(b)
+		n += int64(nn)
+		return err
+	}
+	writeUvarint := func(v uint64) error {
+		return write(buf[:binary.PutUvarint(buf[:], v)])
+	}
+	writeString := func(v string) error {
+		if err := writeUvarint(uint64(len(v))); err != nil {
+			return err
+		}
+		return write([]byte(v))
+	}
+
+	var hdr [13]byte
+	binary.BigEndian.PutUint32(hdr[0:4], IndexSnapshotMagicNumber)
+	hdr[4] = IndexSnapshotVersion
+	binary.BigEndian.PutUint64(hdr[5:13], s.Generation)
+	if err := write(hdr[:]); err != nil {
+		return n, err
+	}
+
+	if err := writeUvarint(uint64(len(s.Measurements))); err != nil {
+		return n, err
+	}
+	for _, name := range sortedKeys(s.Measurements) {
+		m := s.Measurements[name]
+		if err := writeString(name); err != nil {
+			return n, err
+		}
+
+		fields := make([]string, 0, len(m.Fields))
+		for field := range m.Fields {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+
+		if err := writeUvarint(uint64(len(fields))); err != nil {
+			return n, err
+		}
+		for _, field := range fields {
+			if err := write([]byte{m.Fields[field]}); err != nil {
+				return n, err
+			}
+			if err := writeString(field); err != nil {
+				return n, err
+			}
+		}
+
+		keys := make([]string, 0, len(m.Series))
+		for key := range m.Series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		if err := writeUvarint(uint64(len(keys))); err != nil {
+			return n, err
+		}
+		for _, key := range keys {
+			if err := writeString(key); err != nil {
+				return n, err
+			}
+		}
+	}
+
+	if err := bw.Flush(); err != nil {
+		return n, err
+	}
+
+	// The checksum is written directly so it is not included in itself.
+	var checksum [crc32.Size]byte
+	binary.BigEndian.PutUint32(checksum[:], h.Sum32())
+	nn, err := w.Write(checksum[:])
+	n += int64(nn)
+	return n, err
+}
+
+// UnmarshalBinary decodes a snapshot from b.
+func (s *IndexSnapshot) UnmarshalBinary(b []byte) error {
+	if len(b) < 13+crc32.Size {
+		return ErrInvalidIndexSnapshot
+	}
+
+	data, checksum := b[:len(b)-crc32.Size], b[len(b)-crc32.Size:]
+	if binary.BigEndian.Uint32(checksum) != crc32.ChecksumIEEE(data) {
+		return ErrInvalidIndexSnapshot
+	}
+
+	if binary.BigEndian.Uint32(data[0:4]) != IndexSnapshotMagicNumber {
+		return ErrInvalidIndexSnapshot
+	} else if data[4] != IndexSnapshotVersion {
+		return fmt.Errorf("unsupported index snapshot version: %d", data[4])
+	}
+	s.Generation = binary.BigEndian.Uint64(data[5:13])
+	data = data[13:]
+
+	readUvarint := func() (uint64, error) {
+		v, n := binary.Uvarint(data)
+		if n <= 0 {
+			return 0, ErrInvalidIndexSnapshot
+		}
+		data = data[n:]
+		return v, nil
+	}
+	readString := func() (string, error) {
+		sz, err := readUvarint()
+		if err != nil {
+			return "", err
+		} else if uint64(len(data)) < sz {
+			return "", ErrInvalidIndexSnapshot
+		}
+		v := string(data[:sz])
+		data = data[sz:]
+		return v, nil
+	}
+
+	measurementN, err := readUvarint()
+	if err != nil {
+		return err
+	}
+
+	s.Measurements = make(map[string]*IndexSnapshotMeasurement)
+	for i := uint64(0); i < measurementN; i++ {
+		name, err := readString()
+		if err != nil {
+			return err
+		}
+
+		m := &IndexSnapshotMeasurement{
+			Fields: make(map[string]byte),
+			Series: make(map[string]struct{}),
+		}
+
+		fieldN, err := readUvarint()
+		if err != nil {
+			return err
+		}
+		for j := uint64(0); j < fieldN; j++ {
+			if len(data) == 0 {
+				return ErrInvalidIndexSnapshot
+			}
+			typ := data[0]
+			data = data[1:]
+
+			field, err := readString()
+			if err != nil {
+				return err
+			}
+			m.Fields[field] = typ
+		}
+
+		seriesN, err := readUvarint()
+		if err != nil {
+			return err
+		}
+		for j := uint64(0); j < seriesN; j++ {
+			key, err := readString()
+			if err != nil {
+				return err
+			}
+			m.Series[key] = struct{}{}
+		}
+
+		s.Measurements[name] = m
+	}
+
+	if len(data) != 0 {
+		return ErrInvalidIndexSnapshot
+	}
+	return nil
+}
+
+// ReadIndexSnapshot reads the snapshot at path.
+func ReadIndexSnapshot(path string) (*IndexSnapshot, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &IndexSnapshot{}
+	if err := s.UnmarshalBinary(buf); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// WriteIndexSnapshot atomically writes the snapshot to path.
+func WriteIndexSnapshot(path string, s *IndexSnapshot) error {
+	tmpPath := fmt.Sprintf("%s.%s", path, CompactionTempExtension)
+	f, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.WriteTo(f); err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
+
+// fileSetGeneration returns a hash identifying a set of TSM files and their
+// tombstones.  Compactions, new files and deletes all change the generation.
+func fileSetGeneration(files []TSMFile) uint64 {
+	h := fnv.New64a()
+	var buf [8]byte
+	writeStat := func(stat FileStat) {
+		h.Write([]byte(filepath.Base(stat.Path)))
+		binary.BigEndian.PutUint32(buf[:4], stat.Size)
+		h.Write(buf[:4])
+	}
+
+	for _, f := range files {
+		writeStat(FileStat{Path: f.Path(), Size: f.Size()})
+		for _, ts := range f.TombstoneFiles() {
+			writeStat(ts)
+			binary.BigEndian.PutUint64(buf[:], uint64(ts.LastModified))
+			h.Write(buf[:])
+		}
+	}
+	return h.Sum64()
+}
+
+func sortedKeys(m map[string]*IndexSnapshotMeasurement) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
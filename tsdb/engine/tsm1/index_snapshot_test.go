@@ -0,0 +1,55 @@
+package tsm1_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/influxdata/influxdb/tsdb/engine/tsm1"
+)
+
+// Ensure an index snapshot can be encoded and decoded.
+func TestIndexSnapshot_Encode(t *testing.T) {
+	s := tsm1.NewIndexSnapshot(100)
+	s.Add(tsm1.SeriesFieldKey("cpu,host=A", "value"), tsm1.BlockFloat64)
+	s.Add(tsm1.SeriesFieldKey("cpu,host=B", "value"), tsm1.BlockFloat64)
+	s.Add(tsm1.SeriesFieldKey("cpu,host=B", "status"), tsm1.BlockString)
+	s.Add(tsm1.SeriesFieldKey("mem", "free"), tsm1.BlockInteger)
+
+	var buf bytes.Buffer
+	if _, err := s.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var other tsm1.IndexSnapshot
+	if err := other.UnmarshalBinary(buf.Bytes()); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(s, &other) {
+		t.Fatalf("unexpected snapshot: %#v", other)
+	}
+
+	if !other.Contains(tsm1.SeriesFieldKey("cpu,host=B", "status")) {
+		t.Fatal("expected key in snapshot")
+	} else if other.Contains(tsm1.SeriesFieldKey("cpu,host=C", "value")) {
+		t.Fatal("unexpected key in snapshot")
+	}
+}
+
+// Ensure a corrupt index snapshot returns an error.
+func TestIndexSnapshot_UnmarshalBinary_Corrupt(t *testing.T) {
+	s := tsm1.NewIndexSnapshot(1)
+	s.Add(tsm1.SeriesFieldKey("cpu,host=A", "value"), tsm1.BlockFloat64)
+
+	var buf bytes.Buffer
+	if _, err := s.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	b := buf.Bytes()
+	b[len(b)/2]++
+
+	var other tsm1.IndexSnapshot
+	if err := other.UnmarshalBinary(b); err != tsm1.ErrInvalidIndexSnapshot {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -4,11 +4,15 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"math"
 	"os"
 	"sort"
 	"sync"
+
+	"github.com/influxdata/influxdb/pkg/bloom"
+	"github.com/influxdata/influxdb/tsdb"
 )
 
 type TSMReader struct {
@@ -20,6 +24,9 @@ type TSMReader struct {
 	// index is the index of all blocks.
 	index TSMIndex
 
+	// filter is the bloom filter of the keys in the file, if it has one.
+	filter *bloom.Filter
+
 	// tombstoner ensures tombstoned keys are not available by the index.
 	tombstoner *Tombstoner
 
@@ -101,6 +108,7 @@ type blockAccessor interface {
 	readStringBlock(entry *IndexEntry, values []StringValue) ([]StringValue, error)
 	readBooleanBlock(entry *IndexEntry, values []BooleanValue) ([]BooleanValue, error)
 	readBytes(entry *IndexEntry, buf []byte) ([]byte, error)
+	bloomFilter() *bloom.Filter
 	path() string
 	close() error
 }
@@ -111,6 +119,9 @@ type TSMReaderOptions struct {
 
 	// MMAPFile is used to create an MMAP based reader.
 	MMAPFile *os.File
+
+	// Keyring holds the keys to decrypt encrypted files with.
+	Keyring *tsdb.Keyring
 }
 
 func NewTSMReader(r io.ReadSeeker) (*TSMReader, error) {
@@ -138,7 +149,8 @@ func NewTSMReaderWithOptions(opt TSMReaderOptions) (*TSMReader, error) {
 			t.lastModified = stat.ModTime().UnixNano()
 		}
 		t.accessor = &fileAccessor{
-			r: opt.Reader,
+			r:       opt.Reader,
+			keyring: opt.Keyring,
 		}
 
 	} else if opt.MMAPFile != nil {
@@ -149,7 +161,8 @@ func NewTSMReaderWithOptions(opt TSMReaderOptions) (*TSMReader, error) {
 		t.size = stat.Size()
 		t.lastModified = stat.ModTime().UnixNano()
 		t.accessor = &mmapAccessor{
-			f: opt.MMAPFile,
+			f:       opt.MMAPFile,
+			keyring: opt.Keyring,
 		}
 	} else {
 		panic("invalid options: need Reader or MMAPFile")
@@ -161,6 +174,7 @@ func NewTSMReaderWithOptions(opt TSMReaderOptions) (*TSMReader, error) {
 	}
 
 	t.index = index
+	t.filter = t.accessor.bloomFilter()
 	t.tombstoner = &Tombstoner{Path: t.Path()}
 
 	if err := t.applyTombstones(); err != nil {
@@ -284,6 +298,18 @@ func (t *TSMReader) Contains(key string) bool {
 	return t.index.Contains(key)
 }
 
+// MayContain returns false if the bloom filter of the file shows it does not
+// contain key, without searching the index.  Files without a bloom filter
+// may contain any key.
+func (t *TSMReader) MayContain(key string) bool {
+	return t.filter == nil || t.filter.ContainsString(key)
+}
+
+// HasBloomFilter returns true if the file has a bloom filter of its keys.
+func (t *TSMReader) HasBloomFilter() bool {
+	return t.filter != nil
+}
+
 // ContainsValue returns true if key and time might exists in this file.  This function could
 // return true even though the actual point does not exists.  For example, the key may
 // exists in this file, but not have point exactly at time t.
@@ -711,6 +737,12 @@ type fileAccessor struct {
 	mu    sync.Mutex
 	r     io.ReadSeeker
 	index TSMIndex
+
+	// key decrypts the blocks and index of an encrypted file.
+	keyring *tsdb.Keyring
+	key     *tsdb.EncryptionKey
+
+	filter *bloom.Filter
 }
 
 func (f *fileAccessor) init() (TSMIndex, error) {
@@ -718,7 +750,11 @@ func (f *fileAccessor) init() (TSMIndex, error) {
 	defer f.mu.Unlock()
 
 	// Verify it's a TSM file of the right version
-	if err := verifyVersion(f.r); err != nil {
+	keyID, err := verifyVersion(f.r)
+	if err != nil {
+		return nil, err
+	}
+	if f.key, err = encryptionKey(f.keyring, keyID); err != nil {
 		return nil, err
 	}
 
@@ -746,6 +782,8 @@ func (f *fileAccessor) init() (TSMIndex, error) {
 
 	indexStart := int64(binary.BigEndian.Uint64(b))
 
+	f.filter = f.readBloomFilter(indexStart)
+
 	_, err = f.r.Seek(indexStart, os.SEEK_SET)
 	if err != nil {
 		return nil, fmt.Errorf("init: failed to seek to index: %v", err)
@@ -760,6 +798,12 @@ func (f *fileAccessor) init() (TSMIndex, error) {
 		return nil, fmt.Errorf("init: read index: %v", err)
 	}
 
+	if f.key != nil {
+		if b, err = f.key.Open(nil, b, offsetAD(indexStart)); err != nil {
+			return nil, fmt.Errorf("init: decrypt index: %v", err)
+		}
+	}
+
 	if err := f.index.UnmarshalBinary(b); err != nil {
 		return nil, fmt.Errorf("init: unmarshal error: %v", err)
 	}
@@ -767,6 +811,38 @@ func (f *fileAccessor) init() (TSMIndex, error) {
 	return f.index, nil
 }
 
+// readBloomFilter reads the bloom filter preceding the index at indexStart.
+// Returns nil if the file has no bloom filter or it cannot be read.
+func (f *fileAccessor) readBloomFilter(indexStart int64) *bloom.Filter {
+	if indexStart < bloomTrailerSize {
+		return nil
+	}
+
+	trailer := make([]byte, bloomTrailerSize)
+	if _, err := f.r.Seek(indexStart-bloomTrailerSize, os.SEEK_SET); err != nil {
+		return nil
+	} else if _, err := io.ReadFull(f.r, trailer); err != nil {
+		return nil
+	}
+
+	offset, length, checksum, ok := parseBloomTrailer(trailer, indexStart)
+	if !ok {
+		return nil
+	}
+
+	b := make([]byte, length)
+	if _, err := f.r.Seek(offset, os.SEEK_SET); err != nil {
+		return nil
+	} else if _, err := io.ReadFull(f.r, b); err != nil {
+		return nil
+	}
+	return decodeBloomFilter(b, offset, checksum, f.key)
+}
+
+func (f *fileAccessor) bloomFilter() *bloom.Filter {
+	return f.filter
+}
+
 func (f *fileAccessor) read(key string, timestamp int64) ([]Value, error) {
 	entry := f.index.Entry(key, timestamp)
 
@@ -875,6 +951,9 @@ func (f *fileAccessor) readBytes(entry *IndexEntry, b []byte) ([]byte, error) {
 		return nil, err
 	}
 
+	if f.key != nil {
+		return f.key.Open(nil, b[4:n], offsetAD(entry.Offset))
+	}
 	return b[4:n], nil
 }
 
@@ -937,17 +1016,25 @@ type mmapAccessor struct {
 	f     *os.File
 	b     []byte
 	index TSMIndex
+
+	// key decrypts the blocks and index of an encrypted file.
+	keyring *tsdb.Keyring
+	key     *tsdb.EncryptionKey
+
+	filter *bloom.Filter
 }
 
 func (m *mmapAccessor) init() (TSMIndex, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	if err := verifyVersion(m.f); err != nil {
+	keyID, err := verifyVersion(m.f)
+	if err != nil {
+		return nil, err
+	}
+	if m.key, err = encryptionKey(m.keyring, keyID); err != nil {
 		return nil, err
 	}
-
-	var err error
 
 	if _, err := m.f.Seek(0, 0); err != nil {
 		return nil, err
@@ -966,9 +1053,27 @@ func (m *mmapAccessor) init() (TSMIndex, error) {
 	indexOfsPos := len(m.b) - 8
 	indexStart := binary.BigEndian.Uint64(m.b[indexOfsPos : indexOfsPos+8])
 
+	if indexStart >= bloomTrailerSize && indexStart <= uint64(indexOfsPos) {
+		trailer := m.b[indexStart-bloomTrailerSize : indexStart]
+		if offset, length, checksum, ok := parseBloomTrailer(trailer, int64(indexStart)); ok {
+			m.filter = decodeBloomFilter(m.b[offset:offset+int64(length)], offset, checksum, m.key)
+		}
+	}
+
+	if indexStart > uint64(indexOfsPos) {
+		return nil, CorruptFileError{Err: fmt.Errorf("init: invalid index offset: %d", indexStart)}
+	}
+
+	index := m.b[indexStart:indexOfsPos]
+	if m.key != nil {
+		if index, err = m.key.Open(nil, index, offsetAD(int64(indexStart))); err != nil {
+			return nil, CorruptFileError{Err: fmt.Errorf("init: decrypt index: %v", err)}
+		}
+	}
+
 	m.index = NewIndirectIndex()
-	if err := m.index.UnmarshalBinary(m.b[indexStart:indexOfsPos]); err != nil {
-		return nil, err
+	if err := m.index.UnmarshalBinary(index); err != nil {
+		return nil, CorruptFileError{Err: err}
 	}
 
 	return m.index, nil
@@ -991,8 +1096,11 @@ func (m *mmapAccessor) readBlock(entry *IndexEntry, values []Value) ([]Value, er
 		return nil, ErrTSMClosed
 	}
 	//TODO: Validate checksum
-	var err error
-	values, err = DecodeBlock(m.b[entry.Offset+4:entry.Offset+int64(entry.Size)], values)
+	b, err := m.block(entry)
+	if err != nil {
+		return nil, err
+	}
+	values, err = DecodeBlock(b, values)
 	if err != nil {
 		return nil, err
 	}
@@ -1008,8 +1116,11 @@ func (m *mmapAccessor) readFloatBlock(entry *IndexEntry, values []FloatValue) ([
 		return nil, ErrTSMClosed
 	}
 	//TODO: Validate checksum
-	var err error
-	values, err = DecodeFloatBlock(m.b[entry.Offset+4:entry.Offset+int64(entry.Size)], values)
+	b, err := m.block(entry)
+	if err != nil {
+		return nil, err
+	}
+	values, err = DecodeFloatBlock(b, values)
 	if err != nil {
 		return nil, err
 	}
@@ -1025,8 +1136,11 @@ func (m *mmapAccessor) readIntegerBlock(entry *IndexEntry, values []IntegerValue
 		return nil, ErrTSMClosed
 	}
 	//TODO: Validate checksum
-	var err error
-	values, err = DecodeIntegerBlock(m.b[entry.Offset+4:entry.Offset+int64(entry.Size)], values)
+	b, err := m.block(entry)
+	if err != nil {
+		return nil, err
+	}
+	values, err = DecodeIntegerBlock(b, values)
 	if err != nil {
 		return nil, err
 	}
@@ -1042,8 +1156,11 @@ func (m *mmapAccessor) readStringBlock(entry *IndexEntry, values []StringValue)
 		return nil, ErrTSMClosed
 	}
 	//TODO: Validate checksum
-	var err error
-	values, err = DecodeStringBlock(m.b[entry.Offset+4:entry.Offset+int64(entry.Size)], values)
+	b, err := m.block(entry)
+	if err != nil {
+		return nil, err
+	}
+	values, err = DecodeStringBlock(b, values)
 	if err != nil {
 		return nil, err
 	}
@@ -1059,8 +1176,11 @@ func (m *mmapAccessor) readBooleanBlock(entry *IndexEntry, values []BooleanValue
 		return nil, ErrTSMClosed
 	}
 	//TODO: Validate checksum
-	var err error
-	values, err = DecodeBooleanBlock(m.b[entry.Offset+4:entry.Offset+int64(entry.Size)], values)
+	b, err := m.block(entry)
+	if err != nil {
+		return nil, err
+	}
+	values, err = DecodeBooleanBlock(b, values)
 	if err != nil {
 		return nil, err
 	}
@@ -1076,8 +1196,18 @@ func (m *mmapAccessor) readBytes(entry *IndexEntry, b []byte) ([]byte, error) {
 		return nil, ErrTSMClosed
 	}
 
+	return m.block(entry)
+}
+
+// block returns the data of the block at entry, decrypted if the file is
+// encrypted.  The read lock must be held.
+func (m *mmapAccessor) block(entry *IndexEntry) ([]byte, error) {
 	// return the bytes after the 4 byte checksum
-	return m.b[entry.Offset+4 : entry.Offset+int64(entry.Size)], nil
+	b := m.b[entry.Offset+4 : entry.Offset+int64(entry.Size)]
+	if m.key != nil {
+		return m.key.Open(nil, b, offsetAD(entry.Offset))
+	}
+	return b, nil
 }
 
 // ReadAll returns all values for a key in all blocks.
@@ -1096,8 +1226,12 @@ func (m *mmapAccessor) readAll(key string) ([]Value, error) {
 	for _, block := range blocks {
 		//TODO: Validate checksum
 		temp = temp[:0]
-		// The +4 is the 4 byte checksum length
-		temp, err = DecodeBlock(m.b[block.Offset+4:block.Offset+int64(block.Size)], temp)
+		var b []byte
+		b, err = m.block(block)
+		if err != nil {
+			return nil, err
+		}
+		temp, err = DecodeBlock(b, temp)
 		if err != nil {
 			return nil, err
 		}
@@ -1107,6 +1241,10 @@ func (m *mmapAccessor) readAll(key string) ([]Value, error) {
 	return values, nil
 }
 
+func (m *mmapAccessor) bloomFilter() *bloom.Filter {
+	return m.filter
+}
+
 func (m *mmapAccessor) path() string {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -1131,6 +1269,62 @@ func (m *mmapAccessor) close() error {
 	return m.f.Close()
 }
 
+// decodeBloomFilter decodes the bloom filter b read from offset, decrypting
+// it if key is set.  Returns nil if the filter is corrupt, since a file
+// without a filter is still readable.
+func decodeBloomFilter(b []byte, offset int64, checksum uint32, key *tsdb.EncryptionKey) *bloom.Filter {
+	if crc32.ChecksumIEEE(b) != checksum {
+		return nil
+	}
+
+	if key != nil {
+		var err error
+		if b, err = key.Open(nil, b, offsetAD(offset)); err != nil {
+			return nil
+		}
+	}
+
+	filter := &bloom.Filter{}
+	if err := filter.UnmarshalBinary(b); err != nil {
+		return nil
+	}
+	return filter
+}
+
+// CorruptFileError is returned when a TSM file cannot be opened because its
+// header or index is corrupt, as opposed to the file not being readable.
+type CorruptFileError struct {
+	Err error
+}
+
+func (e CorruptFileError) Error() string { return e.Err.Error() }
+
+// EncryptionKeyError is returned when a file is encrypted with a key that is
+// not in the keyring.
+type EncryptionKeyError struct {
+	KeyID string
+}
+
+func (e EncryptionKeyError) Error() string {
+	return fmt.Sprintf("init: file is encrypted with key %q which is not configured", e.KeyID)
+}
+
+// encryptionKey returns the key in keyring a file is encrypted with, or nil
+// if the file is not encrypted.
+func encryptionKey(keyring *tsdb.Keyring, id string) (*tsdb.EncryptionKey, error) {
+	if id == "" {
+		return nil, nil
+	} else if keyring == nil {
+		return nil, EncryptionKeyError{KeyID: id}
+	}
+
+	key, err := keyring.Key(id)
+	if err != nil {
+		return nil, EncryptionKeyError{KeyID: id}
+	}
+	return key, nil
+}
+
 type indexEntries struct {
 	Type    byte
 	entries []*IndexEntry
@@ -2,10 +2,13 @@ package tsm1_test
 
 import (
 	"bytes"
+	"crypto/rand"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"testing"
 
+	"github.com/influxdata/influxdb/tsdb"
 	"github.com/influxdata/influxdb/tsdb/engine/tsm1"
 )
 
@@ -429,6 +432,144 @@ func TestTSMReader_VerifiesFileType(t *testing.T) {
 	}
 }
 
+// Ensure encrypted files are readable with their key through both accessors.
+func TestTSMReader_Encrypted(t *testing.T) {
+	dir := MustTempDir()
+	defer os.RemoveAll(dir)
+	f := MustTempFile(dir)
+	defer f.Close()
+
+	keyring := MustKeyring("k1")
+	w, err := tsm1.NewEncryptedTSMWriter(f, keyring.Current())
+	if err != nil {
+		t.Fatalf("unexpected error creating writer: %v", err)
+	}
+
+	values := []tsm1.Value{tsm1.NewValue(1, 1.5), tsm1.NewValue(2, 2.5)}
+	if err := w.Write("cpu,host=secret#!~#value", values); err != nil {
+		t.Fatalf("unexpected error writing: %v", err)
+	}
+	if err := w.WriteIndex(); err != nil {
+		t.Fatalf("unexpected error writing index: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("unexpected error closing: %v", err)
+	}
+
+	b, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	} else if bytes.Contains(b, []byte("secret")) {
+		t.Fatal("expected series key to be encrypted")
+	}
+
+	for _, opt := range []tsm1.TSMReaderOptions{
+		{MMAPFile: MustOpenFile(f.Name()), Keyring: keyring},
+		{Reader: MustOpenFile(f.Name()), Keyring: keyring},
+	} {
+		r, err := tsm1.NewTSMReaderWithOptions(opt)
+		if err != nil {
+			t.Fatalf("unexpected error created reader: %v", err)
+		}
+
+		readValues, err := r.ReadAll("cpu,host=secret#!~#value")
+		if err != nil {
+			t.Fatalf("unexpected error reading: %v", err)
+		} else if len(readValues) != len(values) {
+			t.Fatalf("read values length mismatch: got %v, exp %v", len(readValues), len(values))
+		}
+		for i, v := range values {
+			assertValueEqual(t, readValues[i], v)
+		}
+		r.Close()
+	}
+
+	// Opening without the key fails.
+	fd := MustOpenFile(f.Name())
+	defer fd.Close()
+	if _, err := tsm1.NewTSMReaderWithOptions(tsm1.TSMReaderOptions{MMAPFile: fd, Keyring: MustKeyring("k2")}); err == nil {
+		t.Fatal("expected error opening file without its key")
+	} else if e, ok := err.(tsm1.EncryptionKeyError); !ok || e.KeyID != "k1" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure the bloom filter of a file is read by both accessors and rules out
+// keys the file does not contain.
+func TestTSMReader_BloomFilter(t *testing.T) {
+	dir := MustTempDir()
+	defer os.RemoveAll(dir)
+
+	keyring := MustKeyring("k1")
+	for _, opt := range []tsm1.TSMWriterOptions{
+		{BloomFilterBitsPerKey: 10},
+		{BloomFilterBitsPerKey: 10, Key: keyring.Current()},
+	} {
+		f := MustTempFile(dir)
+		w, err := tsm1.NewTSMWriterWithOptions(f, opt)
+		if err != nil {
+			t.Fatalf("unexpected error creating writer: %v", err)
+		}
+		for i := 0; i < 100; i++ {
+			if err := w.Write(fmt.Sprintf("cpu,host=server%03d#!~#value", i), []tsm1.Value{tsm1.NewValue(1, float64(i))}); err != nil {
+				t.Fatalf("unexpected error writing: %v", err)
+			}
+		}
+		if err := w.WriteIndex(); err != nil {
+			t.Fatalf("unexpected error writing index: %v", err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("unexpected error closing: %v", err)
+		}
+
+		// Files with a bloom filter remain valid for tools that ignore it.
+		if errs, err := tsm1.VerifyTSMFile(f.Name(), keyring); err != nil || len(errs) != 0 {
+			t.Fatalf("unexpected verify errors: %v %v", err, errs)
+		}
+
+		for _, ropt := range []tsm1.TSMReaderOptions{
+			{MMAPFile: MustOpenFile(f.Name()), Keyring: keyring},
+			{Reader: MustOpenFile(f.Name()), Keyring: keyring},
+		} {
+			r, err := tsm1.NewTSMReaderWithOptions(ropt)
+			if err != nil {
+				t.Fatalf("unexpected error created reader: %v", err)
+			} else if !r.HasBloomFilter() {
+				t.Fatal("expected bloom filter")
+			}
+
+			var skipped int
+			for i := 0; i < 100; i++ {
+				if !r.MayContain(fmt.Sprintf("cpu,host=server%03d#!~#value", i)) {
+					t.Fatalf("expected file to contain key %d", i)
+				}
+				if !r.MayContain(fmt.Sprintf("mem,host=server%03d#!~#value", i)) {
+					skipped++
+				}
+			}
+			if skipped < 90 {
+				t.Fatalf("expected bloom filter to rule out most keys, ruled out %d", skipped)
+			}
+
+			if values, err := r.ReadAll("cpu,host=server042#!~#value"); err != nil {
+				t.Fatalf("unexpected error reading: %v", err)
+			} else if len(values) != 1 || values[0].Value() != float64(42) {
+				t.Fatalf("unexpected values: %v", values)
+			}
+			r.Close()
+		}
+	}
+
+	// Files without a bloom filter may contain any key.
+	r := MustTSMReader(dir, 1, map[string][]tsm1.Value{"cpu": []tsm1.Value{tsm1.NewValue(1, 1.0)}})
+	defer r.Close()
+	if r.HasBloomFilter() {
+		t.Fatal("expected no bloom filter")
+	} else if !r.MayContain("mem") {
+		t.Fatal("expected file without bloom filter to possibly contain any key")
+	}
+}
+
 func TestIndirectIndex_Entries(t *testing.T) {
 	index := tsm1.NewDirectIndex()
 	index.Add("cpu", tsm1.BlockFloat64, 0, 1, 10, 100)
@@ -995,3 +1136,26 @@ func BenchmarkIndirectIndex_UnmarshalBinary(b *testing.B) {
 		}
 	}
 }
+
+// MustKeyring returns a keyring of random keys with ids. The last is current.
+func MustKeyring(ids ...string) *tsdb.Keyring {
+	k := tsdb.NewKeyring()
+	for _, id := range ids {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			panic(err)
+		}
+		if err := k.Add(id, key); err != nil {
+			panic(err)
+		}
+	}
+	return k
+}
+
+func MustOpenFile(name string) *os.File {
+	f, err := os.Open(name)
+	if err != nil {
+		panic(fmt.Sprintf("open file: %v", err))
+	}
+	return f
+}
@@ -0,0 +1,132 @@
+package tsm1
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/influxdata/influxdb/tsdb"
+)
+
+// QuarantineExtension is appended to the name of corrupt TSM files that have
+// been moved out of the way so they are no longer loaded.
+const QuarantineExtension = "quarantine"
+
+// RepairTSMFile rewrites the TSM file at path without any blocks that fail
+// verification, rebuilding its index from the blocks that remain. The
+// original file is kept next to the repaired one with the QuarantineExtension
+// appended. If no blocks can be salvaged, the file is only quarantined.
+// Encrypted files are decrypted with the keys in keyring and the repaired
+// file is encrypted with the same key.
+//
+// Returns the problems found, which identify the series and time ranges
+// lost. A file without problems is left untouched. An error is returned if
+// the file cannot be repaired, such as when its index cannot be found.
+func RepairTSMFile(path string, keyring *tsdb.Keyring) ([]VerifyError, error) {
+	problems, err := VerifyTSMFile(path, keyring)
+	if err != nil {
+		return nil, err
+	} else if len(problems) == 0 {
+		return nil, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	} else if stat.Size() == 0 {
+		return problems, QuarantineTSMFile(path)
+	}
+
+	b, err := mmap(f, 0, int(stat.Size()))
+	if err != nil {
+		return nil, err
+	}
+	defer munmap(b)
+
+	tmpPath := path + ".repair.tmp"
+	n, err := writeRepairedTSM(b, keyring, tmpPath)
+	if err != nil {
+		os.Remove(tmpPath)
+		return nil, err
+	}
+
+	if err := QuarantineTSMFile(path); err != nil {
+		os.Remove(tmpPath)
+		return nil, err
+	}
+
+	// Nothing could be salvaged so there is no file to replace the original.
+	if n == 0 {
+		os.Remove(tmpPath)
+		return problems, nil
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return nil, err
+	}
+	return problems, syncDir(filepath.Dir(path))
+}
+
+// writeRepairedTSM writes every valid block of the TSM file in b to a new
+// file at path. Returns the number of blocks written.
+func writeRepairedTSM(b []byte, keyring *tsdb.Keyring, path string) (int, error) {
+	_, ek, err := parseTSMHeader(b, keyring)
+	if err != nil {
+		return 0, fmt.Errorf("cannot repair: %s", err)
+	}
+
+	fd, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_EXCL, 0666)
+	if err != nil {
+		return 0, err
+	}
+	defer fd.Close()
+
+	w, err := NewTSMWriterWithOptions(fd, TSMWriterOptions{Key: ek})
+	if err != nil {
+		return 0, err
+	}
+
+	var n int
+	var werr error
+	if _, err := walkTSM(b, keyring, func(key string, typ byte, e *IndexEntry, block []byte, ek *tsdb.EncryptionKey) {
+		if werr != nil || verifyBlock(block, typ, e, ek) != nil {
+			return
+		}
+
+		var data []byte
+		if data, werr = openBlock(block, e, ek); werr != nil {
+			return
+		}
+		if werr = w.WriteBlock(key, e.MinTime, e.MaxTime, data); werr == nil {
+			n++
+		}
+	}); err != nil {
+		return 0, fmt.Errorf("cannot repair: %s", err)
+	} else if werr != nil {
+		return 0, werr
+	} else if n == 0 {
+		return 0, nil
+	}
+
+	if err := w.WriteIndex(); err != nil {
+		return 0, err
+	} else if err := w.Close(); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// QuarantineTSMFile moves a TSM file out of the way by appending the
+// QuarantineExtension to its name.
+func QuarantineTSMFile(path string) error {
+	if err := os.Rename(path, path+"."+QuarantineExtension); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
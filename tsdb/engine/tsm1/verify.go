@@ -0,0 +1,303 @@
+package tsm1
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/influxdata/influxdb/tsdb"
+)
+
+// VerifyError describes a problem found while verifying a TSM file.
+type VerifyError struct {
+	// Key the problem was found in. Empty if the problem affects the whole
+	// file, such as a corrupt header or footer.
+	Key string
+
+	// Time range, position and size of the block the problem was found in.
+	// Zero if the problem isn't specific to a block.
+	MinTime, MaxTime int64
+	Offset           int64
+	Size             uint32
+
+	Err error
+}
+
+// Error returns a string representation of the problem.
+func (e VerifyError) Error() string {
+	if e.Key == "" {
+		return e.Err.Error()
+	} else if e.Size == 0 {
+		return fmt.Sprintf("%s: %s", e.Key, e.Err)
+	}
+	return fmt.Sprintf("%s: block at %d (%d bytes, %d-%d): %s", e.Key, e.Offset, e.Size, e.MinTime, e.MaxTime, e.Err)
+}
+
+// VerifyTSMFile checks the header, footer and index of the TSM file at path
+// along with the checksum and encoding of every block and the file's
+// tombstones. The file is parsed directly rather than through a TSMReader so
+// that corrupt data is reported rather than trusted. Encrypted files are
+// decrypted with the keys in keyring. Returns every problem found. An error
+// is only returned if the file could not be read, such as when it is
+// encrypted with a key that is not in keyring.
+func VerifyTSMFile(path string, keyring *tsdb.Keyring) ([]VerifyError, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []VerifyError
+	if stat.Size() < 5+8 {
+		errs = append(errs, VerifyError{Err: fmt.Errorf("file too short: %d bytes", stat.Size())})
+	} else {
+		b, err := mmap(f, 0, int(stat.Size()))
+		if err != nil {
+			return nil, err
+		}
+		defer munmap(b)
+
+		if _, _, err := parseTSMHeader(b, keyring); isEncryptionKeyError(err) {
+			return nil, err
+		}
+		errs = verifyTSM(b, keyring)
+	}
+
+	tombstoneErrs, err := verifyTombstone(path)
+	if err != nil {
+		return nil, err
+	}
+	return append(errs, tombstoneErrs...), nil
+}
+
+// verifyTSM checks the contents of a TSM file.
+func verifyTSM(b []byte, keyring *tsdb.Keyring) []VerifyError {
+	var errs []VerifyError
+	walkErrs, err := walkTSM(b, keyring, func(key string, typ byte, e *IndexEntry, block []byte, ek *tsdb.EncryptionKey) {
+		if err := verifyBlock(block, typ, e, ek); err != nil {
+			errs = append(errs, VerifyError{Key: key, MinTime: e.MinTime, MaxTime: e.MaxTime, Offset: e.Offset, Size: e.Size, Err: err})
+		}
+	})
+	if err != nil {
+		return []VerifyError{{Err: err}}
+	}
+	return append(walkErrs, errs...)
+}
+
+// parseTSMHeader parses the header of the TSM file in b. Returns the size of
+// the header and the key the file is encrypted with, or nil if the file is
+// not encrypted.
+func parseTSMHeader(b []byte, keyring *tsdb.Keyring) (int, *tsdb.EncryptionKey, error) {
+	if len(b) < 5+8 {
+		return 0, nil, fmt.Errorf("file too short: %d bytes", len(b))
+	} else if magic := binary.BigEndian.Uint32(b[:4]); magic != MagicNumber {
+		return 0, nil, fmt.Errorf("invalid magic number: %x", magic)
+	}
+
+	switch b[4] {
+	case Version:
+		return 5, nil, nil
+	case EncryptedVersion:
+	default:
+		return 0, nil, fmt.Errorf("unsupported version: %d", b[4])
+	}
+
+	n := int(b[5])
+	if n == 0 || 6+n > len(b) {
+		return 0, nil, fmt.Errorf("invalid key id length: %d", n)
+	}
+	ek, err := encryptionKey(keyring, string(b[6:6+n]))
+	if err != nil {
+		return 0, nil, err
+	}
+	return 6 + n, ek, nil
+}
+
+// isEncryptionKeyError returns true if err is caused by a file being
+// encrypted with a key that is not configured.
+func isEncryptionKeyError(err error) bool {
+	_, ok := err.(EncryptionKeyError)
+	return ok
+}
+
+// walkTSM parses the header, index and footer of the TSM file in b and calls
+// fn with every index entry whose block lies within the data section, in
+// index order. block holds the block prefixed with its checksum, and is
+// still encrypted with ek if the file is encrypted. Problems with the index
+// are returned as VerifyErrors, parsing as much of the index as possible. An
+// error is returned if the index cannot be found at all.
+func walkTSM(b []byte, keyring *tsdb.Keyring, fn func(key string, typ byte, e *IndexEntry, block []byte, ek *tsdb.EncryptionKey)) ([]VerifyError, error) {
+	headerSize, ek, err := parseTSMHeader(b, keyring)
+	if err != nil {
+		return nil, err
+	}
+
+	// The footer holds the position of the index, which must lie between the
+	// header and the footer.
+	indexEnd := int64(len(b) - 8)
+	indexStart := int64(binary.BigEndian.Uint64(b[indexEnd:]))
+	if indexStart < int64(headerSize) || indexStart >= indexEnd {
+		return nil, fmt.Errorf("invalid index offset in footer: %d", indexStart)
+	}
+
+	var errs []VerifyError
+	idx := b[indexStart:indexEnd]
+	if ek != nil {
+		if idx, err = ek.Open(nil, idx, offsetAD(indexStart)); err != nil {
+			return nil, fmt.Errorf("unable to decrypt index: %s", err)
+		}
+	}
+	var prevKey string
+	for i, n := 0, 0; i < len(idx); n++ {
+		if i+2 > len(idx) {
+			errs = append(errs, VerifyError{Err: fmt.Errorf("index truncated after %d keys", n)})
+			break
+		}
+		keyLen := int(binary.BigEndian.Uint16(idx[i:]))
+		i += 2
+
+		if i+keyLen+indexTypeSize+indexCountSize > len(idx) {
+			errs = append(errs, VerifyError{Err: fmt.Errorf("index truncated after %d keys", n)})
+			break
+		}
+		key := string(idx[i : i+keyLen])
+		i += keyLen
+
+		typ := idx[i]
+		i += indexTypeSize
+
+		count := int(binary.BigEndian.Uint16(idx[i:]))
+		i += indexCountSize
+
+		if n > 0 && key <= prevKey {
+			errs = append(errs, VerifyError{Key: key, Err: fmt.Errorf("key out of order after %s", prevKey)})
+		}
+		prevKey = key
+
+		if count == 0 {
+			errs = append(errs, VerifyError{Key: key, Err: fmt.Errorf("no index entries")})
+		}
+
+		if i+count*indexEntrySize > len(idx) {
+			errs = append(errs, VerifyError{Key: key, Err: fmt.Errorf("index truncated: %d entries expected", count)})
+			break
+		}
+
+		var prev IndexEntry
+		for j := 0; j < count; j++ {
+			var e IndexEntry
+			e.UnmarshalBinary(idx[i : i+indexEntrySize])
+			i += indexEntrySize
+
+			verr := VerifyError{Key: key, MinTime: e.MinTime, MaxTime: e.MaxTime, Offset: e.Offset, Size: e.Size}
+			if e.MinTime > e.MaxTime {
+				verr.Err = fmt.Errorf("min time after max time")
+				errs = append(errs, verr)
+			} else if j > 0 && e.MinTime < prev.MinTime {
+				verr.Err = fmt.Errorf("entry out of order after %d-%d", prev.MinTime, prev.MaxTime)
+				errs = append(errs, verr)
+			}
+			prev = e
+
+			// Blocks must lie between the header and the index and hold at
+			// least a checksum and a block type.
+			if e.Offset < int64(headerSize) || e.Size < 5 || e.Offset+int64(e.Size) > indexStart {
+				verr.Err = fmt.Errorf("block outside of data section")
+				errs = append(errs, verr)
+				continue
+			}
+
+			fn(key, typ, &e, b[e.Offset:e.Offset+int64(e.Size)], ek)
+		}
+	}
+	return errs, nil
+}
+
+// verifyBlock checks the checksum, type and timestamps of a single block. b
+// holds the block prefixed with its checksum, encrypted with ek if set.
+func verifyBlock(b []byte, typ byte, e *IndexEntry, ek *tsdb.EncryptionKey) (err error) {
+	if sum := crc32.ChecksumIEEE(b[4:]); sum != binary.BigEndian.Uint32(b[:4]) {
+		return fmt.Errorf("checksum mismatch: %x != %x", sum, binary.BigEndian.Uint32(b[:4]))
+	}
+
+	block, err := openBlock(b, e, ek)
+	if err != nil {
+		return err
+	} else if len(block) == 0 {
+		return fmt.Errorf("block is empty")
+	}
+
+	if blockType, err := BlockType(block); err != nil {
+		return err
+	} else if blockType != typ {
+		return fmt.Errorf("block type %d does not match index type %d", blockType, typ)
+	}
+
+	// The decoders assume well formed input, so treat a panic as corruption.
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("unable to decode block: %v", r)
+		}
+	}()
+
+	values, err := DecodeBlock(block, nil)
+	if err != nil {
+		return fmt.Errorf("unable to decode block: %s", err)
+	} else if len(values) == 0 {
+		return fmt.Errorf("block has no values")
+	}
+
+	for i, v := range values {
+		if t := v.UnixNano(); t < e.MinTime || t > e.MaxTime {
+			return fmt.Errorf("value time %d outside of block time range", t)
+		} else if i > 0 && t <= values[i-1].UnixNano() {
+			return fmt.Errorf("value time %d out of order", t)
+		}
+	}
+	return nil
+}
+
+// openBlock returns the data of the block b, which is prefixed with its
+// checksum, decrypting it with ek if set.
+func openBlock(b []byte, e *IndexEntry, ek *tsdb.EncryptionKey) ([]byte, error) {
+	if ek == nil {
+		return b[4:], nil
+	}
+
+	block, err := ek.Open(nil, b[4:], offsetAD(e.Offset))
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt block: %s", err)
+	}
+	return block, nil
+}
+
+// verifyTombstone checks the tombstone file of the TSM file at path, if any.
+func verifyTombstone(path string) ([]VerifyError, error) {
+	t := &Tombstoner{Path: path}
+	b, err := ioutil.ReadFile(t.tombstonePath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if strings.TrimSpace(string(b)) == "" {
+		return nil, nil
+	}
+
+	var errs []VerifyError
+	for i, key := range strings.Split(string(b), "\n") {
+		if key == "" {
+			errs = append(errs, VerifyError{Err: fmt.Errorf("tombstone: empty key on line %d", i+1)})
+		}
+	}
+	return errs, nil
+}
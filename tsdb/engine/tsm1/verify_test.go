@@ -0,0 +1,268 @@
+package tsm1_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/influxdata/influxdb/tsdb"
+	"github.com/influxdata/influxdb/tsdb/engine/tsm1"
+)
+
+func TestVerifyTSMFile(t *testing.T) {
+	dir := MustTempDir()
+	defer os.RemoveAll(dir)
+
+	path := MustWriteVerifyTSM(dir, nil)
+	errs, err := tsm1.VerifyTSMFile(path, nil)
+	if err != nil {
+		fatal(t, "verifying file", err)
+	} else if len(errs) != 0 {
+		t.Fatalf("unexpected problems: %v", errs)
+	}
+}
+
+func TestVerifyTSMFile_Checksum(t *testing.T) {
+	dir := MustTempDir()
+	defer os.RemoveAll(dir)
+
+	path := MustWriteVerifyTSM(dir, nil)
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		fatal(t, "reading file", err)
+	}
+
+	// Flip a bit in the last byte of the first block.
+	r, err := tsm1.NewTSMReader(strings.NewReader(string(b)))
+	if err != nil {
+		fatal(t, "creating reader", err)
+	}
+	e := r.Entries("cpu,host=A#!~#value")[0]
+	b[e.Offset+int64(e.Size)-1] ^= 0xFF
+	if err := ioutil.WriteFile(path, b, 0666); err != nil {
+		fatal(t, "writing file", err)
+	}
+
+	errs, err := tsm1.VerifyTSMFile(path, nil)
+	if err != nil {
+		fatal(t, "verifying file", err)
+	} else if len(errs) != 1 {
+		t.Fatalf("unexpected problems: %v", errs)
+	} else if errs[0].Key != "cpu,host=A#!~#value" || !strings.Contains(errs[0].Error(), "checksum mismatch") {
+		t.Fatalf("unexpected problem: %s", errs[0])
+	}
+}
+
+func TestVerifyTSMFile_Footer(t *testing.T) {
+	dir := MustTempDir()
+	defer os.RemoveAll(dir)
+
+	path := MustWriteVerifyTSM(dir, nil)
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		fatal(t, "reading file", err)
+	}
+	b[len(b)-8] = 0xFF
+	if err := ioutil.WriteFile(path, b, 0666); err != nil {
+		fatal(t, "writing file", err)
+	}
+
+	errs, err := tsm1.VerifyTSMFile(path, nil)
+	if err != nil {
+		fatal(t, "verifying file", err)
+	} else if len(errs) != 1 || errs[0].Key != "" || !strings.Contains(errs[0].Error(), "invalid index offset") {
+		t.Fatalf("unexpected problems: %v", errs)
+	}
+}
+
+func TestVerifyTSMFile_Tombstone(t *testing.T) {
+	dir := MustTempDir()
+	defer os.RemoveAll(dir)
+
+	path := MustWriteVerifyTSM(dir, nil)
+	tombstone := strings.TrimSuffix(path, ".tsm") + ".tombstone"
+	if err := ioutil.WriteFile(tombstone, []byte("cpu,host=A#!~#value\n\ncpu,host=B#!~#value"), 0666); err != nil {
+		fatal(t, "writing tombstone", err)
+	}
+
+	errs, err := tsm1.VerifyTSMFile(path, nil)
+	if err != nil {
+		fatal(t, "verifying file", err)
+	} else if len(errs) != 1 || !strings.Contains(errs[0].Error(), "empty key on line 2") {
+		t.Fatalf("unexpected problems: %v", errs)
+	}
+}
+
+func TestVerifyTSMFile_Encrypted(t *testing.T) {
+	dir := MustTempDir()
+	defer os.RemoveAll(dir)
+
+	keyring := MustKeyring("k1")
+	path := MustWriteVerifyTSM(dir, keyring.Current())
+	if errs, err := tsm1.VerifyTSMFile(path, keyring); err != nil {
+		fatal(t, "verifying file", err)
+	} else if len(errs) != 0 {
+		t.Fatalf("unexpected problems: %v", errs)
+	}
+
+	// The file can't be verified without its key.
+	if _, err := tsm1.VerifyTSMFile(path, nil); err == nil {
+		t.Fatal("expected error verifying without key")
+	}
+
+	// Flip a bit in the last byte of the first block.
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		fatal(t, "reading file", err)
+	}
+	r, err := tsm1.NewTSMReaderWithOptions(tsm1.TSMReaderOptions{Reader: strings.NewReader(string(b)), Keyring: keyring})
+	if err != nil {
+		fatal(t, "creating reader", err)
+	}
+	e := r.Entries("cpu,host=A#!~#value")[0]
+	b[e.Offset+int64(e.Size)-1] ^= 0xFF
+	if err := ioutil.WriteFile(path, b, 0666); err != nil {
+		fatal(t, "writing file", err)
+	}
+
+	errs, err := tsm1.VerifyTSMFile(path, keyring)
+	if err != nil {
+		fatal(t, "verifying file", err)
+	} else if len(errs) != 1 || errs[0].Key != "cpu,host=A#!~#value" {
+		t.Fatalf("unexpected problems: %v", errs)
+	}
+}
+
+// MustWriteVerifyTSM writes a TSM file with two keys to dir, encrypted with
+// key if set, and returns its path.
+func MustWriteVerifyTSM(dir string, key *tsdb.EncryptionKey) string {
+	path := filepath.Join(dir, "000000001-000000001.tsm")
+	f, err := os.Create(path)
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+
+	w, err := tsm1.NewTSMWriterWithOptions(f, tsm1.TSMWriterOptions{Key: key})
+	if err != nil {
+		panic(err)
+	}
+	for _, key := range []string{"cpu,host=A#!~#value", "cpu,host=B#!~#value"} {
+		if err := w.Write(key, []tsm1.Value{tsm1.NewValue(1, 1.0), tsm1.NewValue(2, 2.0)}); err != nil {
+			panic(err)
+		}
+	}
+	if err := w.WriteIndex(); err != nil {
+		panic(err)
+	}
+	if err := w.Close(); err != nil {
+		panic(err)
+	}
+	return path
+}
+
+func TestRepairTSMFile(t *testing.T) {
+	dir := MustTempDir()
+	defer os.RemoveAll(dir)
+
+	path := MustWriteVerifyTSM(dir, nil)
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		fatal(t, "reading file", err)
+	}
+
+	// Corrupt the block of the first key.
+	r, err := tsm1.NewTSMReader(strings.NewReader(string(b)))
+	if err != nil {
+		fatal(t, "creating reader", err)
+	}
+	e := r.Entries("cpu,host=A#!~#value")[0]
+	b[e.Offset+int64(e.Size)-1] ^= 0xFF
+	if err := ioutil.WriteFile(path, b, 0666); err != nil {
+		fatal(t, "writing file", err)
+	}
+
+	lost, err := tsm1.RepairTSMFile(path, nil)
+	if err != nil {
+		fatal(t, "repairing file", err)
+	} else if len(lost) != 1 || lost[0].Key != "cpu,host=A#!~#value" || lost[0].MinTime != 1 || lost[0].MaxTime != 2 {
+		t.Fatalf("unexpected lost blocks: %v", lost)
+	}
+
+	// The original is kept and the repaired file only holds the valid key.
+	if _, err := os.Stat(path + "." + tsm1.QuarantineExtension); err != nil {
+		t.Fatalf("original not quarantined: %s", err)
+	}
+	if errs, err := tsm1.VerifyTSMFile(path, nil); err != nil {
+		fatal(t, "verifying file", err)
+	} else if len(errs) != 0 {
+		t.Fatalf("unexpected problems after repair: %v", errs)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		fatal(t, "opening file", err)
+	}
+	r, err = tsm1.NewTSMReader(f)
+	if err != nil {
+		fatal(t, "creating reader", err)
+	}
+	defer r.Close()
+	if keys := r.Keys(); len(keys) != 1 || keys[0] != "cpu,host=B#!~#value" {
+		t.Fatalf("unexpected keys: %v", keys)
+	}
+
+	// Repairing a healthy file does nothing.
+	if lost, err := tsm1.RepairTSMFile(path, nil); err != nil || len(lost) != 0 {
+		t.Fatalf("unexpected repair of healthy file: %v %v", lost, err)
+	}
+}
+
+func TestRepairTSMFile_Encrypted(t *testing.T) {
+	dir := MustTempDir()
+	defer os.RemoveAll(dir)
+
+	keyring := MustKeyring("k1")
+	path := MustWriteVerifyTSM(dir, keyring.Current())
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		fatal(t, "reading file", err)
+	}
+
+	// Corrupt the block of the first key.
+	r, err := tsm1.NewTSMReaderWithOptions(tsm1.TSMReaderOptions{Reader: strings.NewReader(string(b)), Keyring: keyring})
+	if err != nil {
+		fatal(t, "creating reader", err)
+	}
+	e := r.Entries("cpu,host=A#!~#value")[0]
+	b[e.Offset+int64(e.Size)-1] ^= 0xFF
+	if err := ioutil.WriteFile(path, b, 0666); err != nil {
+		fatal(t, "writing file", err)
+	}
+
+	if lost, err := tsm1.RepairTSMFile(path, keyring); err != nil {
+		fatal(t, "repairing file", err)
+	} else if len(lost) != 1 || lost[0].Key != "cpu,host=A#!~#value" {
+		t.Fatalf("unexpected lost blocks: %v", lost)
+	}
+
+	// The repaired file is still encrypted and holds the valid key.
+	b, err = ioutil.ReadFile(path)
+	if err != nil {
+		fatal(t, "reading file", err)
+	} else if b[4] != tsm1.EncryptedVersion {
+		t.Fatalf("unexpected version: %d", b[4])
+	}
+	r, err = tsm1.NewTSMReaderWithOptions(tsm1.TSMReaderOptions{Reader: strings.NewReader(string(b)), Keyring: keyring})
+	if err != nil {
+		fatal(t, "creating reader", err)
+	}
+	defer r.Close()
+	if keys := r.Keys(); len(keys) != 1 || keys[0] != "cpu,host=B#!~#value" {
+		t.Fatalf("unexpected keys: %v", keys)
+	} else if values, err := r.ReadAll("cpu,host=B#!~#value"); err != nil || len(values) != 2 {
+		t.Fatalf("unexpected values: %v %v", values, err)
+	}
+}
@@ -53,6 +53,11 @@ type WalEntryType byte
 const (
 	WriteWALEntryType  WalEntryType = 0x01
 	DeleteWALEntryType WalEntryType = 0x02
+
+	// encryptedWALEntry is set in the type of encrypted entries. Their
+	// compressed block is prefixed with a 1 byte key id length and the key
+	// id, and encrypted with AES-GCM using the type as additional data.
+	encryptedWALEntry WalEntryType = 0x80
 )
 
 var ErrWALClosed = fmt.Errorf("WAL closed")
@@ -61,8 +66,15 @@ var ErrWALClosed = fmt.Errorf("WAL closed")
 const (
 	statWALOldBytes     = "oldSegmentsDiskBytes"
 	statWALCurrentBytes = "currentSegmentDiskBytes"
+	statWALFsync        = "fsync"           // number of fsyncs
+	statWALFsyncNs      = "fsyncDurationNs" // total time spent in fsync
+	statWALFsyncWrites  = "fsyncWrites"     // number of writes made durable by fsyncs
 )
 
+func init() {
+	influxdb.RegisterGauges("tsm1_wal", statWALOldBytes, statWALCurrentBytes)
+}
+
 type WAL struct {
 	mu            sync.RWMutex
 	lastWriteTime time.Time
@@ -86,9 +98,28 @@ type WAL struct {
 	// LoggingEnabled specifies if detailed logs should be output
 	LoggingEnabled bool
 
+	// SyncMode is one of the tsdb.WALFsync modes and determines when writes
+	// are fsynced. SyncDelay is the group commit delay or periodic interval.
+	SyncMode  string
+	SyncDelay time.Duration
+
+	// Keyring, if set, encrypts new segments with its current key.
+	Keyring *tsdb.Keyring
+
+	// unsynced is the number of writes to the current segment since it was
+	// last fsynced and syncBatch the writes waiting for a group commit.
+	unsynced  int
+	syncBatch *walSyncBatch
+
 	statMap *expvar.Map
 }
 
+// walSyncBatch is a group of writes waiting on the same fsync.
+type walSyncBatch struct {
+	done chan struct{}
+	err  error
+}
+
 func NewWAL(path string) *WAL {
 	db, rp := tsdb.DecodeStorePath(path)
 	return &WAL{
@@ -97,6 +128,8 @@ func NewWAL(path string) *WAL {
 		// these options should be overriden by any options in the config
 		LogOutput:   os.Stderr,
 		SegmentSize: DefaultSegmentSize,
+		SyncMode:    tsdb.DefaultWALFsyncMode,
+		SyncDelay:   tsdb.DefaultWALFsyncDelay,
 		logger:      log.New(os.Stderr, "[tsm1wal] ", log.LstdFlags),
 		closing:     make(chan struct{}),
 
@@ -172,6 +205,10 @@ func (l *WAL) Open() error {
 
 	l.lastWriteTime = time.Now()
 
+	if l.SyncMode == tsdb.WALFsyncPeriodic {
+		go l.syncPeriodically(l.closing)
+	}
+
 	return nil
 }
 
@@ -272,25 +309,40 @@ func (l *WAL) writeToLog(entry WALEntry) (int, error) {
 	defer putBuf(encBuf)
 	compressed := snappy.Encode(encBuf, b)
 
+	id, batch, err := l.writeEntry(entry.Type(), compressed)
+	if err != nil {
+		return -1, err
+	} else if batch != nil {
+		// Wait for the group commit that covers this write.
+		<-batch.done
+		return id, batch.err
+	}
+	return id, nil
+}
+
+// writeEntry appends a compressed entry to the current segment and fsyncs it
+// according to the sync mode. In group mode, the returned batch is completed
+// once the write has been fsynced.
+func (l *WAL) writeEntry(entryType WalEntryType, compressed []byte) (int, *walSyncBatch, error) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
 	// Make sure the log has not been closed
 	select {
 	case <-l.closing:
-		return -1, ErrWALClosed
+		return -1, nil, ErrWALClosed
 	default:
 	}
 
 	// roll the segment file if needed
 	if err := l.rollSegment(); err != nil {
-		return -1, fmt.Errorf("error rolling WAL segment: %v", err)
+		return -1, nil, fmt.Errorf("error rolling WAL segment: %v", err)
 	}
 
-	// write and sync
-	if err := l.currentSegmentWriter.Write(entry.Type(), compressed); err != nil {
-		return -1, fmt.Errorf("error writing WAL entry: %v", err)
+	if err := l.currentSegmentWriter.Write(entryType, compressed); err != nil {
+		return -1, nil, fmt.Errorf("error writing WAL entry: %v", err)
 	}
+	l.unsynced++
 
 	// Update stats for current segment size
 	curSize := new(expvar.Int)
@@ -299,7 +351,81 @@ func (l *WAL) writeToLog(entry WALEntry) (int, error) {
 
 	l.lastWriteTime = time.Now()
 
-	return l.currentSegmentID, l.currentSegmentWriter.sync()
+	switch l.SyncMode {
+	case tsdb.WALFsyncPeriodic:
+		return l.currentSegmentID, nil, nil
+	case tsdb.WALFsyncGroup:
+		// The first write of a batch schedules the fsync for all writes
+		// that arrive before it runs.
+		if l.syncBatch == nil {
+			l.syncBatch = &walSyncBatch{done: make(chan struct{})}
+			time.AfterFunc(l.SyncDelay, l.groupCommit)
+		}
+		return l.currentSegmentID, l.syncBatch, nil
+	default:
+		return l.currentSegmentID, nil, l.sync()
+	}
+}
+
+// groupCommit fsyncs the current segment and releases the writes waiting on
+// the pending batch.
+func (l *WAL) groupCommit() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.commitBatch()
+}
+
+// commitBatch completes the pending group commit batch, if any. Must be
+// called with l.mu held.
+func (l *WAL) commitBatch() {
+	batch := l.syncBatch
+	if batch == nil {
+		return
+	}
+	l.syncBatch = nil
+	batch.err = l.sync()
+	close(batch.done)
+}
+
+// syncPeriodically fsyncs the current segment every SyncDelay until closing
+// is closed.
+func (l *WAL) syncPeriodically(closing <-chan struct{}) {
+	interval := l.SyncDelay
+	if interval <= 0 {
+		interval = tsdb.DefaultWALFsyncDelay
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-closing:
+			return
+		case <-ticker.C:
+			l.mu.Lock()
+			if err := l.sync(); err != nil {
+				l.logger.Printf("error syncing WAL segment: %v", err)
+			}
+			l.mu.Unlock()
+		}
+	}
+}
+
+// sync fsyncs the current segment if it has been written to since it was
+// last synced, recording the latency and the number of writes covered. Must
+// be called with l.mu held.
+func (l *WAL) sync() error {
+	if l.currentSegmentWriter == nil || l.unsynced == 0 {
+		return nil
+	}
+
+	start := time.Now()
+	err := l.currentSegmentWriter.sync()
+	l.statMap.Add(statWALFsync, 1)
+	l.statMap.Add(statWALFsyncNs, int64(time.Since(start)))
+	l.statMap.Add(statWALFsyncWrites, int64(l.unsynced))
+	l.unsynced = 0
+	return err
 }
 
 // rollSegment closes the current segment and opens a new one if the current segment is over
@@ -356,6 +482,12 @@ func (l *WAL) Close() error {
 	// Close, but don't set to nil so future goroutines can still be signaled
 	close(l.closing)
 
+	// Make writes waiting for a group commit or periodic fsync durable.
+	l.commitBatch()
+	if err := l.sync(); err != nil {
+		l.logger.Printf("error syncing WAL segment: %v", err)
+	}
+
 	if l.currentSegmentWriter != nil {
 		l.currentSegmentWriter.close()
 		l.currentSegmentWriter = nil
@@ -378,6 +510,11 @@ func segmentFileNames(dir string) ([]string, error) {
 func (l *WAL) newSegmentFile() error {
 	l.currentSegmentID++
 	if l.currentSegmentWriter != nil {
+		// Make any unsynced writes to the old segment durable before
+		// closing it.
+		if err := l.sync(); err != nil {
+			return err
+		}
 		if err := l.currentSegmentWriter.close(); err != nil {
 			return err
 		}
@@ -390,6 +527,9 @@ func (l *WAL) newSegmentFile() error {
 		return err
 	}
 	l.currentSegmentWriter = NewWALSegmentWriter(fd)
+	if l.Keyring != nil {
+		l.currentSegmentWriter.key = l.Keyring.Current()
+	}
 
 	// Reset the current segment size stat
 	curSize := new(expvar.Int)
@@ -671,6 +811,9 @@ func (w *DeleteWALEntry) Type() WalEntryType {
 type WALSegmentWriter struct {
 	w    io.WriteCloser
 	size int
+
+	// key encrypts the entries if set.
+	key *tsdb.EncryptionKey
 }
 
 func NewWALSegmentWriter(w io.WriteCloser) *WALSegmentWriter {
@@ -687,6 +830,18 @@ func (w *WALSegmentWriter) path() string {
 }
 
 func (w *WALSegmentWriter) Write(entryType WalEntryType, compressed []byte) error {
+	if w.key != nil {
+		entryType |= encryptedWALEntry
+
+		prefix := make([]byte, 1, 1+len(w.key.ID)+w.key.Overhead()+len(compressed))
+		prefix[0] = byte(len(w.key.ID))
+		prefix = append(prefix, w.key.ID...)
+
+		var err error
+		if compressed, err = w.key.Seal(prefix, compressed, []byte{byte(entryType)}); err != nil {
+			return err
+		}
+	}
 
 	var buf [5]byte
 	buf[0] = byte(entryType)
@@ -723,6 +878,9 @@ type WALSegmentReader struct {
 	entry WALEntry
 	n     int64
 	err   error
+
+	// Keyring holds the keys to decrypt encrypted entries with.
+	Keyring *tsdb.Keyring
 }
 
 func NewWALSegmentReader(r io.ReadCloser) *WALSegmentReader {
@@ -766,7 +924,16 @@ func (r *WALSegmentReader) Next() bool {
 	}
 	nReadOK += n
 
-	decLen, err := snappy.DecodedLen(b[:length])
+	compressed := b[:length]
+	if WalEntryType(entryType)&encryptedWALEntry != 0 {
+		if compressed, err = r.decrypt(WalEntryType(entryType), compressed); err != nil {
+			r.err = err
+			return true
+		}
+		entryType &^= byte(encryptedWALEntry)
+	}
+
+	decLen, err := snappy.DecodedLen(compressed)
 	if err != nil {
 		r.err = err
 		return true
@@ -774,7 +941,7 @@ func (r *WALSegmentReader) Next() bool {
 	decBuf := getBuf(decLen)
 	defer putBuf(decBuf)
 
-	data, err := snappy.Decode(decBuf, b[:length])
+	data, err := snappy.Decode(decBuf, compressed)
 	if err != nil {
 		r.err = err
 		return true
@@ -801,6 +968,24 @@ func (r *WALSegmentReader) Next() bool {
 	return true
 }
 
+// decrypt returns the compressed block of an encrypted entry. An
+// EncryptionKeyError is returned if its key is not in the keyring.
+func (r *WALSegmentReader) decrypt(entryType WalEntryType, b []byte) ([]byte, error) {
+	if len(b) < 1 || len(b) < 1+int(b[0]) {
+		return nil, fmt.Errorf("encrypted wal entry too short: %d bytes", len(b))
+	}
+	id := string(b[1 : 1+int(b[0])])
+
+	if r.Keyring == nil {
+		return nil, EncryptionKeyError{KeyID: id}
+	}
+	key, err := r.Keyring.Key(id)
+	if err != nil {
+		return nil, EncryptionKeyError{KeyID: id}
+	}
+	return key.Open(nil, b[1+len(id):], []byte{byte(entryType)})
+}
+
 func (r *WALSegmentReader) Read() (WALEntry, error) {
 	if r.err != nil {
 		return nil, r.err
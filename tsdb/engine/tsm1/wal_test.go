@@ -3,8 +3,12 @@ package tsm1_test
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/influxdata/influxdb/tsdb"
 	"github.com/influxdata/influxdb/tsdb/engine/tsm1"
 
 	"github.com/golang/snappy"
@@ -371,6 +375,73 @@ func TestWAL_ClosedSegments(t *testing.T) {
 	}
 }
 
+// Ensure encrypted segments are only readable with their key.
+func TestWAL_Encrypted(t *testing.T) {
+	dir := MustTempDir()
+	defer os.RemoveAll(dir)
+
+	keyring := MustKeyring("k1")
+	w := tsm1.NewWAL(dir)
+	w.Keyring = keyring
+	if err := w.Open(); err != nil {
+		t.Fatalf("error opening WAL: %v", err)
+	}
+
+	if _, err := w.WritePoints(map[string][]tsm1.Value{
+		"cpu,host=secret#!~#value": []tsm1.Value{
+			tsm1.NewValue(1, 1.1),
+		},
+	}); err != nil {
+		t.Fatalf("error writing points: %v", err)
+	}
+	if _, err := w.Delete([]string{"cpu,host=secret#!~#value"}); err != nil {
+		t.Fatalf("error deleting: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("error closing wal: %v", err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*."+tsm1.WALFileExtension))
+	if err != nil {
+		t.Fatal(err)
+	} else if len(files) != 1 {
+		t.Fatalf("segment count mismatch: got %d, exp 1", len(files))
+	}
+
+	r := tsm1.NewWALSegmentReader(MustOpenFile(files[0]))
+	r.Keyring = keyring
+	defer r.Close()
+
+	if !r.Next() {
+		t.Fatal("expected next, got false")
+	} else if e, err := r.Read(); err != nil {
+		fatal(t, "read entry", err)
+	} else if e, ok := e.(*tsm1.WriteWALEntry); !ok {
+		t.Fatalf("expected WriteWALEntry: got %#v", e)
+	} else if got, exp := e.Values["cpu,host=secret#!~#value"][0].String(), tsm1.NewValue(1, 1.1).String(); got != exp {
+		t.Fatalf("points mismatch: got %v, exp %v", got, exp)
+	}
+
+	if !r.Next() {
+		t.Fatal("expected next, got false")
+	} else if e, err := r.Read(); err != nil {
+		fatal(t, "read entry", err)
+	} else if _, ok := e.(*tsm1.DeleteWALEntry); !ok {
+		t.Fatalf("expected DeleteWALEntry: got %#v", e)
+	}
+
+	// Without the key, the entry cannot be read.
+	r = tsm1.NewWALSegmentReader(MustOpenFile(files[0]))
+	defer r.Close()
+	if !r.Next() {
+		t.Fatal("expected next, got false")
+	} else if _, err := r.Read(); err == nil {
+		t.Fatal("expected error reading entry without its key")
+	} else if _, ok := err.(tsm1.EncryptionKeyError); !ok {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
 func TestWAL_Delete(t *testing.T) {
 	dir := MustTempDir()
 	defer os.RemoveAll(dir)
@@ -413,6 +484,77 @@ func TestWAL_Delete(t *testing.T) {
 	}
 }
 
+// Ensure concurrent writes in group commit mode are all acknowledged and
+// written to the log.
+func TestWAL_GroupCommit(t *testing.T) {
+	dir := MustTempDir()
+	defer os.RemoveAll(dir)
+
+	w := tsm1.NewWAL(dir)
+	w.SyncMode = tsdb.WALFsyncGroup
+	w.SyncDelay = 10 * time.Millisecond
+	if err := w.Open(); err != nil {
+		t.Fatalf("error opening WAL: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	errC := make(chan error, 50)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := w.WritePoints(map[string][]tsm1.Value{
+				"cpu,host=A#!~#value": []tsm1.Value{tsm1.NewValue(int64(i), 1.1)},
+			})
+			errC <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errC)
+
+	for err := range errC {
+		if err != nil {
+			t.Fatalf("error writing points: %v", err)
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatalf("error closing wal: %v", err)
+	}
+	if got, exp := MustCountWALEntries(dir), 50; got != exp {
+		t.Fatalf("entry count mismatch: got %v, exp %v", got, exp)
+	}
+}
+
+// Ensure writes in periodic mode do not wait for an fsync and are written
+// when the log is closed.
+func TestWAL_PeriodicSync(t *testing.T) {
+	dir := MustTempDir()
+	defer os.RemoveAll(dir)
+
+	w := tsm1.NewWAL(dir)
+	w.SyncMode = tsdb.WALFsyncPeriodic
+	w.SyncDelay = time.Hour
+	if err := w.Open(); err != nil {
+		t.Fatalf("error opening WAL: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := w.WritePoints(map[string][]tsm1.Value{
+			"cpu,host=A#!~#value": []tsm1.Value{tsm1.NewValue(int64(i), 1.1)},
+		}); err != nil {
+			t.Fatalf("error writing points: %v", err)
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatalf("error closing wal: %v", err)
+	}
+	if got, exp := MustCountWALEntries(dir), 3; got != exp {
+		t.Fatalf("entry count mismatch: got %v, exp %v", got, exp)
+	}
+}
+
 func TestWALWriter_Corrupt(t *testing.T) {
 	dir := MustTempDir()
 	defer os.RemoveAll(dir)
@@ -550,3 +692,29 @@ func mustMarshalEntry(entry tsm1.WALEntry) (tsm1.WalEntryType, []byte) {
 
 	return entry.Type(), snappy.Encode(b, b)
 }
+
+// MustCountWALEntries returns the number of entries in the WAL segments in dir.
+func MustCountWALEntries(dir string) int {
+	files, err := filepath.Glob(filepath.Join(dir, "*."+tsm1.WALFileExtension))
+	if err != nil {
+		panic(err)
+	}
+
+	var n int
+	for _, fn := range files {
+		f, err := os.Open(fn)
+		if err != nil {
+			panic(err)
+		}
+
+		r := tsm1.NewWALSegmentReader(f)
+		for r.Next() {
+			if _, err := r.Read(); err != nil {
+				panic(err)
+			}
+			n++
+		}
+		r.Close()
+	}
+	return n
+}
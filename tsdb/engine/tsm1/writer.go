@@ -60,6 +60,35 @@ The last section is the footer that stores the offset of the start of the index.
 │Index Ofs│
 │ 8 bytes │
 └─────────┘
+
+Encrypted files are version 2 and append the id of the key they are encrypted
+with to the header.
+
+┌───────────────────────────────────────────┐
+│             Encrypted Header              │
+├─────────┬─────────┬────────────┬──────────┤
+│  Magic  │ Version │ Key ID Len │  Key ID  │
+│ 4 bytes │ 1 byte  │   1 byte   │ N bytes  │
+└─────────┴─────────┴────────────┴──────────┘
+
+The data of each block and the whole index are encrypted with AES-GCM, with
+the offset they are written at as additional data so they cannot be moved
+within the file.  Each is stored as a 12 byte nonce followed by the ciphertext
+and a 16 byte tag.  Block CRCs cover the encrypted data and offsets and sizes
+in the index refer to the encrypted blocks.
+
+Files may have a bloom filter of their keys between the blocks and the index,
+so readers can skip the index of files that do not contain a key.  It ends
+with its length, a CRC32 and a magic number, which readers look for right
+before the index.  Readers that do not know about it never read it since no
+index entry refers to it.  The filter is encrypted in encrypted files.
+
+┌─────────────────────────────────────────────────────┐
+│                    Bloom Filter                     │
+├─────────┬─────────┬──────────┬──────────┬───────────┤
+│  Bits   │ Hashes  │  Length  │   CRC    │   Magic   │
+│ N bytes │ 1 byte  │ 4 bytes  │ 4 bytes  │  4 bytes  │
+└─────────┴─────────┴──────────┴──────────┴───────────┘
 */
 
 import (
@@ -73,6 +102,9 @@ import (
 	"sort"
 	"sync"
 	"time"
+
+	"github.com/influxdata/influxdb/pkg/bloom"
+	"github.com/influxdata/influxdb/tsdb"
 )
 
 const (
@@ -82,6 +114,17 @@ const (
 
 	Version byte = 1
 
+	// EncryptedVersion is the version of files whose blocks and index are
+	// encrypted.
+	EncryptedVersion byte = 2
+
+	// BloomFilterMagic ends the bloom filter section of a file.
+	BloomFilterMagic uint32 = 0xB10F11E5
+
+	// Size in bytes of the length, checksum and magic number following
+	// a bloom filter
+	bloomTrailerSize = 12
+
 	// Size in bytes of an index entry
 	indexEntrySize = 28
 
@@ -503,22 +546,59 @@ type tsmWriter struct {
 	w       *bufio.Writer
 	index   TSMIndex
 	n       int64
+
+	// key encrypts the blocks and index if set.
+	key *tsdb.EncryptionKey
+
+	// bloomBitsPerKey sizes the bloom filter. Zero writes no filter.
+	bloomBitsPerKey int
+}
+
+// TSMWriterOptions are the options of a TSMWriter.
+type TSMWriterOptions struct {
+	// Key, if set, encrypts the blocks and index of the file.
+	Key *tsdb.EncryptionKey
+
+	// BloomFilterBitsPerKey, if positive, writes a bloom filter of the
+	// keys using this many bits per key.
+	BloomFilterBitsPerKey int
 }
 
 func NewTSMWriter(w io.Writer) (TSMWriter, error) {
+	return NewTSMWriterWithOptions(w, TSMWriterOptions{})
+}
+
+// NewEncryptedTSMWriter returns a writer that encrypts the blocks and index
+// of the file with key.
+func NewEncryptedTSMWriter(w io.Writer, key *tsdb.EncryptionKey) (TSMWriter, error) {
+	return NewTSMWriterWithOptions(w, TSMWriterOptions{Key: key})
+}
+
+func NewTSMWriterWithOptions(w io.Writer, opt TSMWriterOptions) (TSMWriter, error) {
 	index := &directIndex{
 		blocks: map[string]*indexEntries{},
 	}
 
-	return &tsmWriter{wrapped: w, w: bufio.NewWriterSize(w, 4*1024*1024), index: index}, nil
+	return &tsmWriter{
+		wrapped:         w,
+		w:               bufio.NewWriterSize(w, 4*1024*1024),
+		index:           index,
+		key:             opt.Key,
+		bloomBitsPerKey: opt.BloomFilterBitsPerKey,
+	}, nil
 }
 
 func (t *tsmWriter) writeHeader() error {
-	var buf [5]byte
+	buf := make([]byte, 5, 6+tsdb.MaxEncryptionKeyIDLen)
 	binary.BigEndian.PutUint32(buf[0:4], MagicNumber)
 	buf[4] = Version
+	if t.key != nil {
+		buf[4] = EncryptedVersion
+		buf = append(buf, byte(len(t.key.ID)))
+		buf = append(buf, t.key.ID...)
+	}
 
-	n, err := t.w.Write(buf[:])
+	n, err := t.w.Write(buf)
 	if err != nil {
 		return err
 	}
@@ -526,6 +606,22 @@ func (t *tsmWriter) writeHeader() error {
 	return nil
 }
 
+// seal encrypts data written at offset if the file is encrypted.
+func (t *tsmWriter) seal(data []byte, offset int64) ([]byte, error) {
+	if t.key == nil {
+		return data, nil
+	}
+	return t.key.Seal(nil, data, offsetAD(offset))
+}
+
+// offsetAD returns the additional data encrypted data written at offset is
+// authenticated with.
+func offsetAD(offset int64) []byte {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(offset))
+	return b[:]
+}
+
 func (t *tsmWriter) Write(key string, values Values) error {
 	// Nothing to write
 	if len(values) == 0 {
@@ -549,6 +645,11 @@ func (t *tsmWriter) Write(key string, values Values) error {
 		return err
 	}
 
+	block, err = t.seal(block, t.n)
+	if err != nil {
+		return err
+	}
+
 	var checksum [crc32.Size]byte
 	binary.BigEndian.PutUint32(checksum[:], crc32.ChecksumIEEE(block))
 
@@ -589,6 +690,11 @@ func (t *tsmWriter) WriteBlock(key string, minTime, maxTime int64, block []byte)
 		}
 	}
 
+	block, err = t.seal(block, t.n)
+	if err != nil {
+		return err
+	}
+
 	var checksum [crc32.Size]byte
 	binary.BigEndian.PutUint32(checksum[:], crc32.ChecksumIEEE(block))
 
@@ -615,14 +721,31 @@ func (t *tsmWriter) WriteBlock(key string, minTime, maxTime int64, block []byte)
 // WriteIndex writes the index section of the file.  If there are no index entries to write,
 // this returns ErrNoValues
 func (t *tsmWriter) WriteIndex() error {
-	indexPos := t.n
-
 	if t.index.KeyCount() == 0 {
 		return ErrNoValues
 	}
 
+	if t.bloomBitsPerKey > 0 {
+		if err := t.writeBloomFilter(); err != nil {
+			return err
+		}
+	}
+
+	indexPos := t.n
+
 	// Write the index
-	if err := t.index.Write(t.w); err != nil {
+	if t.key != nil {
+		b, err := t.index.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		if b, err = t.seal(b, indexPos); err != nil {
+			return err
+		}
+		if _, err := t.w.Write(b); err != nil {
+			return err
+		}
+	} else if err := t.index.Write(t.w); err != nil {
 		return err
 	}
 
@@ -634,6 +757,53 @@ func (t *tsmWriter) WriteIndex() error {
 	return err
 }
 
+// writeBloomFilter writes a bloom filter of the keys in the index.
+func (t *tsmWriter) writeBloomFilter() error {
+	keys := t.index.Keys()
+	filter := bloom.NewFilter(len(keys), t.bloomBitsPerKey)
+	for _, key := range keys {
+		filter.InsertString(key)
+	}
+
+	b, err := filter.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if b, err = t.seal(b, t.n); err != nil {
+		return err
+	}
+
+	var trailer [bloomTrailerSize]byte
+	binary.BigEndian.PutUint32(trailer[0:4], uint32(len(b)))
+	binary.BigEndian.PutUint32(trailer[4:8], crc32.ChecksumIEEE(b))
+	binary.BigEndian.PutUint32(trailer[8:12], BloomFilterMagic)
+
+	if _, err := t.w.Write(b); err != nil {
+		return err
+	}
+	if _, err := t.w.Write(trailer[:]); err != nil {
+		return err
+	}
+	t.n += int64(len(b) + len(trailer))
+	return nil
+}
+
+// parseBloomTrailer returns the offset and length of the bloom filter whose
+// trailer precedes the index at indexStart. ok is false if the file has no
+// bloom filter.
+func parseBloomTrailer(trailer []byte, indexStart int64) (offset int64, length uint32, checksum uint32, ok bool) {
+	if len(trailer) != bloomTrailerSize || binary.BigEndian.Uint32(trailer[8:12]) != BloomFilterMagic {
+		return 0, 0, 0, false
+	}
+
+	length = binary.BigEndian.Uint32(trailer[0:4])
+	offset = indexStart - bloomTrailerSize - int64(length)
+	if offset < 5 {
+		return 0, 0, 0, false
+	}
+	return offset, length, binary.BigEndian.Uint32(trailer[4:8]), true
+}
+
 func (t *tsmWriter) Close() error {
 	if err := t.w.Flush(); err != nil {
 		return err
@@ -650,27 +820,51 @@ func (t *tsmWriter) Size() uint32 {
 }
 
 // verifyVersion will verify that the reader's bytes are a TSM byte
-// stream of the correct version (1)
-func verifyVersion(r io.ReadSeeker) error {
+// stream of the correct version (1) or an encrypted one (2).  It returns
+// the id of the key an encrypted file is encrypted with.
+func verifyVersion(r io.ReadSeeker) (string, error) {
 	_, err := r.Seek(0, 0)
 	if err != nil {
-		return fmt.Errorf("init: failed to seek: %v", err)
+		return "", fmt.Errorf("init: failed to seek: %v", err)
 	}
-	var b [4]byte
-	_, err = io.ReadFull(r, b[:])
+	var b [tsdb.MaxEncryptionKeyIDLen]byte
+	_, err = io.ReadFull(r, b[:4])
 	if err != nil {
-		return fmt.Errorf("init: error reading magic number of file: %v", err)
+		return "", headerReadError("init: error reading magic number of file", err)
 	}
-	if binary.BigEndian.Uint32(b[:]) != MagicNumber {
-		return fmt.Errorf("can only read from tsm file")
+	if binary.BigEndian.Uint32(b[:4]) != MagicNumber {
+		return "", CorruptFileError{Err: fmt.Errorf("can only read from tsm file")}
 	}
 	_, err = io.ReadFull(r, b[:1])
 	if err != nil {
-		return fmt.Errorf("init: error reading version: %v", err)
+		return "", headerReadError("init: error reading version", err)
 	}
-	if b[0] != Version {
-		return fmt.Errorf("init: file is version %b. expected %b", b[0], Version)
+	switch b[0] {
+	case Version:
+		return "", nil
+	case EncryptedVersion:
+	default:
+		return "", CorruptFileError{Err: fmt.Errorf("init: file is version %b. expected %b", b[0], Version)}
 	}
 
-	return nil
+	if _, err := io.ReadFull(r, b[:1]); err != nil {
+		return "", headerReadError("init: error reading key id", err)
+	}
+	n := int(b[0])
+	if _, err := io.ReadFull(r, b[:n]); err != nil {
+		return "", headerReadError("init: error reading key id", err)
+	}
+	if n == 0 {
+		return "", CorruptFileError{Err: fmt.Errorf("init: encrypted file has no key id")}
+	}
+	return string(b[:n]), nil
+}
+
+// headerReadError returns the error for a failed read of a file's header. A
+// file too short to hold its header is corrupt.
+func headerReadError(msg string, err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return CorruptFileError{Err: fmt.Errorf("%s: %v", msg, err)}
+	}
+	return fmt.Errorf("%s: %v", msg, err)
 }
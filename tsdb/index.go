@@ -0,0 +1,201 @@
+package tsdb
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/influxdata/influxdb/influxql"
+)
+
+// InmemIndexName is the name of the default index, which keeps all series for
+// a database in the shared in-memory DatabaseIndex.
+const InmemIndexName = "inmem"
+
+// SeriesIndex represents a shard-local, persistent index of the measurements,
+// series and tags written to a shard. When a series index is configured it is
+// used in place of the shared DatabaseIndex for series and tag lookups so that
+// series do not need to be held in memory or rebuilt from TSM keys on startup.
+// Field metadata is still tracked by the DatabaseIndex and MeasurementFields.
+type SeriesIndex interface {
+	Open() error
+	Close() error
+
+	// CreateSeriesIfNotExists adds a series to the index if it does not exist.
+	CreateSeriesIfNotExists(name, key string, tags map[string]string) error
+
+	// HasSeries returns true if the series key exists in the index.
+	HasSeries(key string) bool
+
+	// DropSeries removes the series keys from the index.
+	DropSeries(keys []string) error
+
+	// DropMeasurement removes a measurement and all of its series from the index.
+	DropMeasurement(name string) error
+
+	// SeriesN returns the number of series in the index.
+	SeriesN() int
+
+	// MeasurementNames returns a sorted list of all measurement names.
+	MeasurementNames() []string
+
+	// HasMeasurement returns true if the measurement has at least one series.
+	HasMeasurement(name string) bool
+
+	// MeasurementNamesByExpr returns the sorted names of measurements matching
+	// a tag-only expression. The bool return argument is false if the expression
+	// was not a measurement expression and was therefore not evaluated.
+	MeasurementNamesByExpr(expr influxql.Expr) ([]string, bool, error)
+
+	// MeasurementSeriesKeysByExpr returns the sorted keys of the series in a
+	// measurement matching a tag-only expression, or all series if expr is nil.
+	MeasurementSeriesKeysByExpr(name string, expr influxql.Expr) ([]string, error)
+
+	// TagKeys returns the sorted tag keys of a measurement.
+	TagKeys(name string) []string
+
+	// TagValues returns the sorted values of a tag key in a measurement.
+	TagValues(name, key string) []string
+
+	// TagSets returns the tag sets of a measurement for the given dimensions
+	// and condition, in the same form as Measurement.TagSets. Fields are used
+	// to distinguish field comparisons from tag comparisons in the condition.
+	TagSets(name string, dimensions []string, condition influxql.Expr, fields *MeasurementFields) ([]*influxql.TagSet, error)
+}
+
+// NewIndexFunc creates a new series index.
+type NewIndexFunc func(path string, options EngineOptions) SeriesIndex
+
+// newIndexFuncs is a lookup of series index constructors by name.
+var newIndexFuncs = make(map[string]NewIndexFunc)
+
+// RegisterIndex registers a series index initializer by name.
+func RegisterIndex(name string, fn NewIndexFunc) {
+	if _, ok := newIndexFuncs[name]; ok {
+		panic("index already registered: " + name)
+	}
+	newIndexFuncs[name] = fn
+}
+
+// RegisteredIndexes returns the slice of currently registered indexes,
+// including the in-memory index.
+func RegisteredIndexes() []string {
+	a := make([]string, 0, len(newIndexFuncs)+1)
+	a = append(a, InmemIndexName)
+	for k := range newIndexFuncs {
+		a = append(a, k)
+	}
+	sort.Strings(a)
+	return a
+}
+
+// NewIndex returns an instance of a series index by name. Returns a nil index
+// if the in-memory index is selected.
+func NewIndex(name string, path string, options EngineOptions) (SeriesIndex, error) {
+	if name == "" || name == InmemIndexName {
+		return nil, nil
+	}
+
+	fn := newIndexFuncs[name]
+	if fn == nil {
+		return nil, fmt.Errorf("invalid index version: %q", name)
+	}
+	return fn(path, options), nil
+}
+
+// addSeriesIndex registers the persistent series index of a shard in the database.
+func (d *DatabaseIndex) addSeriesIndex(shardID uint64, idx SeriesIndex) {
+	d.persistentMu.Lock()
+	defer d.persistentMu.Unlock()
+	d.seriesIndexes[shardID] = idx
+	d.persistentSeriesN = -1
+}
+
+// removeSeriesIndex unregisters the persistent series index of a shard.
+func (d *DatabaseIndex) removeSeriesIndex(shardID uint64) {
+	d.persistentMu.Lock()
+	defer d.persistentMu.Unlock()
+	delete(d.seriesIndexes, shardID)
+	d.persistentSeriesN = -1
+}
+
+// hasPersistentSeries returns true if the series key exists in the persistent
+// index of any shard in the database.
+func (d *DatabaseIndex) hasPersistentSeries(key string) bool {
+	d.persistentMu.Lock()
+	defer d.persistentMu.Unlock()
+	for _, idx := range d.seriesIndexes {
+		if idx.HasSeries(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// persistentSeriesCount returns the number of distinct series in the persistent
+// indexes of the database's shards. The count is computed on first use and then
+// kept up to date by addPersistentSeriesN until series are dropped.
+func (d *DatabaseIndex) persistentSeriesCount() (int, error) {
+	d.persistentMu.Lock()
+	defer d.persistentMu.Unlock()
+
+	if d.persistentSeriesN >= 0 {
+		return d.persistentSeriesN, nil
+	}
+
+	// Series are usually written to many shards so count each key once.
+	names := make(map[string]struct{})
+	for _, idx := range d.seriesIndexes {
+		for _, name := range idx.MeasurementNames() {
+			names[name] = struct{}{}
+		}
+	}
+
+	var n int
+	for name := range names {
+		keys := make(map[string]struct{})
+		for _, idx := range d.seriesIndexes {
+			a, err := idx.MeasurementSeriesKeysByExpr(name, nil)
+			if err != nil {
+				return 0, err
+			}
+			for _, k := range a {
+				keys[k] = struct{}{}
+			}
+		}
+		n += len(keys)
+	}
+	d.persistentSeriesN = n
+	return n, nil
+}
+
+// addPersistentSeriesN adds n series new to the database to the persistent series count.
+func (d *DatabaseIndex) addPersistentSeriesN(n int) {
+	d.persistentMu.Lock()
+	defer d.persistentMu.Unlock()
+	if d.persistentSeriesN >= 0 {
+		d.persistentSeriesN += n
+	}
+}
+
+// resetPersistentSeriesN discards the persistent series count after series
+// are dropped so it is recounted on next use.
+func (d *DatabaseIndex) resetPersistentSeriesN() {
+	d.persistentMu.Lock()
+	defer d.persistentMu.Unlock()
+	d.persistentSeriesN = -1
+}
+
+// persistentTagValues returns the distinct values of a tag key in a measurement
+// across the persistent indexes of the database's shards.
+func (d *DatabaseIndex) persistentTagValues(name, key string) map[string]struct{} {
+	d.persistentMu.Lock()
+	defer d.persistentMu.Unlock()
+
+	values := make(map[string]struct{})
+	for _, idx := range d.seriesIndexes {
+		for _, v := range idx.TagValues(name, key) {
+			values[v] = struct{}{}
+		}
+	}
+	return values
+}
@@ -0,0 +1,6 @@
+package index // import "github.com/influxdata/influxdb/tsdb/index"
+
+import (
+	// Initialize and register tsi1 index
+	_ "github.com/influxdata/influxdb/tsdb/index/tsi1"
+)
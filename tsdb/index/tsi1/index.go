@@ -0,0 +1,800 @@
+package tsi1
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/influxdata/influxdb/tsdb"
+)
+
+// IndexName is the name of the index when registered with tsdb.
+const IndexName = "tsi1"
+
+const (
+	// IndexFileExtension is the extension of index files within an index directory.
+	IndexFileExtension = "tsi"
+
+	// LogFileExtension is the extension of log files within an index directory.
+	LogFileExtension = "tsl"
+
+	// DefaultMaxLogFileSize is the size at which the active log file is
+	// compacted into an index file.
+	DefaultMaxLogFileSize = 1 * 1024 * 1024
+)
+
+// ErrIndexClosed is returned when operating on a closed index.
+var ErrIndexClosed = fmt.Errorf("index closed")
+
+func init() {
+	tsdb.RegisterIndex(IndexName, func(path string, options tsdb.EngineOptions) tsdb.SeriesIndex {
+		idx := NewIndex(path)
+		if options.Config.MaxIndexLogFileSize > 0 {
+			idx.MaxLogFileSize = options.Config.MaxIndexLogFileSize
+		}
+		return idx
+	})
+}
+
+// Ensure Index implements the interface.
+var _ tsdb.SeriesIndex = &Index{}
+
+// Index represents a persistent series index for a single shard. Series are
+// appended to a log file as they are created and the log is periodically
+// compacted into an immutable index file. The newest index files are merged
+// once they are of similar size, so each series is rewritten a logarithmic
+// number of times as the index grows.
+type Index struct {
+	mu   sync.RWMutex
+	path string
+
+	files []*IndexFile // index files from oldest to newest
+	logs  []*LogFile   // log files in order, the last is active
+	seq   int          // sequence of the active log file
+	maxID uint64       // highest allocated series id
+
+	compactMu  sync.Mutex // serializes compactions
+	compacting bool
+	wg         sync.WaitGroup
+
+	// The size of the active log file at which a compaction is started.
+	MaxLogFileSize int64
+
+	logger *log.Logger
+}
+
+// NewIndex returns a new index stored in the directory at path.
+func NewIndex(path string) *Index {
+	return &Index{
+		path:           path,
+		MaxLogFileSize: DefaultMaxLogFileSize,
+		logger:         log.New(os.Stderr, "[tsi1] ", log.LstdFlags),
+	}
+}
+
+// Path returns the path of the index directory.
+func (i *Index) Path() string { return i.path }
+
+// SetLogOutput sets the writer used for log output.
+func (i *Index) SetLogOutput(w io.Writer) {
+	i.logger = log.New(w, "[tsi1] ", log.LstdFlags)
+}
+
+// Open opens the index file and replays all log files.
+func (i *Index) Open() error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if err := os.MkdirAll(i.path, 0777); err != nil {
+		return err
+	}
+
+	// Remove any index files left over from an interrupted compaction.
+	tmps, err := filepath.Glob(filepath.Join(i.path, "*.tmp"))
+	if err != nil {
+		return err
+	}
+	for _, path := range tmps {
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+
+	// Open the index files in order. A file whose logs are covered by an
+	// earlier file was merged into it before an interrupted compaction
+	// could remove it.
+	ranges, err := i.indexFileRanges()
+	if err != nil {
+		return err
+	}
+	for _, r := range ranges {
+		if r.last <= i.seq {
+			if err := os.Remove(r.path); err != nil {
+				i.close()
+				return err
+			}
+			continue
+		}
+
+		f := NewIndexFile(r.path)
+		if err := f.Open(); err != nil {
+			i.close()
+			return err
+		}
+		i.files = append(i.files, f)
+		i.seq = r.last
+		if id := f.MaxID(); id > i.maxID {
+			i.maxID = id
+		}
+	}
+
+	// Replay log files in order. Log files already compacted into an index
+	// file are removed and series already compacted are skipped.
+	paths, err := filepath.Glob(filepath.Join(i.path, fmt.Sprintf("L*.%s", LogFileExtension)))
+	if err != nil {
+		i.close()
+		return err
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		seq, err := parseLogFileName(path)
+		if err != nil {
+			i.close()
+			return err
+		}
+		if seq <= i.seq {
+			if err := os.Remove(path); err != nil {
+				i.close()
+				return err
+			}
+			continue
+		}
+
+		f := NewLogFile(path)
+		f.SetMinID(i.maxID + 1)
+		if err := f.Open(); err != nil {
+			i.close()
+			return err
+		}
+		i.logs = append(i.logs, f)
+		i.seq = seq
+	}
+
+	for _, f := range i.logs {
+		if id := f.MaxID(); id > i.maxID {
+			i.maxID = id
+		}
+	}
+
+	// Ensure there is an active log file.
+	if len(i.logs) == 0 {
+		if err := i.rotate(); err != nil {
+			i.close()
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close waits for any running compaction and closes the index.
+func (i *Index) Close() error {
+	i.wg.Wait()
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.close()
+}
+
+func (i *Index) close() error {
+	var err error
+	for _, f := range i.logs {
+		if e := f.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	i.logs = nil
+
+	for _, f := range i.files {
+		if e := f.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	i.files = nil
+	return err
+}
+
+// indexFileRange is an index file and the sequences of the first and last
+// log files it was written from.
+type indexFileRange struct {
+	path        string
+	first, last int
+}
+
+// indexFileRanges returns the index files in the index directory, ordered
+// by their first log file and with larger files before the files they cover.
+func (i *Index) indexFileRanges() ([]indexFileRange, error) {
+	paths, err := filepath.Glob(filepath.Join(i.path, fmt.Sprintf("I*.%s", IndexFileExtension)))
+	if err != nil {
+		return nil, err
+	}
+
+	a := make([]indexFileRange, len(paths))
+	for j, path := range paths {
+		first, last, err := parseIndexFileName(path)
+		if err != nil {
+			return nil, err
+		}
+		a[j] = indexFileRange{path: path, first: first, last: last}
+	}
+
+	sort.Sort(indexFileRanges(a))
+	return a, nil
+}
+
+type indexFileRanges []indexFileRange
+
+func (a indexFileRanges) Len() int      { return len(a) }
+func (a indexFileRanges) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a indexFileRanges) Less(i, j int) bool {
+	if a[i].first != a[j].first {
+		return a[i].first < a[j].first
+	}
+	return a[i].last > a[j].last
+}
+
+// indexFileName returns the name of the index file written from the log
+// files with sequences first to last.
+func indexFileName(first, last int) string {
+	return fmt.Sprintf("I%08d-%08d.%s", first, last, IndexFileExtension)
+}
+
+// parseIndexFileName returns the sequences of the first and last log files
+// an index file was written from.
+func parseIndexFileName(path string) (first, last int, err error) {
+	if _, err := fmt.Sscanf(filepath.Base(path), "I%d-%d."+IndexFileExtension, &first, &last); err != nil {
+		return 0, 0, fmt.Errorf("invalid index file name: %s", path)
+	}
+	return first, last, nil
+}
+
+// parseLogFileName returns the sequence of a log file.
+func parseLogFileName(path string) (int, error) {
+	var seq int
+	if _, err := fmt.Sscanf(filepath.Base(path), "L%d."+LogFileExtension, &seq); err != nil {
+		return 0, fmt.Errorf("invalid log file name: %s", path)
+	}
+	return seq, nil
+}
+
+// rotate opens a new active log file. The lock must be held.
+func (i *Index) rotate() error {
+	i.seq++
+	f := NewLogFile(filepath.Join(i.path, fmt.Sprintf("L%08d.%s", i.seq, LogFileExtension)))
+	if err := f.Open(); err != nil {
+		return err
+	}
+	i.logs = append(i.logs, f)
+	return nil
+}
+
+// activeLog returns the log file currently being appended to.
+func (i *Index) activeLog() *LogFile {
+	if len(i.logs) == 0 {
+		return nil
+	}
+	return i.logs[len(i.logs)-1]
+}
+
+// CreateSeriesIfNotExists adds a series to the index if it does not exist.
+func (i *Index) CreateSeriesIfNotExists(name, key string, tags map[string]string) error {
+	i.mu.RLock()
+	id := i.seriesID(key)
+	i.mu.RUnlock()
+	if id != 0 {
+		return nil
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	// Check again under the write lock.
+	if i.seriesID(key) != 0 {
+		return nil
+	}
+
+	f := i.activeLog()
+	if f == nil {
+		return ErrIndexClosed
+	}
+	if err := f.AddSeries(i.maxID+1, name, key); err != nil {
+		return err
+	}
+	i.maxID++
+
+	// Compact in the background once the active log grows too large.
+	if f.Size() > i.MaxLogFileSize && !i.compacting {
+		i.compacting = true
+		i.wg.Add(1)
+		go func() {
+			defer i.wg.Done()
+			if err := i.Compact(); err != nil {
+				i.logger.Printf("error compacting index %s: %s", i.path, err)
+			}
+
+			i.mu.Lock()
+			i.compacting = false
+			i.mu.Unlock()
+		}()
+	}
+
+	return nil
+}
+
+// HasSeries returns true if the series key exists in the index.
+func (i *Index) HasSeries(key string) bool {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.seriesID(key) != 0
+}
+
+// DropSeries removes the series keys from the index.
+func (i *Index) DropSeries(keys []string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	f := i.activeLog()
+	if f == nil {
+		return ErrIndexClosed
+	}
+
+	for _, key := range keys {
+		if id := i.seriesID(key); id != 0 {
+			if err := f.DeleteSeries(id); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// DropMeasurement removes a measurement and all of its series from the index.
+func (i *Index) DropMeasurement(name string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	f := i.activeLog()
+	if f == nil {
+		return ErrIndexClosed
+	}
+
+	for _, id := range i.measurementSeriesIDs(name) {
+		if err := f.DeleteSeries(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SeriesN returns the number of series in the index.
+func (i *Index) SeriesN() int {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	var n int
+	tombstones := make(map[uint64]struct{})
+	for _, f := range i.files {
+		n += f.SeriesN()
+		for _, id := range f.Tombstones() {
+			tombstones[id] = struct{}{}
+		}
+	}
+	for _, f := range i.logs {
+		n += f.SeriesN()
+		for _, id := range f.Tombstones() {
+			tombstones[id] = struct{}{}
+		}
+	}
+
+	// Only count tombstones of series which still exist in another file.
+	for id := range tombstones {
+		if _, _, ok := i.rawSeries(id); ok {
+			n--
+		}
+	}
+	return n
+}
+
+// MeasurementNames returns a sorted list of all measurement names.
+func (i *Index) MeasurementNames() []string {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.measurementNames()
+}
+
+func (i *Index) measurementNames() []string {
+	set := make(map[string]struct{})
+	for _, f := range i.files {
+		for _, name := range f.MeasurementNames() {
+			set[name] = struct{}{}
+		}
+	}
+	for _, f := range i.logs {
+		for _, name := range f.MeasurementNames() {
+			set[name] = struct{}{}
+		}
+	}
+
+	a := make([]string, 0, len(set))
+	for name := range set {
+		if i.hasMeasurement(name) {
+			a = append(a, name)
+		}
+	}
+	sort.Strings(a)
+	return a
+}
+
+// HasMeasurement returns true if the measurement has at least one series.
+func (i *Index) HasMeasurement(name string) bool {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.hasMeasurement(name)
+}
+
+// TagKeys returns the sorted tag keys of a measurement.
+func (i *Index) TagKeys(name string) []string {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.tagKeys(name)
+}
+
+// TagValues returns the sorted values of a tag key in a measurement.
+func (i *Index) TagValues(name, key string) []string {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.tagValues(name, key)
+}
+
+// Compact writes all log files into a new index file and merges the newest
+// index files once they are of similar size. Writes continue to a new log
+// file while the compaction runs.
+func (i *Index) Compact() error {
+	i.compactMu.Lock()
+	defer i.compactMu.Unlock()
+
+	if err := i.compactLogs(); err != nil {
+		return err
+	}
+	return i.mergeIndexFiles()
+}
+
+// compactLogs writes the current log files into a new index file.
+func (i *Index) compactLogs() error {
+	// Freeze the current log files and start a new active log.
+	i.mu.Lock()
+	if i.activeLog() == nil {
+		i.mu.Unlock()
+		return ErrIndexClosed
+	}
+	frozen := make([]*LogFile, len(i.logs))
+	copy(frozen, i.logs)
+	if err := i.rotate(); err != nil {
+		i.mu.Unlock()
+		return err
+	}
+	full, maxID := len(i.files) == 0, i.maxID
+	i.mu.Unlock()
+
+	first, err := parseLogFileName(frozen[0].Path())
+	if err != nil {
+		return err
+	}
+	last, err := parseLogFileName(frozen[len(frozen)-1].Path())
+	if err != nil {
+		return err
+	}
+
+	// The frozen files are no longer written to so no lock is needed.
+	srcs := make([]indexFileSource, len(frozen))
+	for j, f := range frozen {
+		srcs[j] = f
+	}
+	f, err := i.createIndexFile(indexFileName(first, last), srcs, full, maxID)
+	if err != nil {
+		return err
+	}
+
+	// Swap in the new index file and drop the frozen logs.
+	i.mu.Lock()
+	i.files = append(i.files, f)
+	i.logs = i.logs[len(frozen):]
+	i.mu.Unlock()
+
+	for _, f := range frozen {
+		if err := f.Close(); err != nil {
+			return err
+		}
+		if err := os.Remove(f.Path()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeIndexFiles merges the two newest index files while the older is no
+// more than twice the size of the newer. This keeps the number of files
+// logarithmic in the size of the index.
+func (i *Index) mergeIndexFiles() error {
+	for {
+		// Only compactions change the index files, so they can be read
+		// without the lock while the compaction lock is held.
+		files := i.files
+		n := len(files)
+		if n < 2 || files[n-2].Size() > 2*files[n-1].Size() {
+			return nil
+		}
+		older, newer := files[n-2], files[n-1]
+
+		first, _, err := parseIndexFileName(older.Path())
+		if err != nil {
+			return err
+		}
+		_, last, err := parseIndexFileName(newer.Path())
+		if err != nil {
+			return err
+		}
+
+		f, err := i.createIndexFile(indexFileName(first, last), []indexFileSource{older, newer}, n == 2, newer.MaxID())
+		if err != nil {
+			return err
+		}
+
+		i.mu.Lock()
+		i.files = append(i.files[:n-2:n-2], f)
+		i.mu.Unlock()
+
+		for _, f := range []*IndexFile{older, newer} {
+			if err := f.Close(); err != nil {
+				return err
+			}
+			if err := os.Remove(f.Path()); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// createIndexFile writes srcs to a new index file called name and opens it.
+func (i *Index) createIndexFile(name string, srcs []indexFileSource, full bool, maxID uint64) (*IndexFile, error) {
+	path := filepath.Join(i.path, name)
+	tmpPath := path + ".tmp"
+
+	if err := func() error {
+		f, err := os.Create(tmpPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		if err := writeIndexFile(f, srcs, full, maxID); err != nil {
+			return err
+		}
+		return f.Sync()
+	}(); err != nil {
+		os.Remove(tmpPath)
+		return nil, err
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return nil, err
+	}
+
+	f := NewIndexFile(path)
+	if err := f.Open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// seriesID returns the id of a live series, or zero. The lock must be held.
+func (i *Index) seriesID(key string) uint64 {
+	for j := len(i.logs) - 1; j >= 0; j-- {
+		if id := i.logs[j].SeriesID(key); id != 0 {
+			if i.isTombstoned(id) {
+				return 0
+			}
+			return id
+		}
+	}
+
+	for j := len(i.files) - 1; j >= 0; j-- {
+		if id := i.files[j].SeriesID(key); id != 0 {
+			if i.isTombstoned(id) {
+				return 0
+			}
+			return id
+		}
+	}
+	return 0
+}
+
+// series returns the name and key of a live series by id. The lock must be held.
+func (i *Index) series(id uint64) (name, key string, ok bool) {
+	if i.isTombstoned(id) {
+		return "", "", false
+	}
+	return i.rawSeries(id)
+}
+
+// rawSeries returns the name and key of a series by id, ignoring tombstones.
+func (i *Index) rawSeries(id uint64) (name, key string, ok bool) {
+	for _, f := range i.logs {
+		if name, key, ok := f.Series(id); ok {
+			return name, key, true
+		}
+	}
+	for _, f := range i.files {
+		if name, key, ok := f.Series(id); ok {
+			return name, key, true
+		}
+	}
+	return "", "", false
+}
+
+// isTombstoned returns true if a series id has been deleted by a newer file.
+func (i *Index) isTombstoned(id uint64) bool {
+	for _, f := range i.logs {
+		if f.IsTombstoned(id) {
+			return true
+		}
+	}
+	for _, f := range i.files {
+		if f.IsTombstoned(id) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasLiveSeries returns true if any series in p has not been deleted. Only
+// as much of p is decoded as is needed to find a live series.
+func (i *Index) hasLiveSeries(p postings) bool {
+	for id, ok := p.next(); ok; id, ok = p.next() {
+		if !i.isTombstoned(id) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterIDs returns the sorted, live series ids from a set of ids.
+func (i *Index) filterIDs(ids []uint64) tsdb.SeriesIDs {
+	a := make(tsdb.SeriesIDs, 0, len(ids))
+	for _, id := range ids {
+		if !i.isTombstoned(id) {
+			a = append(a, id)
+		}
+	}
+	sort.Sort(a)
+	return a
+}
+
+// measurementSeriesIDs returns the sorted ids of the live series in a
+// measurement. The lock must be held.
+func (i *Index) measurementSeriesIDs(name string) tsdb.SeriesIDs {
+	var ids []uint64
+	for _, f := range i.files {
+		ids = append(ids, f.MeasurementSeriesIDs(name)...)
+	}
+	for _, f := range i.logs {
+		ids = append(ids, f.MeasurementSeriesIDs(name)...)
+	}
+	return i.filterIDs(ids)
+}
+
+// hasMeasurement returns true if a measurement has at least one live series.
+// The lock must be held.
+func (i *Index) hasMeasurement(name string) bool {
+	for _, f := range i.logs {
+		for _, id := range f.MeasurementSeriesIDs(name) {
+			if !i.isTombstoned(id) {
+				return true
+			}
+		}
+	}
+	for _, f := range i.files {
+		if i.hasLiveSeries(f.measurementPostings(name)) {
+			return true
+		}
+	}
+	return false
+}
+
+// tagKeys returns the sorted tag keys of a measurement which have at least
+// one live series. The lock must be held.
+func (i *Index) tagKeys(name string) []string {
+	set := make(map[string]struct{})
+	for _, f := range i.files {
+		for _, k := range f.TagKeys(name) {
+			set[k] = struct{}{}
+		}
+	}
+	for _, f := range i.logs {
+		for _, k := range f.TagKeys(name) {
+			set[k] = struct{}{}
+		}
+	}
+
+	a := make([]string, 0, len(set))
+	for k := range set {
+		if len(i.tagValues(name, k)) > 0 {
+			a = append(a, k)
+		}
+	}
+	sort.Strings(a)
+	return a
+}
+
+// tagValues returns the sorted values of a tag key which have at least one
+// live series. Postings are only decoded until a live series is found. The
+// lock must be held.
+func (i *Index) tagValues(name, key string) []string {
+	set := make(map[string]struct{})
+	for _, f := range i.files {
+		f.forEachTagValue(name, key, func(v string, p postings) {
+			if _, ok := set[v]; !ok && i.hasLiveSeries(p) {
+				set[v] = struct{}{}
+			}
+		})
+	}
+	for _, f := range i.logs {
+		for _, v := range f.TagValues(name, key) {
+			if _, ok := set[v]; ok {
+				continue
+			}
+			for _, id := range f.TagValueSeriesIDs(name, key, v) {
+				if !i.isTombstoned(id) {
+					set[v] = struct{}{}
+					break
+				}
+			}
+		}
+	}
+
+	a := make([]string, 0, len(set))
+	for v := range set {
+		a = append(a, v)
+	}
+	sort.Strings(a)
+	return a
+}
+
+// tagValueMap returns a map of tag values to the sorted ids of the live series
+// with that value. The lock must be held.
+func (i *Index) tagValueMap(name, key string) map[string]tsdb.SeriesIDs {
+	m := make(map[string][]uint64)
+	for _, f := range i.files {
+		f.forEachTagValue(name, key, func(v string, p postings) {
+			m[v] = append(m[v], p.ids()...)
+		})
+	}
+	for _, f := range i.logs {
+		for _, v := range f.TagValues(name, key) {
+			m[v] = append(m[v], f.TagValueSeriesIDs(name, key, v)...)
+		}
+	}
+
+	values := make(map[string]tsdb.SeriesIDs, len(m))
+	for v, ids := range m {
+		if a := i.filterIDs(ids); len(a) > 0 {
+			values[v] = a
+		}
+	}
+	return values
+}
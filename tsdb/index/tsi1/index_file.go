@@ -0,0 +1,790 @@
+package tsi1
+
+/*
+An index file is an immutable, memory-mapped file containing the series,
+measurements and tag value postings of part of a shard. Index files are
+written by compacting log files and by merging other index files.
+
+┌───────────────────────────────────────────────────────────────────────────┐
+│                                Index File                                 │
+├───────┬────────┬──────────┬─────────────┬─────────────┬─────────┬─────────┤
+│ Magic │ Series │  Series  │ Measurement │ Measurement │Tombstone│ Trailer │
+│4 bytes│ Block  │  Tables  │   Block     │    Table    │  Table  │         │
+└───────┴────────┴──────────┴─────────────┴─────────────┴─────────┴─────────┘
+
+The series block contains one entry per series, sorted by series key. It is
+followed by two tables of fixed-size entries: the offsets of the series
+entries in key order, used to look up a series by key, and (id, offset) pairs
+in id order, used to look up a series by id.
+
+┌────────────────────────────────────────────────────────────┐
+│                        Series Entry                        │
+├─────────┬──────────┬─────────┬─────────┬───────────────────┤
+│   ID    │ Name Len │  Name   │ Key Len │        Key        │
+│ 8 bytes │ uvarint  │ N bytes │ uvarint │      N bytes      │
+└─────────┴──────────┴─────────┴─────────┴───────────────────┘
+
+The measurement block holds the entries of each measurement, sorted by name.
+A measurement entry holds the postings list of the measurement's series and a
+table of the offsets of its tag key entries, sorted by key. Each tag key entry
+holds a table of the offsets of its tag value entries, sorted by value. The
+tables allow a single tag key or value to be found without decoding the
+postings lists of the rest of the measurement.
+
+┌─────────────────────────────────────────────────────────────┐
+│                      Measurement Entry                      │
+├──────────┬─────────┬──────────┬─────────┬───────────────────┤
+│ Name Len │  Name   │ Postings │  Tag N  │  Tag Key Offsets  │
+│ uvarint  │ N bytes │          │ uvarint │  Tag N * 8 bytes  │
+└──────────┴─────────┴──────────┴─────────┴───────────────────┘
+┌─────────────────────────────────────────┐ ┌───────────────────────────────┐
+│              Tag Key Entry              │ │        Tag Value Entry        │
+├─────────┬───────┬─────────┬─────────────┤ ├─────────┬───────┬─────────────┤
+│ Key Len │  Key  │ Value N │Value Offsets│ │ Val Len │ Value │  Postings   │
+│ uvarint │N bytes│ uvarint │N * 8 bytes  │ │ uvarint │N bytes│             │
+└─────────┴───────┴─────────┴─────────────┘ └─────────┴───────┴─────────────┘
+
+Postings lists are sorted, delta encoded series ids prefixed by their count
+and their size in bytes so they can be skipped without being decoded.
+
+┌──────────────────────────────────────┐
+│               Postings               │
+├──────────┬──────────┬────────────────┤
+│ Series N │   Size   │   Series IDs   │
+│ uvarint  │ uvarint  │   N uvarints   │
+└──────────┴──────────┴────────────────┘
+
+The tombstone table holds the sorted ids of series in older index files which
+were deleted by the files this file was written from.
+
+The trailer is a fixed size block of big endian uint64 values locating the
+tables within the file.
+
+┌───────────────────────────────────────────────────────────────────────────┐
+│                                  Trailer                                  │
+├─────────┬─────────┬─────────┬─────────────┬───────┬───────────┬─────┬─────┤
+│Key Table│ID Table │Series N │ Measurement │ Mmt N │ Tombstone │ Tomb│ Max │
+│ Offset  │ Offset  │         │Table Offset │       │Tbl Offset │  N  │ ID  │
+│ 8 bytes │ 8 bytes │ 8 bytes │   8 bytes   │8 bytes│  8 bytes  │8 b. │8 b. │
+└─────────┴─────────┴─────────┴─────────────┴───────┴───────────┴─────┴─────┘
+*/
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+const (
+	// IndexFileMagic is the magic number at the start of an index file.
+	IndexFileMagic = "TSI1"
+
+	// indexFileTrailerSize is the size of the fixed trailer in bytes.
+	indexFileTrailerSize = 8 * 8
+)
+
+// ErrInvalidIndexFile is returned when an index file is malformed.
+var ErrInvalidIndexFile = errors.New("invalid index file")
+
+// IndexFile represents an immutable, memory-mapped index file.
+type IndexFile struct {
+	path string
+	data []byte
+
+	keyTable         []byte
+	idTable          []byte
+	seriesN          int
+	measurementTable []byte
+	measurementN     int
+	tombstoneTable   []byte
+	tombstoneN       int
+	maxID            uint64
+}
+
+// NewIndexFile returns a new index file for path.
+func NewIndexFile(path string) *IndexFile {
+	return &IndexFile{path: path}
+}
+
+// Path returns the path of the index file.
+func (f *IndexFile) Path() string { return f.path }
+
+// Open memory maps the index file and validates its trailer.
+func (f *IndexFile) Open() error {
+	file, err := os.Open(f.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	fi, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.Size() < int64(len(IndexFileMagic)+indexFileTrailerSize) {
+		return fmt.Errorf("%s: %s", ErrInvalidIndexFile, f.path)
+	}
+
+	data, err := mmap(file, int(fi.Size()))
+	if err != nil {
+		return err
+	}
+	f.data = data
+
+	if err := f.unmarshal(); err != nil {
+		munmap(f.data)
+		f.data = nil
+		return fmt.Errorf("%s: %s", err, f.path)
+	}
+	return nil
+}
+
+// unmarshal locates the tables of the file using the trailer.
+func (f *IndexFile) unmarshal() error {
+	if !bytes.Equal(f.data[:len(IndexFileMagic)], []byte(IndexFileMagic)) {
+		return ErrInvalidIndexFile
+	}
+
+	t := f.data[len(f.data)-indexFileTrailerSize:]
+	keyTableOffset := binary.BigEndian.Uint64(t[0:8])
+	idTableOffset := binary.BigEndian.Uint64(t[8:16])
+	seriesN := binary.BigEndian.Uint64(t[16:24])
+	measurementTableOffset := binary.BigEndian.Uint64(t[24:32])
+	measurementN := binary.BigEndian.Uint64(t[32:40])
+	tombstoneTableOffset := binary.BigEndian.Uint64(t[40:48])
+	tombstoneN := binary.BigEndian.Uint64(t[48:56])
+	f.maxID = binary.BigEndian.Uint64(t[56:64])
+
+	end := uint64(len(f.data) - indexFileTrailerSize)
+	if keyTableOffset+seriesN*8 > end || idTableOffset+seriesN*16 > end ||
+		measurementTableOffset+measurementN*8 > end || tombstoneTableOffset+tombstoneN*8 > end {
+		return ErrInvalidIndexFile
+	}
+
+	f.seriesN, f.measurementN, f.tombstoneN = int(seriesN), int(measurementN), int(tombstoneN)
+	f.keyTable = f.data[keyTableOffset : keyTableOffset+seriesN*8]
+	f.idTable = f.data[idTableOffset : idTableOffset+seriesN*16]
+	f.measurementTable = f.data[measurementTableOffset : measurementTableOffset+measurementN*8]
+	f.tombstoneTable = f.data[tombstoneTableOffset : tombstoneTableOffset+tombstoneN*8]
+	return nil
+}
+
+// Close unmaps the index file.
+func (f *IndexFile) Close() error {
+	if f.data == nil {
+		return nil
+	}
+	err := munmap(f.data)
+	f.data = nil
+	return err
+}
+
+// Size returns the size of the file in bytes.
+func (f *IndexFile) Size() int64 { return int64(len(f.data)) }
+
+// SeriesN returns the number of series in the file.
+func (f *IndexFile) SeriesN() int { return f.seriesN }
+
+// MaxID returns the highest series id allocated when the file was written.
+func (f *IndexFile) MaxID() uint64 { return f.maxID }
+
+// seriesAt decodes the series entry at offset.
+func (f *IndexFile) seriesAt(offset uint64) (id uint64, name, key []byte) {
+	b := f.data[offset:]
+	id, b = binary.BigEndian.Uint64(b[:8]), b[8:]
+	name, n := readLenPrefixed(b)
+	key, _ = readLenPrefixed(b[n:])
+	return id, name, key
+}
+
+// SeriesID returns the id of the series key, or zero if it does not exist.
+func (f *IndexFile) SeriesID(key string) uint64 {
+	i := sort.Search(f.seriesN, func(i int) bool {
+		_, _, k := f.seriesAt(binary.BigEndian.Uint64(f.keyTable[i*8:]))
+		return string(k) >= key
+	})
+	if i >= f.seriesN {
+		return 0
+	}
+
+	id, _, k := f.seriesAt(binary.BigEndian.Uint64(f.keyTable[i*8:]))
+	if string(k) != key {
+		return 0
+	}
+	return id
+}
+
+// Series returns the measurement name and key of a series by id.
+func (f *IndexFile) Series(id uint64) (name, key string, ok bool) {
+	i := sort.Search(f.seriesN, func(i int) bool {
+		return binary.BigEndian.Uint64(f.idTable[i*16:]) >= id
+	})
+	if i >= f.seriesN || binary.BigEndian.Uint64(f.idTable[i*16:]) != id {
+		return "", "", false
+	}
+
+	_, n, k := f.seriesAt(binary.BigEndian.Uint64(f.idTable[i*16+8:]))
+	return string(n), string(k), true
+}
+
+// ForEachSeries calls fn for every series in the file in key order.
+func (f *IndexFile) ForEachSeries(fn func(id uint64, name, key string)) {
+	for i := 0; i < f.seriesN; i++ {
+		id, name, key := f.seriesAt(binary.BigEndian.Uint64(f.keyTable[i*8:]))
+		fn(id, string(name), string(key))
+	}
+}
+
+// seriesIterator returns an iterator over the series in key order.
+func (f *IndexFile) seriesIterator() seriesIterator {
+	return &indexFileSeriesIterator{f: f}
+}
+
+// IsTombstoned returns true if the file deletes a series of an older file.
+func (f *IndexFile) IsTombstoned(id uint64) bool {
+	i := sort.Search(f.tombstoneN, func(i int) bool {
+		return binary.BigEndian.Uint64(f.tombstoneTable[i*8:]) >= id
+	})
+	return i < f.tombstoneN && binary.BigEndian.Uint64(f.tombstoneTable[i*8:]) == id
+}
+
+// Tombstones returns the ids of series of older files deleted by the file.
+func (f *IndexFile) Tombstones() []uint64 {
+	a := make([]uint64, f.tombstoneN)
+	for i := range a {
+		a[i] = binary.BigEndian.Uint64(f.tombstoneTable[i*8:])
+	}
+	return a
+}
+
+// measurementNameAt returns the name of the measurement entry at index i.
+func (f *IndexFile) measurementNameAt(i int) []byte {
+	name, _ := readLenPrefixed(f.data[binary.BigEndian.Uint64(f.measurementTable[i*8:]):])
+	return name
+}
+
+// MeasurementNames returns the sorted names of all measurements in the file.
+func (f *IndexFile) MeasurementNames() []string {
+	a := make([]string, f.measurementN)
+	for i := range a {
+		a[i] = string(f.measurementNameAt(i))
+	}
+	return a
+}
+
+// measurement returns the postings and tag key table of a measurement.
+func (f *IndexFile) measurement(name string) (p postings, tags offsetTable, ok bool) {
+	i := sort.Search(f.measurementN, func(i int) bool {
+		return string(f.measurementNameAt(i)) >= name
+	})
+	if i >= f.measurementN || string(f.measurementNameAt(i)) != name {
+		return postings{}, nil, false
+	}
+
+	b := f.data[binary.BigEndian.Uint64(f.measurementTable[i*8:]):]
+	_, n := readLenPrefixed(b)
+	p, b = readPostings(b[n:])
+	return p, readOffsetTable(b), true
+}
+
+// tagKey returns the tag value table of a tag key in a measurement.
+func (f *IndexFile) tagKey(name, key string) (values offsetTable, ok bool) {
+	_, tags, ok := f.measurement(name)
+	if !ok {
+		return nil, false
+	}
+
+	b, ok := tags.search(f.data, key)
+	if !ok {
+		return nil, false
+	}
+	_, n := readLenPrefixed(b)
+	return readOffsetTable(b[n:]), true
+}
+
+// measurementPostings returns the postings of the series in a measurement.
+func (f *IndexFile) measurementPostings(name string) postings {
+	p, _, _ := f.measurement(name)
+	return p
+}
+
+// tagValuePostings returns the postings of the series with a tag value.
+func (f *IndexFile) tagValuePostings(name, key, value string) postings {
+	values, ok := f.tagKey(name, key)
+	if !ok {
+		return postings{}
+	}
+
+	b, ok := values.search(f.data, value)
+	if !ok {
+		return postings{}
+	}
+	_, n := readLenPrefixed(b)
+	p, _ := readPostings(b[n:])
+	return p
+}
+
+// forEachTagValue calls fn with each value of a tag key in a measurement and
+// the postings of the series with that value, in value order.
+func (f *IndexFile) forEachTagValue(name, key string, fn func(value string, p postings)) {
+	values, _ := f.tagKey(name, key)
+	for i := 0; i < values.len(); i++ {
+		b := values.entry(f.data, i)
+		value, n := readLenPrefixed(b)
+		p, _ := readPostings(b[n:])
+		fn(string(value), p)
+	}
+}
+
+// MeasurementSeriesIDs returns the sorted ids of the series in a measurement.
+func (f *IndexFile) MeasurementSeriesIDs(name string) []uint64 {
+	return f.measurementPostings(name).ids()
+}
+
+// TagKeys returns the sorted tag keys of a measurement.
+func (f *IndexFile) TagKeys(name string) []string {
+	_, tags, _ := f.measurement(name)
+	a := make([]string, tags.len())
+	for i := range a {
+		key, _ := readLenPrefixed(tags.entry(f.data, i))
+		a[i] = string(key)
+	}
+	return a
+}
+
+// TagValues returns the sorted values of a tag key in a measurement.
+func (f *IndexFile) TagValues(name, key string) []string {
+	values, _ := f.tagKey(name, key)
+	a := make([]string, values.len())
+	for i := range a {
+		value, _ := readLenPrefixed(values.entry(f.data, i))
+		a[i] = string(value)
+	}
+	return a
+}
+
+// TagValueSeriesIDs returns the sorted ids of the series with a tag value.
+func (f *IndexFile) TagValueSeriesIDs(name, key, value string) []uint64 {
+	return f.tagValuePostings(name, key, value).ids()
+}
+
+// indexFileSeriesIterator iterates over the series of an index file.
+type indexFileSeriesIterator struct {
+	f *IndexFile
+	i int
+}
+
+func (itr *indexFileSeriesIterator) Next() (id uint64, name, key string, ok bool) {
+	if itr.i >= itr.f.seriesN {
+		return 0, "", "", false
+	}
+	id, n, k := itr.f.seriesAt(binary.BigEndian.Uint64(itr.f.keyTable[itr.i*8:]))
+	itr.i++
+	return id, string(n), string(k), true
+}
+
+// offsetTable is a table of big endian offsets of entries which start with
+// a length prefixed name, sorted by name.
+type offsetTable []byte
+
+// readOffsetTable decodes the count and table of offsets at the start of b.
+func readOffsetTable(b []byte) offsetTable {
+	n, sz := binary.Uvarint(b)
+	if sz <= 0 || uint64(len(b)-sz) < n*8 {
+		return nil
+	}
+	return offsetTable(b[sz : sz+int(n)*8])
+}
+
+func (t offsetTable) len() int { return len(t) / 8 }
+
+// entry returns the data of the file from the i-th entry onwards.
+func (t offsetTable) entry(data []byte, i int) []byte {
+	return data[binary.BigEndian.Uint64(t[i*8:]):]
+}
+
+// search returns the data of the file from the entry named name onwards.
+func (t offsetTable) search(data []byte, name string) ([]byte, bool) {
+	i := sort.Search(t.len(), func(i int) bool {
+		s, _ := readLenPrefixed(t.entry(data, i))
+		return string(s) >= name
+	})
+	if i >= t.len() {
+		return nil, false
+	}
+
+	b := t.entry(data, i)
+	if s, _ := readLenPrefixed(b); string(s) != name {
+		return nil, false
+	}
+	return b, true
+}
+
+// postings is a sorted, delta encoded postings list which is decoded as it
+// is iterated.
+type postings struct {
+	n    uint64
+	b    []byte
+	prev uint64
+}
+
+// readPostings returns the postings list at the start of b and the remaining
+// bytes.
+func readPostings(b []byte) (postings, []byte) {
+	n, sz := binary.Uvarint(b)
+	if sz <= 0 {
+		return postings{}, nil
+	}
+	b = b[sz:]
+
+	size, sz := binary.Uvarint(b)
+	if sz <= 0 || uint64(len(b)-sz) < size {
+		return postings{}, nil
+	}
+	return postings{n: n, b: b[sz : sz+int(size)]}, b[sz+int(size):]
+}
+
+// next returns the next id in the list and false once the list is exhausted.
+func (p *postings) next() (uint64, bool) {
+	if p.n == 0 {
+		return 0, false
+	}
+	delta, sz := binary.Uvarint(p.b)
+	if sz <= 0 {
+		p.n = 0
+		return 0, false
+	}
+	p.b, p.n = p.b[sz:], p.n-1
+	p.prev += delta
+	return p.prev, true
+}
+
+// ids decodes the remaining ids of the list.
+func (p postings) ids() []uint64 {
+	a := make([]uint64, 0, p.n)
+	for id, ok := p.next(); ok; id, ok = p.next() {
+		a = append(a, id)
+	}
+	return a
+}
+
+// seriesIterator iterates over series in key order.
+type seriesIterator interface {
+	Next() (id uint64, name, key string, ok bool)
+}
+
+// indexFileSource is a file which can be compacted into an index file.
+type indexFileSource interface {
+	seriesIterator() seriesIterator
+	Series(id uint64) (name, key string, ok bool)
+	IsTombstoned(id uint64) bool
+	Tombstones() []uint64
+	MeasurementNames() []string
+	MeasurementSeriesIDs(name string) []uint64
+	TagKeys(name string) []string
+	TagValues(name, key string) []string
+	TagValueSeriesIDs(name, key, value string) []uint64
+}
+
+// IndexFileSeries represents a series to be written to an index file.
+type IndexFileSeries struct {
+	ID   uint64
+	Name string
+	Key  string
+}
+
+// WriteIndexFile writes an index file containing series to w. MaxID is the
+// highest series id allocated so far, which may belong to a deleted series.
+func WriteIndexFile(w io.Writer, series []IndexFileSeries, maxID uint64) error {
+	f := NewLogFile("")
+	for _, s := range series {
+		f.apply(&LogEntry{Flag: LogEntrySeriesAdd, ID: s.ID, Name: s.Name, Key: s.Key})
+	}
+	return writeIndexFile(w, []indexFileSource{f}, true, maxID)
+}
+
+// writeIndexFile merges the series of srcs into an index file written to w.
+// Series deleted by any of the files are left out. Tombstones of series in
+// other files are kept, unless full is set because srcs includes the oldest
+// file of the index. Only one measurement is held in memory at a time.
+func writeIndexFile(w io.Writer, srcs []indexFileSource, full bool, maxID uint64) error {
+	bw := bufio.NewWriter(w)
+	iw := &indexFileWriter{w: bw}
+
+	isDeleted := func(id uint64) bool {
+		for _, src := range srcs {
+			if src.IsTombstoned(id) {
+				return true
+			}
+		}
+		return false
+	}
+
+	iw.write([]byte(IndexFileMagic))
+
+	// Write the series block in key order, recording each entry's offset.
+	itrs := make([]seriesIterator, len(srcs))
+	for i, src := range srcs {
+		itrs[i] = src.seriesIterator()
+	}
+	var keyOffsets []uint64
+	var byID idOffsets
+	mergeSeries(itrs, func(id uint64, name, key string) {
+		if isDeleted(id) {
+			return
+		}
+		keyOffsets = append(keyOffsets, uint64(iw.n))
+		byID = append(byID, idOffset{id: id, offset: uint64(iw.n)})
+
+		iw.writeUint64(id)
+		iw.writeLenPrefixed(name)
+		iw.writeLenPrefixed(key)
+	})
+
+	// Write key table in key order.
+	keyTableOffset := uint64(iw.n)
+	for _, off := range keyOffsets {
+		iw.writeUint64(off)
+	}
+
+	// Write id table in id order.
+	idTableOffset := uint64(iw.n)
+	sort.Sort(byID)
+	for _, e := range byID {
+		iw.writeUint64(e.id)
+		iw.writeUint64(e.offset)
+	}
+
+	// Write the entries of each measurement followed by the measurement table.
+	var names []string
+	for _, src := range srcs {
+		names = unionStrings(names, src.MeasurementNames())
+	}
+	var mmOffsets []uint64
+	for _, name := range names {
+		if off, ok := writeMeasurement(iw, srcs, name, isDeleted); ok {
+			mmOffsets = append(mmOffsets, off)
+		}
+	}
+
+	measurementTableOffset := uint64(iw.n)
+	for _, off := range mmOffsets {
+		iw.writeUint64(off)
+	}
+
+	// Write the tombstones of series which are not in the written files.
+	var tombstones []uint64
+	if !full {
+		set := make(map[uint64]struct{})
+		for _, src := range srcs {
+			for _, id := range src.Tombstones() {
+				set[id] = struct{}{}
+			}
+		}
+		for id := range set {
+			if !sourcesContain(srcs, id) {
+				tombstones = append(tombstones, id)
+			}
+		}
+		sort.Sort(uint64Slice(tombstones))
+	}
+
+	tombstoneTableOffset := uint64(iw.n)
+	for _, id := range tombstones {
+		iw.writeUint64(id)
+	}
+
+	// Write trailer.
+	iw.writeUint64(keyTableOffset)
+	iw.writeUint64(idTableOffset)
+	iw.writeUint64(uint64(len(keyOffsets)))
+	iw.writeUint64(measurementTableOffset)
+	iw.writeUint64(uint64(len(mmOffsets)))
+	iw.writeUint64(tombstoneTableOffset)
+	iw.writeUint64(uint64(len(tombstones)))
+	iw.writeUint64(maxID)
+
+	if iw.err != nil {
+		return iw.err
+	}
+	return bw.Flush()
+}
+
+// writeMeasurement writes the tag value, tag key and measurement entries of
+// a measurement and returns the offset of the measurement entry. Returns
+// false if the measurement has no live series.
+func writeMeasurement(iw *indexFileWriter, srcs []indexFileSource, name string, isDeleted func(uint64) bool) (uint64, bool) {
+	liveIDs := func(fn func(src indexFileSource) []uint64) []uint64 {
+		var ids []uint64
+		for _, src := range srcs {
+			for _, id := range fn(src) {
+				if !isDeleted(id) {
+					ids = append(ids, id)
+				}
+			}
+		}
+		return ids
+	}
+
+	ids := liveIDs(func(src indexFileSource) []uint64 { return src.MeasurementSeriesIDs(name) })
+	if len(ids) == 0 {
+		return 0, false
+	}
+
+	var keys []string
+	for _, src := range srcs {
+		keys = unionStrings(keys, src.TagKeys(name))
+	}
+
+	var keyOffsets []uint64
+	for _, key := range keys {
+		var values []string
+		for _, src := range srcs {
+			values = unionStrings(values, src.TagValues(name, key))
+		}
+
+		var valueOffsets []uint64
+		for _, value := range values {
+			ids := liveIDs(func(src indexFileSource) []uint64 { return src.TagValueSeriesIDs(name, key, value) })
+			if len(ids) == 0 {
+				continue
+			}
+			valueOffsets = append(valueOffsets, uint64(iw.n))
+			iw.writeLenPrefixed(value)
+			iw.writePostings(ids)
+		}
+		if len(valueOffsets) == 0 {
+			continue
+		}
+
+		keyOffsets = append(keyOffsets, uint64(iw.n))
+		iw.writeLenPrefixed(key)
+		iw.writeOffsetTable(valueOffsets)
+	}
+
+	off := uint64(iw.n)
+	iw.writeLenPrefixed(name)
+	iw.writePostings(ids)
+	iw.writeOffsetTable(keyOffsets)
+	return off, true
+}
+
+// mergeSeries calls fn for each series of the iterators in key order.
+func mergeSeries(itrs []seriesIterator, fn func(id uint64, name, key string)) {
+	type head struct {
+		id        uint64
+		name, key string
+		ok        bool
+	}
+
+	heads := make([]head, len(itrs))
+	for i, itr := range itrs {
+		heads[i].id, heads[i].name, heads[i].key, heads[i].ok = itr.Next()
+	}
+
+	for {
+		min := -1
+		for i := range heads {
+			if heads[i].ok && (min == -1 || heads[i].key < heads[min].key) {
+				min = i
+			}
+		}
+		if min == -1 {
+			return
+		}
+
+		h := heads[min]
+		fn(h.id, h.name, h.key)
+		heads[min].id, heads[min].name, heads[min].key, heads[min].ok = itrs[min].Next()
+	}
+}
+
+// sourcesContain returns true if any of srcs contains the series id.
+func sourcesContain(srcs []indexFileSource, id uint64) bool {
+	for _, src := range srcs {
+		if _, _, ok := src.Series(id); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// indexFileWriter tracks the number of bytes written and the first error.
+type indexFileWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (iw *indexFileWriter) write(b []byte) {
+	if iw.err != nil {
+		return
+	}
+	n, err := iw.w.Write(b)
+	iw.n += int64(n)
+	iw.err = err
+}
+
+func (iw *indexFileWriter) writeUint64(v uint64) {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], v)
+	iw.write(buf[:])
+}
+
+func (iw *indexFileWriter) writeUvarint(v uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	iw.write(buf[:binary.PutUvarint(buf[:], v)])
+}
+
+func (iw *indexFileWriter) writeLenPrefixed(s string) {
+	iw.writeUvarint(uint64(len(s)))
+	iw.write([]byte(s))
+}
+
+// writeOffsetTable writes a count followed by fixed size offsets.
+func (iw *indexFileWriter) writeOffsetTable(offsets []uint64) {
+	iw.writeUvarint(uint64(len(offsets)))
+	for _, off := range offsets {
+		iw.writeUint64(off)
+	}
+}
+
+// writePostings writes a delta encoded, sorted postings list.
+func (iw *indexFileWriter) writePostings(ids []uint64) {
+	sort.Sort(uint64Slice(ids))
+
+	var buf []byte
+	var tmp [binary.MaxVarintLen64]byte
+	var prev uint64
+	for _, id := range ids {
+		buf = append(buf, tmp[:binary.PutUvarint(tmp[:], id-prev)]...)
+		prev = id
+	}
+
+	iw.writeUvarint(uint64(len(ids)))
+	iw.writeUvarint(uint64(len(buf)))
+	iw.write(buf)
+}
+
+// idOffset is the offset of a series entry by id.
+type idOffset struct {
+	id     uint64
+	offset uint64
+}
+
+type idOffsets []idOffset
+
+func (a idOffsets) Len() int           { return len(a) }
+func (a idOffsets) Less(i, j int) bool { return a[i].id < a[j].id }
+func (a idOffsets) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+
+type uint64Slice []uint64
+
+func (a uint64Slice) Len() int           { return len(a) }
+func (a uint64Slice) Less(i, j int) bool { return a[i] < a[j] }
+func (a uint64Slice) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
@@ -0,0 +1,127 @@
+package tsi1_test
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/influxdata/influxdb/tsdb/index/tsi1"
+)
+
+// Ensure an index file can be written and read back.
+func TestIndexFile_WriteAndOpen(t *testing.T) {
+	f := MustCreateIndexFile([]tsi1.IndexFileSeries{
+		{ID: 3, Name: "mem", Key: "mem,host=serverA"},
+		{ID: 1, Name: "cpu", Key: "cpu,host=serverA,region=uswest"},
+		{ID: 2, Name: "cpu", Key: "cpu,host=serverB,region=uswest"},
+	}, 5)
+	defer f.Close()
+
+	if n := f.SeriesN(); n != 3 {
+		t.Fatalf("unexpected series count: %d", n)
+	} else if id := f.MaxID(); id != 5 {
+		t.Fatalf("unexpected max id: %d", id)
+	}
+
+	// Look up series by key and id.
+	if id := f.SeriesID("cpu,host=serverB,region=uswest"); id != 2 {
+		t.Fatalf("unexpected id: %d", id)
+	} else if id := f.SeriesID("cpu,host=serverC"); id != 0 {
+		t.Fatalf("unexpected id: %d", id)
+	}
+	if name, key, ok := f.Series(3); !ok || name != "mem" || key != "mem,host=serverA" {
+		t.Fatalf("unexpected series: %s %s %v", name, key, ok)
+	} else if _, _, ok := f.Series(4); ok {
+		t.Fatal("expected series to not exist")
+	}
+
+	// Read measurements and tag postings.
+	if names := f.MeasurementNames(); !reflect.DeepEqual(names, []string{"cpu", "mem"}) {
+		t.Fatalf("unexpected names: %v", names)
+	}
+
+	if ids := f.MeasurementSeriesIDs("cpu"); !reflect.DeepEqual(ids, []uint64{1, 2}) {
+		t.Fatalf("unexpected series ids: %v", ids)
+	} else if keys := f.TagKeys("cpu"); !reflect.DeepEqual(keys, []string{"host", "region"}) {
+		t.Fatalf("unexpected tag keys: %v", keys)
+	} else if values := f.TagValues("cpu", "host"); !reflect.DeepEqual(values, []string{"serverA", "serverB"}) {
+		t.Fatalf("unexpected tag values: %v", values)
+	} else if ids := f.TagValueSeriesIDs("cpu", "region", "uswest"); !reflect.DeepEqual(ids, []uint64{1, 2}) {
+		t.Fatalf("unexpected tag value series ids: %v", ids)
+	} else if ids := f.TagValueSeriesIDs("cpu", "host", "serverB"); !reflect.DeepEqual(ids, []uint64{2}) {
+		t.Fatalf("unexpected tag value series ids: %v", ids)
+	}
+
+	// Missing measurements, keys and values are empty.
+	if ids := f.MeasurementSeriesIDs("disk"); len(ids) != 0 {
+		t.Fatalf("unexpected series ids: %v", ids)
+	} else if values := f.TagValues("cpu", "zone"); len(values) != 0 {
+		t.Fatalf("unexpected tag values: %v", values)
+	} else if ids := f.TagValueSeriesIDs("cpu", "host", "serverC"); len(ids) != 0 {
+		t.Fatalf("unexpected tag value series ids: %v", ids)
+	}
+}
+
+// Ensure an empty index file can be written and read back.
+func TestIndexFile_Empty(t *testing.T) {
+	f := MustCreateIndexFile(nil, 0)
+	defer f.Close()
+
+	if n := f.SeriesN(); n != 0 {
+		t.Fatalf("unexpected series count: %d", n)
+	} else if names := f.MeasurementNames(); len(names) != 0 {
+		t.Fatalf("unexpected names: %v", names)
+	} else if id := f.SeriesID("cpu"); id != 0 {
+		t.Fatalf("unexpected id: %d", id)
+	}
+}
+
+// Ensure a truncated index file returns an error on open.
+func TestIndexFile_Open_ErrInvalid(t *testing.T) {
+	file, err := ioutil.TempFile("", "tsi1-index-file-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write([]byte("TSI1")); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	if err := tsi1.NewIndexFile(file.Name()).Open(); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+// IndexFile is a test wrapper for tsi1.IndexFile.
+type IndexFile struct {
+	*tsi1.IndexFile
+}
+
+// MustCreateIndexFile writes series to a temporary index file and opens it.
+// Panic on error.
+func MustCreateIndexFile(series []tsi1.IndexFileSeries, maxID uint64) *IndexFile {
+	file, err := ioutil.TempFile("", "tsi1-index-file-")
+	if err != nil {
+		panic(err)
+	}
+	defer file.Close()
+
+	if err := tsi1.WriteIndexFile(file, series, maxID); err != nil {
+		panic(err)
+	}
+
+	f := &IndexFile{IndexFile: tsi1.NewIndexFile(file.Name())}
+	if err := f.Open(); err != nil {
+		panic(err)
+	}
+	return f
+}
+
+// Close closes the index file and removes it from disk.
+func (f *IndexFile) Close() error {
+	defer os.Remove(f.Path())
+	return f.IndexFile.Close()
+}
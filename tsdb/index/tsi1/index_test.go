@@ -0,0 +1,331 @@
+package tsi1_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/influxdata/influxdb/influxql"
+	"github.com/influxdata/influxdb/models"
+	"github.com/influxdata/influxdb/tsdb"
+	"github.com/influxdata/influxdb/tsdb/index/tsi1"
+)
+
+// Ensure series can be created, dropped and reloaded across compactions.
+func TestIndex_CreateSeriesIfNotExists(t *testing.T) {
+	idx := MustOpenIndex()
+	defer idx.Close()
+
+	idx.MustCreateSeries("cpu,host=serverA,region=uswest", "cpu,host=serverB,region=useast", "mem,host=serverA")
+
+	for _, fn := range []func() error{func() error { return nil }, idx.Compact, idx.Reopen} {
+		if err := fn(); err != nil {
+			t.Fatal(err)
+		}
+
+		if n := idx.SeriesN(); n != 3 {
+			t.Fatalf("unexpected series count: %d", n)
+		} else if !idx.HasSeries("cpu,host=serverB,region=useast") {
+			t.Fatal("expected series")
+		} else if names := idx.MeasurementNames(); !reflect.DeepEqual(names, []string{"cpu", "mem"}) {
+			t.Fatalf("unexpected names: %v", names)
+		} else if keys := idx.TagKeys("cpu"); !reflect.DeepEqual(keys, []string{"host", "region"}) {
+			t.Fatalf("unexpected tag keys: %v", keys)
+		} else if values := idx.TagValues("cpu", "host"); !reflect.DeepEqual(values, []string{"serverA", "serverB"}) {
+			t.Fatalf("unexpected tag values: %v", values)
+		}
+	}
+
+	// Existing series are not duplicated.
+	idx.MustCreateSeries("cpu,host=serverA,region=uswest")
+	if n := idx.SeriesN(); n != 3 {
+		t.Fatalf("unexpected series count: %d", n)
+	}
+}
+
+// Ensure dropped series are removed from the index and stay removed after a
+// compaction and reopen.
+func TestIndex_DropSeries(t *testing.T) {
+	idx := MustOpenIndex()
+	defer idx.Close()
+
+	idx.MustCreateSeries("cpu,host=serverA", "cpu,host=serverB", "mem,host=serverA")
+	if err := idx.Compact(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Drop one series from the index file and one measurement.
+	if err := idx.DropSeries([]string{"cpu,host=serverA"}); err != nil {
+		t.Fatal(err)
+	} else if err := idx.DropMeasurement("mem"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, fn := range []func() error{idx.Reopen, idx.Compact, idx.Reopen} {
+		if err := fn(); err != nil {
+			t.Fatal(err)
+		}
+
+		if n := idx.SeriesN(); n != 1 {
+			t.Fatalf("unexpected series count: %d", n)
+		} else if idx.HasSeries("cpu,host=serverA") {
+			t.Fatal("expected series to be dropped")
+		} else if names := idx.MeasurementNames(); !reflect.DeepEqual(names, []string{"cpu"}) {
+			t.Fatalf("unexpected names: %v", names)
+		} else if values := idx.TagValues("cpu", "host"); !reflect.DeepEqual(values, []string{"serverB"}) {
+			t.Fatalf("unexpected tag values: %v", values)
+		}
+	}
+
+	// A dropped series can be recreated.
+	idx.MustCreateSeries("cpu,host=serverA")
+	if !idx.HasSeries("cpu,host=serverA") {
+		t.Fatal("expected series")
+	}
+}
+
+// Ensure log files left behind by an interrupted compaction are not applied twice.
+func TestIndex_Open_StaleLogFile(t *testing.T) {
+	idx := MustOpenIndex()
+	defer idx.Close()
+
+	idx.MustCreateSeries("cpu,host=serverA", "cpu,host=serverB")
+
+	// Copy the log file before compacting it away.
+	paths, _ := filepath.Glob(filepath.Join(idx.Path(), "*.tsl"))
+	if len(paths) != 1 {
+		t.Fatalf("unexpected log files: %v", paths)
+	}
+	buf, err := ioutil.ReadFile(paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	idx.MustCreateSeries("cpu,host=serverC")
+
+	// Restore the log file and reopen.
+	if err := idx.Index.Close(); err != nil {
+		t.Fatal(err)
+	} else if err := ioutil.WriteFile(paths[0], buf, 0666); err != nil {
+		t.Fatal(err)
+	} else if err := idx.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := idx.SeriesN(); n != 3 {
+		t.Fatalf("unexpected series count: %d", n)
+	}
+
+	// New series ids must not collide with existing ones.
+	idx.MustCreateSeries("cpu,host=serverD")
+	if n := idx.SeriesN(); n != 4 {
+		t.Fatalf("unexpected series count: %d", n)
+	}
+}
+
+// Ensure the log is compacted in the background once it exceeds its maximum size.
+func TestIndex_Compact_MaxLogFileSize(t *testing.T) {
+	idx := MustOpenIndex()
+	defer idx.Close()
+	idx.MaxLogFileSize = 256
+
+	for _, host := range []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k", "l"} {
+		idx.MustCreateSeries("cpu,host=server" + host)
+	}
+
+	// Closing waits for the compaction to complete.
+	if err := idx.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+
+	if paths, _ := filepath.Glob(filepath.Join(idx.Path(), "*."+tsi1.IndexFileExtension)); len(paths) == 0 {
+		t.Fatal("expected index file")
+	} else if n := idx.SeriesN(); n != 12 {
+		t.Fatalf("unexpected series count: %d", n)
+	}
+}
+
+// Ensure index files of similar size are merged and that deletions of series
+// in older index files are kept until the files are merged.
+func TestIndex_Compact_Merge(t *testing.T) {
+	idx := MustOpenIndex()
+	defer idx.Close()
+
+	idx.MustCreateSeries("cpu,host=serverA", "cpu,host=serverB", "mem,host=serverA")
+	if err := idx.Compact(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Add a much smaller file which deletes a series of the first file.
+	if err := idx.DropSeries([]string{"cpu,host=serverA"}); err != nil {
+		t.Fatal(err)
+	} else if err := idx.Compact(); err != nil {
+		t.Fatal(err)
+	}
+
+	paths, _ := filepath.Glob(filepath.Join(idx.Path(), "*."+tsi1.IndexFileExtension))
+	if len(paths) != 2 {
+		t.Fatalf("unexpected index files: %v", paths)
+	}
+
+	for _, fn := range []func() error{func() error { return nil }, idx.Reopen} {
+		if err := fn(); err != nil {
+			t.Fatal(err)
+		}
+
+		if n := idx.SeriesN(); n != 2 {
+			t.Fatalf("unexpected series count: %d", n)
+		} else if idx.HasSeries("cpu,host=serverA") {
+			t.Fatal("expected series to be dropped")
+		} else if values := idx.TagValues("cpu", "host"); !reflect.DeepEqual(values, []string{"serverB"}) {
+			t.Fatalf("unexpected tag values: %v", values)
+		}
+	}
+
+	// Adding a file of similar size merges all files.
+	idx.MustCreateSeries("cpu,host=serverC", "cpu,host=serverD", "disk,host=serverA")
+	if err := idx.Compact(); err != nil {
+		t.Fatal(err)
+	}
+
+	paths, _ = filepath.Glob(filepath.Join(idx.Path(), "*."+tsi1.IndexFileExtension))
+	if len(paths) != 1 {
+		t.Fatalf("unexpected index files: %v", paths)
+	}
+
+	for _, fn := range []func() error{func() error { return nil }, idx.Reopen} {
+		if err := fn(); err != nil {
+			t.Fatal(err)
+		}
+
+		if n := idx.SeriesN(); n != 5 {
+			t.Fatalf("unexpected series count: %d", n)
+		} else if names := idx.MeasurementNames(); !reflect.DeepEqual(names, []string{"cpu", "disk", "mem"}) {
+			t.Fatalf("unexpected names: %v", names)
+		} else if values := idx.TagValues("cpu", "host"); !reflect.DeepEqual(values, []string{"serverB", "serverC", "serverD"}) {
+			t.Fatalf("unexpected tag values: %v", values)
+		}
+	}
+}
+
+// Ensure tag sets are generated from a condition on tags and fields.
+func TestIndex_TagSets(t *testing.T) {
+	idx := MustOpenIndex()
+	defer idx.Close()
+
+	idx.MustCreateSeries("cpu,host=serverA,region=uswest", "cpu,host=serverB,region=useast")
+	if err := idx.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	idx.MustCreateSeries("cpu,host=serverC,region=uswest")
+
+	fields := &tsdb.MeasurementFields{Fields: map[string]*tsdb.Field{"value": {ID: 1, Name: "value", Type: influxql.Float}}}
+
+	tagSets, err := idx.TagSets("cpu", []string{"region"}, influxql.MustParseExpr(`host != 'serverA' AND value > 10`), fields)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(tagSets) != 2 {
+		t.Fatalf("unexpected tag set count: %d", len(tagSets))
+	}
+
+	if ts := tagSets[0]; !reflect.DeepEqual(ts.Tags, map[string]string{"region": "useast"}) || !reflect.DeepEqual(ts.SeriesKeys, []string{"cpu,host=serverB,region=useast"}) {
+		t.Fatalf("unexpected tag set(0): %#v", ts)
+	} else if ts.Filters[0].String() != `value > 10.000` {
+		t.Fatalf("unexpected filter: %s", ts.Filters[0])
+	}
+	if ts := tagSets[1]; !reflect.DeepEqual(ts.Tags, map[string]string{"region": "uswest"}) || !reflect.DeepEqual(ts.SeriesKeys, []string{"cpu,host=serverC,region=uswest"}) {
+		t.Fatalf("unexpected tag set(1): %#v", ts)
+	}
+}
+
+// Ensure measurements can be filtered by name and tag expressions.
+func TestIndex_MeasurementNamesByExpr(t *testing.T) {
+	idx := MustOpenIndex()
+	defer idx.Close()
+
+	idx.MustCreateSeries("cpu,host=serverA,region=uswest", "disk,host=serverB", "mem,region=useast")
+
+	for _, tt := range []struct {
+		expr  string
+		names []string
+		ok    bool
+	}{
+		{expr: `host = 'serverA'`, names: []string{"cpu"}, ok: true},
+		{expr: `region =~ /^us/`, names: []string{"cpu", "mem"}, ok: true},
+		{expr: `host = 'serverB' OR region = 'useast'`, names: []string{"disk", "mem"}, ok: true},
+		{expr: `"name" = 'disk'`, names: []string{"disk"}, ok: true},
+		{expr: `_tagKey = 'host'`, ok: false},
+	} {
+		names, ok, err := idx.MeasurementNamesByExpr(influxql.MustParseExpr(tt.expr))
+		if err != nil {
+			t.Fatalf("%s: %s", tt.expr, err)
+		} else if ok != tt.ok || !reflect.DeepEqual(names, tt.names) {
+			t.Fatalf("%s: unexpected names: %v (%v)", tt.expr, names, ok)
+		}
+	}
+
+	keys, err := idx.MeasurementSeriesKeysByExpr("cpu", influxql.MustParseExpr(`region = 'uswest'`))
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(keys, []string{"cpu,host=serverA,region=uswest"}) {
+		t.Fatalf("unexpected keys: %v", keys)
+	}
+}
+
+// Index is a test wrapper for tsi1.Index.
+type Index struct {
+	*tsi1.Index
+}
+
+// MustOpenIndex returns a new, open index in a temporary directory. Panic on error.
+func MustOpenIndex() *Index {
+	path, err := ioutil.TempDir("", "tsi1-index-")
+	if err != nil {
+		panic(err)
+	}
+
+	idx := &Index{Index: tsi1.NewIndex(path)}
+	idx.SetLogOutput(ioutil.Discard)
+	if err := idx.Open(); err != nil {
+		panic(err)
+	}
+	return idx
+}
+
+// Close closes the index and removes it from disk.
+func (idx *Index) Close() error {
+	defer os.RemoveAll(idx.Path())
+	return idx.Index.Close()
+}
+
+// Reopen closes and reopens the index.
+func (idx *Index) Reopen() error {
+	if err := idx.Index.Close(); err != nil {
+		return err
+	}
+	maxLogFileSize := idx.MaxLogFileSize
+
+	idx.Index = tsi1.NewIndex(idx.Path())
+	idx.MaxLogFileSize = maxLogFileSize
+	idx.SetLogOutput(ioutil.Discard)
+	return idx.Open()
+}
+
+// Compact compacts the current index, which may change after a reopen.
+func (idx *Index) Compact() error {
+	return idx.Index.Compact()
+}
+
+// MustCreateSeries creates series from keys. Panic on error.
+func (idx *Index) MustCreateSeries(keys ...string) {
+	for _, key := range keys {
+		_, tags, _ := models.ParseKey(key)
+		if err := idx.CreateSeriesIfNotExists(tsdb.MeasurementFromSeriesKey(key), key, tags); err != nil {
+			panic(err)
+		}
+	}
+}
@@ -0,0 +1,547 @@
+package tsi1
+
+/*
+A log file is an append-only file of series additions and deletions that have
+not yet been compacted into the index file. It is replayed into memory when the
+index is opened.
+
+┌────────────────────────────────────────────────────────────────────┐
+│                               Entry                                │
+├──────┬─────────┬──────────┬─────────┬─────────┬─────────┬──────────┤
+│ Flag │   ID    │ Name Len │  Name   │ Key Len │   Key   │ Checksum │
+│1 byte│ uvarint │ uvarint  │ N bytes │ uvarint │ N bytes │ 4 bytes  │
+└──────┴─────────┴──────────┴─────────┴─────────┴─────────┴──────────┘
+
+The checksum is a CRC32 of the preceding bytes of the entry. A partially
+written or corrupt entry at the end of the file is truncated on open.
+*/
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/influxdata/influxdb/models"
+)
+
+const (
+	// LogEntrySeriesAdd is the flag of a log entry that adds a series.
+	LogEntrySeriesAdd = byte(0x01)
+
+	// LogEntrySeriesDelete is the flag of a log entry that deletes a series.
+	LogEntrySeriesDelete = byte(0x02)
+)
+
+// errLogEntryCorrupt is returned when a log entry cannot be decoded.
+var errLogEntryCorrupt = errors.New("corrupt log entry")
+
+// LogEntry represents a single series addition or deletion in a log file.
+type LogEntry struct {
+	Flag byte
+	ID   uint64
+	Name string
+	Key  string
+}
+
+// AppendTo appends the binary encoding of the entry to b.
+func (e *LogEntry) AppendTo(b []byte) []byte {
+	start := len(b)
+
+	var buf [binary.MaxVarintLen64]byte
+	b = append(b, e.Flag)
+	b = append(b, buf[:binary.PutUvarint(buf[:], e.ID)]...)
+	b = append(b, buf[:binary.PutUvarint(buf[:], uint64(len(e.Name)))]...)
+	b = append(b, e.Name...)
+	b = append(b, buf[:binary.PutUvarint(buf[:], uint64(len(e.Key)))]...)
+	b = append(b, e.Key...)
+
+	var checksum [crc32.Size]byte
+	binary.BigEndian.PutUint32(checksum[:], crc32.ChecksumIEEE(b[start:]))
+	return append(b, checksum[:]...)
+}
+
+// UnmarshalBinary decodes the entry at the start of b and returns the number
+// of bytes read.
+func (e *LogEntry) UnmarshalBinary(b []byte) (int, error) {
+	data := b
+	if len(b) < 1 {
+		return 0, errLogEntryCorrupt
+	}
+	e.Flag, b = b[0], b[1:]
+	n := 1
+
+	id, sz := binary.Uvarint(b)
+	if sz <= 0 {
+		return 0, errLogEntryCorrupt
+	}
+	e.ID, b, n = id, b[sz:], n+sz
+
+	name, sz := readLenPrefixed(b)
+	if sz <= 0 {
+		return 0, errLogEntryCorrupt
+	}
+	e.Name, b, n = string(name), b[sz:], n+sz
+
+	key, sz := readLenPrefixed(b)
+	if sz <= 0 {
+		return 0, errLogEntryCorrupt
+	}
+	e.Key, b, n = string(key), b[sz:], n+sz
+
+	if len(b) < crc32.Size {
+		return 0, errLogEntryCorrupt
+	}
+	if binary.BigEndian.Uint32(b[:crc32.Size]) != crc32.ChecksumIEEE(data[:n]) {
+		return 0, errLogEntryCorrupt
+	}
+	return n + crc32.Size, nil
+}
+
+// LogFile represents an append-only log of series changes that have not yet
+// been compacted into an index file.
+type LogFile struct {
+	mu   sync.RWMutex
+	path string
+	file *os.File
+	w    *bufio.Writer
+	size int64
+
+	// In-memory view of the series added by this log.
+	series     map[string]uint64 // series key to id
+	seriesByID map[uint64]*logSeries
+	mms        map[string]*logMeasurement
+	maxID      uint64
+
+	// Series deleted by this log which were added by another file.
+	tombstones map[uint64]struct{}
+
+	// Minimum series id which will be replayed from the log. Additions with
+	// lower ids have already been compacted into the index file.
+	minID uint64
+}
+
+// logSeries is a series added by a log file.
+type logSeries struct {
+	name string
+	key  string
+	tags map[string]string
+}
+
+// logMeasurement is the in-memory index of a measurement in a log file.
+type logMeasurement struct {
+	name   string
+	series map[uint64]struct{}
+	tagSet map[string]map[string]map[uint64]struct{} // tag key to value to series ids
+}
+
+// NewLogFile returns a new log file for path.
+func NewLogFile(path string) *LogFile {
+	return &LogFile{
+		path:       path,
+		series:     make(map[string]uint64),
+		seriesByID: make(map[uint64]*logSeries),
+		mms:        make(map[string]*logMeasurement),
+		tombstones: make(map[uint64]struct{}),
+	}
+}
+
+// Path returns the path of the log file.
+func (f *LogFile) Path() string { return f.path }
+
+// Open opens the log file, replaying any existing entries into memory.
+func (f *LogFile) Open() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	file, err := os.OpenFile(f.path, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return err
+	}
+	f.file = file
+
+	buf, err := readAll(file)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	// Replay entries until the end of the file or the first corrupt entry.
+	var pos int
+	for pos < len(buf) {
+		var e LogEntry
+		n, err := e.UnmarshalBinary(buf[pos:])
+		if err != nil {
+			break
+		}
+		f.apply(&e)
+		pos += n
+	}
+
+	// Truncate any partially written entries from the end of the file.
+	if pos < len(buf) {
+		if err := file.Truncate(int64(pos)); err != nil {
+			file.Close()
+			return fmt.Errorf("truncate log file %s: %s", f.path, err)
+		}
+	}
+	if _, err := file.Seek(int64(pos), os.SEEK_SET); err != nil {
+		file.Close()
+		return err
+	}
+	f.size = int64(pos)
+	f.w = bufio.NewWriter(file)
+
+	return nil
+}
+
+// Close closes the log file.
+func (f *LogFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+	if err := f.w.Flush(); err != nil {
+		return err
+	}
+	err := f.file.Close()
+	f.file, f.w = nil, nil
+	return err
+}
+
+// Size returns the size of the log file in bytes.
+func (f *LogFile) Size() int64 {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.size
+}
+
+// SetMinID sets the lowest series id that is considered to be added by the
+// log. It is set to one past the maximum id of the index file so that
+// additions which were already compacted are ignored.
+func (f *LogFile) SetMinID(id uint64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.minID = id
+	for sid, s := range f.seriesByID {
+		if sid < id {
+			f.removeSeries(sid, s)
+		}
+	}
+}
+
+// MaxID returns the highest series id added by the log.
+func (f *LogFile) MaxID() uint64 {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.maxID
+}
+
+// AddSeries appends a series addition to the log.
+func (f *LogFile) AddSeries(id uint64, name, key string) error {
+	return f.append(&LogEntry{Flag: LogEntrySeriesAdd, ID: id, Name: name, Key: key})
+}
+
+// DeleteSeries appends a series deletion to the log.
+func (f *LogFile) DeleteSeries(id uint64) error {
+	return f.append(&LogEntry{Flag: LogEntrySeriesDelete, ID: id})
+}
+
+// append writes an entry to the log file and applies it to the in-memory view.
+func (f *LogFile) append(e *LogEntry) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return ErrIndexClosed
+	}
+
+	b := e.AppendTo(nil)
+	if _, err := f.w.Write(b); err != nil {
+		return err
+	}
+	if err := f.w.Flush(); err != nil {
+		return err
+	}
+	f.size += int64(len(b))
+
+	f.apply(e)
+	return nil
+}
+
+// apply applies an entry to the in-memory view of the log.
+func (f *LogFile) apply(e *LogEntry) {
+	switch e.Flag {
+	case LogEntrySeriesAdd:
+		if e.ID < f.minID {
+			return
+		}
+		if _, ok := f.series[e.Key]; ok {
+			return
+		}
+
+		_, tags, _ := models.ParseKey(e.Key)
+		s := &logSeries{name: e.Name, key: e.Key, tags: tags}
+		f.series[e.Key] = e.ID
+		f.seriesByID[e.ID] = s
+		if e.ID > f.maxID {
+			f.maxID = e.ID
+		}
+
+		mm := f.mms[e.Name]
+		if mm == nil {
+			mm = &logMeasurement{
+				name:   e.Name,
+				series: make(map[uint64]struct{}),
+				tagSet: make(map[string]map[string]map[uint64]struct{}),
+			}
+			f.mms[e.Name] = mm
+		}
+		mm.series[e.ID] = struct{}{}
+		for k, v := range tags {
+			values := mm.tagSet[k]
+			if values == nil {
+				values = make(map[string]map[uint64]struct{})
+				mm.tagSet[k] = values
+			}
+			ids := values[v]
+			if ids == nil {
+				ids = make(map[uint64]struct{})
+				values[v] = ids
+			}
+			ids[e.ID] = struct{}{}
+		}
+
+	case LogEntrySeriesDelete:
+		if s := f.seriesByID[e.ID]; s != nil {
+			f.removeSeries(e.ID, s)
+			return
+		}
+		f.tombstones[e.ID] = struct{}{}
+	}
+}
+
+// removeSeries removes a series added by this log from the in-memory view.
+func (f *LogFile) removeSeries(id uint64, s *logSeries) {
+	delete(f.series, s.key)
+	delete(f.seriesByID, id)
+
+	mm := f.mms[s.name]
+	if mm == nil {
+		return
+	}
+	delete(mm.series, id)
+	for k, v := range s.tags {
+		values := mm.tagSet[k]
+		if values == nil {
+			continue
+		}
+		delete(values[v], id)
+		if len(values[v]) == 0 {
+			delete(values, v)
+		}
+		if len(values) == 0 {
+			delete(mm.tagSet, k)
+		}
+	}
+	if len(mm.series) == 0 {
+		delete(f.mms, s.name)
+	}
+}
+
+// SeriesID returns the id of a series added by the log, or zero.
+func (f *LogFile) SeriesID(key string) uint64 {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.series[key]
+}
+
+// Series returns the measurement name and key of a series added by the log.
+func (f *LogFile) Series(id uint64) (name, key string, ok bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	s := f.seriesByID[id]
+	if s == nil {
+		return "", "", false
+	}
+	return s.name, s.key, true
+}
+
+// IsTombstoned returns true if the log deletes a series added by another file.
+func (f *LogFile) IsTombstoned(id uint64) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	_, ok := f.tombstones[id]
+	return ok
+}
+
+// Tombstones returns the ids of series deleted by the log which were added by
+// another file.
+func (f *LogFile) Tombstones() []uint64 {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	a := make([]uint64, 0, len(f.tombstones))
+	for id := range f.tombstones {
+		a = append(a, id)
+	}
+	return a
+}
+
+// SeriesN returns the number of series added by the log.
+func (f *LogFile) SeriesN() int {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return len(f.seriesByID)
+}
+
+// ForEachSeries calls fn for every series added by the log.
+func (f *LogFile) ForEachSeries(fn func(id uint64, name, key string)) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	for id, s := range f.seriesByID {
+		fn(id, s.name, s.key)
+	}
+}
+
+// seriesIterator returns an iterator over the series added by the log in key
+// order.
+func (f *LogFile) seriesIterator() seriesIterator {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	itr := &logSeriesIterator{series: make([]*logSeries, 0, len(f.seriesByID))}
+	for _, s := range f.seriesByID {
+		itr.series = append(itr.series, s)
+	}
+	sort.Sort(logSeriesByKey(itr.series))
+	itr.ids = make([]uint64, len(itr.series))
+	for i, s := range itr.series {
+		itr.ids[i] = f.series[s.key]
+	}
+	return itr
+}
+
+// MeasurementNames returns the sorted names of measurements in the log.
+func (f *LogFile) MeasurementNames() []string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	a := make([]string, 0, len(f.mms))
+	for name := range f.mms {
+		a = append(a, name)
+	}
+	sort.Strings(a)
+	return a
+}
+
+// MeasurementSeriesIDs returns the unsorted ids of the series in a measurement.
+func (f *LogFile) MeasurementSeriesIDs(name string) []uint64 {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	mm := f.mms[name]
+	if mm == nil {
+		return nil
+	}
+	return idSetSlice(mm.series)
+}
+
+// TagKeys returns the unsorted tag keys of a measurement in the log.
+func (f *LogFile) TagKeys(name string) []string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	mm := f.mms[name]
+	if mm == nil {
+		return nil
+	}
+	a := make([]string, 0, len(mm.tagSet))
+	for k := range mm.tagSet {
+		a = append(a, k)
+	}
+	return a
+}
+
+// TagValues returns the unsorted values of a tag key in a measurement in the log.
+func (f *LogFile) TagValues(name, key string) []string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	mm := f.mms[name]
+	if mm == nil {
+		return nil
+	}
+	a := make([]string, 0, len(mm.tagSet[key]))
+	for v := range mm.tagSet[key] {
+		a = append(a, v)
+	}
+	return a
+}
+
+// TagValueSeriesIDs returns the unsorted ids of series with a tag value.
+func (f *LogFile) TagValueSeriesIDs(name, key, value string) []uint64 {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	mm := f.mms[name]
+	if mm == nil {
+		return nil
+	}
+	return idSetSlice(mm.tagSet[key][value])
+}
+
+// logSeriesIterator iterates over a sorted snapshot of the series of a log.
+type logSeriesIterator struct {
+	series []*logSeries
+	ids    []uint64
+}
+
+func (itr *logSeriesIterator) Next() (id uint64, name, key string, ok bool) {
+	if len(itr.series) == 0 {
+		return 0, "", "", false
+	}
+	s, id := itr.series[0], itr.ids[0]
+	itr.series, itr.ids = itr.series[1:], itr.ids[1:]
+	return id, s.name, s.key, true
+}
+
+type logSeriesByKey []*logSeries
+
+func (a logSeriesByKey) Len() int           { return len(a) }
+func (a logSeriesByKey) Less(i, j int) bool { return a[i].key < a[j].key }
+func (a logSeriesByKey) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+
+// idSetSlice converts a set of ids to a slice.
+func idSetSlice(m map[uint64]struct{}) []uint64 {
+	a := make([]uint64, 0, len(m))
+	for id := range m {
+		a = append(a, id)
+	}
+	return a
+}
+
+// readAll reads the remainder of a file into memory.
+func readAll(f *os.File) ([]byte, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, fi.Size())
+	if _, err := io.ReadFull(f, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// readLenPrefixed reads a uvarint length prefixed byte slice and returns the
+// slice and the total number of bytes read.
+func readLenPrefixed(b []byte) ([]byte, int) {
+	sz, n := binary.Uvarint(b)
+	if n <= 0 || uint64(len(b)-n) < sz {
+		return nil, 0
+	}
+	return b[n : n+int(sz)], n + int(sz)
+}
@@ -0,0 +1,147 @@
+package tsi1_test
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/influxdata/influxdb/tsdb/index/tsi1"
+)
+
+// Ensure a log file replays its entries when reopened.
+func TestLogFile_Open_Replay(t *testing.T) {
+	f := MustOpenLogFile()
+	defer f.Close()
+
+	if err := f.AddSeries(1, "cpu", "cpu,host=serverA"); err != nil {
+		t.Fatal(err)
+	} else if err := f.AddSeries(2, "cpu", "cpu,host=serverB"); err != nil {
+		t.Fatal(err)
+	} else if err := f.AddSeries(3, "mem", "mem,host=serverA"); err != nil {
+		t.Fatal(err)
+	} else if err := f.DeleteSeries(2); err != nil {
+		t.Fatal(err)
+	} else if err := f.DeleteSeries(10); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+
+	if id := f.SeriesID("cpu,host=serverA"); id != 1 {
+		t.Fatalf("unexpected id: %d", id)
+	} else if id := f.SeriesID("cpu,host=serverB"); id != 0 {
+		t.Fatalf("expected deleted series, got id %d", id)
+	} else if !f.IsTombstoned(10) {
+		t.Fatal("expected tombstone")
+	} else if names := f.MeasurementNames(); !reflect.DeepEqual(names, []string{"cpu", "mem"}) {
+		t.Fatalf("unexpected names: %v", names)
+	} else if values := f.TagValues("cpu", "host"); !reflect.DeepEqual(values, []string{"serverA"}) {
+		t.Fatalf("unexpected tag values: %v", values)
+	} else if id := f.MaxID(); id != 3 {
+		t.Fatalf("unexpected max id: %d", id)
+	}
+}
+
+// Ensure a partially written entry at the end of a log file is truncated.
+func TestLogFile_Open_TruncateCorruptEntry(t *testing.T) {
+	f := MustOpenLogFile()
+	defer f.Close()
+
+	if err := f.AddSeries(1, "cpu", "cpu,host=serverA"); err != nil {
+		t.Fatal(err)
+	} else if err := f.AddSeries(2, "cpu", "cpu,host=serverB"); err != nil {
+		t.Fatal(err)
+	}
+	size := f.Size()
+	if err := f.LogFile.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Cut the last entry short.
+	if err := os.Truncate(f.Path(), size-2); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+
+	if id := f.SeriesID("cpu,host=serverA"); id != 1 {
+		t.Fatalf("unexpected id: %d", id)
+	} else if id := f.SeriesID("cpu,host=serverB"); id != 0 {
+		t.Fatalf("expected truncated series, got id %d", id)
+	}
+
+	// Ensure new entries are appended after the valid entries.
+	if err := f.AddSeries(3, "cpu", "cpu,host=serverC"); err != nil {
+		t.Fatal(err)
+	} else if err := f.Reopen(); err != nil {
+		t.Fatal(err)
+	} else if id := f.SeriesID("cpu,host=serverC"); id != 3 {
+		t.Fatalf("unexpected id: %d", id)
+	}
+}
+
+// Ensure additions below the minimum id are ignored on replay.
+func TestLogFile_SetMinID(t *testing.T) {
+	f := MustOpenLogFile()
+	defer f.Close()
+
+	if err := f.AddSeries(1, "cpu", "cpu,host=serverA"); err != nil {
+		t.Fatal(err)
+	} else if err := f.AddSeries(2, "cpu", "cpu,host=serverB"); err != nil {
+		t.Fatal(err)
+	} else if err := f.LogFile.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	other := tsi1.NewLogFile(f.Path())
+	other.SetMinID(2)
+	if err := other.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+
+	ids := other.MeasurementSeriesIDs("cpu")
+	if !reflect.DeepEqual(ids, []uint64{2}) {
+		t.Fatalf("unexpected ids: %v", ids)
+	}
+}
+
+// LogFile is a test wrapper for tsi1.LogFile.
+type LogFile struct {
+	*tsi1.LogFile
+}
+
+// MustOpenLogFile returns a new, open log file in a temporary path. Panic on error.
+func MustOpenLogFile() *LogFile {
+	file, err := ioutil.TempFile("", "tsi1-log-file-")
+	if err != nil {
+		panic(err)
+	}
+	file.Close()
+
+	f := &LogFile{LogFile: tsi1.NewLogFile(file.Name())}
+	if err := f.Open(); err != nil {
+		panic(err)
+	}
+	return f
+}
+
+// Close closes the log file and removes it from disk.
+func (f *LogFile) Close() error {
+	defer os.Remove(f.Path())
+	return f.LogFile.Close()
+}
+
+// Reopen closes and reopens the log file.
+func (f *LogFile) Reopen() error {
+	if err := f.LogFile.Close(); err != nil {
+		return err
+	}
+	f.LogFile = tsi1.NewLogFile(f.Path())
+	return f.Open()
+}
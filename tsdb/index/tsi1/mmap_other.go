@@ -0,0 +1,22 @@
+// +build windows plan9 solaris
+
+package tsi1
+
+import (
+	"io"
+	"os"
+)
+
+// mmap reads the file into memory on platforms where the index does not
+// memory map its files.
+func mmap(f *os.File, length int) ([]byte, error) {
+	b := make([]byte, length)
+	if _, err := io.ReadFull(f, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func munmap(b []byte) error {
+	return nil
+}
@@ -0,0 +1,16 @@
+// +build !windows,!plan9,!solaris
+
+package tsi1
+
+import (
+	"os"
+	"syscall"
+)
+
+func mmap(f *os.File, length int) ([]byte, error) {
+	return syscall.Mmap(int(f.Fd()), 0, length, syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+func munmap(b []byte) error {
+	return syscall.Munmap(b)
+}
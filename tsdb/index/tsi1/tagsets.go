@@ -0,0 +1,457 @@
+package tsi1
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/influxdata/influxdb/influxql"
+	"github.com/influxdata/influxdb/models"
+	"github.com/influxdata/influxdb/tsdb"
+)
+
+// measurement is a read-only view of a measurement used while evaluating
+// expressions. Tag value postings are loaded from the index on demand.
+type measurement struct {
+	index     *Index
+	name      string
+	fields    *tsdb.MeasurementFields
+	seriesIDs tsdb.SeriesIDs
+	tagVals   map[string]map[string]tsdb.SeriesIDs
+}
+
+// newMeasurement returns a view of a measurement. The index lock must be held
+// for the lifetime of the view.
+func (i *Index) newMeasurement(name string, fields *tsdb.MeasurementFields) *measurement {
+	return &measurement{
+		index:     i,
+		name:      name,
+		fields:    fields,
+		seriesIDs: i.measurementSeriesIDs(name),
+		tagVals:   make(map[string]map[string]tsdb.SeriesIDs),
+	}
+}
+
+// hasField returns true if the measurement has a field by the given name.
+func (m *measurement) hasField(name string) bool {
+	if m.fields == nil {
+		return false
+	}
+	return m.fields.Fields[name] != nil
+}
+
+// tagValues returns the postings of each value of a tag key and true if the
+// tag key exists on the measurement.
+func (m *measurement) tagValues(key string) (map[string]tsdb.SeriesIDs, bool) {
+	values, ok := m.tagVals[key]
+	if !ok {
+		values = m.index.tagValueMap(m.name, key)
+		m.tagVals[key] = values
+	}
+	return values, len(values) > 0
+}
+
+// TagSets returns the tag sets of a measurement for the given dimensions and
+// condition. It produces the same result as tsdb.Measurement.TagSets.
+func (i *Index) TagSets(name string, dimensions []string, condition influxql.Expr, fields *tsdb.MeasurementFields) ([]*influxql.TagSet, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	m := i.newMeasurement(name, fields)
+
+	// get the unique set of series ids and the filters that should be applied to each
+	filters, err := m.filters(condition)
+	if err != nil {
+		return nil, err
+	}
+
+	// For every series, get the tag values for the requested tag keys i.e. dimensions. Series
+	// with the same TagSet are then grouped together for the purpose of GROUP BY.
+	tagSets := make(map[string]*influxql.TagSet)
+	for id, filter := range filters {
+		_, key, ok := i.series(id)
+		if !ok {
+			continue
+		}
+		_, seriesTags, _ := models.ParseKey(key)
+
+		tags := make(map[string]string, len(dimensions))
+		for _, dim := range dimensions {
+			tags[dim] = seriesTags[dim]
+		}
+
+		tagsAsKey := string(tsdb.MarshalTags(tags))
+		tagSet, ok := tagSets[tagsAsKey]
+		if !ok {
+			tagSet = &influxql.TagSet{Tags: tags, Key: tsdb.MarshalTags(tags)}
+			tagSets[tagsAsKey] = tagSet
+		}
+
+		// Associate the series and filter with the Tagset.
+		tagSet.AddFilter(key, filter)
+	}
+
+	// Return the tag sets sorted by key for consistency.
+	sortedTagSetKeys := make([]string, 0, len(tagSets))
+	for k := range tagSets {
+		sortedTagSetKeys = append(sortedTagSetKeys, k)
+	}
+	sort.Strings(sortedTagSetKeys)
+
+	sortedTagSets := make([]*influxql.TagSet, 0, len(sortedTagSetKeys))
+	for _, k := range sortedTagSetKeys {
+		sortedTagSets = append(sortedTagSets, tagSets[k])
+	}
+	return sortedTagSets, nil
+}
+
+// MeasurementSeriesKeysByExpr returns the sorted keys of the series in a
+// measurement matching a tag-only expression, or all series if expr is nil.
+func (i *Index) MeasurementSeriesKeysByExpr(name string, expr influxql.Expr) ([]string, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	m := i.newMeasurement(name, nil)
+	ids := m.seriesIDs
+	if expr != nil && len(ids) > 0 {
+		var err error
+		if ids, _, err = m.walkWhereForSeriesIDs(expr); err != nil {
+			return nil, err
+		}
+	}
+
+	keys := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if _, key, ok := i.series(id); ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// filters walks the condition and returns a map of all series ids matching
+// the condition to the filter expression that should be applied to each.
+func (m *measurement) filters(condition influxql.Expr) (map[uint64]influxql.Expr, error) {
+	if condition == nil || influxql.OnlyTimeExpr(condition) {
+		seriesIdsToExpr := make(map[uint64]influxql.Expr, len(m.seriesIDs))
+		for _, id := range m.seriesIDs {
+			seriesIdsToExpr[id] = nil
+		}
+		return seriesIdsToExpr, nil
+	}
+
+	ids, seriesIdsToExpr, err := m.walkWhereForSeriesIDs(condition)
+	if err != nil {
+		return nil, err
+	}
+
+	// Ensure every id is in the map and replace literal true expressions with
+	// nil so the engine doesn't waste time evaluating them.
+	for _, id := range ids {
+		if expr, ok := seriesIdsToExpr[id]; !ok {
+			seriesIdsToExpr[id] = nil
+		} else if b, ok := expr.(*influxql.BooleanLiteral); ok && b.Val {
+			seriesIdsToExpr[id] = nil
+		}
+	}
+	return seriesIdsToExpr, nil
+}
+
+// walkWhereForSeriesIDs recursively walks the WHERE clause and returns an
+// ordered set of series ids and a map from those ids to filter expressions.
+func (m *measurement) walkWhereForSeriesIDs(expr influxql.Expr) (tsdb.SeriesIDs, tsdb.FilterExprs, error) {
+	switch n := expr.(type) {
+	case *influxql.BinaryExpr:
+		switch n.Op {
+		case influxql.EQ, influxql.NEQ, influxql.LT, influxql.LTE, influxql.GT, influxql.GTE, influxql.EQREGEX, influxql.NEQREGEX:
+			ids, expr, err := m.idsForExpr(n)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			filters := tsdb.FilterExprs{}
+			for _, id := range ids {
+				filters[id] = expr
+			}
+			return ids, filters, nil
+		case influxql.AND, influxql.OR:
+			lids, lfilters, err := m.walkWhereForSeriesIDs(n.LHS)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			rids, rfilters, err := m.walkWhereForSeriesIDs(n.RHS)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			var ids tsdb.SeriesIDs
+			switch n.Op {
+			case influxql.AND:
+				ids = lids.Intersect(rids)
+			case influxql.OR:
+				ids = lids.Union(rids)
+			}
+
+			ids, filters := tsdb.MergeSeriesFilters(n.Op, ids, lfilters, rfilters)
+			return ids, filters, nil
+		}
+
+		ids, _, err := m.idsForExpr(n)
+		return ids, nil, err
+	case *influxql.ParenExpr:
+		return m.walkWhereForSeriesIDs(n.Expr)
+	default:
+		return nil, nil, nil
+	}
+}
+
+// idsForExpr returns the series ids matching a comparison and the filter
+// expression that should be used to filter points from those series.
+func (m *measurement) idsForExpr(n *influxql.BinaryExpr) (tsdb.SeriesIDs, influxql.Expr, error) {
+	name, ok := n.LHS.(*influxql.VarRef)
+	value := n.RHS
+	if !ok {
+		name, ok = n.RHS.(*influxql.VarRef)
+		if !ok {
+			return nil, nil, fmt.Errorf("invalid expression: %s", n.String())
+		}
+		value = n.LHS
+	}
+
+	// For time literals, return all series IDs and "true" as the filter.
+	if _, ok := value.(*influxql.TimeLiteral); ok || name.Val == "time" {
+		return m.seriesIDs, &influxql.BooleanLiteral{Val: true}, nil
+	}
+
+	// For fields, return all series IDs from this measurement and return
+	// the expression passed in, as the filter.
+	if name.Val != "name" && m.hasField(name.Val) {
+		return m.seriesIDs, n, nil
+	}
+
+	tagVals, ok := m.tagValues(name.Val)
+	if name.Val != "name" && !ok {
+		return nil, nil, nil
+	}
+
+	// if we're looking for series with a specific tag value
+	if str, ok := value.(*influxql.StringLiteral); ok {
+		var ids tsdb.SeriesIDs
+
+		// Special handling for "name" to match measurement name.
+		if name.Val == "name" {
+			if (n.Op == influxql.EQ && str.Val == m.name) || (n.Op == influxql.NEQ && str.Val != m.name) {
+				return m.seriesIDs, &influxql.BooleanLiteral{Val: true}, nil
+			}
+			return nil, &influxql.BooleanLiteral{Val: true}, nil
+		}
+
+		if n.Op == influxql.EQ {
+			ids = tagVals[str.Val]
+		} else if n.Op == influxql.NEQ {
+			ids = m.seriesIDs.Reject(tagVals[str.Val])
+		}
+		return ids, &influxql.BooleanLiteral{Val: true}, nil
+	}
+
+	// if we're looking for series with a tag value that matches a regex
+	if re, ok := value.(*influxql.RegexLiteral); ok {
+		var ids tsdb.SeriesIDs
+
+		// Special handling for "name" to match measurement name.
+		if name.Val == "name" {
+			match := re.Val.MatchString(m.name)
+			if (n.Op == influxql.EQREGEX && match) || (n.Op == influxql.NEQREGEX && !match) {
+				return m.seriesIDs, &influxql.BooleanLiteral{Val: true}, nil
+			}
+			return nil, &influxql.BooleanLiteral{Val: true}, nil
+		}
+
+		// The operation is a NEQREGEX, code must start by assuming all match, even
+		// series without any tags.
+		if n.Op == influxql.NEQREGEX {
+			ids = m.seriesIDs
+		}
+
+		for k := range tagVals {
+			match := re.Val.MatchString(k)
+
+			if match && n.Op == influxql.EQREGEX {
+				ids = ids.Union(tagVals[k])
+			} else if match && n.Op == influxql.NEQREGEX {
+				ids = ids.Reject(tagVals[k])
+			}
+		}
+		return ids, &influxql.BooleanLiteral{Val: true}, nil
+	}
+
+	return nil, nil, nil
+}
+
+// MeasurementNamesByExpr returns the sorted names of measurements matching a
+// tag-only expression. The bool return argument is false if the expression
+// was not a measurement expression and was therefore not evaluated.
+func (i *Index) MeasurementNamesByExpr(expr influxql.Expr) ([]string, bool, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.measurementNamesByExpr(expr)
+}
+
+func (i *Index) measurementNamesByExpr(expr influxql.Expr) ([]string, bool, error) {
+	switch e := expr.(type) {
+	case *influxql.BinaryExpr:
+		switch e.Op {
+		case influxql.EQ, influxql.NEQ, influxql.EQREGEX, influxql.NEQREGEX:
+			tag, ok := e.LHS.(*influxql.VarRef)
+			if !ok {
+				return nil, false, fmt.Errorf("left side of '%s' must be a tag key", e.Op.String())
+			}
+
+			tf := &tsdb.TagFilter{
+				Op:  e.Op,
+				Key: tag.Val,
+			}
+
+			if influxql.IsRegexOp(e.Op) {
+				re, ok := e.RHS.(*influxql.RegexLiteral)
+				if !ok {
+					return nil, false, fmt.Errorf("right side of '%s' must be a regular expression", e.Op.String())
+				}
+				tf.Regex = re.Val
+			} else {
+				s, ok := e.RHS.(*influxql.StringLiteral)
+				if !ok {
+					return nil, false, fmt.Errorf("right side of '%s' must be a tag value string", e.Op.String())
+				}
+				tf.Value = s.Val
+			}
+
+			// Match on name, if specified.
+			if tag.Val == "name" {
+				return i.measurementNamesByNameFilter(tf.Op, tf.Value, tf.Regex), true, nil
+			} else if influxql.IsSystemName(tag.Val) {
+				return nil, false, nil
+			}
+
+			return i.measurementNamesByTagFilter(tf), true, nil
+		case influxql.OR, influxql.AND:
+			lhs, lhsOk, err := i.measurementNamesByExpr(e.LHS)
+			if err != nil {
+				return nil, false, err
+			}
+
+			rhs, rhsOk, err := i.measurementNamesByExpr(e.RHS)
+			if err != nil {
+				return nil, false, err
+			}
+
+			if lhsOk && rhsOk {
+				if e.Op == influxql.OR {
+					return unionStrings(lhs, rhs), true, nil
+				}
+				return intersectStrings(lhs, rhs), true, nil
+			} else if lhsOk {
+				return lhs, true, nil
+			} else if rhsOk {
+				return rhs, true, nil
+			}
+			return nil, false, nil
+		default:
+			return nil, false, fmt.Errorf("invalid tag comparison operator")
+		}
+	case *influxql.ParenExpr:
+		return i.measurementNamesByExpr(e.Expr)
+	}
+	return nil, false, fmt.Errorf("%#v", expr)
+}
+
+// measurementNamesByNameFilter returns the sorted measurement names matching a name.
+func (i *Index) measurementNamesByNameFilter(op influxql.Token, val string, regex *regexp.Regexp) []string {
+	var names []string
+	for _, name := range i.measurementNames() {
+		var matched bool
+		switch op {
+		case influxql.EQ:
+			matched = name == val
+		case influxql.NEQ:
+			matched = name != val
+		case influxql.EQREGEX:
+			matched = regex.MatchString(name)
+		case influxql.NEQREGEX:
+			matched = !regex.MatchString(name)
+		}
+
+		if matched {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// measurementNamesByTagFilter returns the sorted measurement names matching a
+// filter on tag values.
+func (i *Index) measurementNamesByTagFilter(f *tsdb.TagFilter) []string {
+	var names []string
+	for _, name := range i.measurementNames() {
+		tagVals := i.tagValueMap(name, f.Key)
+		if len(tagVals) == 0 {
+			continue
+		}
+
+		var tagMatch bool
+		if f.Op == influxql.EQ || f.Op == influxql.NEQ {
+			_, tagMatch = tagVals[f.Value]
+		} else {
+			for tagVal := range tagVals {
+				if f.Regex.MatchString(tagVal) {
+					tagMatch = true
+					break
+				}
+			}
+		}
+
+		// The measurement matches if the tag matched on an equality operator or
+		// did not match on an inequality operator.
+		isEQ := (f.Op == influxql.EQ || f.Op == influxql.EQREGEX)
+		if tagMatch == isEQ {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// unionStrings returns the sorted union of two sorted string slices.
+func unionStrings(a, b []string) []string {
+	set := make(map[string]struct{}, len(a)+len(b))
+	for _, s := range a {
+		set[s] = struct{}{}
+	}
+	for _, s := range b {
+		set[s] = struct{}{}
+	}
+
+	other := make([]string, 0, len(set))
+	for s := range set {
+		other = append(other, s)
+	}
+	sort.Strings(other)
+	return other
+}
+
+// intersectStrings returns the sorted intersection of two sorted string slices.
+func intersectStrings(a, b []string) []string {
+	set := make(map[string]struct{}, len(b))
+	for _, s := range b {
+		set[s] = struct{}{}
+	}
+
+	var other []string
+	for _, s := range a {
+		if _, ok := set[s]; ok {
+			other = append(other, s)
+		}
+	}
+	return other
+}
@@ -0,0 +1,161 @@
+package tsdb
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// MaxEncryptionKeyIDLen is the longest key id, so that ids fit the one byte
+// length stored in front of them in data files.
+const MaxEncryptionKeyIDLen = 255
+
+// ErrDecryptionFailed is returned when encrypted data does not authenticate
+// with its key, because it is corrupt or was encrypted with a different key.
+var ErrDecryptionFailed = errors.New("decryption failed")
+
+// Keyring holds the AES-GCM keys used to encrypt data at rest. Data is
+// encrypted with the current key and records the id of its key, so data
+// encrypted with any key in the keyring can still be read after the current
+// key is rotated.
+type Keyring struct {
+	keys    map[string]*EncryptionKey
+	current *EncryptionKey
+}
+
+// NewKeyring returns an empty keyring.
+func NewKeyring() *Keyring {
+	return &Keyring{keys: make(map[string]*EncryptionKey)}
+}
+
+// LoadKeyring reads a keyring from a key file. Each line of the file holds
+// a key id and a hex encoded 16, 24 or 32 byte AES key separated by
+// whitespace. Blank lines and lines starting with "#" are ignored. The last
+// key in the file is the current key.
+func LoadKeyring(path string) (*Keyring, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	k := NewKeyring()
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected key id and key", path, n)
+		}
+
+		key, err := hex.DecodeString(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid key: %v", path, n, err)
+		}
+
+		if err := k.Add(fields[0], key); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, n, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if k.current == nil {
+		return nil, fmt.Errorf("%s: no encryption keys", path)
+	}
+	return k, nil
+}
+
+// Add adds a key to the keyring and makes it the current key.
+func (k *Keyring) Add(id string, key []byte) error {
+	if id == "" || len(id) > MaxEncryptionKeyIDLen {
+		return fmt.Errorf("key id must be 1 to %d bytes", MaxEncryptionKeyIDLen)
+	} else if _, ok := k.keys[id]; ok {
+		return fmt.Errorf("duplicate key id %q", id)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+
+	ek := &EncryptionKey{ID: id, aead: aead}
+	k.keys[id] = ek
+	k.current = ek
+	return nil
+}
+
+// Current returns the key new data is encrypted with.
+func (k *Keyring) Current() *EncryptionKey {
+	return k.current
+}
+
+// Key returns the key with the given id.
+func (k *Keyring) Key(id string) (*EncryptionKey, error) {
+	key, ok := k.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown encryption key %q", id)
+	}
+	return key, nil
+}
+
+// EncryptionKey is an AES-GCM key in a keyring.
+type EncryptionKey struct {
+	ID   string
+	aead cipher.AEAD
+}
+
+// Seal encrypts and authenticates plaintext and the additional data ad,
+// appending a random nonce followed by the ciphertext to dst.
+func (k *EncryptionKey) Seal(dst, plaintext, ad []byte) ([]byte, error) {
+	nonceSize := k.aead.NonceSize()
+
+	n := len(dst)
+	if cap(dst)-n < nonceSize+len(plaintext)+k.aead.Overhead() {
+		buf := make([]byte, n, n+nonceSize+len(plaintext)+k.aead.Overhead())
+		copy(buf, dst)
+		dst = buf
+	}
+
+	nonce := dst[n : n+nonceSize]
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return k.aead.Seal(dst[:n+nonceSize], nonce, plaintext, ad), nil
+}
+
+// Open decrypts data sealed with the same key and additional data, appending
+// the plaintext to dst. dst must not overlap sealed.
+func (k *EncryptionKey) Open(dst, sealed, ad []byte) ([]byte, error) {
+	nonceSize := k.aead.NonceSize()
+	if len(sealed) < nonceSize+k.aead.Overhead() {
+		return nil, ErrDecryptionFailed
+	}
+
+	b, err := k.aead.Open(dst, sealed[:nonceSize], sealed[nonceSize:], ad)
+	if err != nil {
+		return nil, ErrDecryptionFailed
+	}
+	return b, nil
+}
+
+// Overhead returns how many bytes longer sealed data is than its plaintext.
+func (k *EncryptionKey) Overhead() int {
+	return k.aead.NonceSize() + k.aead.Overhead()
+}
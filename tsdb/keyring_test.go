@@ -0,0 +1,88 @@
+package tsdb_test
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/influxdata/influxdb/tsdb"
+)
+
+func TestLoadKeyring(t *testing.T) {
+	path := MustWriteKeyFile(`
+# rotated 2016-06-01
+old 000102030405060708090a0b0c0d0e0f
+new 000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f
+`)
+	defer os.Remove(path)
+
+	k, err := tsdb.LoadKeyring(path)
+	if err != nil {
+		t.Fatal(err)
+	} else if id := k.Current().ID; id != "new" {
+		t.Fatalf("current key: got %q, exp %q", id, "new")
+	}
+
+	old, err := k.Key("old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := old.Seal(nil, []byte("secret"), []byte("ad"))
+	if err != nil {
+		t.Fatal(err)
+	} else if len(sealed) != len("secret")+old.Overhead() {
+		t.Fatalf("sealed length: got %d, exp %d", len(sealed), len("secret")+old.Overhead())
+	}
+
+	if b, err := old.Open(nil, sealed, []byte("ad")); err != nil {
+		t.Fatal(err)
+	} else if string(b) != "secret" {
+		t.Fatalf("opened: got %q, exp %q", b, "secret")
+	}
+
+	// Data must not open with other additional data or another key.
+	if _, err := old.Open(nil, sealed, []byte("other")); err != tsdb.ErrDecryptionFailed {
+		t.Fatalf("unexpected error: %v", err)
+	} else if _, err := k.Current().Open(nil, sealed, []byte("ad")); err != tsdb.ErrDecryptionFailed {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := k.Key("missing"); err == nil {
+		t.Fatal("expected error for unknown key")
+	}
+}
+
+func TestLoadKeyring_Invalid(t *testing.T) {
+	for _, tt := range []struct {
+		data string
+		err  string
+	}{
+		{data: "", err: "no encryption keys"},
+		{data: "a", err: "expected key id and key"},
+		{data: "a zz", err: "invalid key"},
+		{data: "a 0001", err: "invalid key size"},
+		{data: "a 000102030405060708090a0b0c0d0e0f\na 000102030405060708090a0b0c0d0e0f", err: "duplicate key id"},
+	} {
+		path := MustWriteKeyFile(tt.data)
+		_, err := tsdb.LoadKeyring(path)
+		os.Remove(path)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%q: got error %v, exp %q", tt.data, err, tt.err)
+		}
+	}
+}
+
+// MustWriteKeyFile writes data to a temporary key file and returns its path.
+func MustWriteKeyFile(data string) string {
+	f, err := ioutil.TempFile("", "influxdb-keys-")
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(data); err != nil {
+		panic(err)
+	}
+	return f.Name()
+}
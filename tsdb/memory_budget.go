@@ -0,0 +1,100 @@
+package tsdb
+
+import "sync"
+
+// MemoryBudget limits the total number of bytes held by a group of
+// consumers, such as the caches of every shard in a store.
+type MemoryBudget struct {
+	mu    sync.Mutex
+	limit uint64
+	used  uint64
+
+	// full is set when a reservation fails and cleared when memory is
+	// released, so consumers can tell that others are waiting for memory.
+	full bool
+
+	// freed is closed and replaced each time memory is released.
+	freed chan struct{}
+}
+
+// NewMemoryBudget returns a budget of limit bytes.
+func NewMemoryBudget(limit uint64) *MemoryBudget {
+	return &MemoryBudget{
+		limit: limit,
+		freed: make(chan struct{}),
+	}
+}
+
+// Reserve adds n bytes to the memory in use. Returns false, reserving
+// nothing, if that would exceed the limit.
+func (b *MemoryBudget) Reserve(n uint64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.used+n > b.limit {
+		b.full = true
+		return false
+	}
+	b.used += n
+	return true
+}
+
+// Charge adds n bytes to the memory in use even if that exceeds the limit.
+// It is used for memory that cannot be refused, such as data being recovered.
+func (b *MemoryBudget) Charge(n uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.used += n
+}
+
+// Release returns n previously reserved bytes to the budget and wakes anyone
+// waiting for memory.
+func (b *MemoryBudget) Release(n uint64) {
+	if n == 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if n > b.used {
+		n = b.used
+	}
+	b.used -= n
+	b.full = false
+
+	close(b.freed)
+	b.freed = make(chan struct{})
+}
+
+// Wait returns nil if n bytes can currently be reserved. Otherwise it returns
+// a channel that is closed the next time memory is released.
+func (b *MemoryBudget) Wait(n uint64) <-chan struct{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.used+n <= b.limit {
+		return nil
+	}
+	return b.freed
+}
+
+// Full returns true if a reservation has failed since memory was last
+// released.
+func (b *MemoryBudget) Full() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.full
+}
+
+// Used returns the number of bytes reserved.
+func (b *MemoryBudget) Used() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.used
+}
+
+// Limit returns the size of the budget in bytes.
+func (b *MemoryBudget) Limit() uint64 {
+	return b.limit
+}
@@ -0,0 +1,41 @@
+package tsdb_test
+
+import (
+	"testing"
+
+	"github.com/influxdata/influxdb/tsdb"
+)
+
+func TestMemoryBudget(t *testing.T) {
+	b := tsdb.NewMemoryBudget(100)
+
+	if !b.Reserve(60) {
+		t.Fatal("expected reservation within limit to succeed")
+	} else if b.Wait(40) != nil {
+		t.Fatal("expected no wait for memory within limit")
+	}
+
+	freed := b.Wait(50)
+	if freed == nil {
+		t.Fatal("expected wait for memory over limit")
+	} else if b.Reserve(50) {
+		t.Fatal("expected reservation over limit to fail")
+	} else if !b.Full() {
+		t.Fatal("expected budget to be full after failed reservation")
+	} else if b.Used() != 60 {
+		t.Fatalf("used: got %d, exp 60", b.Used())
+	}
+
+	b.Release(60)
+	select {
+	case <-freed:
+	default:
+		t.Fatal("expected release to close wait channel")
+	}
+
+	if b.Full() {
+		t.Fatal("expected budget not to be full after release")
+	} else if !b.Reserve(100) {
+		t.Fatal("expected reservation after release to succeed")
+	}
+}
@@ -26,6 +26,10 @@ const (
 	statDatabaseMeasurements = "numMeasurements" // number of measurements in this database
 )
 
+func init() {
+	influxdb.RegisterGauges("database", statDatabaseSeries, statDatabaseMeasurements)
+}
+
 // DatabaseIndex is the in memory index of a collection of measurements, time series, and their tags.
 // Exported functions are goroutine safe while un-exported functions assume the caller will use the appropriate locks
 type DatabaseIndex struct {
@@ -37,6 +41,12 @@ type DatabaseIndex struct {
 
 	name string // name of the database represented by this index
 
+	// persistent series indexes of the database's shards, used to apply
+	// limits across the database when a persistent index is configured
+	persistentMu      sync.Mutex
+	seriesIndexes     map[uint64]SeriesIndex
+	persistentSeriesN int // distinct series in seriesIndexes, -1 until counted
+
 	statMap *expvar.Map
 }
 
@@ -46,7 +56,11 @@ func NewDatabaseIndex(name string) *DatabaseIndex {
 		measurements: make(map[string]*Measurement),
 		series:       make(map[string]*Series),
 		name:         name,
-		statMap:      influxdb.NewStatistics("database:"+name, "database", map[string]string{"database": name}),
+
+		seriesIndexes:     make(map[uint64]SeriesIndex),
+		persistentSeriesN: -1,
+
+		statMap: influxdb.NewStatistics("database:"+name, "database", map[string]string{"database": name}),
 	}
 }
 
@@ -371,6 +385,10 @@ const (
 	statMeasurementSeries = "numSeries" // number of series contained in this measurement
 )
 
+func init() {
+	influxdb.RegisterGauges("measurement", statMeasurementSeries)
+}
+
 // Measurement represents a collection of time series in a database. It also contains in memory
 // structures for indexing tags. Exported functions are goroutine safe while un-exported functions
 // assume the caller will use the appropriate locks
@@ -655,8 +673,8 @@ func (m *Measurement) TagSets(dimensions []string, condition influxql.Expr) ([]*
 	return sortedTagsSets, nil
 }
 
-// mergeSeriesFilters merges two sets of filter expressions and culls series IDs.
-func mergeSeriesFilters(op influxql.Token, ids SeriesIDs, lfilters, rfilters FilterExprs) (SeriesIDs, FilterExprs) {
+// MergeSeriesFilters merges two sets of filter expressions and culls series IDs.
+func MergeSeriesFilters(op influxql.Token, ids SeriesIDs, lfilters, rfilters FilterExprs) (SeriesIDs, FilterExprs) {
 	// Create a map to hold the final set of series filter expressions.
 	filters := make(map[uint64]influxql.Expr, 0)
 	// Resulting list of series IDs
@@ -870,7 +888,7 @@ func (m *Measurement) walkWhereForSeriesIds(expr influxql.Expr) (SeriesIDs, Filt
 			}
 
 			// Merge the filter expressions for the LHS and RHS.
-			ids, filters := mergeSeriesFilters(n.Op, ids, lfilters, rfilters)
+			ids, filters := MergeSeriesFilters(n.Op, ids, lfilters, rfilters)
 
 			return ids, filters, nil
 		}
@@ -964,6 +982,11 @@ func (m *Measurement) seriesIDsAllOrByExpr(expr influxql.Expr) (SeriesIDs, error
 
 // tagKeysByExpr extracts the tag keys wanted by the expression.
 func (m *Measurement) tagKeysByExpr(expr influxql.Expr) (stringSet, bool, error) {
+	return tagKeysByExpr(expr, m.TagKeys())
+}
+
+// tagKeysByExpr extracts the tag keys wanted by the expression from keys.
+func tagKeysByExpr(expr influxql.Expr, keys []string) (stringSet, bool, error) {
 	switch e := expr.(type) {
 	case *influxql.BinaryExpr:
 		switch e.Op {
@@ -994,14 +1017,14 @@ func (m *Measurement) tagKeysByExpr(expr influxql.Expr) (stringSet, bool, error)
 				}
 				tf.Value = s.Val
 			}
-			return m.tagKeysByFilter(tf.Op, tf.Value, tf.Regex), true, nil
+			return tagKeysByFilter(keys, tf.Op, tf.Value, tf.Regex), true, nil
 		case influxql.AND, influxql.OR:
-			lhsKeys, lhsOk, err := m.tagKeysByExpr(e.LHS)
+			lhsKeys, lhsOk, err := tagKeysByExpr(e.LHS, keys)
 			if err != nil {
 				return nil, false, err
 			}
 
-			rhsKeys, rhsOk, err := m.tagKeysByExpr(e.RHS)
+			rhsKeys, rhsOk, err := tagKeysByExpr(e.RHS, keys)
 			if err != nil {
 				return nil, false, err
 			}
@@ -1022,15 +1045,15 @@ func (m *Measurement) tagKeysByExpr(expr influxql.Expr) (stringSet, bool, error)
 			return nil, false, fmt.Errorf("invalid operator")
 		}
 	case *influxql.ParenExpr:
-		return m.tagKeysByExpr(e.Expr)
+		return tagKeysByExpr(e.Expr, keys)
 	}
 	return nil, false, fmt.Errorf("%#v", expr)
 }
 
-// tagKeysByFilter will filter the tag keys for the measurement.
-func (m *Measurement) tagKeysByFilter(op influxql.Token, val string, regex *regexp.Regexp) stringSet {
+// tagKeysByFilter will filter the tag keys.
+func tagKeysByFilter(keys []string, op influxql.Token, val string, regex *regexp.Regexp) stringSet {
 	ss := newStringSet()
-	for _, key := range m.TagKeys() {
+	for _, key := range keys {
 		var matched bool
 		switch op {
 		case influxql.EQ:
@@ -1516,6 +1539,16 @@ func (m *Measurement) TagValues(key string) []string {
 	return values
 }
 
+// tagValueN returns the number of values for the given tag key and whether
+// value is already one of them.
+func (m *Measurement) tagValueN(key, value string) (int, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	values := m.seriesByTagKeyValue[key]
+	_, ok := values[value]
+	return len(values), ok
+}
+
 // SetFieldName adds the field name to the measurement.
 func (m *Measurement) SetFieldName(name string) {
 	m.mu.Lock()
@@ -9,6 +9,8 @@ import (
 	"io"
 	"math"
 	"os"
+	"path/filepath"
+	"regexp"
 	"sort"
 	"strings"
 	"sync"
@@ -42,8 +44,45 @@ var (
 	// ErrFieldUnmappedID is returned when the system is presented, during decode, with a field ID
 	// there is no mapping for.
 	ErrFieldUnmappedID = errors.New("field ID not mapped")
+
+	// ErrCompactionNotSupported is returned when the shard's engine cannot be compacted on demand.
+	ErrCompactionNotSupported = errors.New("engine does not support compaction")
+
+	// ErrEngineClosed is returned when a closed shard is accessed.
+	ErrEngineClosed = errors.New("engine is closed")
 )
 
+// PartialWriteError is returned when some points in a write were dropped,
+// such as when they conflict with a field type or exceed a cardinality
+// limit. The remaining points are still written.
+type PartialWriteError struct {
+	Reason  string
+	Dropped int
+
+	// DroppedPoints holds each dropped point and why it was dropped.
+	DroppedPoints []DroppedPoint
+}
+
+func (e PartialWriteError) Error() string {
+	return fmt.Sprintf("partial write: %s dropped=%d", e.Reason, e.Dropped)
+}
+
+// Merge returns the combination of two partial writes, keeping the first reason.
+func (e PartialWriteError) Merge(other PartialWriteError) PartialWriteError {
+	if e.Reason == "" {
+		e.Reason = other.Reason
+	}
+	e.Dropped += other.Dropped
+	e.DroppedPoints = append(e.DroppedPoints[:len(e.DroppedPoints):len(e.DroppedPoints)], other.DroppedPoints...)
+	return e
+}
+
+// DroppedPoint is a point which was not written and the reason why.
+type DroppedPoint struct {
+	Point  models.Point
+	Reason string
+}
+
 // A ShardError implements the error interface, and contains extra
 // context about the shard that generated the error.
 type ShardError struct {
@@ -79,6 +118,12 @@ type Shard struct {
 	engine  Engine
 	options EngineOptions
 
+	// Persistent series index, nil if series are kept in the DatabaseIndex.
+	seriesIndex SeriesIndex
+
+	// Set if the series index did not exist before the shard was opened.
+	seriesIndexCreated bool
+
 	mu                sync.RWMutex
 	measurementFields map[string]*MeasurementFields // measurement name to their fields
 
@@ -122,6 +167,15 @@ func NewShard(id uint64, index *DatabaseIndex, path string, walPath string, opti
 // Path returns the path set on the shard when it was created.
 func (s *Shard) Path() string { return s.path }
 
+// SeriesIndex returns the shard's persistent series index. Returns nil if the
+// shard's series are kept in the in-memory DatabaseIndex.
+func (s *Shard) SeriesIndex() SeriesIndex { return s.seriesIndex }
+
+// SeriesIndexCreated returns true if the shard's series index was created
+// when the shard was opened. A new index must be populated with the series
+// already stored by the engine, while an existing index already holds them.
+func (s *Shard) SeriesIndexCreated() bool { return s.seriesIndexCreated }
+
 // Open initializes and opens the shard's store.
 func (s *Shard) Open() error {
 	if err := func() error {
@@ -136,6 +190,26 @@ func (s *Shard) Open() error {
 			return nil
 		}
 
+		// Initialize and open the series index, if one is configured.
+		indexPath := filepath.Join(s.path, "index")
+		idx, err := NewIndex(s.options.Config.IndexVersion, indexPath, s.options)
+		if err != nil {
+			return err
+		}
+		if idx != nil {
+			_, err := os.Stat(indexPath)
+			s.seriesIndexCreated = os.IsNotExist(err)
+			if err != nil && !s.seriesIndexCreated {
+				return err
+			}
+
+			if err := idx.Open(); err != nil {
+				return err
+			}
+			s.seriesIndex = idx
+			s.index.addSeriesIndex(s.id, idx)
+		}
+
 		// Initialize underlying engine.
 		e, err := NewEngine(s.path, s.walPath, s.options)
 		if err != nil {
@@ -173,6 +247,14 @@ func (s *Shard) Close() error {
 }
 
 func (s *Shard) close() error {
+	if s.seriesIndex != nil {
+		s.index.removeSeriesIndex(s.id)
+		if err := s.seriesIndex.Close(); err != nil {
+			return err
+		}
+		s.seriesIndex = nil
+	}
+
 	if s.engine == nil {
 		return nil
 	}
@@ -184,6 +266,13 @@ func (s *Shard) close() error {
 	return err
 }
 
+// closed returns true if the shard has been closed.
+func (s *Shard) closed() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.engine == nil
+}
+
 // DiskSize returns the size on disk of this shard
 func (s *Shard) DiskSize() (int64, error) {
 	stats, err := os.Stat(s.path)
@@ -193,6 +282,72 @@ func (s *Shard) DiskSize() (int64, error) {
 	return stats.Size(), nil
 }
 
+// CompactFull compacts all data of the shard into as few files as possible.
+func (s *Shard) CompactFull() error {
+	s.mu.RLock()
+	e := s.engine
+	s.mu.RUnlock()
+
+	if e == nil {
+		return ErrEngineClosed
+	}
+	c, ok := e.(interface {
+		CompactFull() error
+	})
+	if !ok {
+		return ErrCompactionNotSupported
+	}
+	return c.CompactFull()
+}
+
+// CompactPlanned runs the full compaction the engine plans for shards that are
+// cold for writes.
+func (s *Shard) CompactPlanned() error {
+	s.mu.RLock()
+	e := s.engine
+	s.mu.RUnlock()
+
+	if e == nil {
+		return ErrEngineClosed
+	}
+	c, ok := e.(interface {
+		CompactPlanned() error
+	})
+	if !ok {
+		return ErrCompactionNotSupported
+	}
+	return c.CompactPlanned()
+}
+
+// Restore adds the TSM files of a tar archive, as written by a backup, to the
+// shard. The series and fields of the files are added to the index.
+func (s *Shard) Restore(r io.Reader, basePath string) error {
+	s.mu.RLock()
+	e := s.engine
+	s.mu.RUnlock()
+
+	if e == nil {
+		return ErrEngineClosed
+	}
+	return e.Restore(r, basePath, shardIndexLocker{s})
+}
+
+// shardIndexLocker locks a shard and its database index while restored files
+// are added to the shard's engine and index.
+type shardIndexLocker struct {
+	s *Shard
+}
+
+func (l shardIndexLocker) Lock() {
+	l.s.mu.Lock()
+	l.s.index.mu.Lock()
+}
+
+func (l shardIndexLocker) Unlock() {
+	l.s.index.mu.Unlock()
+	l.s.mu.Unlock()
+}
+
 // FieldCodec returns the field encoding for a measurement.
 // TODO: this is temporarily exported to make tx.go work. When the query engine gets refactored
 // into the tsdb package this should be removed. No one outside tsdb should know the underlying field encoding scheme.
@@ -206,6 +361,23 @@ func (s *Shard) FieldCodec(measurementName string) *FieldCodec {
 	return m.Codec
 }
 
+// MeasurementFieldTypes returns the data type of every field of every
+// measurement stored in the shard, keyed by measurement name then field name.
+func (s *Shard) MeasurementFieldTypes() map[string]map[string]influxql.DataType {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	m := make(map[string]map[string]influxql.DataType, len(s.measurementFields))
+	for name, mf := range s.measurementFields {
+		fields := make(map[string]influxql.DataType, len(mf.Fields))
+		for _, f := range mf.Fields {
+			fields[f.Name] = f.Type
+		}
+		m[name] = fields
+	}
+	return m
+}
+
 // FieldCreate holds information for a field to create on a measurement
 type FieldCreate struct {
 	Measurement string
@@ -222,15 +394,34 @@ type SeriesCreate struct {
 func (s *Shard) WritePoints(points []models.Point) error {
 	s.statMap.Add(statWriteReq, 1)
 
-	seriesToCreate, fieldsToCreate, seriesToAddShardTo, err := s.validateSeriesAndFields(points)
+	// The shard may be closed while the write is in progress, in which case
+	// the closed engine and series index fail the write.
+	s.mu.RLock()
+	engine, seriesIndex := s.engine, s.seriesIndex
+	s.mu.RUnlock()
+
+	if engine == nil {
+		return ErrEngineClosed
+	}
+
+	points, seriesToCreate, fieldsToCreate, seriesToAddShardTo, dropErr, err := s.validateSeriesAndFields(points)
 	if err != nil {
 		return err
 	}
 	s.statMap.Add(statSeriesCreate, int64(len(seriesToCreate)))
 	s.statMap.Add(statFieldsCreate, int64(len(fieldsToCreate)))
 
-	// add any new series to the in-memory index
-	if len(seriesToCreate) > 0 {
+	// add any new series to the persistent index or the in-memory index
+	if seriesIndex != nil {
+		for _, ss := range seriesToCreate {
+			if err := seriesIndex.CreateSeriesIfNotExists(ss.Measurement, ss.Series.Key, ss.Series.Tags); err != nil {
+				if s.closed() {
+					return ErrEngineClosed
+				}
+				return err
+			}
+		}
+	} else if len(seriesToCreate) > 0 {
 		s.index.mu.Lock()
 		for _, ss := range seriesToCreate {
 			s.index.CreateSeriesIndexIfNotExists(ss.Measurement, ss.Series)
@@ -257,7 +448,7 @@ func (s *Shard) WritePoints(points []models.Point) error {
 
 	// make sure all data is encoded before attempting to save to bolt
 	// only required for the b1 and bz1 formats
-	if s.engine.Format() != TSM1Format {
+	if engine.Format() != TSM1Format {
 		for _, p := range points {
 			// Ignore if raw data has already been marshaled.
 			if p.Data() != nil {
@@ -283,18 +474,32 @@ func (s *Shard) WritePoints(points []models.Point) error {
 	}
 
 	// Write to the engine.
-	if err := s.engine.WritePoints(points, measurementFieldsToSave, seriesToCreate); err != nil {
+	if err := engine.WritePoints(points, measurementFieldsToSave, seriesToCreate); err != nil {
 		s.statMap.Add(statWritePointsFail, 1)
+		if err == ErrEngineClosed {
+			return err
+		}
 		return fmt.Errorf("engine: %s", err)
 	}
 	s.statMap.Add(statWritePointsOK, int64(len(points)))
 
+	if dropErr != nil {
+		return *dropErr
+	}
 	return nil
 }
 
 // DeleteSeries deletes a list of series.
 func (s *Shard) DeleteSeries(seriesKeys []string) error {
-	return s.engine.DeleteSeries(seriesKeys)
+	if err := s.engine.DeleteSeries(seriesKeys); err != nil {
+		return err
+	}
+
+	if s.seriesIndex != nil {
+		defer s.index.resetPersistentSeriesN()
+		return s.seriesIndex.DropSeries(seriesKeys)
+	}
+	return nil
 }
 
 // DeleteMeasurement deletes a measurement and all underlying series.
@@ -302,10 +507,26 @@ func (s *Shard) DeleteMeasurement(name string, seriesKeys []string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	// Include series which are only known to the persistent index.
+	if s.seriesIndex != nil {
+		keys, err := s.seriesIndex.MeasurementSeriesKeysByExpr(name, nil)
+		if err != nil {
+			return err
+		}
+		seriesKeys = append(keys, seriesKeys...)
+	}
+
 	if err := s.engine.DeleteMeasurement(name, seriesKeys); err != nil {
 		return err
 	}
 
+	if s.seriesIndex != nil {
+		defer s.index.resetPersistentSeriesN()
+		if err := s.seriesIndex.DropMeasurement(name); err != nil {
+			return err
+		}
+	}
+
 	// Remove entry from shard index.
 	delete(s.measurementFields, name)
 
@@ -349,11 +570,14 @@ func (s *Shard) createFieldsAndMeasurements(fieldsToCreate []*FieldCreate) (map[
 	return measurementsToSave, nil
 }
 
-// validateSeriesAndFields checks which series and fields are new and whose metadata should be saved and indexed
-func (s *Shard) validateSeriesAndFields(points []models.Point) ([]*SeriesCreate, []*FieldCreate, []string, error) {
+// validateSeriesAndFields checks which series and fields are new and whose metadata should be saved and indexed.
+// Points which conflict with existing field types or would exceed the series or tag value limits are removed
+// from the returned points and reported by the returned PartialWriteError.
+func (s *Shard) validateSeriesAndFields(points []models.Point) ([]models.Point, []*SeriesCreate, []*FieldCreate, []string, *PartialWriteError, error) {
 	var seriesToCreate []*SeriesCreate
 	var fieldsToCreate []*FieldCreate
 	var seriesToAddShardTo []string
+	var dropErr *PartialWriteError
 
 	// get the mutex for the in memory index, which is shared across shards
 	s.index.mu.RLock()
@@ -363,9 +587,65 @@ func (s *Shard) validateSeriesAndFields(points []models.Point) ([]*SeriesCreate,
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	for _, p := range points {
+	if s.engine == nil {
+		return nil, nil, nil, nil, nil, ErrEngineClosed
+	}
+
+	// track series and tag values created by this write so they are
+	// counted against the limits before they are added to the index
+	limits, err := newCardinalityLimiter(s, s.options.Config.MaxSeriesPerDatabase, s.options.Config.MaxValuesPerTag)
+	if err != nil {
+		return nil, nil, nil, nil, nil, err
+	}
+
+	// kept is only allocated once a point is dropped
+	var kept []models.Point
+	drop := func(i int, reason string) {
+		if kept == nil {
+			kept = make([]models.Point, i, len(points))
+			copy(kept, points[:i])
+		}
+		dropErr = dropPoint(dropErr, points[i], reason)
+	}
+
+	for i, p := range points {
+		// see if the field definitions need to be saved to the shard and
+		// make sure there are no type conflicts with existing fields
+		var newFields []*FieldCreate
+		var conflict string
+		mf := s.measurementFields[p.Name()]
+		for name, value := range p.Fields() {
+			typ := influxql.InspectDataType(value)
+			if mf != nil {
+				if f := mf.Fields[name]; f != nil {
+					if f.Type != typ {
+						conflict = fmt.Sprintf("field type conflict: input field \"%s\" on measurement \"%s\" is type %T, already exists as type %s", name, p.Name(), value, f.Type)
+						break
+					}
+					continue // Field is present, and it's of the same type. Nothing more to do.
+				}
+			}
+			newFields = append(newFields, &FieldCreate{p.Name(), &Field{Name: name, Type: typ}})
+		}
+		if conflict != "" {
+			drop(i, conflict)
+			continue
+		}
+
 		// see if the series should be added to the index
-		if ss := s.index.series[string(p.Key())]; ss == nil {
+		if s.seriesIndex != nil {
+			if !s.seriesIndex.HasSeries(string(p.Key())) {
+				if reason := limits.add(p); reason != "" {
+					drop(i, reason)
+					continue
+				}
+				seriesToCreate = append(seriesToCreate, &SeriesCreate{p.Name(), NewSeries(string(p.Key()), p.Tags())})
+			}
+		} else if ss := s.index.series[string(p.Key())]; ss == nil {
+			if reason := limits.add(p); reason != "" {
+				drop(i, reason)
+				continue
+			}
 			series := NewSeries(string(p.Key()), p.Tags())
 			seriesToCreate = append(seriesToCreate, &SeriesCreate{p.Name(), series})
 			seriesToAddShardTo = append(seriesToAddShardTo, series.Key)
@@ -375,31 +655,142 @@ func (s *Shard) validateSeriesAndFields(points []models.Point) ([]*SeriesCreate,
 			seriesToAddShardTo = append(seriesToAddShardTo, ss.Key)
 		}
 
-		// see if the field definitions need to be saved to the shard
-		mf := s.measurementFields[p.Name()]
-		if mf == nil {
-			for name, value := range p.Fields() {
-				fieldsToCreate = append(fieldsToCreate, &FieldCreate{p.Name(), &Field{Name: name, Type: influxql.InspectDataType(value)}})
+		fieldsToCreate = append(fieldsToCreate, newFields...)
+		if kept != nil {
+			kept = append(kept, p)
+		}
+	}
+
+	if kept != nil {
+		points = kept
+	}
+
+	// count the accepted series against the database before they are created
+	// so concurrent writes to other shards see them
+	if s.seriesIndex != nil {
+		s.index.addPersistentSeriesN(limits.createdN)
+	}
+	return points, seriesToCreate, fieldsToCreate, seriesToAddShardTo, dropErr, nil
+}
+
+// dropPoint records a dropped point, keeping the reason of the first drop.
+func dropPoint(err *PartialWriteError, p models.Point, reason string) *PartialWriteError {
+	if err == nil {
+		err = &PartialWriteError{Reason: reason}
+	}
+	err.Dropped++
+	err.DroppedPoints = append(err.DroppedPoints, DroppedPoint{Point: p, Reason: reason})
+	return err
+}
+
+// cardinalityLimiter checks new series against the max-series-per-database
+// and max-values-per-tag limits. The caller must hold the index lock.
+//
+// With a persistent series index, series and tag values are counted across
+// the indexes of all open shards in the database.
+type cardinalityLimiter struct {
+	shard           *Shard
+	maxSeries       int
+	maxValuesPerTag int
+
+	seriesN   int
+	createdN  int                            // series new to the database accepted by this write
+	values    map[string]map[string]struct{} // measurement and tag key to persistent index values
+	newValues map[string]map[string]struct{} // measurement and tag key to values created by this write
+}
+
+func newCardinalityLimiter(s *Shard, maxSeries, maxValuesPerTag int) (*cardinalityLimiter, error) {
+	l := &cardinalityLimiter{
+		shard:           s,
+		maxSeries:       maxSeries,
+		maxValuesPerTag: maxValuesPerTag,
+		values:          make(map[string]map[string]struct{}),
+		newValues:       make(map[string]map[string]struct{}),
+	}
+
+	if maxSeries > 0 {
+		if s.seriesIndex != nil {
+			n, err := s.index.persistentSeriesCount()
+			if err != nil {
+				return nil, err
 			}
-			continue // skip validation since all fields are new
+			l.seriesN = n
+		} else {
+			l.seriesN = len(s.index.series)
 		}
+	}
+	return l, nil
+}
 
-		// validate field types and encode data
-		for name, value := range p.Fields() {
-			if f := mf.Fields[name]; f != nil {
-				// Field present in shard metadata, make sure there is no type conflict.
-				if f.Type != influxql.InspectDataType(value) {
-					return nil, nil, nil, fmt.Errorf("field type conflict: input field \"%s\" on measurement \"%s\" is type %T, already exists as type %s", name, p.Name(), value, f.Type)
-				}
+// add checks a point for a new series against the limits. Returns the reason
+// the point must be dropped or a blank string if the series can be created.
+func (l *cardinalityLimiter) add(p models.Point) string {
+	if l.maxSeries <= 0 && l.maxValuesPerTag <= 0 {
+		return ""
+	}
 
-				continue // Field is present, and it's of the same type. Nothing more to do.
+	// A series already in another shard's persistent index is not new to the database.
+	if l.shard.seriesIndex != nil && l.shard.index.hasPersistentSeries(string(p.Key())) {
+		return ""
+	}
+
+	if l.maxSeries > 0 && l.seriesN >= l.maxSeries {
+		return fmt.Sprintf("max-series-per-database limit exceeded: db=%s measurement=%q (%d/%d)", l.shard.database, p.Name(), l.seriesN, l.maxSeries)
+	}
+
+	var created []string
+	if l.maxValuesPerTag > 0 {
+		for k, v := range p.Tags() {
+			key := p.Name() + "\x00" + k
+			if _, ok := l.newValues[key][v]; ok {
+				continue
+			}
+
+			n, ok := l.tagValueN(p.Name(), k, v)
+			if ok {
+				continue
 			}
+			n += len(l.newValues[key])
 
-			fieldsToCreate = append(fieldsToCreate, &FieldCreate{p.Name(), &Field{Name: name, Type: influxql.InspectDataType(value)}})
+			if n >= l.maxValuesPerTag {
+				return fmt.Sprintf("max-values-per-tag limit exceeded (%d/%d): measurement=%q tag=%q value=%q", n, l.maxValuesPerTag, p.Name(), k, v)
+			}
+			created = append(created, k)
+		}
+	}
+
+	// The point is accepted so count its series and new tag values.
+	l.seriesN++
+	l.createdN++
+	for _, k := range created {
+		key := p.Name() + "\x00" + k
+		if l.newValues[key] == nil {
+			l.newValues[key] = make(map[string]struct{})
+		}
+		l.newValues[key][p.Tags()[k]] = struct{}{}
+	}
+	return ""
+}
+
+// tagValueN returns the number of existing values for a tag key and whether
+// value is already one of them.
+func (l *cardinalityLimiter) tagValueN(name, key, value string) (int, bool) {
+	if l.shard.seriesIndex != nil {
+		k := name + "\x00" + key
+		values, ok := l.values[k]
+		if !ok {
+			values = l.shard.index.persistentTagValues(name, key)
+			l.values[k] = values
 		}
+		_, ok = values[value]
+		return len(values), ok
 	}
 
-	return seriesToCreate, fieldsToCreate, seriesToAddShardTo, nil
+	m := l.shard.index.measurements[name]
+	if m == nil {
+		return 0, false
+	}
+	return m.tagValueN(key, value)
 }
 
 // SeriesCount returns the number of series buckets on the shard.
@@ -462,7 +853,12 @@ func (s *Shard) FieldDimensions(sources influxql.Sources) (fields, dimensions ma
 			for _, name := range mm.FieldNames() {
 				fields[name] = struct{}{}
 			}
-			for _, key := range mm.TagKeys() {
+
+			tagKeys := mm.TagKeys()
+			if s.seriesIndex != nil {
+				tagKeys = s.seriesIndex.TagKeys(m.Name)
+			}
+			for _, key := range tagKeys {
 				dimensions[key] = struct{}{}
 			}
 		}
@@ -508,11 +904,11 @@ func (s *Shard) ExpandSources(sources influxql.Sources) (influxql.Sources, error
 			}
 
 			// Loop over matching measurements.
-			for _, m := range s.index.MeasurementsByRegex(src.Regex.Val) {
+			for _, name := range s.measurementNamesByRegex(src.Regex.Val) {
 				other := &influxql.Measurement{
 					Database:        src.Database,
 					RetentionPolicy: src.RetentionPolicy,
-					Name:            m.Name,
+					Name:            name,
 				}
 				set[other.String()] = other
 			}
@@ -538,6 +934,51 @@ func (s *Shard) ExpandSources(sources influxql.Sources) (influxql.Sources, error
 	return expanded, nil
 }
 
+// measurementNamesByRegex returns the names of the measurements matching re.
+func (s *Shard) measurementNamesByRegex(re *regexp.Regexp) []string {
+	var names []string
+	if s.seriesIndex != nil {
+		for _, name := range s.seriesIndex.MeasurementNames() {
+			if re.MatchString(name) {
+				names = append(names, name)
+			}
+		}
+		return names
+	}
+
+	for _, m := range s.index.MeasurementsByRegex(re) {
+		names = append(names, m.Name)
+	}
+	return names
+}
+
+// measurementNamesByExpr returns the sorted names of the measurements matching
+// a condition, or all measurements if condition is nil. The bool return
+// argument is false if the condition was not a measurement expression.
+func (s *Shard) measurementNamesByExpr(condition influxql.Expr) ([]string, bool, error) {
+	if s.seriesIndex != nil {
+		if condition == nil {
+			return s.seriesIndex.MeasurementNames(), true, nil
+		}
+		return s.seriesIndex.MeasurementNamesByExpr(condition)
+	}
+
+	mms, ok := s.index.Measurements(), true
+	if condition != nil {
+		var err error
+		if mms, ok, err = s.index.measurementsByExpr(condition); err != nil {
+			return nil, false, err
+		}
+	}
+	sort.Sort(mms)
+
+	names := make([]string, len(mms))
+	for i, m := range mms {
+		names[i] = m.Name
+	}
+	return names, ok, nil
+}
+
 // Shards represents a sortable list of shards.
 type Shards []*Shard
 
@@ -896,7 +1337,11 @@ func (ic *shardIteratorCreator) ExpandSources(sources influxql.Sources) (influxq
 }
 
 func NewFieldKeysIterator(sh *Shard, opt influxql.IteratorOptions) (influxql.Iterator, error) {
-	fn := func(m *Measurement) []string {
+	fn := func(name string) []string {
+		m := sh.index.Measurement(name)
+		if m == nil {
+			return nil
+		}
 		keys := m.FieldNames()
 		sort.Strings(keys)
 		return keys
@@ -906,7 +1351,7 @@ func NewFieldKeysIterator(sh *Shard, opt influxql.IteratorOptions) (influxql.Ite
 
 // MeasurementIterator represents a string iterator that emits all measurement names in a shard.
 type MeasurementIterator struct {
-	mms    Measurements
+	names  []string
 	source *influxql.Measurement
 }
 
@@ -919,19 +1364,12 @@ func NewMeasurementIterator(sh *Shard, opt influxql.IteratorOptions) (*Measureme
 		itr.source, _ = opt.Sources[0].(*influxql.Measurement)
 	}
 
-	// Retrieve measurements from shard. Filter if condition specified.
-	if opt.Condition == nil {
-		itr.mms = sh.index.Measurements()
-	} else {
-		mms, _, err := sh.index.measurementsByExpr(opt.Condition)
-		if err != nil {
-			return nil, err
-		}
-		itr.mms = mms
+	// Retrieve measurement names from shard. Filter if condition specified.
+	names, _, err := sh.measurementNamesByExpr(opt.Condition)
+	if err != nil {
+		return nil, err
 	}
-
-	// Sort measurements by name.
-	sort.Sort(itr.mms)
+	itr.names = names
 
 	return itr, nil
 }
@@ -941,14 +1379,14 @@ func (itr *MeasurementIterator) Close() error { return nil }
 
 // Next emits the next measurement name.
 func (itr *MeasurementIterator) Next() *influxql.FloatPoint {
-	if len(itr.mms) == 0 {
+	if len(itr.names) == 0 {
 		return nil
 	}
-	mm := itr.mms[0]
-	itr.mms = itr.mms[1:]
+	name := itr.names[0]
+	itr.names = itr.names[1:]
 	return &influxql.FloatPoint{
 		Name: "measurements",
-		Aux:  []interface{}{mm.Name},
+		Aux:  []interface{}{name},
 	}
 }
 
@@ -960,9 +1398,6 @@ type seriesIterator struct {
 
 // NewSeriesIterator returns a new instance of SeriesIterator.
 func NewSeriesIterator(sh *Shard, opt influxql.IteratorOptions) (influxql.Iterator, error) {
-	// Retrieve a list of all measurements.
-	mms := sh.index.Measurements()
-	sort.Sort(mms)
 
 	// Only equality operators are allowed.
 	var err error
@@ -983,6 +1418,25 @@ func NewSeriesIterator(sh *Shard, opt influxql.IteratorOptions) (influxql.Iterat
 
 	// Generate a list of all series keys.
 	keys := newStringSet()
+	if sh.seriesIndex != nil {
+		for _, name := range sh.seriesIndex.MeasurementNames() {
+			a, err := sh.seriesIndex.MeasurementSeriesKeysByExpr(name, opt.Condition)
+			if err != nil {
+				return nil, err
+			}
+			keys.add(a...)
+		}
+
+		return &seriesIterator{
+			keys:   keys.list(),
+			fields: opt.Aux,
+		}, nil
+	}
+
+	// Retrieve a list of all measurements.
+	mms := sh.index.Measurements()
+	sort.Sort(mms)
+
 	for _, mm := range mms {
 		ids, err := mm.seriesIDsAllOrByExpr(opt.Condition)
 		if err != nil {
@@ -1030,7 +1484,14 @@ func (itr *seriesIterator) Next() *influxql.FloatPoint {
 
 // NewTagKeysIterator returns a new instance of TagKeysIterator.
 func NewTagKeysIterator(sh *Shard, opt influxql.IteratorOptions) (influxql.Iterator, error) {
-	fn := func(m *Measurement) []string {
+	fn := func(name string) []string {
+		if sh.seriesIndex != nil {
+			return sh.seriesIndex.TagKeys(name)
+		}
+		m := sh.index.Measurement(name)
+		if m == nil {
+			return nil
+		}
 		return m.TagKeys()
 	}
 	return newMeasurementKeysIterator(sh, fn, opt)
@@ -1038,29 +1499,27 @@ func NewTagKeysIterator(sh *Shard, opt influxql.IteratorOptions) (influxql.Itera
 
 // tagValuesIterator emits key/tag values
 type tagValuesIterator struct {
-	series []*Series // remaining series
-	keys   []string  // tag keys to select from a series
-	fields []string  // fields to emit (key or value)
+	series []tagValuesSeries // remaining series
+	keys   []string          // tag keys to select from a series
+	fields []string          // fields to emit (key or value)
 	buf    struct {
-		s    *Series  // current series
-		keys []string // current tag's keys
+		s    tagValuesSeries // current series
+		keys []string        // current tag's keys
 	}
 }
 
+// tagValuesSeries is a series emitted by tagValuesIterator.
+type tagValuesSeries struct {
+	name string
+	tags map[string]string
+}
+
 // NewTagValuesIterator returns a new instance of TagValuesIterator.
 func NewTagValuesIterator(sh *Shard, opt influxql.IteratorOptions) (influxql.Iterator, error) {
 	if opt.Condition == nil {
 		return nil, errors.New("a condition is required")
 	}
 
-	mms, ok, err := sh.index.measurementsByExpr(opt.Condition)
-	if err != nil {
-		return nil, err
-	} else if !ok {
-		mms = sh.index.Measurements()
-		sort.Sort(mms)
-	}
-
 	filterExpr := influxql.CloneExpr(opt.Condition)
 	filterExpr = influxql.RewriteExpr(filterExpr, func(e influxql.Expr) influxql.Expr {
 		switch e := e.(type) {
@@ -1076,7 +1535,19 @@ func NewTagValuesIterator(sh *Shard, opt influxql.IteratorOptions) (influxql.Ite
 		return e
 	})
 
-	var series []*Series
+	if sh.seriesIndex != nil {
+		return newIndexTagValuesIterator(sh.seriesIndex, filterExpr, opt)
+	}
+
+	mms, ok, err := sh.index.measurementsByExpr(opt.Condition)
+	if err != nil {
+		return nil, err
+	} else if !ok {
+		mms = sh.index.Measurements()
+		sort.Sort(mms)
+	}
+
+	var series []tagValuesSeries
 	keys := newStringSet()
 	for _, mm := range mms {
 		ss, ok, err := mm.tagKeysByExpr(opt.Condition)
@@ -1094,7 +1565,47 @@ func NewTagValuesIterator(sh *Shard, opt influxql.IteratorOptions) (influxql.Ite
 		}
 
 		for _, id := range ids {
-			series = append(series, mm.SeriesByID(id))
+			series = append(series, tagValuesSeries{name: mm.Name, tags: mm.SeriesByID(id).Tags})
+		}
+	}
+
+	return &tagValuesIterator{
+		series: series,
+		keys:   keys.list(),
+		fields: opt.Aux,
+	}, nil
+}
+
+// newIndexTagValuesIterator returns a tagValuesIterator for the series in a
+// persistent series index.
+func newIndexTagValuesIterator(idx SeriesIndex, filterExpr influxql.Expr, opt influxql.IteratorOptions) (influxql.Iterator, error) {
+	names, ok, err := idx.MeasurementNamesByExpr(opt.Condition)
+	if err != nil {
+		return nil, err
+	} else if !ok {
+		names = idx.MeasurementNames()
+	}
+
+	var series []tagValuesSeries
+	keys := newStringSet()
+	for _, name := range names {
+		ss, ok, err := tagKeysByExpr(opt.Condition, idx.TagKeys(name))
+		if err != nil {
+			return nil, err
+		} else if !ok {
+			keys.add(idx.TagKeys(name)...)
+		} else {
+			keys = keys.union(ss)
+		}
+
+		seriesKeys, err := idx.MeasurementSeriesKeysByExpr(name, filterExpr)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, key := range seriesKeys {
+			_, tags, _ := models.ParseKey(key)
+			series = append(series, tagValuesSeries{name: name, tags: tags})
 		}
 	}
 
@@ -1124,7 +1635,7 @@ func (itr *tagValuesIterator) Next() *influxql.FloatPoint {
 		}
 
 		key := itr.buf.keys[0]
-		value, ok := itr.buf.s.Tags[key]
+		value, ok := itr.buf.s.tags[key]
 		if !ok {
 			itr.buf.keys = itr.buf.keys[1:]
 			continue
@@ -1143,7 +1654,7 @@ func (itr *tagValuesIterator) Next() *influxql.FloatPoint {
 
 		// Return next key.
 		p := &influxql.FloatPoint{
-			Name: itr.buf.s.measurement.Name,
+			Name: itr.buf.s.name,
 			Aux:  auxFields,
 		}
 		itr.buf.keys = itr.buf.keys[1:]
@@ -1153,34 +1664,27 @@ func (itr *tagValuesIterator) Next() *influxql.FloatPoint {
 }
 
 // measurementKeyFunc is the function called by measurementKeysIterator.
-type measurementKeyFunc func(m *Measurement) []string
+type measurementKeyFunc func(name string) []string
 
 func newMeasurementKeysIterator(sh *Shard, fn measurementKeyFunc, opt influxql.IteratorOptions) (*measurementKeysIterator, error) {
 	itr := &measurementKeysIterator{fn: fn}
 
-	// Retrieve measurements from shard. Filter if condition specified.
-	if opt.Condition == nil {
-		itr.mms = sh.index.Measurements()
-	} else {
-		mms, _, err := sh.index.measurementsByExpr(opt.Condition)
-		if err != nil {
-			return nil, err
-		}
-		itr.mms = mms
+	// Retrieve measurement names from shard. Filter if condition specified.
+	names, _, err := sh.measurementNamesByExpr(opt.Condition)
+	if err != nil {
+		return nil, err
 	}
-
-	// Sort measurements by name.
-	sort.Sort(itr.mms)
+	itr.names = names
 
 	return itr, nil
 }
 
 // measurementKeysIterator iterates over measurements and gets keys from each measurement.
 type measurementKeysIterator struct {
-	mms Measurements // remaining measurements
-	buf struct {
-		mm   *Measurement // current measurement
-		keys []string     // current measurement's keys
+	names []string // remaining measurement names
+	buf   struct {
+		name string   // current measurement
+		keys []string // current measurement's keys
 	}
 	fn measurementKeyFunc
 }
@@ -1193,19 +1697,19 @@ func (itr *measurementKeysIterator) Next() *influxql.FloatPoint {
 	for {
 		// If there are no more keys then move to the next measurements.
 		if len(itr.buf.keys) == 0 {
-			if len(itr.mms) == 0 {
+			if len(itr.names) == 0 {
 				return nil
 			}
 
-			itr.buf.mm = itr.mms[0]
-			itr.buf.keys = itr.fn(itr.buf.mm)
-			itr.mms = itr.mms[1:]
+			itr.buf.name = itr.names[0]
+			itr.buf.keys = itr.fn(itr.buf.name)
+			itr.names = itr.names[1:]
 			continue
 		}
 
 		// Return next key.
 		p := &influxql.FloatPoint{
-			Name: itr.buf.mm.Name,
+			Name: itr.buf.name,
 			Aux:  []interface{}{itr.buf.keys[0]},
 		}
 		itr.buf.keys = itr.buf.keys[1:]
@@ -16,6 +16,7 @@ import (
 	"github.com/influxdata/influxdb/pkg/deep"
 	"github.com/influxdata/influxdb/tsdb"
 	_ "github.com/influxdata/influxdb/tsdb/engine"
+	_ "github.com/influxdata/influxdb/tsdb/index"
 )
 
 // DefaultPrecision is the precision used by the MustWritePointsString() function.
@@ -149,6 +150,182 @@ func TestShardWriteAddNewField(t *testing.T) {
 	}
 }
 
+// Ensure a shard drops points with conflicting field types and writes the rest.
+func TestShard_WritePoints_FieldConflict(t *testing.T) {
+	tmpDir, _ := ioutil.TempDir("", "shard_test")
+	defer os.RemoveAll(tmpDir)
+
+	index := tsdb.NewDatabaseIndex("db")
+	opts := tsdb.NewEngineOptions()
+	opts.Config.WALDir = filepath.Join(tmpDir, "wal")
+
+	sh := tsdb.NewShard(1, index, filepath.Join(tmpDir, "shard"), filepath.Join(tmpDir, "wal"), opts)
+	if err := sh.Open(); err != nil {
+		t.Fatalf("error opening shard: %s", err.Error())
+	}
+	defer sh.Close()
+
+	if err := sh.WritePoints([]models.Point{
+		models.MustNewPoint("cpu", map[string]string{"host": "A"}, map[string]interface{}{"value": 1.0}, time.Unix(10, 0)),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	conflict := models.MustNewPoint("cpu", map[string]string{"host": "B"}, map[string]interface{}{"value": "x"}, time.Unix(20, 0))
+	err := sh.WritePoints([]models.Point{
+		conflict,
+		models.MustNewPoint("cpu", map[string]string{"host": "C"}, map[string]interface{}{"value": 2.0}, time.Unix(20, 0)),
+	})
+	if perr, ok := err.(tsdb.PartialWriteError); !ok {
+		t.Fatalf("unexpected error: %v", err)
+	} else if perr.Dropped != 1 || len(perr.DroppedPoints) != 1 {
+		t.Fatalf("unexpected dropped count: %d", perr.Dropped)
+	} else if perr.DroppedPoints[0].Point != conflict {
+		t.Fatalf("unexpected dropped point: %v", perr.DroppedPoints[0].Point)
+	} else if !strings.Contains(perr.Reason, "field type conflict") {
+		t.Fatalf("unexpected reason: %s", perr.Reason)
+	}
+
+	if n := index.SeriesN(); n != 2 {
+		t.Fatalf("unexpected series count: %d", n)
+	} else if index.Series("cpu,host=B") != nil {
+		t.Fatal("unexpected series for dropped point")
+	}
+}
+
+// Ensure a shard drops points which would exceed the series limit.
+func TestShard_WritePoints_MaxSeriesPerDatabase(t *testing.T) {
+	tmpDir, _ := ioutil.TempDir("", "shard_test")
+	defer os.RemoveAll(tmpDir)
+
+	index := tsdb.NewDatabaseIndex("db")
+	opts := tsdb.NewEngineOptions()
+	opts.Config.WALDir = filepath.Join(tmpDir, "wal")
+	opts.Config.MaxSeriesPerDatabase = 2
+
+	sh := tsdb.NewShard(1, index, filepath.Join(tmpDir, "shard"), filepath.Join(tmpDir, "wal"), opts)
+	if err := sh.Open(); err != nil {
+		t.Fatalf("error opening shard: %s", err.Error())
+	}
+	defer sh.Close()
+
+	err := sh.WritePoints([]models.Point{
+		models.MustNewPoint("cpu", map[string]string{"host": "A"}, map[string]interface{}{"value": 1.0}, time.Unix(1, 0)),
+		models.MustNewPoint("cpu", map[string]string{"host": "B"}, map[string]interface{}{"value": 1.0}, time.Unix(1, 0)),
+		models.MustNewPoint("cpu", map[string]string{"host": "C"}, map[string]interface{}{"value": 1.0}, time.Unix(1, 0)),
+	})
+	if perr, ok := err.(tsdb.PartialWriteError); !ok {
+		t.Fatalf("unexpected error: %v", err)
+	} else if perr.Dropped != 1 {
+		t.Fatalf("unexpected dropped count: %d", perr.Dropped)
+	} else if !strings.Contains(perr.Reason, `measurement="cpu"`) {
+		t.Fatalf("unexpected reason: %s", perr.Reason)
+	}
+
+	if n := index.SeriesN(); n != 2 {
+		t.Fatalf("unexpected series count: %d", n)
+	}
+
+	// Writes to existing series are still accepted.
+	if err := sh.WritePoints([]models.Point{
+		models.MustNewPoint("cpu", map[string]string{"host": "A"}, map[string]interface{}{"value": 2.0}, time.Unix(2, 0)),
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Ensure the series limit applies across all shards of a database when a
+// persistent series index is used.
+func TestShard_WritePoints_MaxSeriesPerDatabase_SeriesIndex(t *testing.T) {
+	tmpDir, _ := ioutil.TempDir("", "shard_test")
+	defer os.RemoveAll(tmpDir)
+
+	index := tsdb.NewDatabaseIndex("db")
+	opts := tsdb.NewEngineOptions()
+	opts.Config.WALDir = filepath.Join(tmpDir, "wal")
+	opts.Config.IndexVersion = "tsi1"
+	opts.Config.MaxSeriesPerDatabase = 2
+
+	sh0 := tsdb.NewShard(1, index, filepath.Join(tmpDir, "shard0"), filepath.Join(tmpDir, "wal0"), opts)
+	if err := sh0.Open(); err != nil {
+		t.Fatalf("error opening shard: %s", err.Error())
+	}
+	defer sh0.Close()
+
+	sh1 := tsdb.NewShard(2, index, filepath.Join(tmpDir, "shard1"), filepath.Join(tmpDir, "wal1"), opts)
+	if err := sh1.Open(); err != nil {
+		t.Fatalf("error opening shard: %s", err.Error())
+	}
+	defer sh1.Close()
+
+	if err := sh0.WritePoints([]models.Point{
+		models.MustNewPoint("cpu", map[string]string{"host": "A"}, map[string]interface{}{"value": 1.0}, time.Unix(1, 0)),
+		models.MustNewPoint("cpu", map[string]string{"host": "B"}, map[string]interface{}{"value": 1.0}, time.Unix(1, 0)),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Series already in the database are accepted by another shard but new
+	// series are counted against the series in the first shard.
+	err := sh1.WritePoints([]models.Point{
+		models.MustNewPoint("cpu", map[string]string{"host": "A"}, map[string]interface{}{"value": 1.0}, time.Unix(2, 0)),
+		models.MustNewPoint("cpu", map[string]string{"host": "C"}, map[string]interface{}{"value": 1.0}, time.Unix(2, 0)),
+	})
+	if perr, ok := err.(tsdb.PartialWriteError); !ok {
+		t.Fatalf("unexpected error: %v", err)
+	} else if perr.Dropped != 1 {
+		t.Fatalf("unexpected dropped count: %d", perr.Dropped)
+	} else if exp := "cpu,host=C"; string(perr.DroppedPoints[0].Point.Key()) != exp {
+		t.Fatalf("unexpected dropped point: %s", perr.DroppedPoints[0].Point.Key())
+	}
+
+	if n := sh1.SeriesIndex().SeriesN(); n != 1 {
+		t.Fatalf("unexpected series count: %d", n)
+	}
+}
+
+// Ensure a shard drops points which would exceed the tag value limit.
+func TestShard_WritePoints_MaxValuesPerTag(t *testing.T) {
+	tmpDir, _ := ioutil.TempDir("", "shard_test")
+	defer os.RemoveAll(tmpDir)
+
+	index := tsdb.NewDatabaseIndex("db")
+	opts := tsdb.NewEngineOptions()
+	opts.Config.WALDir = filepath.Join(tmpDir, "wal")
+	opts.Config.MaxValuesPerTag = 2
+
+	sh := tsdb.NewShard(1, index, filepath.Join(tmpDir, "shard"), filepath.Join(tmpDir, "wal"), opts)
+	if err := sh.Open(); err != nil {
+		t.Fatalf("error opening shard: %s", err.Error())
+	}
+	defer sh.Close()
+
+	if err := sh.WritePoints([]models.Point{
+		models.MustNewPoint("cpu", map[string]string{"host": "A"}, map[string]interface{}{"value": 1.0}, time.Unix(1, 0)),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := sh.WritePoints([]models.Point{
+		models.MustNewPoint("cpu", map[string]string{"host": "B", "region": "west"}, map[string]interface{}{"value": 1.0}, time.Unix(1, 0)),
+		models.MustNewPoint("cpu", map[string]string{"host": "C"}, map[string]interface{}{"value": 1.0}, time.Unix(1, 0)),
+		models.MustNewPoint("mem", map[string]string{"host": "C"}, map[string]interface{}{"value": 1.0}, time.Unix(1, 0)),
+	})
+	if perr, ok := err.(tsdb.PartialWriteError); !ok {
+		t.Fatalf("unexpected error: %v", err)
+	} else if perr.Dropped != 1 {
+		t.Fatalf("unexpected dropped count: %d", perr.Dropped)
+	} else if exp := `max-values-per-tag limit exceeded (2/2): measurement="cpu" tag="host" value="C"`; perr.Reason != exp {
+		t.Fatalf("unexpected reason: %s", perr.Reason)
+	}
+
+	if n := index.SeriesN(); n != 3 {
+		t.Fatalf("unexpected series count: %d", n)
+	} else if index.Series("mem,host=C") == nil {
+		t.Fatal("expected series in other measurement")
+	}
+}
+
 // Ensure a shard can create iterators for its underlying data.
 func TestShard_CreateIterator(t *testing.T) {
 	sh := MustOpenShard()
@@ -208,6 +385,73 @@ cpu,host=serverB,region=uswest value=25  0
 	}
 }
 
+// Ensure a shard using a persistent series index can create iterators and
+// reload its series after being reopened.
+func TestShard_CreateIterator_SeriesIndex(t *testing.T) {
+	sh := MustOpenShardWithIndex("tsi1")
+	defer sh.Close()
+
+	sh.MustWritePointsString(`
+cpu,host=serverA,region=uswest value=100 0
+cpu,host=serverB,region=useast value=50 10
+cpu,host=serverC,region=uswest value=25 20
+mem,host=serverA value=1 0
+`)
+
+	// Reopen the shard to ensure the series are loaded from the index.
+	if err := sh.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := sh.SeriesIndex().SeriesN(); n != 4 {
+		t.Fatalf("unexpected series count: %d", n)
+	}
+
+	itr, err := sh.CreateIterator(influxql.IteratorOptions{
+		Expr:       influxql.MustParseExpr(`value`),
+		Dimensions: []string{"host"},
+		Sources:    []influxql.Source{&influxql.Measurement{Name: "cpu"}},
+		Condition:  influxql.MustParseExpr(`region = 'uswest'`),
+		Ascending:  true,
+		StartTime:  influxql.MinTime,
+		EndTime:    influxql.MaxTime,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer itr.Close()
+	fitr := itr.(influxql.FloatIterator)
+
+	if p := fitr.Next(); !deep.Equal(p, &influxql.FloatPoint{
+		Name:  "cpu",
+		Tags:  influxql.NewTags(map[string]string{"host": "serverA"}),
+		Time:  time.Unix(0, 0).UnixNano(),
+		Value: 100,
+	}) {
+		t.Fatalf("unexpected point(0): %s", spew.Sdump(p))
+	}
+	if p := fitr.Next(); !deep.Equal(p, &influxql.FloatPoint{
+		Name:  "cpu",
+		Tags:  influxql.NewTags(map[string]string{"host": "serverC"}),
+		Time:  time.Unix(20, 0).UnixNano(),
+		Value: 25,
+	}) {
+		t.Fatalf("unexpected point(1): %s", spew.Sdump(p))
+	}
+	if p := fitr.Next(); p != nil {
+		t.Fatalf("unexpected point(2): %s", spew.Sdump(p))
+	}
+
+	// Dropping a measurement removes its series from the index.
+	if err := sh.DeleteMeasurement("mem", nil); err != nil {
+		t.Fatal(err)
+	} else if sh.SeriesIndex().HasMeasurement("mem") {
+		t.Fatal("expected measurement to be dropped")
+	} else if names := sh.SeriesIndex().MeasurementNames(); !reflect.DeepEqual(names, []string{"cpu"}) {
+		t.Fatalf("unexpected measurement names: %v", names)
+	}
+}
+
 func BenchmarkWritePoints_NewSeries_1K(b *testing.B)   { benchmarkWritePoints(b, 38, 3, 3, 1) }
 func BenchmarkWritePoints_NewSeries_100K(b *testing.B) { benchmarkWritePoints(b, 32, 5, 5, 1) }
 func BenchmarkWritePoints_NewSeries_250K(b *testing.B) { benchmarkWritePoints(b, 80, 5, 5, 1) }
@@ -339,10 +583,17 @@ func chunkedWrite(shard *tsdb.Shard, points []models.Point) {
 type Shard struct {
 	*tsdb.Shard
 	path string
+	opt  tsdb.EngineOptions
 }
 
 // NewShard returns a new instance of Shard with temp paths.
 func NewShard() *Shard {
+	return NewShardWithIndex(tsdb.DefaultIndex)
+}
+
+// NewShardWithIndex returns a new instance of Shard with temp paths using
+// the named series index.
+func NewShardWithIndex(index string) *Shard {
 	// Create temporary path for data and WAL.
 	path, err := ioutil.TempDir("", "influxdb-tsdb-")
 	if err != nil {
@@ -352,6 +603,7 @@ func NewShard() *Shard {
 	// Build engine options.
 	opt := tsdb.NewEngineOptions()
 	opt.Config.WALDir = filepath.Join(path, "wal")
+	opt.Config.IndexVersion = index
 
 	return &Shard{
 		Shard: tsdb.NewShard(0,
@@ -361,6 +613,7 @@ func NewShard() *Shard {
 			opt,
 		),
 		path: path,
+		opt:  opt,
 	}
 }
 
@@ -373,6 +626,31 @@ func MustOpenShard() *Shard {
 	return sh
 }
 
+// MustOpenShardWithIndex returns a new open shard using the named series
+// index. Panic on error.
+func MustOpenShardWithIndex(index string) *Shard {
+	sh := NewShardWithIndex(index)
+	if err := sh.Open(); err != nil {
+		panic(err)
+	}
+	return sh
+}
+
+// Reopen closes and reopens the shard with a new database index.
+func (sh *Shard) Reopen() error {
+	if err := sh.Shard.Close(); err != nil {
+		return err
+	}
+
+	sh.Shard = tsdb.NewShard(0,
+		tsdb.NewDatabaseIndex("db"),
+		filepath.Join(sh.path, "data"),
+		filepath.Join(sh.path, "wal"),
+		sh.opt,
+	)
+	return sh.Open()
+}
+
 // Close closes the shard and removes all underlying data.
 func (sh *Shard) Close() error {
 	defer os.RemoveAll(sh.path)
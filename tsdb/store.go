@@ -23,12 +23,20 @@ var (
 	ErrShardNotFound = fmt.Errorf("shard not found")
 	// ErrStoreClosed gets returned when trying to use a closed Store.
 	ErrStoreClosed = fmt.Errorf("store is closed")
+	// ErrColdDirNotSet gets returned when moving a shard to cold storage without a cold directory.
+	ErrColdDirNotSet = fmt.Errorf("cold data directory not set")
 )
 
 const (
 	maintenanceCheckInterval = time.Minute
 )
 
+// Storage tiers a shard's data files can be kept on.
+const (
+	HotTier  = "hot"
+	ColdTier = "cold"
+)
+
 // Store manages shards and indexes for databases.
 type Store struct {
 	mu   sync.RWMutex
@@ -39,6 +47,9 @@ type Store struct {
 	// shards is a map of shard IDs to the associated Shard.
 	shards map[uint64]*Shard
 
+	// moving holds the shards being moved to the cold tier.
+	moving map[uint64]*shardMove
+
 	EngineOptions EngineOptions
 	Logger        *log.Logger
 
@@ -72,10 +83,31 @@ func (s *Store) Open() error {
 	s.closing = make(chan struct{})
 
 	s.shards = map[uint64]*Shard{}
+	s.moving = map[uint64]*shardMove{}
 	s.databaseIndexes = map[string]*DatabaseIndex{}
 
 	s.Logger.Printf("Using data dir: %v", s.Path())
 
+	// Share a single memory budget between the caches of all shards.
+	if n := s.EngineOptions.Config.CacheMaxMemorySizeTotal; n > 0 && s.EngineOptions.CacheBudget == nil {
+		s.EngineOptions.CacheBudget = NewMemoryBudget(n)
+	}
+
+	// Schedule the compactions of all shards together.
+	if s.EngineOptions.CompactionScheduler == nil {
+		c := s.EngineOptions.Config
+		s.EngineOptions.CompactionScheduler = NewCompactionScheduler(c.MaxConcurrentCompactions, c.CompactThroughput)
+	}
+
+	// Load the encryption keys used by all shards.
+	if path := s.EngineOptions.Config.EncryptionKeyFile; path != "" && s.EngineOptions.Keyring == nil {
+		keyring, err := LoadKeyring(path)
+		if err != nil {
+			return fmt.Errorf("load encryption keys: %v", err)
+		}
+		s.EngineOptions.Keyring = keyring
+	}
+
 	// Create directory.
 	if err := os.MkdirAll(s.path, 0777); err != nil {
 		return err
@@ -95,26 +127,53 @@ func (s *Store) Open() error {
 	return nil
 }
 
-func (s *Store) loadIndexes() error {
-	dbs, err := ioutil.ReadDir(s.path)
-	if err != nil {
-		return err
+// roots returns the data directories shards are stored in. The cold
+// directory, if set, comes first.
+func (s *Store) roots() []string {
+	if dir := s.EngineOptions.Config.ColdDir; dir != "" {
+		return []string{dir, s.path}
 	}
-	for _, db := range dbs {
-		if !db.IsDir() {
-			s.Logger.Printf("Skipping database dir: %s. Not a directory", db.Name())
+	return []string{s.path}
+}
+
+func (s *Store) loadIndexes() error {
+	for _, root := range s.roots() {
+		dbs, err := ioutil.ReadDir(root)
+		if os.IsNotExist(err) {
 			continue
+		} else if err != nil {
+			return err
+		}
+		for _, db := range dbs {
+			if !db.IsDir() {
+				s.Logger.Printf("Skipping database dir: %s. Not a directory", db.Name())
+				continue
+			}
+			if _, ok := s.databaseIndexes[db.Name()]; !ok {
+				s.databaseIndexes[db.Name()] = NewDatabaseIndex(db.Name())
+			}
 		}
-		s.databaseIndexes[db.Name()] = NewDatabaseIndex(db.Name())
 	}
 	return nil
 }
 
 func (s *Store) loadShards() error {
+	for _, root := range s.roots() {
+		if err := s.loadShardsFrom(root); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadShardsFrom opens the shards stored under a data directory.
+func (s *Store) loadShardsFrom(root string) error {
 	// loop through the current database indexes
 	for db := range s.databaseIndexes {
-		rps, err := ioutil.ReadDir(filepath.Join(s.path, db))
-		if err != nil {
+		rps, err := ioutil.ReadDir(filepath.Join(root, db))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
 			return err
 		}
 
@@ -125,12 +184,12 @@ func (s *Store) loadShards() error {
 				continue
 			}
 
-			shards, err := ioutil.ReadDir(filepath.Join(s.path, db, rp.Name()))
+			shards, err := ioutil.ReadDir(filepath.Join(root, db, rp.Name()))
 			if err != nil {
 				return err
 			}
 			for _, sh := range shards {
-				path := filepath.Join(s.path, db, rp.Name(), sh.Name())
+				path := filepath.Join(root, db, rp.Name(), sh.Name())
 				walPath := filepath.Join(s.EngineOptions.Config.WALDir, db, rp.Name(), sh.Name())
 
 				// Shard file names are numeric shardIDs
@@ -140,6 +199,16 @@ func (s *Store) loadShards() error {
 					continue
 				}
 
+				// A shard in both directories was moved to cold storage but
+				// the hot copy was not removed yet.
+				if other, ok := s.shards[shardID]; ok {
+					s.Logger.Printf("shard %d already loaded from %s. Removing %s.", shardID, other.path, path)
+					if err := os.RemoveAll(path); err != nil {
+						return err
+					}
+					continue
+				}
+
 				shard := NewShard(shardID, s.databaseIndexes[db], path, walPath, s.EngineOptions)
 				err = shard.Open()
 				if err != nil {
@@ -210,6 +279,28 @@ func (s *Store) Shards(ids []uint64) []*Shard {
 	return a
 }
 
+// MeasurementFields returns the field types of all measurements stored in
+// the given shards, keyed by measurement name then field name. Shards that
+// are not open on this node are skipped.
+func (s *Store) MeasurementFields(ids []uint64) map[string]map[string]influxql.DataType {
+	m := make(map[string]map[string]influxql.DataType)
+	for _, sh := range s.Shards(ids) {
+		for name, fields := range sh.MeasurementFieldTypes() {
+			mf := m[name]
+			if mf == nil {
+				mf = make(map[string]influxql.DataType, len(fields))
+				m[name] = mf
+			}
+			for k, typ := range fields {
+				if _, ok := mf[k]; !ok {
+					mf[k] = typ
+				}
+			}
+		}
+	}
+	return m
+}
+
 // ShardN returns the number of shards in the store.
 func (s *Store) ShardN() int {
 	s.mu.RLock()
@@ -318,8 +409,10 @@ func (s *Store) DeleteDatabase(name string) error {
 		}
 	}
 
-	if err := os.RemoveAll(filepath.Join(s.path, name)); err != nil {
-		return err
+	for _, root := range s.roots() {
+		if err := os.RemoveAll(filepath.Join(root, name)); err != nil {
+			return err
+		}
 	}
 	if err := os.RemoveAll(filepath.Join(s.EngineOptions.Config.WALDir, name)); err != nil {
 		return err
@@ -348,8 +441,10 @@ func (s *Store) DeleteRetentionPolicy(database, name string) error {
 	}
 
 	// Remove the rentention policy folder.
-	if err := os.RemoveAll(filepath.Join(s.path, database, name)); err != nil {
-		return err
+	for _, root := range s.roots() {
+		if err := os.RemoveAll(filepath.Join(root, database, name)); err != nil {
+			return err
+		}
 	}
 
 	// Remove the retention policy folder from the the WAL.
@@ -467,7 +562,7 @@ func (s *Store) BackupShard(id uint64, since time.Time, w io.Writer) error {
 		return fmt.Errorf("shard %d doesn't exist on this server", id)
 	}
 
-	path, err := relativePath(s.path, shard.path)
+	path, err := relativePath(s.shardRoot(shard), shard.path)
 	if err != nil {
 		return err
 	}
@@ -475,13 +570,255 @@ func (s *Store) BackupShard(id uint64, since time.Time, w io.Writer) error {
 	return shard.engine.Backup(w, path, since)
 }
 
+// ShardDataFiles returns the names and sizes of the data files of a shard.
+func (s *Store) ShardDataFiles(id uint64) ([]DataFile, error) {
+	shard := s.Shard(id)
+	if shard == nil {
+		return nil, fmt.Errorf("shard %d doesn't exist on this server", id)
+	}
+	return shard.engine.DataFiles()
+}
+
+// BackupShardFiles will have the engine of the shard write the named data
+// files to the writer.
+func (s *Store) BackupShardFiles(id uint64, names []string, w io.Writer) error {
+	shard := s.Shard(id)
+	if shard == nil {
+		return fmt.Errorf("shard %d doesn't exist on this server", id)
+	}
+
+	path, err := relativePath(s.shardRoot(shard), shard.path)
+	if err != nil {
+		return err
+	}
+
+	return shard.engine.BackupFiles(w, path, names)
+}
+
+// RestoreShard adds the data files of a tar archive, as written by
+// BackupShard, to an existing shard.
+func (s *Store) RestoreShard(id uint64, r io.Reader) error {
+	shard := s.Shard(id)
+	if shard == nil {
+		return fmt.Errorf("shard %d doesn't exist on this server", id)
+	}
+
+	path, err := relativePath(s.shardRoot(shard), shard.path)
+	if err != nil {
+		return err
+	}
+
+	return shard.Restore(r, path)
+}
+
 // ShardRelativePath will return the relative path to the shard. i.e. <database>/<retention>/<id>
 func (s *Store) ShardRelativePath(id uint64) (string, error) {
 	shard := s.Shard(id)
 	if shard == nil {
 		return "", fmt.Errorf("shard %d doesn't exist on this server", id)
 	}
-	return relativePath(s.path, shard.path)
+	return relativePath(s.shardRoot(shard), shard.path)
+}
+
+// shardRoot returns the data directory a shard is stored in.
+func (s *Store) shardRoot(sh *Shard) string {
+	if s.shardTier(sh) == ColdTier {
+		return s.EngineOptions.Config.ColdDir
+	}
+	return s.path
+}
+
+// shardTier returns the storage tier of a shard.
+func (s *Store) shardTier(sh *Shard) string {
+	dir := s.EngineOptions.Config.ColdDir
+	if dir == "" {
+		return HotTier
+	}
+	if rel, err := relativePath(dir, sh.path); err == nil && !strings.HasPrefix(rel, "..") {
+		return ColdTier
+	}
+	return HotTier
+}
+
+// ShardTier returns the storage tier of a shard, or blank if the shard is
+// not stored on this server.
+func (s *Store) ShardTier(id uint64) string {
+	sh := s.Shard(id)
+	if sh == nil {
+		return ""
+	}
+	return s.shardTier(sh)
+}
+
+// ShardCompaction describes the data files of a shard before and after an
+// on-demand compaction.
+type ShardCompaction struct {
+	FilesBefore int
+	SizeBefore  int64
+	FilesAfter  int
+	SizeAfter   int64
+	Duration    time.Duration
+}
+
+// CompactShard compacts a shard immediately. Its files are compacted as
+// planned for shards that are cold for writes or, if full is set, the cache
+// is written out and all files are compacted into as few as possible.
+func (s *Store) CompactShard(id uint64, full bool) (ShardCompaction, error) {
+	var c ShardCompaction
+
+	sh := s.Shard(id)
+	if sh == nil {
+		return c, ErrShardNotFound
+	}
+
+	files, err := s.ShardDataFiles(id)
+	if err != nil {
+		return c, err
+	}
+	c.FilesBefore, c.SizeBefore = len(files), dataFilesSize(files)
+
+	start := time.Now()
+	if full {
+		err = sh.CompactFull()
+	} else {
+		err = sh.CompactPlanned()
+	}
+	if err != nil {
+		return c, err
+	}
+	c.Duration = time.Since(start)
+
+	if files, err = s.ShardDataFiles(id); err != nil {
+		return c, err
+	}
+	c.FilesAfter, c.SizeAfter = len(files), dataFilesSize(files)
+	return c, nil
+}
+
+// dataFilesSize returns the total size of files.
+func dataFilesSize(files []DataFile) int64 {
+	var n int64
+	for _, f := range files {
+		n += f.Size
+	}
+	return n
+}
+
+// shardMove tracks a shard being moved to the cold tier.
+type shardMove struct {
+	closed bool          // set while the shard is closed for the move
+	done   chan struct{} // closed once the move finishes
+}
+
+// MoveShardToCold fully compacts a shard and moves its data files to the
+// cold data directory. The shard is then reopened from its new location.
+// The shard's WAL stays in the WAL directory.
+//
+// The store lock is only held to register the move and to swap in the moved
+// shard. Writes to the shard wait, or are retried, while it is closed for the
+// move.
+func (s *Store) MoveShardToCold(id uint64) error {
+	coldDir := s.EngineOptions.Config.ColdDir
+	if coldDir == "" {
+		return ErrColdDirNotSet
+	}
+
+	s.mu.Lock()
+	sh := s.shards[id]
+	if sh == nil {
+		s.mu.Unlock()
+		return ErrShardNotFound
+	} else if s.moving[id] != nil || s.shardTier(sh) == ColdTier {
+		s.mu.Unlock()
+		return nil
+	}
+	m := &shardMove{done: make(chan struct{})}
+	s.moving[id] = m
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.moving, id)
+		s.mu.Unlock()
+		close(m.done)
+	}()
+
+	if err := sh.CompactFull(); err != nil && err != ErrCompactionNotSupported {
+		return err
+	}
+
+	dst := filepath.Join(coldDir, sh.database, sh.retentionPolicy, strconv.FormatUint(id, 10))
+	tmp := dst + ".tmp"
+	if err := os.RemoveAll(tmp); err != nil {
+		return err
+	}
+
+	// Copy the files while the shard is still serving. Anything that changes
+	// in the meantime is copied again once the shard is closed.
+	if err := syncDir(sh.path, tmp); err != nil {
+		return err
+	}
+
+	// Stop new writes to the shard. Writes in progress fail once the shard is
+	// closed and are retried by WriteToShard after the move.
+	s.mu.Lock()
+	if s.shards[id] != sh {
+		s.mu.Unlock()
+		os.RemoveAll(tmp)
+		return ErrShardNotFound
+	}
+	m.closed = true
+	s.mu.Unlock()
+
+	if err := sh.Close(); err != nil {
+		return err
+	}
+
+	moved := NewShard(id, sh.index, dst, sh.walPath, s.EngineOptions)
+	err := func() error {
+		if err := syncDir(sh.path, tmp); err != nil {
+			return err
+		} else if err := os.Rename(tmp, dst); err != nil {
+			return err
+		}
+		return moved.Open()
+	}()
+	if err != nil {
+		// Fall back to the hot copy.
+		os.RemoveAll(tmp)
+		os.RemoveAll(dst)
+		if err := sh.Open(); err != nil {
+			s.Logger.Printf("failed to reopen shard %d: %s", id, err)
+		}
+		moved = sh
+	}
+
+	s.mu.Lock()
+	closed := s.shards == nil
+	deleted := !closed && s.shards[id] != sh
+	if !closed && !deleted {
+		s.shards[id] = moved
+	}
+	s.mu.Unlock()
+
+	if closed {
+		// The store closed during the move. Keep whichever copy was opened.
+		moved.Close()
+		if err == nil {
+			os.RemoveAll(sh.path)
+		}
+		return ErrStoreClosed
+	} else if deleted {
+		// The shard was deleted during the move so remove what was reopened.
+		moved.Close()
+		os.RemoveAll(moved.path)
+		return ErrShardNotFound
+	} else if err != nil {
+		return err
+	}
+
+	s.Logger.Printf("moved shard %d to %s", id, dst)
+	return os.RemoveAll(sh.path)
 }
 
 // DeleteSeries loops through the local shards and deletes the series data and metadata for the passed in series keys
@@ -504,13 +841,29 @@ func (s *Store) DeleteSeries(database string, sources []influxql.Source, conditi
 		return nil
 	}
 
-	measurements, err := measurementsFromSourcesOrDB(db, sources...)
+	idxs := s.seriesIndexes(database)
+	measurements, err := measurementsFromSourcesOrDB(db, idxs, sources...)
 	if err != nil {
 		return err
 	}
 
 	var seriesKeys []string
 	for _, m := range measurements {
+		// Series in persistent series indexes are only matched on tags.
+		for _, idx := range idxs {
+			for _, name := range influxql.ExprNames(condition) {
+				if m.HasField(name) {
+					return errors.New("DROP SERIES doesn't support fields in WHERE clause")
+				}
+			}
+
+			keys, err := idx.MeasurementSeriesKeysByExpr(m.Name, condition)
+			if err != nil {
+				return err
+			}
+			seriesKeys = append(seriesKeys, keys...)
+		}
+
 		var ids SeriesIDs
 		var filters FilterExprs
 		if condition != nil {
@@ -586,20 +939,48 @@ func (s *Store) IteratorCreators() influxql.IteratorCreators {
 // WriteToShard writes a list of points to a shard identified by its ID.
 func (s *Store) WriteToShard(shardID uint64, points []models.Point) error {
 	s.mu.RLock()
-	defer s.mu.RUnlock()
 
 	select {
 	case <-s.closing:
+		s.mu.RUnlock()
 		return ErrStoreClosed
 	default:
 	}
 
 	sh, ok := s.shards[shardID]
 	if !ok {
+		s.mu.RUnlock()
 		return ErrShardNotFound
 	}
 
-	return sh.WritePoints(points)
+	// Wait for a shard being moved to the cold tier to be reopened.
+	if m := s.moving[shardID]; m != nil && m.closed {
+		s.mu.RUnlock()
+		<-m.done
+		return s.WriteToShard(shardID, points)
+	}
+	s.mu.RUnlock()
+
+	// The write may block while the cache is full so it is done without the
+	// store lock. If the shard is closed meanwhile by a move, retry the write
+	// once the shard has been reopened.
+	err := sh.WritePoints(points)
+	if err != ErrEngineClosed {
+		return err
+	}
+
+	s.mu.RLock()
+	m := s.moving[shardID]
+	replaced := s.shards[shardID] != sh
+	s.mu.RUnlock()
+
+	if m != nil {
+		<-m.done
+		return s.WriteToShard(shardID, points)
+	} else if replaced {
+		return s.WriteToShard(shardID, points)
+	}
+	return err
 }
 
 func (s *Store) ExecuteShowFieldKeysStatement(stmt *influxql.ShowFieldKeysStatement, database string) (models.Rows, error) {
@@ -618,7 +999,7 @@ func (s *Store) ExecuteShowFieldKeysStatement(stmt *influxql.ShowFieldKeysStatem
 		return nil, err
 	}
 
-	measurements, err := measurementsFromSourcesOrDB(db, sources...)
+	measurements, err := measurementsFromSourcesOrDB(db, s.seriesIndexes(database), sources...)
 	if err != nil {
 		return nil, err
 	}
@@ -702,7 +1083,8 @@ func (s *Store) ExecuteShowTagValuesStatement(stmt *influxql.ShowTagValuesStatem
 	}
 
 	// Get the list of measurements we're interested in.
-	measurements, err := measurementsFromSourcesOrDB(db, sources...)
+	idxs := s.seriesIndexes(database)
+	measurements, err := measurementsFromSourcesOrDB(db, idxs, sources...)
 	if err != nil {
 		return nil, err
 	}
@@ -711,6 +1093,26 @@ func (s *Store) ExecuteShowTagValuesStatement(stmt *influxql.ShowTagValuesStatem
 	var rows models.Rows
 	tagValues := make(map[string]stringSet)
 	for _, m := range measurements {
+		// Add tag values from series in persistent series indexes.
+		for _, idx := range idxs {
+			keys, err := idx.MeasurementSeriesKeysByExpr(m.Name, stmt.Condition)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, key := range keys {
+				_, tags, _ := models.ParseKey(key)
+				for _, k := range stmt.TagKeys {
+					if v, ok := tags[k]; ok {
+						if tagValues[k] == nil {
+							tagValues[k] = newStringSet()
+						}
+						tagValues[k].add(v)
+					}
+				}
+			}
+		}
+
 		var ids SeriesIDs
 
 		if stmt.Condition != nil {
@@ -770,6 +1172,9 @@ func IsRetryable(err error) bool {
 	if strings.Contains(err.Error(), "field type conflict") {
 		return false
 	}
+	if _, ok := err.(PartialWriteError); ok {
+		return false
+	}
 	return true
 }
 
@@ -808,10 +1213,28 @@ func relativePath(storePath, shardPath string) (string, error) {
 	return name, nil
 }
 
+// seriesIndexes returns the persistent series indexes of a database's shards.
+func (s *Store) seriesIndexes(database string) []SeriesIndex {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var a []SeriesIndex
+	for _, sh := range s.shards {
+		if sh.database != database {
+			continue
+		}
+		if idx := sh.SeriesIndex(); idx != nil {
+			a = append(a, idx)
+		}
+	}
+	return a
+}
+
 // measurementsFromSourcesOrDB returns a list of measurements from the
 // sources passed in or, if sources is empty, a list of all
-// measurement names from the database passed in.
-func measurementsFromSourcesOrDB(db *DatabaseIndex, sources ...influxql.Source) (Measurements, error) {
+// measurement names from the database passed in. Measurements with series
+// in any of the persistent series indexes are included.
+func measurementsFromSourcesOrDB(db *DatabaseIndex, idxs []SeriesIndex, sources ...influxql.Source) (Measurements, error) {
 	var measurements Measurements
 	if len(sources) > 0 {
 		for _, source := range sources {
@@ -829,7 +1252,7 @@ func measurementsFromSourcesOrDB(db *DatabaseIndex, sources ...influxql.Source)
 	} else {
 		// No measurements specified in FROM clause so get all measurements that have series.
 		for _, m := range db.Measurements() {
-			if m.HasSeries() {
+			if m.HasSeries() || hasMeasurement(idxs, m.Name) {
 				measurements = append(measurements, m)
 			}
 		}
@@ -838,3 +1261,93 @@ func measurementsFromSourcesOrDB(db *DatabaseIndex, sources ...influxql.Source)
 
 	return measurements, nil
 }
+
+// hasMeasurement returns true if any of the series indexes contain series for
+// the measurement.
+func hasMeasurement(idxs []SeriesIndex, name string) bool {
+	for _, idx := range idxs {
+		if idx.HasMeasurement(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// syncDir makes dst a copy of src. Files whose size and modification time
+// already match are not copied again and files missing from src are removed.
+func syncDir(src, dst string) error {
+	seen := make(map[string]struct{})
+	if err := filepath.Walk(src, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		seen[rel] = struct{}{}
+		target := filepath.Join(dst, rel)
+
+		if fi.IsDir() {
+			return os.MkdirAll(target, 0700)
+		}
+		if t, err := os.Stat(target); err == nil && t.Size() == fi.Size() && t.ModTime().Equal(fi.ModTime()) {
+			return nil
+		}
+		return copyFile(path, target, fi)
+	}); err != nil {
+		return err
+	}
+
+	// Remove files that no longer exist in src, such as compacted TSM files.
+	var stale []string
+	if err := filepath.Walk(dst, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dst, path)
+		if err != nil {
+			return err
+		}
+		if _, ok := seen[rel]; !ok {
+			stale = append(stale, path)
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	for _, path := range stale {
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyFile copies the contents and modification time of a file and syncs it to disk.
+func copyFile(src, dst string, fi os.FileInfo) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, fi.Mode())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	} else if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	} else if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(dst, fi.ModTime(), fi.ModTime())
+}
@@ -1,11 +1,14 @@
 package tsdb_test
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -136,6 +139,337 @@ func TestStore_DeleteShard(t *testing.T) {
 	}
 }
 
+// Ensure the store can move a shard to cold storage and reopen it from there.
+func TestStore_MoveShardToCold(t *testing.T) {
+	s := NewStore()
+	defer s.Close()
+
+	coldDir, err := ioutil.TempDir("", "influxdb-tsdb-cold-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(coldDir)
+	s.EngineOptions.Config.ColdDir = coldDir
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	s.MustCreateShardWithData("db0", "rp0", 1,
+		`cpu,host=serverA value=1  0`,
+		`cpu,host=serverA value=2 10`,
+	)
+	if tier := s.ShardTier(1); tier != tsdb.HotTier {
+		t.Fatalf("unexpected tier: %s", tier)
+	}
+
+	// Ensure both points can be read back from the shard.
+	readPoints := func() {
+		itr, err := s.Shard(1).CreateIterator(influxql.IteratorOptions{
+			Expr:      influxql.MustParseExpr(`value`),
+			Sources:   []influxql.Source{&influxql.Measurement{Name: "cpu"}},
+			Ascending: true,
+			StartTime: influxql.MinTime,
+			EndTime:   influxql.MaxTime,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer itr.Close()
+		fitr := itr.(influxql.FloatIterator)
+
+		if p := fitr.Next(); p == nil || p.Value != 1 {
+			t.Fatalf("unexpected point(0): %s", spew.Sdump(p))
+		} else if p = fitr.Next(); p == nil || p.Value != 2 {
+			t.Fatalf("unexpected point(1): %s", spew.Sdump(p))
+		} else if p = fitr.Next(); p != nil {
+			t.Fatalf("expected eof, got: %s", spew.Sdump(p))
+		}
+	}
+
+	if err := s.MoveShardToCold(1); err != nil {
+		t.Fatal(err)
+	} else if tier := s.ShardTier(1); tier != tsdb.ColdTier {
+		t.Fatalf("unexpected tier: %s", tier)
+	} else if !dirExists(filepath.Join(coldDir, "db0", "rp0", "1")) {
+		t.Fatal("shard not moved to cold directory")
+	} else if dirExists(filepath.Join(s.Path(), "db0", "rp0", "1")) {
+		t.Fatal("shard not removed from hot directory")
+	}
+	readPoints()
+
+	// Reopen the store and ensure the shard is still loaded from cold storage.
+	if err := s.Reopen(); err != nil {
+		t.Fatal(err)
+	} else if tier := s.ShardTier(1); tier != tsdb.ColdTier {
+		t.Fatalf("unexpected tier after reopen: %s", tier)
+	}
+	readPoints()
+}
+
+// Ensure writes to a shard and to other shards succeed while it is moved to cold storage.
+func TestStore_MoveShardToCold_ConcurrentWrites(t *testing.T) {
+	s := NewStore()
+	defer s.Close()
+
+	coldDir, err := ioutil.TempDir("", "influxdb-tsdb-cold-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(coldDir)
+	s.EngineOptions.Config.ColdDir = coldDir
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	s.MustCreateShardWithData("db0", "rp0", 1, `cpu,host=serverA value=1 0`)
+	s.MustCreateShardWithData("db0", "rp0", 2, `cpu,host=serverA value=1 0`)
+
+	done := make(chan struct{})
+	errs := make(chan error, 2)
+	var wg sync.WaitGroup
+	for _, id := range []uint64{1, 2} {
+		wg.Add(1)
+		go func(id uint64) {
+			defer wg.Done()
+			for i := 1; ; i++ {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				pt := models.MustNewPoint("cpu", map[string]string{"host": "serverA"}, map[string]interface{}{"value": float64(i)}, time.Unix(int64(i), 0))
+				if err := s.WriteToShard(id, []models.Point{pt}); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(id)
+	}
+
+	err = s.MoveShardToCold(1)
+	close(done)
+	wg.Wait()
+	close(errs)
+
+	if err != nil {
+		t.Fatal(err)
+	} else if tier := s.ShardTier(1); tier != tsdb.ColdTier {
+		t.Fatalf("unexpected tier: %s", tier)
+	}
+	for err := range errs {
+		t.Fatalf("unexpected write error: %s", err)
+	}
+}
+
+// Ensure writes to a shard deleted while they are in progress fail without
+// holding up the delete.
+func TestStore_WriteToShard_ConcurrentDelete(t *testing.T) {
+	s := MustOpenStore()
+	defer s.Close()
+
+	s.MustCreateShardWithData("db0", "rp0", 1, `cpu,host=serverA value=1 0`)
+
+	errs := make(chan error, 1)
+	go func() {
+		for i := 1; ; i++ {
+			pt := models.MustNewPoint("cpu", map[string]string{"host": "serverA"}, map[string]interface{}{"value": float64(i)}, time.Unix(int64(i), 0))
+			if err := s.WriteToShard(1, []models.Point{pt}); err != nil {
+				errs <- err
+				return
+			}
+		}
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	if err := s.DeleteShard(1); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-errs:
+		if err != tsdb.ErrShardNotFound {
+			t.Fatalf("unexpected write error: %s", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("write not stopped by the delete")
+	}
+}
+
+// Ensure a shard can be restored from a backup while it is being written to.
+func TestStore_RestoreShard(t *testing.T) {
+	s := MustOpenStore()
+	defer s.Close()
+
+	s.MustCreateShardWithData("db0", "rp0", 1, `cpu,host=serverA value=1 0`)
+	s.MustCreateShardWithData("db0", "rp0", 2, `mem,host=serverA value=1 0`)
+
+	var buf bytes.Buffer
+	if err := s.BackupShard(1, time.Time{}, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	errs := make(chan error, 1)
+	go func() {
+		defer close(errs)
+		for i := 1; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+
+			pt := models.MustNewPoint("mem", map[string]string{"host": "serverA"}, map[string]interface{}{"value": float64(i)}, time.Unix(int64(i), 0))
+			if err := s.WriteToShard(2, []models.Point{pt}); err != nil {
+				errs <- err
+				return
+			}
+		}
+	}()
+
+	err := s.RestoreShard(2, &buf)
+	close(done)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for err := range errs {
+		t.Fatalf("unexpected write error: %s", err)
+	}
+
+	// The restored series is readable from the shard.
+	itr, err := s.Shard(2).CreateIterator(influxql.IteratorOptions{
+		Expr:      influxql.MustParseExpr(`value`),
+		Sources:   []influxql.Source{&influxql.Measurement{Name: "cpu"}},
+		Ascending: true,
+		StartTime: influxql.MinTime,
+		EndTime:   influxql.MaxTime,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer itr.Close()
+
+	if p := itr.(influxql.FloatIterator).Next(); p == nil || p.Value != 1 {
+		t.Fatalf("unexpected point: %s", spew.Sdump(p))
+	}
+}
+
+// Ensure a shard can be compacted on demand.
+func TestStore_CompactShard(t *testing.T) {
+	s := MustOpenStore()
+	defer s.Close()
+
+	// Write two generations of TSM files.
+	s.MustCreateShardWithData("db0", "rp0", 1, `cpu,host=serverA value=1 0`)
+	if _, err := s.ShardDataFiles(1); err != nil {
+		t.Fatal(err)
+	}
+	s.MustWriteToShardString(1, `cpu,host=serverB value=2 10`)
+
+	c, err := s.CompactShard(1, false)
+	if err != nil {
+		t.Fatal(err)
+	} else if c.FilesBefore != 2 || c.FilesAfter != 1 {
+		t.Fatalf("unexpected file counts: %+v", c)
+	} else if c.SizeBefore == 0 || c.SizeAfter == 0 {
+		t.Fatalf("unexpected file sizes: %+v", c)
+	}
+
+	if _, err := s.CompactShard(2, true); err != tsdb.ErrShardNotFound {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure compacting a shard on demand waits for the scheduler to allow a full compaction.
+func TestStore_CompactShard_Scheduled(t *testing.T) {
+	s := NewStore()
+	defer s.Close()
+
+	scheduler := tsdb.NewCompactionScheduler(1, 0)
+	s.EngineOptions.CompactionScheduler = scheduler
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	s.MustCreateShardWithData("db0", "rp0", 1, `cpu,host=serverA value=1 0`)
+	if _, err := s.ShardDataFiles(1); err != nil {
+		t.Fatal(err)
+	}
+	s.MustWriteToShardString(1, `cpu,host=serverB value=2 10`)
+
+	// Hold the only full compaction slot.
+	release, ok := scheduler.Acquire(tsdb.CompactionLevelFull, 0, nil)
+	if !ok {
+		t.Fatal("unable to acquire compaction")
+	}
+
+	for _, full := range []bool{false, true} {
+		done := make(chan error, 1)
+		go func() {
+			_, err := s.CompactShard(1, full)
+			done <- err
+		}()
+
+		select {
+		case err := <-done:
+			t.Fatalf("compaction ran without a slot: %v", err)
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		release()
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+
+		release, _ = scheduler.Acquire(tsdb.CompactionLevelFull, 0, nil)
+		s.MustWriteToShardString(1, `cpu,host=serverC value=3 20`)
+		if _, err := s.ShardDataFiles(1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	release()
+}
+
+// Ensure a series index created for a shard which already has data is
+// populated from the shard's TSM files, and is not repopulated once it exists.
+func TestStore_Open_SeriesIndexCreated(t *testing.T) {
+	s := MustOpenStore()
+	defer s.Close()
+
+	s.MustCreateShardWithData("db0", "rp0", 1, `
+cpu,host=serverA value=100 0
+cpu,host=serverB value=50 10
+mem,host=serverA value=1 0
+`)
+
+	// Move the points from the WAL into a TSM file.
+	if _, err := s.ShardDataFiles(1); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, created := range []bool{true, false} {
+		if err := s.Store.Close(); err != nil {
+			t.Fatal(err)
+		}
+		s.Store = tsdb.NewStore(s.Path())
+		s.EngineOptions.Config.WALDir = filepath.Join(s.Path(), "wal")
+		s.EngineOptions.Config.IndexVersion = "tsi1"
+		if err := s.Open(); err != nil {
+			t.Fatal(err)
+		}
+
+		sh := s.Shard(1)
+		if sh.SeriesIndexCreated() != created {
+			t.Fatalf("unexpected series index created: %v", sh.SeriesIndexCreated())
+		} else if n := sh.SeriesIndex().SeriesN(); n != 3 {
+			t.Fatalf("unexpected series count: %d", n)
+		} else if keys := sh.SeriesIndex().TagKeys("cpu"); !reflect.DeepEqual(keys, []string{"host"}) {
+			t.Fatalf("unexpected tag keys: %v", keys)
+		}
+	}
+}
+
 // Ensure the store reports an error when it can't open a database directory.
 func TestStore_Open_InvalidDatabaseFile(t *testing.T) {
 	s := NewStore()
@@ -343,8 +677,10 @@ func (s *Store) Reopen() error {
 	if err := s.Store.Close(); err != nil {
 		return err
 	}
+	coldDir := s.EngineOptions.Config.ColdDir
 	s.Store = tsdb.NewStore(s.Path())
 	s.EngineOptions.Config.WALDir = filepath.Join(s.Path(), "wal")
+	s.EngineOptions.Config.ColdDir = coldDir
 	return s.Open()
 }
 